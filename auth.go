@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+)
+
+type (
+	// Principal is the authenticated caller of a request.
+	Principal struct {
+		Subject string   // identifier of the caller
+		Roles   []string // roles or scopes granted to the caller
+	}
+	// Authorizer decides whether the principal in ctx may call the method.
+	// A non-nil error rejects the call with a permission denied error.
+	Authorizer interface {
+		Authorize(ctx context.Context, m Method) error
+	}
+	// AuthorizerFunc adapts a function to the Authorizer interface.
+	AuthorizerFunc func(ctx context.Context, m Method) error
+	// RoleAuthorizer allows a call if the principal holds every role
+	// required by the method. Methods with no required roles are allowed.
+	RoleAuthorizer struct{}
+)
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the given principal.
+// Authentication middleware should use it to attach the caller to the
+// request context before it reaches Serve.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal attached to ctx, if any.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// requirePrincipal fails calls without an authenticated caller with
+// CodeUnauthenticated, for methods managing the service itself.
+func requirePrincipal(ctx context.Context, what string) error {
+	if _, ok := PrincipalFromContext(ctx); !ok {
+		return &Error{
+			Code:    CodeUnauthenticated,
+			Message: what + " requires an authenticated caller",
+		}
+	}
+	return nil
+}
+
+// requireAdminRoles returns an error unless opts require callers to hold
+// roles, see WithRoles, and s enforces them with an Authorizer, for
+// methods managing the service itself, which are denied by default.
+func requireAdminRoles(s *Service, what string, opts []MethodOption) error {
+	m := Method{}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	if len(m.Roles) == 0 || s.Authorizer == nil {
+		return fmt.Errorf("rpc: %s requires roles, see WithRoles, and an authorizer, see WithAuthorizer", what)
+	}
+	return nil
+}
+
+// HasRole returns whether the principal has been granted the given role.
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, m Method) error {
+	return f(ctx, m)
+}
+
+func (RoleAuthorizer) Authorize(ctx context.Context, m Method) error {
+	if len(m.Roles) == 0 {
+		return nil
+	}
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("unauthenticated")
+	}
+	for _, role := range m.Roles {
+		if !p.HasRole(role) {
+			return fmt.Errorf("missing role %q", role)
+		}
+	}
+	return nil
+}
+
+// WithRoles requires the caller to be granted the given roles.
+// The roles are enforced by the service's Authorizer.
+func WithRoles(roles ...string) MethodOption {
+	return func(m *Method) {
+		m.Roles = append(m.Roles, roles...)
+	}
+}
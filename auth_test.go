@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Authorizer(t *testing.T) {
+	s := New()
+	s.Authorizer = RoleAuthorizer{}
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Configure("Math.Add", WithRoles("math")))
+
+	roles := []string{}
+	authn := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithPrincipal(r.Context(), Principal{Subject: "test", Roles: roles})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+	srv := httptest.NewServer(authn(s.Serve()))
+	defer srv.Close()
+
+	// Missing role.
+	res := &AddResponse{}
+	err := s.Call(http.DefaultClient, srv.URL, "Math.Add", &AddRequest{A: 1, B: 2}, res)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodePermissionDenied, rerr.Code)
+
+	// Granted role.
+	roles = []string{"math"}
+	err = s.Call(http.DefaultClient, srv.URL, "Math.Add", &AddRequest{A: 1, B: 2}, res)
+	require.NoError(t, err)
+	require.Equal(t, 3, res.X)
+}
+
+func TestService_Configure_NotFound(t *testing.T) {
+	s := New()
+	require.Error(t, s.Configure("Math.Add", WithRoles("math")))
+}
@@ -0,0 +1,830 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AvroCodec encodes messages in the Avro binary encoding, framed like
+// Confluent's serializers do: a zero byte, the big-endian 4 byte ID of the
+// schema the message was written with in Registry, and the message, so
+// payloads can be fed as is to Kafka pipelines mandating Avro.
+//
+// Schemas are derived from the Go types of messages, following
+// encoding/json's rules for field names, and registered under their full
+// names. Messages are decoded with the schema they were written with,
+// resolved from Registry, so records of other versions of a schema decode
+// field by field, by name. Types holding interfaces can't be encoded.
+type AvroCodec struct {
+	Registry SchemaRegistry
+
+	mu      sync.Mutex
+	writers map[reflect.Type]avroWriter
+	readers map[uint32]*avroSchema
+}
+
+type (
+	// avroSchema is a parsed or derived Avro schema.
+	avroSchema struct {
+		Type     string        // primitive type, or "record", "enum", "array", "map", "fixed" or "union"
+		Name     string        // full name, of named types
+		Logical  string        // logical type, if any
+		Fields   []avroField   // of records
+		Symbols  []string      // of enums
+		Items    *avroSchema   // of arrays
+		Values   *avroSchema   // of maps
+		Size     int           // of fixed
+		Branches []*avroSchema // of unions
+	}
+	avroField struct {
+		Name   string
+		Schema *avroSchema
+		Index  []int // of the struct field, of derived schemas
+	}
+	// avroWriter is the schema messages of a type are written with.
+	avroWriter struct {
+		schema *avroSchema
+		id     uint32
+	}
+)
+
+const avroMagic = 0
+
+func (c *AvroCodec) ContentType() string {
+	return "avro/binary"
+}
+
+func (c *AvroCodec) Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || rv.Kind() == reflect.Ptr {
+		return nil, errors.New("rpc: can't encode nil as avro")
+	}
+	w, err := c.writer(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer([]byte{avroMagic, 0, 0, 0, 0})
+	binary.BigEndian.PutUint32(buf.Bytes()[1:], w.id)
+	if err := avroEncode(buf, w.schema, rv); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *AvroCodec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("rpc: can't decode avro into %T", v)
+	}
+	if len(data) < 5 || data[0] != avroMagic {
+		return errors.New("rpc: not an avro message")
+	}
+	schema, err := c.reader(binary.BigEndian.Uint32(data[1:5]))
+	if err != nil {
+		return err
+	}
+	r := &avroReader{data: data[5:]}
+	return r.decode(schema, rv.Elem())
+}
+
+// writer returns the schema values of type t are written with, deriving
+// and registering it if needed.
+func (c *AvroCodec) writer(t reflect.Type) (avroWriter, error) {
+	c.mu.Lock()
+	w, ok := c.writers[t]
+	c.mu.Unlock()
+	if ok {
+		return w, nil
+	}
+
+	schema, err := deriveAvroSchema(t, map[reflect.Type]*avroSchema{})
+	if err != nil {
+		return avroWriter{}, err
+	}
+	schemaBytes, err := json.Marshal(schema.json(map[string]bool{}))
+	if err != nil {
+		return avroWriter{}, err
+	}
+	subject := schema.Name
+	if subject == "" {
+		subject = schema.Type
+	}
+	id, err := c.Registry.Register(context.Background(), subject, string(schemaBytes))
+	if err != nil {
+		return avroWriter{}, err
+	}
+	w = avroWriter{schema: schema, id: uint32(id)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writers == nil {
+		c.writers = map[reflect.Type]avroWriter{}
+	}
+	c.writers[t] = w
+	return w, nil
+}
+
+// reader returns the schema with the given ID, resolving it from the
+// registry if needed.
+func (c *AvroCodec) reader(id uint32) (*avroSchema, error) {
+	c.mu.Lock()
+	schema, ok := c.readers[id]
+	c.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	s, err := c.Registry.Schema(context.Background(), int(id))
+	if err != nil {
+		return nil, err
+	}
+	schema, err = parseAvroSchema(s)
+	if err != nil {
+		return nil, fmt.Errorf("rpc: schema %d: %v", id, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readers == nil {
+		c.readers = map[uint32]*avroSchema{}
+	}
+	c.readers[id] = schema
+	return schema, nil
+}
+
+// deriveAvroSchema returns the schema of values of type t. Struct types
+// already derived are reused, so recursive types refer to themselves.
+func deriveAvroSchema(t reflect.Type, named map[reflect.Type]*avroSchema) (*avroSchema, error) {
+	switch {
+	case t == typeOfTime:
+		return &avroSchema{Type: "long", Logical: "timestamp-micros"}, nil
+	case t.Kind() == reflect.Ptr:
+		elem, err := deriveAvroSchema(t.Elem(), named)
+		if err != nil {
+			return nil, err
+		}
+		return &avroSchema{Type: "union", Branches: []*avroSchema{{Type: "null"}, elem}}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &avroSchema{Type: "boolean"}, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &avroSchema{Type: "int"}, nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &avroSchema{Type: "long"}, nil
+	case reflect.Float32:
+		return &avroSchema{Type: "float"}, nil
+	case reflect.Float64:
+		return &avroSchema{Type: "double"}, nil
+	case reflect.String:
+		return &avroSchema{Type: "string"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &avroSchema{Type: "bytes"}, nil
+		}
+		items, err := deriveAvroSchema(t.Elem(), named)
+		if err != nil {
+			return nil, err
+		}
+		return &avroSchema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("rpc: can't encode %s as avro, map keys must be strings", t)
+		}
+		values, err := deriveAvroSchema(t.Elem(), named)
+		if err != nil {
+			return nil, err
+		}
+		return &avroSchema{Type: "map", Values: values}, nil
+	case reflect.Struct:
+		if schema, ok := named[t]; ok {
+			return schema, nil
+		}
+		schema := &avroSchema{Type: "record", Name: avroName(t)}
+		named[t] = schema
+		for _, f := range jsonFields(t) {
+			fs, err := deriveAvroSchema(f.Type, named)
+			if err != nil {
+				return nil, err
+			}
+			schema.Fields = append(schema.Fields, avroField{Name: f.Name, Schema: fs, Index: f.Index})
+		}
+		return schema, nil
+	default:
+		return nil, fmt.Errorf("rpc: can't encode %s as avro", t)
+	}
+}
+
+// avroName returns the full name of the record of struct type t,
+// namespaced by its package. Anonymous structs are named after a hash of
+// their definition.
+func avroName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" {
+		h := fnv.New32a()
+		h.Write([]byte(t.String())) // nolint: errcheck
+		name = fmt.Sprintf("Anonymous%08x", h.Sum32())
+	}
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		// Instances of generic types.
+		name = name[:i]
+	}
+	ns := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, path.Base(t.PkgPath()))
+	if ns == "" || ns == "_" {
+		return name
+	}
+	return ns + "." + name
+}
+
+// json returns the schema as encoded in JSON, defining named types the
+// first time they appear.
+func (s *avroSchema) json(defined map[string]bool) interface{} {
+	switch s.Type {
+	case "union":
+		branches := []interface{}{}
+		for _, b := range s.Branches {
+			branches = append(branches, b.json(defined))
+		}
+		return branches
+	case "array":
+		return map[string]interface{}{"type": "array", "items": s.Items.json(defined)}
+	case "map":
+		return map[string]interface{}{"type": "map", "values": s.Values.json(defined)}
+	case "record":
+		if defined[s.Name] {
+			return s.Name
+		}
+		defined[s.Name] = true
+		fields := []interface{}{}
+		for _, f := range s.Fields {
+			fields = append(fields, map[string]interface{}{"name": f.Name, "type": f.Schema.json(defined)})
+		}
+		return map[string]interface{}{"type": "record", "name": s.Name, "fields": fields}
+	}
+	if s.Logical != "" {
+		return map[string]interface{}{"type": s.Type, "logicalType": s.Logical}
+	}
+	return s.Type
+}
+
+// parseAvroSchema parses a schema in its JSON form.
+func parseAvroSchema(s string) (*avroSchema, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return parseAvroType(v, "", map[string]*avroSchema{})
+}
+
+func parseAvroType(v interface{}, namespace string, named map[string]*avroSchema) (*avroSchema, error) {
+	switch v := v.(type) {
+	case string:
+		switch v {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &avroSchema{Type: v}, nil
+		}
+		if schema, ok := named[v]; ok {
+			return schema, nil
+		}
+		if schema, ok := named[namespace+"."+v]; ok {
+			return schema, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", v)
+	case []interface{}:
+		schema := &avroSchema{Type: "union"}
+		for _, b := range v {
+			branch, err := parseAvroType(b, namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			schema.Branches = append(schema.Branches, branch)
+		}
+		return schema, nil
+	case map[string]interface{}:
+		return parseAvroObject(v, namespace, named)
+	default:
+		return nil, fmt.Errorf("invalid schema %v", v)
+	}
+}
+
+func parseAvroObject(v map[string]interface{}, namespace string, named map[string]*avroSchema) (*avroSchema, error) {
+	typ, _ := v["type"].(string)
+	schema := &avroSchema{Type: typ}
+	switch typ {
+	case "record", "error", "enum", "fixed":
+		name, _ := v["name"].(string)
+		if ns, ok := v["namespace"].(string); ok && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		if !strings.Contains(name, ".") && namespace != "" {
+			name = namespace + "." + name
+		}
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			namespace = name[:i]
+		}
+		schema.Type, schema.Name = strings.Replace(typ, "error", "record", 1), name
+		named[name] = schema
+	}
+
+	switch schema.Type {
+	case "record":
+		fields, _ := v["fields"].([]interface{})
+		for _, f := range fields {
+			f, _ := f.(map[string]interface{})
+			name, _ := f["name"].(string)
+			fs, err := parseAvroType(f["type"], namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			schema.Fields = append(schema.Fields, avroField{Name: name, Schema: fs})
+		}
+	case "enum":
+		symbols, _ := v["symbols"].([]interface{})
+		for _, s := range symbols {
+			s, _ := s.(string)
+			schema.Symbols = append(schema.Symbols, s)
+		}
+	case "fixed":
+		size, _ := v["size"].(float64)
+		schema.Size = int(size)
+	case "array":
+		items, err := parseAvroType(v["items"], namespace, named)
+		if err != nil {
+			return nil, err
+		}
+		schema.Items = items
+	case "map":
+		values, err := parseAvroType(v["values"], namespace, named)
+		if err != nil {
+			return nil, err
+		}
+		schema.Values = values
+	default:
+		// Primitive types, possibly annotated with a logical type.
+		primitive, err := parseAvroType(v["type"], namespace, named)
+		if err != nil {
+			return nil, err
+		}
+		schema = primitive
+		if logical, ok := v["logicalType"].(string); ok {
+			schema = &avroSchema{Type: primitive.Type, Logical: logical}
+		}
+	}
+	return schema, nil
+}
+
+// avroEncode writes v, of a type schema was derived from.
+func avroEncode(buf *bytes.Buffer, schema *avroSchema, v reflect.Value) error {
+	switch schema.Type {
+	case "null":
+	case "boolean":
+		if v.Bool() {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case "int", "long":
+		switch {
+		case v.Type() == typeOfTime:
+			avroWriteLong(buf, v.Interface().(time.Time).UnixMicro())
+		case v.CanInt():
+			avroWriteLong(buf, v.Int())
+		default:
+			avroWriteLong(buf, int64(v.Uint()))
+		}
+	case "float":
+		buf.Write(binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(v.Float()))))
+	case "double":
+		buf.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(v.Float())))
+	case "bytes":
+		avroWriteLong(buf, int64(v.Len()))
+		buf.Write(v.Bytes())
+	case "string":
+		avroWriteLong(buf, int64(v.Len()))
+		buf.WriteString(v.String())
+	case "array":
+		if v.Len() > 0 {
+			avroWriteLong(buf, int64(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				if err := avroEncode(buf, schema.Items, v.Index(i)); err != nil {
+					return err
+				}
+			}
+		}
+		avroWriteLong(buf, 0)
+	case "map":
+		if v.Len() > 0 {
+			keys := v.MapKeys()
+			sort.Slice(keys, func(i, j int) bool {
+				return keys[i].String() < keys[j].String()
+			})
+			avroWriteLong(buf, int64(len(keys)))
+			for _, k := range keys {
+				avroWriteLong(buf, int64(k.Len()))
+				buf.WriteString(k.String())
+				if err := avroEncode(buf, schema.Values, v.MapIndex(k)); err != nil {
+					return err
+				}
+			}
+		}
+		avroWriteLong(buf, 0)
+	case "record":
+		for _, f := range schema.Fields {
+			fv, err := v.FieldByIndexErr(f.Index)
+			if err != nil {
+				// Fields of nil embedded structs are zero.
+				fv = reflect.Zero(v.Type().FieldByIndex(f.Index).Type)
+			}
+			if err := avroEncode(buf, f.Schema, fv); err != nil {
+				return err
+			}
+		}
+	case "union":
+		// Unions of derived schemas are those of nil or pointers.
+		if v.IsNil() {
+			avroWriteLong(buf, 0)
+			return nil
+		}
+		avroWriteLong(buf, 1)
+		return avroEncode(buf, schema.Branches[1], v.Elem())
+	default:
+		return fmt.Errorf("rpc: can't encode avro %s", schema.Type)
+	}
+	return nil
+}
+
+func avroWriteLong(buf *bytes.Buffer, n int64) {
+	buf.Write(binary.AppendUvarint(nil, uint64(n<<1)^uint64(n>>63)))
+}
+
+// avroReader decodes values written with a schema into Go values,
+// converting them to the types of the values they're decoded into.
+type avroReader struct {
+	data []byte
+}
+
+var errAvroShort = errors.New("rpc: avro message too short")
+
+func (r *avroReader) long() (int64, error) {
+	u, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		return 0, errAvroShort
+	}
+	r.data = r.data[n:]
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (r *avroReader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data) {
+		return nil, errAvroShort
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+// block returns the number of items of the next block of an array or
+// map, skipping the byte size of blocks that have one.
+func (r *avroReader) block() (int, error) {
+	n, err := r.long()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		if _, err := r.long(); err != nil {
+			return 0, err
+		}
+		n = -n
+	}
+	if n > int64(len(r.data)) {
+		// Items are a byte long at least, but for nulls and empty
+		// records, which have no business in long arrays.
+		return 0, errAvroShort
+	}
+	return int(n), nil
+}
+
+// decode decodes a value written with schema into v, or skips it if v
+// isn't valid.
+func (r *avroReader) decode(schema *avroSchema, v reflect.Value) error {
+	if v.IsValid() && v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		x, err := r.generic(schema)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.SetZero()
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+	if v.IsValid() && v.Kind() == reflect.Ptr && schema.Type != "null" && schema.Type != "union" {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	switch schema.Type {
+	case "null":
+		if v.IsValid() {
+			v.SetZero()
+		}
+	case "boolean":
+		b, err := r.bytes(1)
+		if err != nil {
+			return err
+		}
+		if v.IsValid() {
+			if v.Kind() != reflect.Bool {
+				return avroMismatch(schema, v)
+			}
+			v.SetBool(b[0] != 0)
+		}
+	case "int", "long":
+		n, err := r.long()
+		if err != nil {
+			return err
+		}
+		if !v.IsValid() {
+			return nil
+		}
+		switch {
+		case v.Type() == typeOfTime && schema.Logical == "timestamp-millis":
+			v.Set(reflect.ValueOf(time.UnixMilli(n)))
+		case v.Type() == typeOfTime:
+			v.Set(reflect.ValueOf(time.UnixMicro(n)))
+		case v.CanInt():
+			v.SetInt(n)
+		case v.CanUint():
+			v.SetUint(uint64(n))
+		case v.CanFloat():
+			v.SetFloat(float64(n))
+		default:
+			return avroMismatch(schema, v)
+		}
+	case "float", "double":
+		size := 8
+		if schema.Type == "float" {
+			size = 4
+		}
+		b, err := r.bytes(size)
+		if err != nil {
+			return err
+		}
+		if !v.IsValid() {
+			return nil
+		}
+		if !v.CanFloat() {
+			return avroMismatch(schema, v)
+		}
+		if size == 4 {
+			v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+		} else {
+			v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		}
+	case "bytes", "string", "fixed":
+		n := schema.Size
+		if schema.Type != "fixed" {
+			l, err := r.long()
+			if err != nil {
+				return err
+			}
+			n = int(l)
+		}
+		b, err := r.bytes(n)
+		if err != nil {
+			return err
+		}
+		if !v.IsValid() {
+			return nil
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), b...))
+		default:
+			return avroMismatch(schema, v)
+		}
+	case "enum":
+		i, err := r.long()
+		if err != nil {
+			return err
+		}
+		if i < 0 || int(i) >= len(schema.Symbols) {
+			return fmt.Errorf("rpc: invalid symbol %d of avro enum %s", i, schema.Name)
+		}
+		if v.IsValid() {
+			if v.Kind() != reflect.String {
+				return avroMismatch(schema, v)
+			}
+			v.SetString(schema.Symbols[i])
+		}
+	case "array":
+		if v.IsValid() && v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return avroMismatch(schema, v)
+		}
+		if v.IsValid() && v.Kind() == reflect.Slice {
+			v.SetLen(0)
+		}
+		for i := 0; ; {
+			n, err := r.block()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			for ; n > 0; n-- {
+				item := reflect.Value{}
+				switch {
+				case !v.IsValid():
+				case v.Kind() == reflect.Slice:
+					v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+					item = v.Index(v.Len() - 1)
+				case i < v.Len():
+					// Items past the length of arrays are dropped.
+					item = v.Index(i)
+				}
+				if err := r.decode(schema.Items, item); err != nil {
+					return err
+				}
+				i++
+			}
+		}
+	case "map":
+		if v.IsValid() && (v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String) {
+			return avroMismatch(schema, v)
+		}
+		for {
+			n, err := r.block()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			if v.IsValid() && v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			for ; n > 0; n-- {
+				l, err := r.long()
+				if err != nil {
+					return err
+				}
+				k, err := r.bytes(int(l))
+				if err != nil {
+					return err
+				}
+				if !v.IsValid() {
+					if err := r.decode(schema.Values, reflect.Value{}); err != nil {
+						return err
+					}
+					continue
+				}
+				item := reflect.New(v.Type().Elem()).Elem()
+				if err := r.decode(schema.Values, item); err != nil {
+					return err
+				}
+				v.SetMapIndex(reflect.ValueOf(string(k)).Convert(v.Type().Key()), item)
+			}
+		}
+	case "record":
+		if v.IsValid() && v.Kind() != reflect.Struct {
+			return avroMismatch(schema, v)
+		}
+		var fields map[string][]int
+		if v.IsValid() {
+			fields = map[string][]int{}
+			for _, f := range jsonFields(v.Type()) {
+				fields[f.Name] = f.Index
+			}
+		}
+		for _, f := range schema.Fields {
+			// Fields missing from v are skipped.
+			fv := reflect.Value{}
+			if index, ok := fields[f.Name]; ok {
+				fv = avroFieldByIndex(v, index)
+			}
+			if err := r.decode(f.Schema, fv); err != nil {
+				return err
+			}
+		}
+	case "union":
+		i, err := r.long()
+		if err != nil {
+			return err
+		}
+		if i < 0 || int(i) >= len(schema.Branches) {
+			return fmt.Errorf("rpc: invalid branch %d of avro union", i)
+		}
+		branch := schema.Branches[i]
+		if branch.Type == "null" {
+			if v.IsValid() {
+				v.SetZero()
+			}
+			return nil
+		}
+		if v.IsValid() && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		return r.decode(branch, v)
+	default:
+		return fmt.Errorf("rpc: can't decode avro %s", schema.Type)
+	}
+	return nil
+}
+
+// generic decodes a value written with schema as the types encoding/json
+// decodes values into interfaces as, but for integers and bytes.
+func (r *avroReader) generic(schema *avroSchema) (interface{}, error) {
+	var v reflect.Value
+	switch schema.Type {
+	case "null":
+		return nil, nil
+	case "boolean":
+		v = reflect.New(reflect.TypeOf(false)).Elem()
+	case "int", "long":
+		v = reflect.New(reflect.TypeOf(int64(0))).Elem()
+	case "float", "double":
+		v = reflect.New(reflect.TypeOf(float64(0))).Elem()
+	case "bytes", "fixed":
+		v = reflect.New(reflect.TypeOf([]byte(nil))).Elem()
+	case "string", "enum":
+		v = reflect.New(reflect.TypeOf("")).Elem()
+	case "array":
+		v = reflect.New(reflect.TypeOf([]interface{}(nil))).Elem()
+	case "map":
+		v = reflect.New(reflect.TypeOf(map[string]interface{}(nil))).Elem()
+	case "record":
+		m := map[string]interface{}{}
+		for _, f := range schema.Fields {
+			x, err := r.generic(f.Schema)
+			if err != nil {
+				return nil, err
+			}
+			m[f.Name] = x
+		}
+		return m, nil
+	case "union":
+		i, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(schema.Branches) {
+			return nil, fmt.Errorf("rpc: invalid branch %d of avro union", i)
+		}
+		return r.generic(schema.Branches[i])
+	default:
+		return nil, fmt.Errorf("rpc: can't decode avro %s", schema.Type)
+	}
+	if err := r.decode(schema, v); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// avroFieldByIndex returns the field of struct v with the given index,
+// allocating the nil embedded structs it's promoted from.
+func avroFieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func avroMismatch(schema *avroSchema, v reflect.Value) error {
+	return fmt.Errorf("rpc: can't decode avro %s into %s", schema.Type, v.Type())
+}
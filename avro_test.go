@@ -0,0 +1,165 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// schemaRegistry fakes the REST API of a Confluent schema registry.
+type schemaRegistry struct {
+	mu       sync.Mutex
+	schemas  []string
+	subjects map[string][]int
+}
+
+func (reg *schemaRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	w.Header().Set("Content-Type", schemaRegistryContentType)
+	switch {
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/schemas/ids/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/schemas/ids/"))
+		if id < 1 || id > len(reg.schemas) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"schema": reg.schemas[id-1]})
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/versions"):
+		subject := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/subjects/"), "/versions")
+		var req struct{ Schema string }
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		id := 0
+		for i, s := range reg.schemas {
+			if s == req.Schema {
+				id = i + 1
+			}
+		}
+		if id == 0 {
+			reg.schemas = append(reg.schemas, req.Schema)
+			id = len(reg.schemas)
+		}
+		if reg.subjects == nil {
+			reg.subjects = map[string][]int{}
+		}
+		reg.subjects[subject] = append(reg.subjects[subject], id)
+		_ = json.NewEncoder(w).Encode(map[string]int{"id": id})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestAvroCodec(t *testing.T) {
+	reg := &schemaRegistry{}
+	regSrv := httptest.NewServer(reg)
+	defer regSrv.Close()
+
+	s := New(WithCodecs(&AvroCodec{Registry: &SchemaRegistryClient{URL: regSrv.URL}}))
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// Calls are encoded with the schemas of their types, registered under
+	// their full names.
+	as := New(WithCodec(&AvroCodec{Registry: &SchemaRegistryClient{URL: regSrv.URL}}))
+	require.NoError(t, as.Register(&Math{}))
+	res := &AddResponse{}
+	require.NoError(t, as.Call(http.DefaultClient, srv.URL, "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 3, res.X)
+	require.Contains(t, reg.subjects, "go_rpc.Request")
+	require.Contains(t, reg.subjects, "go_rpc.AddRequest")
+	require.Contains(t, reg.subjects, "go_rpc.Response")
+	require.Contains(t, reg.subjects, "go_rpc.AddResponse")
+
+	// Messages are framed like Confluent's serializers do.
+	codec := &AvroCodec{Registry: &SchemaRegistryClient{URL: regSrv.URL}}
+	b, err := codec.Marshal(&AddRequest{A: 1, B: -1})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 0, 0, 0, byte(reg.subjects["go_rpc.AddRequest"][0]), 2, 1}, b)
+
+	// Unknown schemas fail.
+	err = codec.Unmarshal([]byte{0, 0, 0, 0, 99, 2}, &AddRequest{})
+	require.EqualError(t, err, "rpc: schema registry: Schema not found (40403)")
+}
+
+type avroMessage struct {
+	Name    string
+	Count   uint16
+	Ratio   float32
+	Score   float64
+	Tags    []string
+	Labels  map[string]int `json:"labels,omitempty"`
+	Next    *avroMessage
+	At      time.Time
+	Raw     []byte
+	Ignored string `json:"-"`
+	avroEmbedded
+}
+
+type avroEmbedded struct {
+	Note string
+}
+
+// avroMessageV2 is a later version of avroMessage.
+type avroMessageV2 struct {
+	Name  string
+	Extra []int
+	Count int64
+}
+
+func TestAvroCodec_Resolution(t *testing.T) {
+	regSrv := httptest.NewServer(&schemaRegistry{})
+	defer regSrv.Close()
+	codec := &AvroCodec{Registry: &SchemaRegistryClient{URL: regSrv.URL}}
+
+	// Values round trip, recursively.
+	msg := &avroMessage{
+		Name:         "a",
+		Count:        3,
+		Ratio:        0.5,
+		Score:        -1.25,
+		Tags:         []string{"x", "y"},
+		Labels:       map[string]int{"k": 1},
+		Next:         &avroMessage{Name: "b", At: time.UnixMicro(0)},
+		At:           time.UnixMicro(1700000000000000),
+		Raw:          []byte{1, 2},
+		Ignored:      "dropped",
+		avroEmbedded: avroEmbedded{Note: "n"},
+	}
+	b, err := codec.Marshal(msg)
+	require.NoError(t, err)
+	got := &avroMessage{}
+	require.NoError(t, codec.Unmarshal(b, got))
+	msg.Ignored = ""
+	require.Equal(t, msg, got)
+
+	// Records written with other versions decode field by field.
+	b, err = codec.Marshal(&avroMessageV2{Name: "c", Extra: []int{1}, Count: 7})
+	require.NoError(t, err)
+	got = &avroMessage{Tags: []string{"old"}}
+	require.NoError(t, codec.Unmarshal(b, got))
+	require.Equal(t, &avroMessage{Name: "c", Count: 7, Tags: []string{"old"}}, got)
+
+	// As do values decoded into interfaces.
+	var generic interface{}
+	require.NoError(t, codec.Unmarshal(b, &generic))
+	require.Equal(t, map[string]interface{}{
+		"Name":  "c",
+		"Extra": []interface{}{int64(1)},
+		"Count": int64(7),
+	}, generic)
+
+	// Types holding interfaces can't be encoded.
+	_, err = codec.Marshal(&struct{ V interface{} }{})
+	require.Error(t, err)
+	// Nor can truncated messages be decoded.
+	require.Error(t, codec.Unmarshal(b[:len(b)-1], &avroMessageV2{}))
+}
@@ -0,0 +1,87 @@
+package rpc
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff computes the delays waited between attempts, by client retries
+// and resumed downloads, see RetryPolicy.
+type Backoff interface {
+	// Delay returns the delay before the given retry, counting from 1,
+	// given the delay before the previous one, or 0 for the first retry.
+	Delay(retry int, prev time.Duration) time.Duration
+}
+
+// ConstantBackoff waits the same delay before every retry.
+type ConstantBackoff time.Duration
+
+// Delay implements Backoff.
+func (b ConstantBackoff) Delay(retry int, prev time.Duration) time.Duration {
+	return time.Duration(b)
+}
+
+// ExponentialBackoff doubles the delay before each retry, from Base up to
+// Max, and waits a random delay of up to it, known as "full jitter", so
+// that callers failing together don't retry together.
+type ExponentialBackoff struct {
+	Base time.Duration // defaults to 100ms
+	Max  time.Duration // defaults to 10s
+}
+
+// Delay implements Backoff.
+func (b ExponentialBackoff) Delay(retry int, prev time.Duration) time.Duration {
+	base, limit := backoffBounds(b.Base, b.Max)
+	d := base
+	for i := 1; i < retry && d < limit; i++ {
+		d *= 2
+	}
+	return jitter(0, min(d, limit))
+}
+
+// DecorrelatedJitterBackoff waits a random delay between Base and three
+// times the previous delay, up to Max. Delays grow like those of an
+// ExponentialBackoff, but spread out more.
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration // defaults to 100ms
+	Max  time.Duration // defaults to 10s
+}
+
+// Delay implements Backoff.
+func (b DecorrelatedJitterBackoff) Delay(retry int, prev time.Duration) time.Duration {
+	base, limit := backoffBounds(b.Base, b.Max)
+	return min(jitter(base, max(base, 3*prev)), limit)
+}
+
+// backoffBounds returns the base and max delays of a backoff, defaulting
+// to DefaultRetryBackoff and DefaultRetryMaxDelay.
+func backoffBounds(base, limit time.Duration) (time.Duration, time.Duration) {
+	if base <= 0 {
+		base = DefaultRetryBackoff
+	}
+	if limit <= 0 {
+		limit = DefaultRetryMaxDelay
+	}
+	return base, limit
+}
+
+// jitter returns a random duration in [lo, hi].
+func jitter(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	return lo + rand.N(hi-lo+1)
+}
+
+// sleep waits for d, and returns false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,41 @@
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	require.Equal(t, time.Second, ConstantBackoff(time.Second).Delay(5, time.Second))
+
+	// Exponential delays double up to Max, and are jittered below them.
+	exp := ExponentialBackoff{Base: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		require.LessOrEqual(t, exp.Delay(1, 0), 10*time.Millisecond)
+		require.LessOrEqual(t, exp.Delay(3, 0), 40*time.Millisecond)
+		require.LessOrEqual(t, exp.Delay(30, 0), 50*time.Millisecond)
+		require.GreaterOrEqual(t, exp.Delay(30, 0), time.Duration(0))
+	}
+
+	// Decorrelated delays are between Base and three times the previous
+	// one, up to Max.
+	dec := DecorrelatedJitterBackoff{Base: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		d := dec.Delay(1, 0)
+		require.Equal(t, 10*time.Millisecond, d)
+		d = dec.Delay(2, 12*time.Millisecond)
+		require.GreaterOrEqual(t, d, 10*time.Millisecond)
+		require.LessOrEqual(t, d, 36*time.Millisecond)
+		require.LessOrEqual(t, dec.Delay(3, time.Second), 50*time.Millisecond)
+	}
+
+	// Policies default to an exponential backoff up to their MaxDelay.
+	p := &RetryPolicy{MaxDelay: time.Second}
+	require.Equal(t, ExponentialBackoff{Max: time.Second}, p.backoff())
+	rerr := &Error{Code: CodeUnavailable}
+	d, ok := (&RetryPolicy{Backoff: ConstantBackoff(time.Minute)}).delay(rerr, 1, 0)
+	require.True(t, ok)
+	require.Equal(t, DefaultRetryMaxDelay, d)
+}
@@ -0,0 +1,480 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// BatchRequest is the envelope of a batch of calls, sent with the
+	// BatchHeader set.
+	// JSON request bodies can use the results of other calls of the batch:
+	// strings of the form "${<seq>.<path>}", eg. "${0.User.ID}", are
+	// replaced with the value at the path in the response body of the call
+	// with that Seq. Calls are made after the calls they reference, and
+	// fail with CodeAborted if those fail.
+	BatchRequest struct {
+		Requests []Request
+		Atomic   bool // whether the calls must all succeed or all fail
+	}
+	// BatchResponse is the envelope of the results of a batch of calls.
+	// Responses are in the order of the requests, and each carries the
+	// error of its call, if any.
+	BatchResponse struct {
+		Responses []Response
+		Succeeded int // number of calls that succeeded
+		Failed    int // number of calls that failed
+	}
+	// BatchCall is a call made as part of a batch.
+	BatchCall struct {
+		Method   string
+		Request  interface{}
+		Response interface{} // decoded into if the call succeeds
+		Error    error       // error of the call, if any
+	}
+	// Transactor runs atomic batches in transactions. The context returned
+	// by Begin is passed to every call of the batch, and to Commit or
+	// Rollback once they have all succeeded or one has failed.
+	// Methods find the transaction they are part of in their context.
+	Transactor interface {
+		Begin(ctx context.Context) (context.Context, error)
+		Commit(ctx context.Context) error
+		Rollback(ctx context.Context) error
+	}
+)
+
+// BatchHeader is the request header marking the body as a BatchRequest.
+const BatchHeader = "Rpc-Batch"
+
+// batchRef matches references to the results of other calls in a batch,
+// as "${<seq>.<path>}", eg. "${0.User.ID}" or "${1.Items.0}".
+var batchRef = regexp.MustCompile(`^\$\{(\d+)((?:\.[^.}]+)*)\}$`)
+
+// serveBatch serves a batch of calls. Calls are made in order, and their
+// errors are reported in their responses.
+func (s *Service) serveBatch(w http.ResponseWriter, r *http.Request, reqBytes []byte) {
+	var batch BatchRequest
+	if err := s.codec.Unmarshal(reqBytes, &batch); err != nil {
+		s.httpError(w, http.StatusBadRequest, errBadRequest)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	var res *BatchResponse
+	if batch.Atomic {
+		var err error
+		res, err = s.callAtomic(ctx, batch.Requests)
+		if err != nil {
+			s.writeError(w, r, nil, err)
+			return
+		}
+	} else {
+		res = &BatchResponse{}
+		res.Responses, _ = s.runBatch(ctx, batch.Requests, false)
+	}
+
+	for _, r := range res.Responses {
+		if r.Error != "" {
+			res.Failed++
+		} else {
+			res.Succeeded++
+		}
+	}
+
+	resBytes, err := s.codec.Marshal(res)
+	if err != nil {
+		s.logf("rpc: error encoding batch response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", s.codec.ContentType())
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(resBytes)
+}
+
+// callAtomic makes the calls in a transaction, which is rolled back if any
+// of them fails. The other calls then fail with CodeAborted.
+func (s *Service) callAtomic(ctx context.Context, reqs []Request) (*BatchResponse, error) {
+	if s.transactor == nil {
+		return nil, &Error{
+			Code:    CodeInvalidRequest,
+			Message: "atomic batches are not supported",
+		}
+	}
+	txCtx, err := s.transactor.Begin(ctx)
+	if err != nil {
+		return nil, &Error{
+			Code:    CodeUnavailable,
+			Message: "error beginning transaction: " + err.Error(),
+		}
+	}
+
+	res := &BatchResponse{}
+	var failed int
+	res.Responses, failed = s.runBatch(txCtx, reqs, true)
+	if failed >= 0 {
+		if err := s.transactor.Rollback(txCtx); err != nil {
+			s.logf("rpc: error rolling back batch: %v", err)
+		}
+		aborted := &Error{
+			Code:    CodeAborted,
+			Message: fmt.Sprintf("batch aborted: call %d to %s failed", reqs[failed].Seq, reqs[failed].ServiceMethod),
+		}
+		for i := range reqs {
+			if i != failed {
+				res.Responses[i] = s.batchEntry(txCtx, &reqs[i], nil, aborted)
+			}
+		}
+		return res, nil
+	}
+
+	if err := s.transactor.Commit(txCtx); err != nil {
+		aborted := &Error{
+			Code:    CodeAborted,
+			Message: "batch aborted: error committing transaction: " + err.Error(),
+		}
+		for i := range reqs {
+			res.Responses[i] = s.batchEntry(txCtx, &reqs[i], nil, aborted)
+		}
+	}
+	return res, nil
+}
+
+// runBatch makes the calls of a batch in dependency order, and returns
+// their responses in the order of the requests. Calls depending on calls
+// that failed fail with CodeAborted. With stop, no more calls are made
+// once one fails, and the index of the failed call is returned, or -1.
+func (s *Service) runBatch(ctx context.Context, reqs []Request, stop bool) ([]Response, int) {
+	ctx = context.WithValue(ctx, batchCallKey{}, true)
+	res := make([]Response, len(reqs))
+	results := map[uint64]interface{}{}
+	order, deps, errs := batchOrder(reqs)
+	referenced := map[int]bool{}
+	for _, ds := range deps {
+		for _, d := range ds {
+			referenced[d] = true
+		}
+	}
+	for _, i := range order {
+		req := &reqs[i]
+		err := errs[i]
+		if err == nil {
+			for _, d := range deps[i] {
+				if res[d].Error != "" {
+					err = &Error{
+						Code:    CodeAborted,
+						Message: fmt.Sprintf("depends on call %d, which failed", reqs[d].Seq),
+					}
+					break
+				}
+			}
+		}
+		var r *Response
+		if err == nil {
+			var body []byte
+			body, err = substituteRefs(req.Body, results)
+			if err == nil {
+				r, err = s.callContext(ctx, &Request{
+					ServiceMethod: req.ServiceMethod,
+					Body:          body,
+					Seq:           req.Seq,
+				})
+				if errors.Is(err, ErrMethodNotFound) {
+					err = s.methodNotFound(ctx, req.ServiceMethod)
+				}
+			}
+		}
+		res[i] = s.batchEntry(ctx, req, r, err)
+		if err != nil {
+			if stop {
+				return res, i
+			}
+			continue
+		}
+		if referenced[i] {
+			if v, err := decodeJSON(r.Body); err == nil {
+				results[req.Seq] = v
+			}
+		}
+	}
+	return res, -1
+}
+
+// batchCallKey marks the contexts of the calls of batches.
+type batchCallKey struct{}
+
+// isBatchCall returns whether ctx is the context of a call of a batch,
+// which shares the headers of the batch with the other calls.
+func isBatchCall(ctx context.Context) bool {
+	batched, _ := ctx.Value(batchCallKey{}).(bool)
+	return batched
+}
+
+// batchOrder returns the order to make the calls of a batch in, so calls
+// are made after the calls they reference, the indices of the calls each
+// call references, and the errors of calls with invalid references.
+// Calls are otherwise made in the order of the requests.
+func batchOrder(reqs []Request) (order []int, deps [][]int, errs []error) {
+	seqs := map[uint64]int{}
+	for i := len(reqs) - 1; i >= 0; i-- {
+		seqs[reqs[i].Seq] = i
+	}
+	deps = make([][]int, len(reqs))
+	errs = make([]error, len(reqs))
+	for i := range reqs {
+		for _, seq := range batchRefs(reqs[i].Body) {
+			d, ok := seqs[seq]
+			if !ok || d == i {
+				errs[i] = &Error{
+					Code:    CodeInvalidRequest,
+					Message: fmt.Sprintf("invalid reference to call %d", seq),
+				}
+				break
+			}
+			deps[i] = append(deps[i], d)
+		}
+	}
+
+	placed := make([]bool, len(reqs))
+	for len(order) < len(reqs) {
+		progress := false
+		for i := range reqs {
+			if placed[i] {
+				continue
+			}
+			ready := true
+			for _, d := range deps[i] {
+				ready = ready && placed[d]
+			}
+			if ready {
+				order = append(order, i)
+				placed[i] = true
+				progress = true
+			}
+		}
+		if progress {
+			continue
+		}
+		// The remaining calls reference each other.
+		for i := range reqs {
+			if !placed[i] {
+				errs[i] = &Error{
+					Code:    CodeInvalidRequest,
+					Message: "circular reference between calls",
+				}
+				order = append(order, i)
+				placed[i] = true
+			}
+		}
+	}
+	return order, deps, errs
+}
+
+// batchRefs returns the Seq of the calls referenced in the body.
+func batchRefs(body []byte) []uint64 {
+	if !bytes.Contains(body, []byte("${")) {
+		return nil
+	}
+	v, err := decodeJSON(body)
+	if err != nil {
+		return nil
+	}
+	var refs []uint64
+	walkRefs(v, func(s string) interface{} {
+		m := batchRef.FindStringSubmatch(s)
+		if seq, err := strconv.ParseUint(m[1], 10, 64); err == nil {
+			refs = append(refs, seq)
+		}
+		return s
+	})
+	return refs
+}
+
+// substituteRefs replaces references in body with the referenced values
+// of results, keyed by Seq.
+func substituteRefs(body []byte, results map[uint64]interface{}) ([]byte, error) {
+	if !bytes.Contains(body, []byte("${")) {
+		return body, nil
+	}
+	v, err := decodeJSON(body)
+	if err != nil {
+		// Left for the method to reject.
+		return body, nil
+	}
+	var refErr error
+	v = walkRefs(v, func(s string) interface{} {
+		m := batchRef.FindStringSubmatch(s)
+		seq, _ := strconv.ParseUint(m[1], 10, 64)
+		value, ok := results[seq]
+		for _, key := range strings.Split(strings.TrimPrefix(m[2], "."), ".") {
+			if !ok || key == "" {
+				break
+			}
+			switch x := value.(type) {
+			case map[string]interface{}:
+				value, ok = x[key]
+			case []interface{}:
+				n, err := strconv.Atoi(key)
+				ok = err == nil && n >= 0 && n < len(x)
+				if ok {
+					value = x[n]
+				}
+			default:
+				ok = false
+			}
+		}
+		if !ok && refErr == nil {
+			refErr = &Error{
+				Code:    CodeInvalidRequest,
+				Message: "unresolved reference " + s,
+			}
+		}
+		return value
+	})
+	if refErr != nil {
+		return nil, refErr
+	}
+	return json.Marshal(v)
+}
+
+// walkRefs replaces the strings of v that are references with the result
+// of fn.
+func walkRefs(v interface{}, fn func(ref string) interface{}) interface{} {
+	switch x := v.(type) {
+	case string:
+		if batchRef.MatchString(x) {
+			return fn(x)
+		}
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = walkRefs(e, fn)
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = walkRefs(e, fn)
+		}
+	}
+	return v
+}
+
+// decodeJSON decodes b, keeping numbers as they are.
+func decodeJSON(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// batchEntry returns the response of a call in a batch.
+func (s *Service) batchEntry(ctx context.Context, req *Request, res *Response, err error) Response {
+	if err != nil {
+		_, err = s.localize(HeaderFromContext(ctx).Get("Accept-Language"), s.errorEncoder.encode(err))
+		r, _ := errorResponse(req, err)
+		return r
+	}
+	return *res
+}
+
+// Batch makes the calls in a single request. Calls are made in order, and
+// each call's error is set on it. With atomic, the calls are made in a
+// transaction, and either all succeed or all fail.
+// The returned error is set if the batch couldn't be made at all.
+func (c *Client) Batch(ctx context.Context, atomic bool, calls ...*BatchCall) error {
+	if err := callBatch(ctx, c.httpClient, c.codec, c.uri, atomic, calls); err != nil {
+		return c.errorDecoder.decode(err)
+	}
+	for _, call := range calls {
+		call.Error = c.errorDecoder.decode(call.Error)
+	}
+	return nil
+}
+
+// callBatch sends a batch of calls to the server at uri, and sets their
+// results.
+func callBatch(ctx context.Context, httpClient *http.Client, codec Codec, uri string, atomic bool, calls []*BatchCall) error {
+	// Encode the batch.
+	batch := BatchRequest{
+		Atomic: atomic,
+	}
+	for i, c := range calls {
+		body, err := marshalBody(codec, c.Request)
+		if err != nil {
+			return fmt.Errorf("rpc: error encoding request: %v", err)
+		}
+		batch.Requests = append(batch.Requests, Request{
+			ServiceMethod: c.Method,
+			Body:          body,
+			Seq:           uint64(i),
+		})
+	}
+	reqBytes, err := codec.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("rpc: error marshalling request: %v", err)
+	}
+
+	// Send the batch.
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(reqBytes))
+	if err != nil {
+		return fmt.Errorf("rpc: error creating request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", codec.ContentType())
+	httpReq.Header.Set(BatchHeader, "1")
+	setTimeoutHeader(ctx, httpReq.Header)
+	setOutgoingHeader(ctx, httpReq.Header)
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("rpc: error sending request: %v", err)
+	}
+
+	// Decode the results.
+	defer resp.Body.Close()
+	resBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("rpc: error reading response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return decodeResult(codec, resBytes, nil)
+	}
+	res := BatchResponse{}
+	if err := codec.Unmarshal(resBytes, &res); err != nil {
+		return fmt.Errorf("rpc: error reading response body: %v", err)
+	}
+	if len(res.Responses) != len(calls) {
+		return fmt.Errorf("rpc: got %d responses for %d calls", len(res.Responses), len(calls))
+	}
+	// Responses echo the Seq of their request, its index in calls.
+	for _, r := range res.Responses {
+		if r.Seq >= uint64(len(calls)) {
+			return fmt.Errorf("rpc: got response for unknown call %d", r.Seq)
+		}
+		c := calls[r.Seq]
+		c.Error = decodeResponse(codec, r, c.Response)
+	}
+	return nil
+}
+
+// SplitBatch splits calls made with Client.Batch into the ones that
+// succeeded and the ones that failed, keeping their order.
+func SplitBatch(calls []*BatchCall) (succeeded, failed []*BatchCall) {
+	for _, c := range calls {
+		if c.Error != nil {
+			failed = append(failed, c)
+		} else {
+			succeeded = append(succeeded, c)
+		}
+	}
+	return succeeded, failed
+}
@@ -0,0 +1,200 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	// Ledger credits amounts in the transaction of its context.
+	Ledger struct{}
+	// ledgerStore is a Transactor committing credits to balance.
+	ledgerStore struct {
+		mu      sync.Mutex
+		balance int
+	}
+	ledgerTxKey struct{}
+)
+
+func (l *Ledger) Credit(ctx context.Context, req *AddRequest, res *AddResponse) error {
+	if req.A < 0 {
+		return &Error{Code: CodeInvalidRequest, Message: "negative credit"}
+	}
+	tx := ctx.Value(ledgerTxKey{}).(*int)
+	*tx += req.A
+	res.X = *tx
+	return nil
+}
+
+func (s *ledgerStore) Begin(ctx context.Context) (context.Context, error) {
+	return context.WithValue(ctx, ledgerTxKey{}, new(int)), nil
+}
+
+func (s *ledgerStore) Commit(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balance += *ctx.Value(ledgerTxKey{}).(*int)
+	return nil
+}
+
+func (s *ledgerStore) Rollback(ctx context.Context) error {
+	return nil
+}
+
+func TestClient_Batch(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	defer c.Close()
+
+	first, second := &AddResponse{}, &AddResponse{}
+	calls := []*BatchCall{
+		{Method: "Math.Add", Request: &AddRequest{A: 1, B: 2}, Response: first},
+		{Method: "Math.Missing", Request: &AddRequest{}},
+		{Method: "Math.Add", Request: &AddRequest{A: 3, B: 4}, Response: second},
+	}
+	require.NoError(t, c.Batch(context.Background(), false, calls...))
+	require.NoError(t, calls[0].Error)
+	require.Equal(t, 3, first.X)
+	var rerr *Error
+	require.True(t, errors.As(calls[1].Error, &rerr))
+	require.Equal(t, CodeMethodNotFound, rerr.Code)
+	require.NoError(t, calls[2].Error)
+	require.Equal(t, 7, second.X)
+
+	// Atomic batches need a transactor.
+	err = c.Batch(context.Background(), true, calls...)
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+}
+
+func TestClient_Batch_Atomic(t *testing.T) {
+	store := &ledgerStore{}
+	s := New(WithTransactor(store))
+	require.NoError(t, s.Register(&Ledger{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	defer c.Close()
+
+	// All calls succeed.
+	res := &AddResponse{}
+	calls := []*BatchCall{
+		{Method: "Ledger.Credit", Request: &AddRequest{A: 1}, Response: &AddResponse{}},
+		{Method: "Ledger.Credit", Request: &AddRequest{A: 2}, Response: res},
+	}
+	require.NoError(t, c.Batch(context.Background(), true, calls...))
+	require.NoError(t, calls[0].Error)
+	require.NoError(t, calls[1].Error)
+	require.Equal(t, 3, res.X)
+	require.Equal(t, 3, store.balance)
+
+	// One call fails, none are committed.
+	calls = []*BatchCall{
+		{Method: "Ledger.Credit", Request: &AddRequest{A: 1}, Response: &AddResponse{}},
+		{Method: "Ledger.Credit", Request: &AddRequest{A: -1}, Response: &AddResponse{}},
+	}
+	require.NoError(t, c.Batch(context.Background(), true, calls...))
+	var rerr *Error
+	require.True(t, errors.As(calls[0].Error, &rerr))
+	require.Equal(t, CodeAborted, rerr.Code)
+	require.True(t, errors.As(calls[1].Error, &rerr))
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+	require.Equal(t, 3, store.balance)
+}
+
+func TestService_Serve_BatchSummary(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	body := `{"Requests": [
+		{"ServiceMethod": "Math.Add", "Body": {"A": 1}, "Seq": 7},
+		{"ServiceMethod": "Math.Add", "Body": "invalid", "Seq": 8}
+	]}`
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(BatchHeader, "1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	res := BatchResponse{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.Equal(t, 1, res.Succeeded)
+	require.Equal(t, 1, res.Failed)
+	require.Equal(t, uint64(7), res.Responses[0].Seq)
+	require.Equal(t, uint64(8), res.Responses[1].Seq)
+	require.Equal(t, CodeInvalidRequest, res.Responses[1].Code)
+}
+
+func TestSplitBatch(t *testing.T) {
+	calls := []*BatchCall{
+		{Method: "a"},
+		{Method: "b", Error: errors.New("failed")},
+		{Method: "c"},
+	}
+	succeeded, failed := SplitBatch(calls)
+	require.Equal(t, []*BatchCall{calls[0], calls[2]}, succeeded)
+	require.Equal(t, []*BatchCall{calls[1]}, failed)
+}
+
+func TestClient_Batch_References(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	defer c.Close()
+
+	// The second call is made after the third, whose result it uses.
+	sum, total := &AddResponse{}, &AddResponse{}
+	calls := []*BatchCall{
+		{Method: "Math.Add", Request: &AddRequest{A: 1, B: 2}, Response: &AddResponse{}},
+		{Method: "Math.Add", Request: map[string]interface{}{"A": "${0.X}", "B": "${2.X}"}, Response: total},
+		{Method: "Math.Add", Request: map[string]interface{}{"A": "${0.X}", "B": 10}, Response: sum},
+		{Method: "Math.Add", Request: map[string]interface{}{"A": "${0.Missing}"}},
+		{Method: "Math.Add", Request: map[string]interface{}{"A": "${3.X}"}},
+		{Method: "Math.Add", Request: map[string]interface{}{"A": "${6.X}"}},
+		{Method: "Math.Add", Request: map[string]interface{}{"A": "${5.X}"}},
+	}
+	require.NoError(t, c.Batch(context.Background(), false, calls...))
+	require.NoError(t, calls[1].Error)
+	require.NoError(t, calls[2].Error)
+	require.Equal(t, 13, sum.X)
+	require.Equal(t, 16, total.X)
+
+	// Unresolved references.
+	var rerr *Error
+	require.True(t, errors.As(calls[3].Error, &rerr))
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+
+	// References to failed calls.
+	require.True(t, errors.As(calls[4].Error, &rerr))
+	require.Equal(t, CodeAborted, rerr.Code)
+
+	// Circular references.
+	require.True(t, errors.As(calls[5].Error, &rerr))
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+	require.True(t, errors.As(calls[6].Error, &rerr))
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+}
@@ -0,0 +1,155 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// BidiStream sends a stream of requests to a method taking one, see
+// RecvStream, and receives the stream of responses it sends, see Stream:
+//
+//	func (q *Query) Live(ctx context.Context, filters *rpc.RecvStream[Filter], rows *rpc.Stream[Row]) error
+//
+// Over HTTP, requests and responses are sent as NDJSON request and
+// response bodies, both at once, which needs HTTP/2 or, over HTTP/1.1, a
+// client and server supporting full duplex, as those of net/http do.
+type BidiStream[Req, Res any] struct {
+	w      *io.PipeWriter
+	codec  Codec
+	method string
+	seq    uint64
+	cancel context.CancelFunc
+	resp   chan bidiResponse
+
+	mu           sync.Mutex
+	received     bool // whether resp was received
+	body         io.ReadCloser
+	messages     *bufio.Reader
+	deltas       *deltaDecoder
+	errorDecoder ErrorDecoder
+	err          error // once the stream of responses has ended
+}
+
+type bidiResponse struct {
+	body   io.ReadCloser
+	deltas *deltaDecoder
+	err    error
+}
+
+// OpenBidiStream calls a method taking a stream of requests and sending a
+// stream of responses. The call is canceled once the stream is closed.
+func OpenBidiStream[Req, Res any](ctx context.Context, c *Client, method string) (*BidiStream[Req, Res], error) {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	seq := c.nextSeq()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.uri, pr)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("rpc: error creating request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", NDJSONContentType)
+	httpReq.Header.Set("Accept", NDJSONContentType)
+	httpReq.Header.Set(DeltaHeader, MergePatchDelta)
+	httpReq.Header.Set(MethodHeader, method)
+	httpReq.Header.Set(SeqHeader, strconv.FormatUint(seq, 10))
+	setTimeoutHeader(ctx, httpReq.Header)
+	setOutgoingHeader(WithOutgoingHeader(ctx, ClientIDHeader, c.id), httpReq.Header)
+
+	s := &BidiStream[Req, Res]{
+		w:            pw,
+		codec:        c.codec,
+		method:       method,
+		seq:          seq,
+		cancel:       cancel,
+		resp:         make(chan bidiResponse, 1),
+		errorDecoder: c.errorDecoder,
+	}
+	go func() {
+		resp, err := c.httpClient.Do(httpReq)
+		if err != nil {
+			pr.CloseWithError(err) // nolint: errcheck
+			s.resp <- bidiResponse{err: fmt.Errorf("rpc: error sending request: %w", err)}
+			return
+		}
+		c.versions.update(resp.Header)
+		s.resp <- bidiResponse{body: resp.Body, deltas: receivesDeltas(resp)}
+	}()
+	return s, nil
+}
+
+// Send sends a request of the stream. It fails if the call has already
+// completed, in which case Recv returns its error.
+func (s *BidiStream[Req, Res]) Send(v Req) error {
+	b, err := marshalBody(s.codec, v)
+	if err != nil {
+		return fmt.Errorf("rpc: error encoding request: %v", err)
+	}
+	if _, err := s.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("rpc: error sending request: %w", err)
+	}
+	return nil
+}
+
+// CloseSend closes the stream of requests. Responses can still be
+// received.
+func (s *BidiStream[Req, Res]) CloseSend() error {
+	return s.w.Close()
+}
+
+// Recv returns the next response of the stream. Once the method returns,
+// it returns io.EOF, or the error of the call.
+func (s *BidiStream[Req, Res]) Recv() (Res, error) {
+	var v Res
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return v, s.err
+	}
+	if !s.received {
+		res := <-s.resp
+		s.received = true
+		if res.err != nil {
+			s.err = res.err
+			return v, s.err
+		}
+		s.body = res.body
+		s.messages = bufio.NewReader(res.body)
+		s.deltas = res.deltas
+	}
+	more, err := readStreamMessage(s.codec, s.messages, s.method, s.seq, s.deltas, &v)
+	if !more {
+		s.err = s.errorDecoder.decode(err)
+		if s.err == nil {
+			s.err = io.EOF
+		}
+		return v, s.err
+	}
+	return v, nil
+}
+
+// Close cancels the call, if it hasn't completed, and releases its
+// resources.
+func (s *BidiStream[Req, Res]) Close() error {
+	s.cancel()
+	s.w.Close() // nolint: errcheck
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.received {
+		s.received = true
+		if res := <-s.resp; res.body != nil {
+			s.body = res.body
+		}
+	}
+	if s.err == nil {
+		s.err = errStreamClosed
+	}
+	if s.body != nil {
+		return s.body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Query struct {
+	words []string
+}
+
+type (
+	Filter struct {
+		Prefix string
+	}
+	Row struct {
+		Word string
+	}
+)
+
+// Live sends the words matching each filter it receives, followed by an
+// empty row.
+func (q *Query) Live(ctx context.Context, filters *RecvStream[Filter], rows *Stream[Row]) error {
+	for {
+		f, err := filters.Recv(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if f.Prefix == "" {
+			return &Error{Code: CodeInvalidRequest, Message: "empty filter"}
+		}
+		for _, w := range q.words {
+			if strings.HasPrefix(w, f.Prefix) {
+				if err := rows.Send(ctx, Row{Word: w}); err != nil {
+					return err
+				}
+			}
+		}
+		if err := rows.Send(ctx, Row{}); err != nil {
+			return err
+		}
+	}
+}
+
+func TestOpenBidiStream(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Query{words: []string{"apple", "apricot", "banana", "blueberry", "cherry"}}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// recvRows receives the rows sent for a filter.
+	recvRows := func(stream *BidiStream[Filter, Row]) []string {
+		var words []string
+		for {
+			row, err := stream.Recv()
+			require.NoError(t, err)
+			if row.Word == "" {
+				return words
+			}
+			words = append(words, row.Word)
+		}
+	}
+
+	// Responses are received while requests are still being sent.
+	stream, err := OpenBidiStream[Filter, Row](ctx, c, "Query.Live")
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(Filter{Prefix: "ap"}))
+	require.Equal(t, []string{"apple", "apricot"}, recvRows(stream))
+	require.NoError(t, stream.Send(Filter{Prefix: "b"}))
+	require.Equal(t, []string{"banana", "blueberry"}, recvRows(stream))
+	require.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	require.Equal(t, io.EOF, err)
+	require.NoError(t, stream.Close())
+
+	// Errors of the method end the stream of responses.
+	stream, err = OpenBidiStream[Filter, Row](ctx, c, "Query.Live")
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(Filter{Prefix: "c"}))
+	require.Equal(t, []string{"cherry"}, recvRows(stream))
+	require.NoError(t, stream.Send(Filter{}))
+	_, err = stream.Recv()
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+	require.NoError(t, stream.Close())
+
+	// Closing the stream cancels the call.
+	stream, err = OpenBidiStream[Filter, Row](ctx, c, "Query.Live")
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(Filter{Prefix: "a"}))
+	require.NoError(t, stream.Close())
+	_, err = stream.Recv()
+	require.Error(t, err)
+}
@@ -0,0 +1,168 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+const (
+	// MethodHeader carries the method of calls whose request body is a
+	// raw Blob, sent as the HTTP request body instead of in an envelope.
+	MethodHeader = "Rpc-Method"
+	// SeqHeader carries the Seq of calls whose request or response body
+	// is a raw Blob.
+	SeqHeader = "Rpc-Seq"
+	// RawResponseHeader is set by callers accepting Blob response bodies
+	// as the raw HTTP response body, instead of in an envelope.
+	RawResponseHeader = "Rpc-Raw-Response"
+)
+
+// Blob is a binary request or response body, eg. a file chunk or a
+// compressed blob. Methods taking or returning a *Blob have their bodies
+// sent over HTTP as they are, tagged with their content type, instead of
+// being base64 encoded in the envelope. Over other transports, blobs are
+// encoded like other bodies.
+type Blob struct {
+	ContentType string `json:",omitempty"`
+	Data        []byte
+	// Reader, if set, streams the body instead of Data. Requests spooled
+	// to disk, see WithSpoolThreshold, are read from it. Methods can set
+	// it on responses to stream them to callers accepting raw responses,
+	// without buffering them in memory, and it is closed once read if it
+	// is an io.Closer. Calls with other callers read it into Data.
+	Reader io.Reader `json:"-"`
+}
+
+var typeOfBlob = reflect.TypeOf(&Blob{})
+
+// rawRequest returns the request of a call whose request body is a raw
+// Blob.
+func (s *Service) rawRequest(r *http.Request, method string, data []byte) (*Request, error) {
+	req := &Request{
+		ServiceMethod: method,
+	}
+	if v := r.Header.Get(SeqHeader); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("rpc: invalid %s header: %v", SeqHeader, err)
+		}
+		req.Seq = seq
+	}
+	if m, ok := s.method(method); !ok || m.RequestType != typeOfBlob {
+		return nil, ErrMethodNotFound
+	}
+	body, err := s.codec.Marshal(&Blob{
+		ContentType: r.Header.Get("Content-Type"),
+		Data:        data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req.Body = body
+	return req, nil
+}
+
+// writeRawResponse writes the response body as it is if it is a Blob and
+// the caller accepts raw responses, and returns whether it did.
+func (s *Service) writeRawResponse(w http.ResponseWriter, r *http.Request, req *Request, res *Response) bool {
+	if r.Header.Get(RawResponseHeader) == "" || req.Encrypted {
+		return false
+	}
+	if m, ok := s.method(req.ServiceMethod); !ok || m.ResponseType != typeOfBlob {
+		return false
+	}
+	blob := &Blob{}
+	if err := s.codec.Unmarshal(res.Body, blob); err != nil {
+		return false
+	}
+	contentType := blob.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	body := io.Reader(bytes.NewReader(blob.Data))
+	if streams, ok := r.Context().Value(blobStreamsKey{}).(*blobStreams); ok && streams.res != nil {
+		body = streams.res
+		if c, ok := body.(io.Closer); ok {
+			defer c.Close() // nolint: errcheck
+		}
+	}
+	w.Header().Set(MethodHeader, res.ServiceMethod)
+	w.Header().Set(SeqHeader, strconv.FormatUint(res.Seq, 10))
+	if r.Header.Get(ChunkSizeHeader) != "" {
+		s.writeChunks(w, r, req, contentType, body)
+		return true
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		s.logf("rpc: error streaming response of %s: %v", req.ServiceMethod, err)
+	}
+	return true
+}
+
+// callRaw is like call, for calls whose request or response body is a
+// Blob, which are sent as raw HTTP bodies.
+func callRaw(ctx context.Context, httpClient *http.Client, codec Codec, uri string, method string, seq uint64, v *versionNegotiator, reqBody, resBody interface{}) error {
+	var (
+		body        []byte
+		contentType = codec.ContentType()
+		err         error
+	)
+	var reader io.Reader
+	reqBlob, rawRequest := reqBody.(*Blob)
+	if rawRequest {
+		body = reqBlob.Data
+		reader = reqBlob.Reader
+		contentType = reqBlob.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	} else if body, err = encodeCall(ctx, codec, method, reqBody, seq, v.current()); err != nil {
+		return err
+	}
+
+	if reader == nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, reader)
+	if err != nil {
+		return fmt.Errorf("rpc: error creating request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	if rawRequest {
+		httpReq.Header.Set(MethodHeader, method)
+		httpReq.Header.Set(SeqHeader, strconv.FormatUint(seq, 10))
+	}
+	resBlob, rawResponse := resBody.(*Blob)
+	if rawResponse {
+		httpReq.Header.Set(RawResponseHeader, "1")
+	}
+	setTimeoutHeader(ctx, httpReq.Header)
+	setOutgoingHeader(ctx, httpReq.Header)
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("rpc: error sending request: %w", err)
+	}
+
+	defer resp.Body.Close()
+	v.update(resp.Header)
+	resBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("rpc: error reading response body: %v", err)
+	}
+	if rawResponse && resp.StatusCode == http.StatusOK && resp.Header.Get(MethodHeader) != "" {
+		if resp.Header.Get(MethodHeader) != method || resp.Header.Get(SeqHeader) != strconv.FormatUint(seq, 10) {
+			return fmt.Errorf("%w: got %s #%s, expected %s #%d", ErrResponseMismatch, resp.Header.Get(MethodHeader), resp.Header.Get(SeqHeader), method, seq)
+		}
+		resBlob.ContentType = resp.Header.Get("Content-Type")
+		resBlob.Data = resBytes
+		return nil
+	}
+	return decodeReply(codec, resBytes, method, seq, resBody)
+}
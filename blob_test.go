@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	Files          struct{}
+	UploadResponse struct {
+		Size        int
+		ContentType string
+	}
+	DownloadRequest struct {
+		Size int
+	}
+)
+
+func (f *Files) Upload(req *Blob, res *UploadResponse) error {
+	res.Size = len(req.Data)
+	res.ContentType = req.ContentType
+	return nil
+}
+
+func (f *Files) Download(req *DownloadRequest, res *Blob) error {
+	res.ContentType = "application/x-test"
+	res.Data = bytes.Repeat([]byte{0xff}, req.Size)
+	return nil
+}
+
+func (f *Files) Echo(req *Blob, res *Blob) error {
+	*res = *req
+	return nil
+}
+
+func TestBlob(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Files{}))
+
+	// Record what is sent over the wire.
+	var reqLen, resLen int64
+	var reqType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqLen, reqType = r.ContentLength, r.Header.Get("Content-Type")
+		rec := httptest.NewRecorder()
+		s.Serve().ServeHTTP(rec, r)
+		resLen = int64(rec.Body.Len())
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		_, _ = w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	data := bytes.Repeat([]byte{0xff}, 1000)
+	up := &UploadResponse{}
+	require.NoError(t, c.Call(ctx, "Files.Upload", &Blob{ContentType: "image/png", Data: data}, up))
+	require.Equal(t, &UploadResponse{Size: 1000, ContentType: "image/png"}, up)
+	require.Equal(t, int64(1000), reqLen)
+	require.Equal(t, "image/png", reqType)
+
+	down := &Blob{}
+	require.NoError(t, c.Call(ctx, "Files.Download", &DownloadRequest{Size: 1000}, down))
+	require.Equal(t, "application/x-test", down.ContentType)
+	require.Equal(t, data, down.Data)
+	require.Equal(t, int64(1000), resLen)
+
+	echo := &Blob{}
+	require.NoError(t, c.Call(ctx, "Files.Echo", &Blob{Data: data}, echo))
+	require.Equal(t, data, echo.Data)
+	require.Equal(t, "application/octet-stream", echo.ContentType)
+
+	// Methods not taking blobs reject raw requests.
+	require.Error(t, c.Call(ctx, "Files.Download", &Blob{Data: data}, down))
+}
+
+func TestBlob_Message(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Files{}))
+	transport := func(ctx context.Context, msg []byte) ([]byte, error) {
+		return s.ServeMessage(ctx, msg), nil
+	}
+
+	// Blobs are encoded like other bodies over other transports.
+	res := &Blob{}
+	require.NoError(t, CallMessage(context.Background(), transport, JSONCodec{}, "Files.Echo", &Blob{ContentType: "text/plain", Data: []byte("hi")}, res))
+	require.Equal(t, &Blob{ContentType: "text/plain", Data: []byte("hi")}, res)
+}
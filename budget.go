@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"sync"
+	"time"
+)
+
+// RetryBudget limits the retries of calls to a ratio of the calls made
+// over a sliding window, so that retries by many callers can't multiply
+// the load on a server which is already failing. A budget can be shared by
+// the retry policies of several clients, to limit their retries together.
+type RetryBudget struct {
+	Ratio      float64       // retries allowed per call made, eg. 0.1
+	MinRetries int           // retries allowed per window regardless of the ratio
+	Window     time.Duration // defaults to 10s
+
+	mu      sync.Mutex
+	buckets [retryBudgetBuckets]retryBucket
+	current int       // index of the current bucket
+	start   time.Time // start of the current bucket
+}
+
+// DefaultRetryBudgetWindow is the window of RetryBudget.
+const DefaultRetryBudgetWindow = 10 * time.Second
+
+// retryBudgetBuckets is the number of buckets the window of a RetryBudget
+// is split into, the calls of the oldest one leaving it at once.
+const retryBudgetBuckets = 10
+
+type retryBucket struct {
+	calls, retries int
+}
+
+// Retries returns the number of retries made within the window.
+func (b *RetryBudget) Retries() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll(time.Now())
+	_, retries := b.count()
+	return retries
+}
+
+// call records a call, retries aside.
+func (b *RetryBudget) call() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll(time.Now())
+	b.buckets[b.current].calls++
+}
+
+// retry records a retry and returns true if the budget allows it.
+func (b *RetryBudget) retry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll(time.Now())
+	calls, retries := b.count()
+	if float64(retries+1) > float64(b.MinRetries)+b.Ratio*float64(calls) {
+		return false
+	}
+	b.buckets[b.current].retries++
+	return true
+}
+
+// count returns the calls and retries made within the window.
+func (b *RetryBudget) count() (calls, retries int) {
+	for _, bucket := range b.buckets {
+		calls += bucket.calls
+		retries += bucket.retries
+	}
+	return calls, retries
+}
+
+// roll moves the current bucket forward to now, emptying the buckets left
+// behind.
+func (b *RetryBudget) roll(now time.Time) {
+	window := b.Window
+	if window <= 0 {
+		window = DefaultRetryBudgetWindow
+	}
+	width := window / retryBudgetBuckets
+	if b.start.IsZero() {
+		b.start = now
+		return
+	}
+	for n := 0; now.Sub(b.start) >= width; n++ {
+		if n == retryBudgetBuckets {
+			b.buckets = [retryBudgetBuckets]retryBucket{}
+			b.start = now
+			return
+		}
+		b.current = (b.current + 1) % retryBudgetBuckets
+		b.buckets[b.current] = retryBucket{}
+		b.start = b.start.Add(width)
+	}
+}
@@ -0,0 +1,64 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryBudget(t *testing.T) {
+	flaky := &Flaky{}
+	s := New()
+	require.NoError(t, s.Register(flaky))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// Clients share the budget.
+	budget := &RetryBudget{Ratio: 0.5, MinRetries: 1}
+	policy := RetryPolicy{MaxAttempts: 2, Backoff: ConstantBackoff(time.Millisecond), Budget: budget}
+	c1, err := Dial(srv.URL, WithRetry(policy))
+	require.NoError(t, err)
+	c2, err := Dial(srv.URL, WithRetry(policy))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Successful calls add to the budget.
+	for _, c := range []*Client{c1, c2, c1, c2} {
+		require.NoError(t, c.Call(ctx, "Flaky.Add", &AddRequest{}, &AddResponse{}))
+	}
+	require.Equal(t, 0, budget.Retries())
+
+	// Which allows MinRetries, and a retry per two calls.
+	flaky.calls, flaky.rejects = 0, 1000
+	var rerr *Error
+	for _, c := range []*Client{c1, c2, c1, c2, c1, c2} {
+		err := c.Call(ctx, "Flaky.Add", &AddRequest{}, &AddResponse{})
+		require.True(t, errors.As(err, &rerr), "%v", err)
+	}
+	// 10 calls made allow 1+5 retries.
+	require.Equal(t, 6, budget.Retries())
+	require.Equal(t, 12, flaky.calls)
+}
+
+func TestRetryBudget_window(t *testing.T) {
+	b := &RetryBudget{Window: time.Second}
+	now := time.Now()
+	b.roll(now)
+	b.buckets[b.current].retries = 3
+	b.roll(now.Add(500 * time.Millisecond))
+	b.buckets[b.current].retries = 2
+	_, retries := b.count()
+	require.Equal(t, 5, retries)
+
+	// Retries leave the window with their bucket.
+	b.roll(now.Add(1050 * time.Millisecond))
+	_, retries = b.count()
+	require.Equal(t, 2, retries)
+	b.roll(now.Add(time.Hour))
+	_, retries = b.count()
+	require.Equal(t, 0, retries)
+}
@@ -0,0 +1,62 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+)
+
+// WithChecksums sends the CRC-32C checksum of the body of requests in
+// their envelope, which servers verify, and asks servers to send that of
+// responses, which the client verifies. Checksums of streamed and raw
+// bodies aren't sent.
+func WithChecksums() Option {
+	return func(o *clientOptions) {
+		o.checksums = true
+	}
+}
+
+type checksumKey struct{}
+
+// envelopeContext returns a context for which calls send checksums and
+// encrypt their bodies, if the client is configured to.
+func (c *Client) envelopeContext(ctx context.Context) context.Context {
+	if c.checksums {
+		ctx = context.WithValue(ctx, checksumKey{}, true)
+	}
+	if c.aead != nil {
+		ctx = context.WithValue(ctx, encryptionKey{}, c.aead)
+	}
+	return ctx
+}
+
+// checksum returns the checksum of a body sent in an envelope.
+func checksum(body []byte) string {
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.Checksum(body, crc32c))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyChecksum checks body matches the checksum of its envelope, if it
+// has one.
+func verifyChecksum(body []byte, sum string) error {
+	if sum == "" || sum == checksum(body) {
+		return nil
+	}
+	return &Error{
+		Code:    CodeChecksumMismatch,
+		Message: "body doesn't match its checksum, it was corrupted in transit",
+	}
+}
+
+// checksummed returns the response to req, with the checksum of its body
+// if req has one, copying res if needed.
+func checksummed(res *Response, req *Request) *Response {
+	if req.Checksum == "" || res == nil {
+		return res
+	}
+	out := *res
+	out.Checksum = checksum(out.Body)
+	return &out
+}
@@ -0,0 +1,93 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithChecksums(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// A proxy which corrupts the bodies it is told to.
+	var corruptRequest, corruptResponse bool
+	var (
+		sent     Request
+		received Response
+	)
+	corrupt := func(b []byte) []byte {
+		return bytes.Replace(b, []byte(`":2`), []byte(`":9`), 1)
+	}
+	httpClient := &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			sent, received = Request{}, Response{}
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			require.NoError(t, JSONCodec{}.Unmarshal(body, &sent))
+			if corruptRequest {
+				body = corrupt(body)
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			resp, err := http.DefaultTransport.RoundTrip(r)
+			if err != nil {
+				return nil, err
+			}
+			body, err = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			_ = JSONCodec{}.Unmarshal(body, &received)
+			if corruptResponse {
+				body = corrupt(body)
+			}
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+			resp.ContentLength = int64(len(body))
+			return resp, nil
+		}),
+	}
+	ctx := context.Background()
+
+	// Checksums are sent, and verified, both ways.
+	c, err := Dial(srv.URL, WithHTTPClient(httpClient), WithChecksums())
+	require.NoError(t, err)
+	res := &AddResponse{}
+	require.NoError(t, c.Call(ctx, "Math.Add", &AddRequest{A: 1, B: 1}, res))
+	require.Equal(t, 2, res.X)
+	require.Equal(t, checksum(sent.Body), sent.Checksum)
+	require.NotEmpty(t, sent.Checksum)
+	require.Equal(t, checksum(received.Body), received.Checksum)
+
+	// Corrupted requests are rejected.
+	corruptRequest = true
+	err = c.Call(ctx, "Math.Add", &AddRequest{A: 2, B: 1}, res)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeChecksumMismatch, rerr.Code)
+
+	// Corrupted responses fail the call.
+	corruptRequest, corruptResponse = false, true
+	err = c.Call(ctx, "Math.Add", &AddRequest{A: 1, B: 1}, res)
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeChecksumMismatch, rerr.Code)
+
+	// Clients without checksums get responses without them.
+	corruptResponse = false
+	c, err = Dial(srv.URL, WithHTTPClient(httpClient))
+	require.NoError(t, err)
+	require.NoError(t, c.Call(ctx, "Math.Add", &AddRequest{A: 1, B: 1}, res))
+	require.Empty(t, sent.Checksum)
+	require.Empty(t, received.Checksum)
+}
@@ -0,0 +1,299 @@
+package rpc
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Client calls methods of a remote Service.
+	Client struct {
+		httpClient   *http.Client
+		uri          string
+		codec        Codec
+		queue        *OfflineQueue
+		fallbacks    map[string]Fallback
+		loopback     *Service
+		direct       bool
+		id           string // sent as the ClientIDHeader
+		seq          uint64 // last Seq of the client's calls
+		versions     versionNegotiator
+		errorDecoder ErrorDecoder
+		retryPolicy  *RetryPolicy
+		checksums    bool
+		aead         cipher.AEAD
+	}
+	// Option configures a Client.
+	Option func(*clientOptions)
+	// clientOptions holds the configuration Dial builds the Client from.
+	clientOptions struct {
+		httpClient    *http.Client
+		tlsConfig     *tls.Config
+		dialTimeout   time.Duration
+		callTimeout   time.Duration
+		path          string
+		codec         Codec
+		queue         *OfflineQueue
+		fallbacks     map[string]Fallback
+		loopback      *Service
+		direct        bool
+		http2         *http.HTTP2Config
+		errorDecoder  ErrorDecoder
+		retry         *RetryPolicy
+		checksums     bool
+		aead          cipher.AEAD
+		signingKeyID  string
+		signingSecret []byte
+		sessions      bool
+	}
+	// Fallback serves a call locally, eg. from a cache or with defaults,
+	// when the server can't be reached.
+	Fallback func(ctx context.Context, reqBody, resBody interface{}) error
+)
+
+// WithHTTPClient uses the given http client to make calls, instead of one
+// constructed by Dial. TLS and dial options are ignored when it is used.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *clientOptions) {
+		o.httpClient = c
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for https targets.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *clientOptions) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithDialTimeout limits how long establishing a connection can take.
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *clientOptions) {
+		o.dialTimeout = d
+	}
+}
+
+// WithCallTimeout limits how long each call can take, including reading
+// the response.
+func WithCallTimeout(d time.Duration) Option {
+	return func(o *clientOptions) {
+		o.callTimeout = d
+	}
+}
+
+// WithReceiveWindow sets the HTTP/2 flow control windows of the client:
+// how many bytes of response bodies each stream, and all the streams of a
+// connection, can send before the client reads them. A window per stream
+// smaller than that of the connection keeps a stream of responses the
+// caller is slow to read from stalling the other calls multiplexed on the
+// connection.
+func WithReceiveWindow(stream, conn int) Option {
+	return func(o *clientOptions) {
+		o.http2 = &http.HTTP2Config{
+			MaxReceiveBufferPerStream:     stream,
+			MaxReceiveBufferPerConnection: conn,
+		}
+	}
+}
+
+// WithPath sets the HTTP path the service is served on, for unix and tcp
+// targets which don't otherwise have one. Defaults to "/".
+func WithPath(path string) Option {
+	return func(o *clientOptions) {
+		o.path = path
+	}
+}
+
+// WithCallCodec sets the codec calls are encoded with, which the service
+// must accept, see WithCodec and WithCodecs. Defaults to JSONCodec.
+func WithCallCodec(c Codec) Option {
+	return func(o *clientOptions) {
+		o.codec = c
+	}
+}
+
+// WithFallback serves calls to the method with f when the server can't be
+// reached. Calls the server rejects are not passed to f.
+func WithFallback(method string, f Fallback) Option {
+	return func(o *clientOptions) {
+		if o.fallbacks == nil {
+			o.fallbacks = map[string]Fallback{}
+		}
+		o.fallbacks[method] = f
+	}
+}
+
+// Dial returns a client calling the service at the given target.
+// Supported targets are:
+//   - http://host:port/path and https://host:port/path
+//   - tcp://host:port, plain HTTP over TCP
+//   - h2c://host:port, HTTP/2 over TCP without TLS, see WithH2C
+//   - unix:///path/to/socket, plain HTTP over a Unix socket
+//
+// Connections are established lazily, when making calls.
+func Dial(target string, opts ...Option) (*Client, error) {
+	o := &clientOptions{
+		path:  "/",
+		codec: JSONCodec{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("rpc: invalid target %q: %v", target, err)
+	}
+
+	dialer := &net.Dialer{
+		Timeout: o.dialTimeout,
+	}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     o.tlsConfig,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		HTTP2:               o.http2,
+	}
+
+	uri := ""
+	switch u.Scheme {
+	case "http", "https":
+		uri = u.String()
+	case "tcp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("rpc: invalid target %q: missing host", target)
+		}
+		uri = "http://" + u.Host + o.path
+	case "h2c":
+		if u.Host == "" {
+			return nil, fmt.Errorf("rpc: invalid target %q: missing host", target)
+		}
+		p := &http.Protocols{}
+		p.SetUnencryptedHTTP2(true)
+		transport.Protocols = p
+		uri = "http://" + u.Host + o.path
+	case "unix":
+		socket := u.Path
+		if socket == "" {
+			socket = u.Opaque
+		}
+		if socket == "" {
+			return nil, fmt.Errorf("rpc: invalid target %q: missing socket path", target)
+		}
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		uri = "http://unix" + o.path
+	default:
+		return nil, fmt.Errorf("rpc: unsupported target scheme %q", u.Scheme)
+	}
+
+	httpClient := o.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Transport: transport,
+			Timeout:   o.callTimeout,
+		}
+	}
+	if o.sessions {
+		httpClient = wrapTransport(httpClient, func(base http.RoundTripper) http.RoundTripper {
+			return &sessionTransport{base: base}
+		})
+	}
+	if o.signingSecret != nil {
+		httpClient = wrapTransport(httpClient, func(base http.RoundTripper) http.RoundTripper {
+			return &signingTransport{base: base, keyID: o.signingKeyID, secret: o.signingSecret}
+		})
+	}
+
+	return &Client{
+		httpClient:   httpClient,
+		uri:          uri,
+		codec:        o.codec,
+		queue:        o.queue,
+		fallbacks:    o.fallbacks,
+		loopback:     o.loopback,
+		direct:       o.direct,
+		id:           randomID(),
+		errorDecoder: o.errorDecoder,
+		retryPolicy:  o.retry,
+		checksums:    o.checksums,
+		aead:         o.aead,
+	}, nil
+}
+
+// wrapTransport returns a copy of c whose transport is wrapped by wrap.
+func wrapTransport(c *http.Client, wrap func(http.RoundTripper) http.RoundTripper) *http.Client {
+	wrapped := *c
+	base := wrapped.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped.Transport = wrap(base)
+	return &wrapped
+}
+
+// Call calls the given method, and decodes its result into resBody.
+// If the server can't be reached, the method's fallback is used, if any.
+func (c *Client) Call(ctx context.Context, method string, reqBody, resBody interface{}) error {
+	err := c.call(ctx, method, reqBody, resBody)
+	if f, ok := c.fallbacks[method]; ok && unreachable(err) {
+		return f(ctx, reqBody, resBody)
+	}
+	return err
+}
+
+// call calls the given method on the server.
+func (c *Client) call(ctx context.Context, method string, reqBody, resBody interface{}) error {
+	err := c.retry(ctx, func() error {
+		if m, ok := c.loopback.lookup(method); ok {
+			return c.callLoopback(ctx, m, reqBody, resBody)
+		}
+		ctx := c.envelopeContext(WithOutgoingHeader(ctx, ClientIDHeader, c.id))
+		return call(ctx, c.httpClient, c.codec, c.uri, method, c.nextSeq(), &c.versions, reqBody, resBody)
+	})
+	return c.errorDecoder.decode(err)
+}
+
+// nextSeq returns the Seq of the client's next call.
+func (c *Client) nextSeq() uint64 {
+	return atomic.AddUint64(&c.seq, 1)
+}
+
+type outgoingHeaderKey struct{}
+
+// WithOutgoingHeader returns a context which sets the given header on calls
+// made with it, eg. PriorityHeader.
+func WithOutgoingHeader(ctx context.Context, key, value string) context.Context {
+	h := http.Header{}
+	if parent, ok := ctx.Value(outgoingHeaderKey{}).(http.Header); ok {
+		h = parent.Clone()
+	}
+	h.Set(key, value)
+	return context.WithValue(ctx, outgoingHeaderKey{}, h)
+}
+
+// setOutgoingHeader sets the headers of ctx set with WithOutgoingHeader.
+func setOutgoingHeader(ctx context.Context, h http.Header) {
+	outgoing, _ := ctx.Value(outgoingHeaderKey{}).(http.Header)
+	for k, v := range outgoing {
+		h[k] = v
+	}
+}
+
+// Close closes any idle connections to the server.
+func (c *Client) Close() error {
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
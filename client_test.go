@@ -0,0 +1,190 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDial(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+
+	mux := http.NewServeMux()
+	mux.Handle("/rpc", s.Serve())
+
+	httpSrv := httptest.NewServer(mux)
+	defer httpSrv.Close()
+
+	tlsSrv := httptest.NewTLSServer(mux)
+	defer tlsSrv.Close()
+
+	socket := filepath.Join(t.TempDir(), "rpc.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	unixSrv := &httptest.Server{
+		Listener: l,
+		Config:   &http.Server{Handler: mux},
+	}
+	unixSrv.Start()
+	defer unixSrv.Close()
+
+	tests := []struct {
+		name   string
+		target string
+		opts   []Option
+	}{
+		{"http", httpSrv.URL + "/rpc", nil},
+		{"https", tlsSrv.URL + "/rpc", []Option{
+			WithTLSConfig(tlsSrv.Client().Transport.(*http.Transport).TLSClientConfig),
+		}},
+		{"tcp", "tcp://" + strings.TrimPrefix(httpSrv.URL, "http://"), []Option{
+			WithPath("/rpc"),
+		}},
+		{"unix", "unix://" + socket, []Option{
+			WithPath("/rpc"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Dial(tt.target, tt.opts...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			res := &AddResponse{}
+			err = c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res)
+			require.NoError(t, err)
+			require.Equal(t, 3, res.X)
+		})
+	}
+}
+
+func TestDial_InvalidTarget(t *testing.T) {
+	_, err := Dial("ftp://localhost")
+	require.Error(t, err)
+	_, err = Dial("unix://")
+	require.Error(t, err)
+}
+
+func TestClient_Fallback(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+
+	fallback := func(ctx context.Context, reqBody, resBody interface{}) error {
+		resBody.(*AddResponse).X = -1
+		return nil
+	}
+	c, err := Dial(srv.URL, WithFallback("Math.Add", fallback))
+	require.NoError(t, err)
+
+	res := &AddResponse{}
+	require.NoError(t, c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 3, res.X)
+
+	// Calls the server rejects don't fall back.
+	require.Error(t, c.Call(context.Background(), "Math.Add", "invalid", res))
+
+	srv.Close()
+	require.NoError(t, c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, -1, res.X)
+
+	// Methods without fallbacks fail.
+	require.Error(t, c.Call(context.Background(), "Math.Sub", &AddRequest{}, res))
+}
+
+func TestClient_Seq(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	var seqs []uint64
+	s.Use(func(next Handler) Handler {
+		return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+			seqs = append(seqs, req.Seq)
+			return next(ctx, m, req)
+		}
+	})
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	res := &AddResponse{}
+	require.NoError(t, c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.NoError(t, c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, []uint64{1, 2}, seqs)
+}
+
+func TestClient_CallCodec(t *testing.T) {
+	s := New(WithCodecs(gobCodec{}))
+	require.NoError(t, s.Register(&Math{}))
+	var contentTypes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+		s.Serve().ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	// Calls are encoded with the client's codec.
+	c, err := Dial(srv.URL, WithCallCodec(gobCodec{}))
+	require.NoError(t, err)
+	res := &AddResponse{}
+	require.NoError(t, c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 3, res.X)
+	require.Equal(t, []string{"application/x-gob"}, contentTypes)
+
+	// As are streams.
+	s = New(WithCodec(testCodec{}))
+	require.NoError(t, s.Register(&Ticker{}))
+	srv.Config.Handler = s.Serve()
+	c, err = Dial(srv.URL, WithCallCodec(testCodec{}))
+	require.NoError(t, err)
+	ticks := 0
+	for _, err := range CallStream[Tick](context.Background(), c, "Ticker.Ticks", &TickRequest{Count: 3}) {
+		require.NoError(t, err)
+		ticks++
+	}
+	require.Equal(t, 3, ticks)
+}
+
+func TestClient_ResponseMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  error
+	}{{
+		name:     "seq",
+		response: `{"ServiceMethod":"Math.Add","Seq":7,"Body":{"X":3}}`,
+		wantErr:  ErrResponseMismatch,
+	}, {
+		name:     "method",
+		response: `{"ServiceMethod":"Math.Sub","Seq":1,"Body":{"X":3}}`,
+		wantErr:  ErrResponseMismatch,
+	}, {
+		name:     "undecoded request error",
+		response: `{"Error":"request too large","Code":"request_too_large"}`,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.response))
+			}))
+			defer srv.Close()
+
+			c, err := Dial(srv.URL)
+			require.NoError(t, err)
+			err = c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, &AddResponse{})
+			require.Error(t, err)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NotErrorIs(t, err, ErrResponseMismatch)
+			}
+		})
+	}
+}
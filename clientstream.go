@@ -0,0 +1,245 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// RecvStream receives the messages of a method taking a stream of
+// requests. Methods taking a *RecvStream[T] in place of their request
+// receive messages of type T from the caller, sent with OpenClientStream,
+// and return a single response:
+//
+//	func (s *Store) Ingest(ctx context.Context, stream *rpc.RecvStream[Record], res *IngestResponse) error
+//
+// Over HTTP, the messages are sent as the NDJSONContentType request body,
+// one per line, with the method and Seq of the call in the MethodHeader
+// and SeqHeader. The request size limit applies to each message.
+type RecvStream[T any] struct {
+	r streamReader
+}
+
+// Recv returns the next message of the stream, or io.EOF once the caller
+// has closed it.
+func (s *RecvStream[T]) Recv(ctx context.Context) (T, error) {
+	var v T
+	if s.r == nil {
+		return v, errStreamNotOpen
+	}
+	if err := ctx.Err(); err != nil {
+		return v, err
+	}
+	if err := s.r.recv(&v); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+func (s *RecvStream[T]) openRecv(r streamReader) {
+	s.r = r
+}
+
+type (
+	// recvOpener is implemented by the request of methods taking a stream
+	// of requests, see RecvStream.
+	recvOpener interface {
+		openRecv(r streamReader)
+	}
+	// streamReader reads the messages of a stream from the caller.
+	streamReader interface {
+		recv(v interface{}) error
+	}
+	recvStreamKey struct{}
+)
+
+var typeOfRecvOpener = reflect.TypeOf((*recvOpener)(nil)).Elem()
+
+// ClientStreaming returns whether the method takes a stream of requests,
+// see RecvStream.
+func (m Method) ClientStreaming() bool {
+	return m.RequestType != nil && m.RequestType.Implements(typeOfRecvOpener)
+}
+
+// openRecvStream opens the stream of requests of a call to a method
+// taking one, reading its messages with the stream reader of ctx. Calls
+// made without streaming their requests fail.
+func openRecvStream(ctx context.Context, reqBody interface{}) error {
+	st, ok := reqBody.(recvOpener)
+	if !ok {
+		return nil
+	}
+	r, ok := ctx.Value(recvStreamKey{}).(streamReader)
+	if !ok {
+		return &Error{
+			Code:    CodeInvalidRequest,
+			Message: "method takes a stream of requests, call it with OpenClientStream",
+		}
+	}
+	st.openRecv(r)
+	return nil
+}
+
+// isStreamRequest returns whether the request body of r is a stream of
+// requests.
+func isStreamRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == NDJSONContentType
+}
+
+// streamRequest returns the request of a call whose request body is a
+// stream of requests, read by the method.
+func (s *Service) streamRequest(r *http.Request, method string) (*Request, error) {
+	if m, ok := s.method(method); !ok || !m.ClientStreaming() {
+		return nil, ErrMethodNotFound
+	}
+	body, err := s.codec.Marshal(struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	req := &Request{
+		ServiceMethod: method,
+		Body:          body,
+	}
+	if v := r.Header.Get(SeqHeader); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("rpc: invalid %s header: %v", SeqHeader, err)
+		}
+		req.Seq = seq
+	}
+	return req, nil
+}
+
+// httpRecvStream reads the messages of a stream of requests from the body
+// of an HTTP request, one per line.
+type httpRecvStream struct {
+	scanner *bufio.Scanner
+	codec   Codec
+	limit   int
+}
+
+// withRecvStream returns a context from which the method reads the
+// stream of requests of r, answered with w.
+func (s *Service) withRecvStream(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+	clearDeadlines(w, true)
+	s.trackStream(r.Context())
+	limit := maxFrameSize
+	if s.maxRequestSize > 0 && s.maxRequestSize < int64(limit) {
+		limit = int(s.maxRequestSize)
+	}
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, min(4096, limit)), limit)
+	st := &httpRecvStream{scanner: scanner, codec: s.codec, limit: limit}
+	return context.WithValue(ctx, recvStreamKey{}, streamReader(st))
+}
+
+func (st *httpRecvStream) recv(v interface{}) error {
+	for st.scanner.Scan() {
+		line := st.scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err := unmarshalBody(st.codec, line, v); err != nil {
+			return &Error{
+				Code:    CodeInvalidRequest,
+				Message: "Bad request",
+			}
+		}
+		return nil
+	}
+	err := st.scanner.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		return &Error{
+			Code:    CodeRequestTooLarge,
+			Message: fmt.Sprintf("request exceeds limit of %d bytes", st.limit),
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// ClientStream sends a stream of requests to a method taking one, see
+// RecvStream. The requests are sent as they are written, and the call
+// completes once the stream is closed.
+type ClientStream[T any] struct {
+	w     *io.PipeWriter
+	codec Codec
+	done  chan error
+
+	once sync.Once
+	err  error
+}
+
+// OpenClientStream calls a method taking a stream of requests, whose
+// response is decoded into resBody once the stream is closed.
+func OpenClientStream[T any](ctx context.Context, c *Client, method string, resBody interface{}) (*ClientStream[T], error) {
+	codec := c.codec
+	pr, pw := io.Pipe()
+	seq := c.nextSeq()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.uri, pr)
+	if err != nil {
+		return nil, fmt.Errorf("rpc: error creating request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", NDJSONContentType)
+	httpReq.Header.Set(MethodHeader, method)
+	httpReq.Header.Set(SeqHeader, strconv.FormatUint(seq, 10))
+	setTimeoutHeader(ctx, httpReq.Header)
+	setOutgoingHeader(WithOutgoingHeader(ctx, ClientIDHeader, c.id), httpReq.Header)
+
+	s := &ClientStream[T]{
+		w:     pw,
+		codec: codec,
+		done:  make(chan error, 1),
+	}
+	go func() {
+		s.done <- func() error {
+			defer pr.Close()
+			resp, err := c.httpClient.Do(httpReq)
+			if err != nil {
+				return fmt.Errorf("rpc: error sending request: %w", err)
+			}
+			defer resp.Body.Close()
+			c.versions.update(resp.Header)
+			resBytes, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return fmt.Errorf("rpc: error reading response body: %v", err)
+			}
+			return c.errorDecoder.decode(decodeReply(codec, resBytes, method, seq, resBody))
+		}()
+	}()
+	return s, nil
+}
+
+// Send sends a request of the stream. It fails if the call has already
+// completed, in which case Close returns its error.
+func (s *ClientStream[T]) Send(v T) error {
+	b, err := marshalBody(s.codec, v)
+	if err != nil {
+		return fmt.Errorf("rpc: error encoding request: %v", err)
+	}
+	if _, err := s.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("rpc: error sending request: %w", err)
+	}
+	return nil
+}
+
+// Close closes the stream and waits for the response of the call.
+func (s *ClientStream[T]) Close() error {
+	s.once.Do(func() {
+		s.w.Close() // nolint: errcheck
+		s.err = <-s.done
+	})
+	return s.err
+}
@@ -0,0 +1,96 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Ingester struct{}
+
+type (
+	Record struct {
+		Value int
+		Note  string
+	}
+	IngestResponse struct {
+		Count int
+		Sum   int
+	}
+)
+
+func (i *Ingester) Ingest(ctx context.Context, stream *RecvStream[Record], res *IngestResponse) error {
+	for {
+		rec, err := stream.Recv(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rec.Value < 0 {
+			return &Error{Code: CodeInvalidRequest, Message: "negative value"}
+		}
+		res.Count++
+		res.Sum += rec.Value
+	}
+}
+
+func TestOpenClientStream(t *testing.T) {
+	s := New(WithMaxRequestSize(200))
+	require.NoError(t, s.Register(&Ingester{}))
+	require.True(t, s.Methods["Ingester.Ingest"].ClientStreaming())
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// The response is returned once the stream is closed.
+	res := &IngestResponse{}
+	stream, err := OpenClientStream[Record](ctx, c, "Ingester.Ingest", res)
+	require.NoError(t, err)
+	for i := 1; i <= 100; i++ {
+		require.NoError(t, stream.Send(Record{Value: i}))
+	}
+	require.NoError(t, stream.Close())
+	require.Equal(t, &IngestResponse{Count: 100, Sum: 5050}, res)
+	require.NoError(t, stream.Close())
+
+	// Empty streams are fine.
+	res = &IngestResponse{}
+	stream, err = OpenClientStream[Record](ctx, c, "Ingester.Ingest", res)
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+	require.Equal(t, &IngestResponse{}, res)
+
+	// Errors of the method are returned by Close.
+	stream, err = OpenClientStream[Record](ctx, c, "Ingester.Ingest", &IngestResponse{})
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(Record{Value: 1}))
+	require.NoError(t, stream.Send(Record{Value: -1}))
+	var rerr *Error
+	err = stream.Close()
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+
+	// The size limit applies to each message.
+	stream, err = OpenClientStream[Record](ctx, c, "Ingester.Ingest", &IngestResponse{})
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(Record{Value: 1}))
+	_ = stream.Send(Record{Value: 1, Note: strings.Repeat("x", 300)})
+	err = stream.Close()
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeRequestTooLarge, rerr.Code)
+
+	// Streams of requests can't be sent as single requests.
+	err = c.Call(ctx, "Ingester.Ingest", &Record{}, &IngestResponse{})
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+}
@@ -0,0 +1,170 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// CloudEvents adapts one-way calls to CloudEvents, sent in structured
+	// JSON mode over HTTP. The type of events is the name of the method
+	// called, prefixed with TypePrefix.
+	CloudEvents struct {
+		Source     string // source of the events sent, a URI-reference
+		TypePrefix string // prefix of event types, eg. "com.example."
+	}
+	// CloudEvent is a CloudEvents 1.0 event in structured JSON mode.
+	CloudEvent struct {
+		SpecVersion     string          `json:"specversion"`
+		ID              string          `json:"id"`
+		Source          string          `json:"source"`
+		Type            string          `json:"type"`
+		Subject         string          `json:"subject,omitempty"`
+		Time            string          `json:"time,omitempty"`
+		DataContentType string          `json:"datacontenttype,omitempty"`
+		Data            json.RawMessage `json:"data,omitempty"`
+	}
+)
+
+// CloudEventsContentType is the content type of structured CloudEvents.
+const CloudEventsContentType = "application/cloudevents+json"
+
+// Event returns the event notifying method with the given data.
+func (c CloudEvents) Event(method string, data interface{}) (*CloudEvent, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("rpc: error encoding event data: %v", err)
+	}
+	return &CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              randomID(),
+		Source:          c.Source,
+		Type:            c.TypePrefix + method,
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		DataContentType: "application/json",
+		Data:            body,
+	}, nil
+}
+
+// Notify sends the event notifying method with the given data to the
+// CloudEvents endpoint at uri, without waiting for a result.
+func (c CloudEvents) Notify(ctx context.Context, httpClient *http.Client, uri string, method string, data interface{}) error {
+	event, err := c.Event(method, data)
+	if err != nil {
+		return err
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("rpc: error marshalling event: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(eventBytes))
+	if err != nil {
+		return fmt.Errorf("rpc: error creating request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", CloudEventsContentType)
+	setTimeoutHeader(ctx, httpReq.Header)
+	setOutgoingHeader(ctx, httpReq.Header)
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("rpc: error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	// Errors from CloudEventsHandler are responses, other endpoints only
+	// have a status.
+	resBytes, _ := ioutil.ReadAll(resp.Body)
+	res := Response{}
+	if err := json.Unmarshal(resBytes, &res); err != nil || res.Error == "" {
+		return fmt.Errorf("rpc: server: %s", resp.Status)
+	}
+	return fmt.Errorf("rpc: server: %w", &Error{
+		Code:    res.Code,
+		Message: res.Error,
+		Details: res.Details,
+	})
+}
+
+// CloudEventsHandler returns a handler accepting structured CloudEvents,
+// which calls the method named by the event type with the event data as
+// the request. Events are one-way, so responses are discarded and
+// accepted events are answered with 202 Accepted.
+// Events whose type doesn't start with the TypePrefix of c are rejected.
+func (s *Service) CloudEventsHandler(c CloudEvents) http.Handler {
+	codec := JSONCodec{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != CloudEventsContentType {
+			http.Error(w, "Unsupported media type", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, err := s.readRequest(r)
+		if err != nil {
+			writeError(w, codec, nil, err)
+			return
+		}
+		event := CloudEvent{}
+		if err := json.Unmarshal(body, &event); err != nil {
+			writeError(w, codec, nil, &Error{
+				Code:    CodeInvalidRequest,
+				Message: "invalid event: " + err.Error(),
+			})
+			return
+		}
+		if event.SpecVersion != "1.0" || event.ID == "" || event.Source == "" {
+			writeError(w, codec, nil, &Error{
+				Code:    CodeInvalidRequest,
+				Message: "invalid event: missing or unsupported attributes",
+			})
+			return
+		}
+		if ct, _, _ := mime.ParseMediaType(event.DataContentType); event.DataContentType != "" && ct != "application/json" {
+			writeError(w, codec, nil, &Error{
+				Code:    CodeInvalidRequest,
+				Message: "unsupported event data content type " + event.DataContentType,
+			})
+			return
+		}
+		if !strings.HasPrefix(event.Type, c.TypePrefix) {
+			writeError(w, codec, nil, &Error{
+				Code:    CodeInvalidRequest,
+				Message: "unsupported event type " + event.Type,
+			})
+			return
+		}
+
+		req := &Request{
+			ServiceMethod: strings.TrimPrefix(event.Type, c.TypePrefix),
+			Body:          event.Data,
+		}
+		if len(req.Body) == 0 {
+			req.Body = json.RawMessage("null")
+		}
+		if _, err := s.dispatch(r, req); err != nil {
+			if errors.Is(err, ErrMethodNotFound) {
+				err = &Error{
+					Code:    CodeInvalidRequest,
+					Message: "unsupported event type " + event.Type,
+				}
+			}
+			s.writeCodecError(w, r, codec, req, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
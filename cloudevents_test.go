@@ -0,0 +1,75 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Inbox struct {
+	received chan AddRequest
+}
+
+func (i *Inbox) Deliver(req *AddRequest, res *struct{}) error {
+	i.received <- *req
+	return nil
+}
+
+func TestCloudEvents(t *testing.T) {
+	inbox := &Inbox{received: make(chan AddRequest, 1)}
+	s := New()
+	require.NoError(t, s.Register(inbox))
+
+	ce := CloudEvents{Source: "/tests", TypePrefix: "com.example."}
+	srv := httptest.NewServer(s.CloudEventsHandler(ce))
+	defer srv.Close()
+
+	err := ce.Notify(context.Background(), http.DefaultClient, srv.URL, "Inbox.Deliver", &AddRequest{A: 1, B: 2})
+	require.NoError(t, err)
+	require.Equal(t, AddRequest{A: 1, B: 2}, <-inbox.received)
+
+	// Unknown methods are rejected.
+	err = ce.Notify(context.Background(), http.DefaultClient, srv.URL, "Inbox.Missing", &AddRequest{})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+
+	// So are events of other sources' types.
+	other := CloudEvents{Source: "/tests", TypePrefix: "org.example."}
+	err = other.Notify(context.Background(), http.DefaultClient, srv.URL, "Inbox.Deliver", &AddRequest{})
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+}
+
+func TestCloudEvents_Event(t *testing.T) {
+	ce := CloudEvents{Source: "/tests", TypePrefix: "com.example."}
+	event, err := ce.Event("Inbox.Deliver", &AddRequest{A: 1})
+	require.NoError(t, err)
+	require.Equal(t, "1.0", event.SpecVersion)
+	require.Len(t, event.ID, 32)
+	require.Equal(t, "/tests", event.Source)
+	require.Equal(t, "com.example.Inbox.Deliver", event.Type)
+	require.Equal(t, "application/json", event.DataContentType)
+	require.JSONEq(t, `{"A":1,"B":0}`, string(event.Data))
+
+	b, err := json.Marshal(event)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(b), `{"specversion":"1.0",`))
+}
+
+func TestService_CloudEventsHandler_ContentType(t *testing.T) {
+	s := New()
+	srv := httptest.NewServer(s.CloudEventsHandler(CloudEvents{}))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
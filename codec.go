@@ -0,0 +1,208 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+)
+
+// Codec encodes request and response envelopes, and their bodies.
+type Codec interface {
+	// ContentType is the media type of the encoded messages.
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is the default codec, encoding messages as JSON.
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// envelopeEncoder is implemented by codecs that encode response envelopes
+// around their body, rather than copying it, see writeResponse.
+type envelopeEncoder interface {
+	// encodeEnvelope returns the encoding of res before and after its
+	// body.
+	encodeEnvelope(res *Response) (head, tail []byte, err error)
+}
+
+// envelopeDecoder is implemented by codecs that decode request envelopes
+// as they read them, see decodeRequest.
+type envelopeDecoder interface {
+	decodeEnvelope(r io.Reader, req *Request) error
+}
+
+func (JSONCodec) decodeEnvelope(r io.Reader, req *Request) error {
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(req); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err != nil {
+			return err
+		}
+		return errors.New("rpc: data trailing request envelope")
+	}
+	return nil
+}
+
+func (JSONCodec) encodeEnvelope(res *Response) (head, tail []byte, err error) {
+	envelope := *res
+	envelope.Body = nil
+	b, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Strings are escaped, so the first match is the field of the
+	// envelope, which follows ServiceMethod.
+	field := []byte(`"Body":`)
+	i := bytes.Index(b, append(field, "null"...))
+	if i < 0 {
+		return nil, nil, errors.New("rpc: response envelope has no body")
+	}
+	i += len(field)
+	return b[:i], b[i+len("null"):], nil
+}
+
+// WithCodecs accepts requests encoded with any of codecs besides the
+// service's own, see WithCodec. Each request is decoded with the codec of
+// its Content-Type, and responded to in kind. Codecs for formats such as
+// msgpack or CBOR wrap the library of the application's choice.
+func WithCodecs(codecs ...Codec) ServiceOption {
+	return func(s *Service) {
+		if s.codecs == nil {
+			s.codecs = map[string]Codec{}
+		}
+		for _, c := range codecs {
+			s.codecs[mediaType(c.ContentType())] = c
+		}
+	}
+}
+
+type (
+	// typeChecker is implemented by codecs that can only encode some
+	// types. Methods whose bodies they can't encode fail to register.
+	typeChecker interface {
+		CheckType(t reflect.Type) error
+	}
+	codecKey struct{}
+)
+
+// checkTypes checks the codecs of the service can encode the given body
+// types.
+func (s *Service) checkTypes(types ...reflect.Type) error {
+	codecs := []Codec{s.codec}
+	for _, c := range s.codecs {
+		codecs = append(codecs, c)
+	}
+	for _, c := range codecs {
+		tc, ok := c.(typeChecker)
+		if !ok {
+			continue
+		}
+		for _, t := range types {
+			if err := tc.CheckType(t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// negotiateCodec returns the codec of the Content-Type of r, or that of
+// the service and false if it accepts no such codec.
+func (s *Service) negotiateCodec(r *http.Request) (Codec, bool) {
+	ct := mediaType(r.Header.Get("Content-Type"))
+	if ct == mediaType(s.codec.ContentType()) {
+		return s.codec, true
+	}
+	if c, ok := s.codecs[ct]; ok {
+		return c, true
+	}
+	return s.codec, false
+}
+
+// requestCodec returns the codec the request being served with ctx is
+// encoded with.
+func (s *Service) requestCodec(ctx context.Context) Codec {
+	if c, ok := ctx.Value(codecKey{}).(Codec); ok {
+		return c
+	}
+	return s.codec
+}
+
+// mediaType returns the media type of the Content-Type ct, without its
+// parameters.
+func mediaType(ct string) string {
+	if mt, _, err := mime.ParseMediaType(ct); err == nil {
+		return mt
+	}
+	return ct
+}
+
+type (
+	// Marshaler is implemented by bodies with an encoding of their own,
+	// such as a bespoke compact one, which bypasses the codec: the bytes
+	// MarshalRPC returns are carried as is, as a byte string of the codec.
+	Marshaler interface {
+		MarshalRPC() ([]byte, error)
+	}
+	// Unmarshaler is implemented by bodies that decode the bytes their
+	// MarshalRPC returned, see Marshaler.
+	Unmarshaler interface {
+		UnmarshalRPC(data []byte) error
+	}
+)
+
+// marshalBody encodes the body of a request or response with codec,
+// unless it's a Marshaler.
+func marshalBody(codec Codec, v interface{}) ([]byte, error) {
+	m, ok := v.(Marshaler)
+	if !ok {
+		return codec.Marshal(v)
+	}
+	b, err := m.MarshalRPC()
+	if err != nil {
+		return nil, err
+	}
+	return codec.Marshal(b)
+}
+
+// unmarshalBody decodes the body of a request or response into v with
+// codec, unless it's an Unmarshaler.
+func unmarshalBody(codec Codec, data []byte, v interface{}) error {
+	u, ok := v.(Unmarshaler)
+	if rv := reflect.ValueOf(v); !ok && rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		// Pointers to the pointers methods take.
+		if rv.Elem().Type().Implements(typeOfUnmarshaler) {
+			if rv.Elem().IsNil() {
+				rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+			}
+			u, ok = rv.Elem().Interface().(Unmarshaler)
+		}
+	}
+	if !ok {
+		return codec.Unmarshal(data, v)
+	}
+	var b []byte
+	if err := codec.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	return u.UnmarshalRPC(b)
+}
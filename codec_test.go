@@ -0,0 +1,164 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gobCodec stands in for binary codecs such as msgpack or CBOR.
+type gobCodec struct{}
+
+func (gobCodec) ContentType() string {
+	return "application/x-gob"
+}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func TestWithCodecs(t *testing.T) {
+	s := New(WithCodecs(gobCodec{}, testCodec{}))
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	post := func(codec Codec, contentType string, req *Request) (*http.Response, *Response) {
+		reqBytes, err := codec.Marshal(req)
+		require.NoError(t, err)
+		resp, err := http.Post(srv.URL, contentType, bytes.NewReader(reqBytes))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusUnsupportedMediaType {
+			return resp, nil
+		}
+		var buf bytes.Buffer
+		_, err = buf.ReadFrom(resp.Body)
+		require.NoError(t, err)
+		res := &Response{}
+		require.NoError(t, codec.Unmarshal(buf.Bytes(), res))
+		return resp, res
+	}
+
+	// Bodies are decoded with the codec of their Content-Type, and
+	// responses encoded to match.
+	body, err := gobCodec{}.Marshal(&AddRequest{A: 1, B: 2})
+	require.NoError(t, err)
+	resp, res := post(gobCodec{}, "application/x-gob", &Request{ServiceMethod: "Math.Add", Body: body, Seq: 1})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/x-gob", resp.Header.Get("Content-Type"))
+	require.Empty(t, res.Error)
+	sum := &AddResponse{}
+	require.NoError(t, gobCodec{}.Unmarshal(res.Body, sum))
+	require.Equal(t, 3, sum.X)
+
+	// As are errors.
+	resp, res = post(gobCodec{}, "application/x-gob", &Request{ServiceMethod: "Math.Sub", Body: body, Seq: 2})
+	require.Equal(t, "application/x-gob", resp.Header.Get("Content-Type"))
+	require.NotEmpty(t, res.Error)
+	require.Equal(t, CodeMethodNotFound, res.Code)
+
+	// Parameters of the Content-Type are ignored.
+	resp, res = post(testCodec{}, "application/x-test; charset=utf-8", &Request{ServiceMethod: "Math.Add", Body: []byte(`{"A":2,"B":2}`), Seq: 3})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{"X":4}`, string(res.Body))
+
+	// The service's own codec is still accepted, others aren't.
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	require.NoError(t, c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 1}, sum))
+	require.Equal(t, 2, sum.X)
+	resp, _ = post(JSONCodec{}, "application/cbor", &Request{ServiceMethod: "Math.Add"})
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
+
+// Point encodes itself in two bytes.
+type Point struct {
+	X, Y int8
+}
+
+func (p *Point) MarshalRPC() ([]byte, error) {
+	return []byte{byte(p.X), byte(p.Y)}, nil
+}
+
+func (p *Point) UnmarshalRPC(data []byte) error {
+	if len(data) != 2 {
+		return errors.New("invalid point")
+	}
+	p.X, p.Y = int8(data[0]), int8(data[1])
+	return nil
+}
+
+type Plane struct{}
+
+func (Plane) Mirror(req *Point, res *Point) error {
+	res.X, res.Y = -req.X, -req.Y
+	return nil
+}
+
+func TestMarshaler(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Plane{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	res := &Point{}
+	require.NoError(t, c.Call(context.Background(), "Plane.Mirror", &Point{X: 1, Y: -2}, res))
+	require.Equal(t, &Point{X: -1, Y: 2}, res)
+
+	// Bodies are carried as byte strings of the codec.
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(
+		`{"ServiceMethod":"Plane.Mirror","Body":"AwQ=","Seq":1}`,
+	))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var out Response
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	require.Equal(t, `"/fw="`, string(out.Body))
+
+	resp, err = http.Post(srv.URL, "application/json", strings.NewReader(
+		`{"ServiceMethod":"Plane.Mirror","Body":"AQ==","Seq":2}`,
+	))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	require.Equal(t, "string", s.Methods["Plane.Mirror"].JSONSchemas().Request.Type)
+}
+
+func TestJSONCodec_encodeEnvelope(t *testing.T) {
+	for _, res := range []*Response{
+		{ServiceMethod: "Math.Add", Body: []byte(`{"X":3}`), Seq: 1},
+		{ServiceMethod: `"Body":null`, Body: []byte(`[1,2]`), Seq: 2},
+		{ServiceMethod: "Math.Add", Body: []byte(`"x"`), Version: 2, Metadata: map[string]string{"k": "v"}, More: true},
+	} {
+		head, tail, err := JSONCodec{}.encodeEnvelope(res)
+		require.NoError(t, err)
+		want, err := json.Marshal(res)
+		require.NoError(t, err)
+		got := append(append(append([]byte{}, head...), res.Body...), tail...)
+		require.Equal(t, string(want), string(got))
+	}
+
+	// Responses are written around their body.
+	w := httptest.NewRecorder()
+	require.NoError(t, writeResponse(w, JSONCodec{}, &Response{ServiceMethod: "Math.Add", Body: []byte(`{"X":3}`)}))
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.JSONEq(t, `{"ServiceMethod":"Math.Add","Body":{"X":3},"Seq":0,"Error":"","Code":""}`, w.Body.String())
+}
@@ -0,0 +1,247 @@
+package rpc
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// MethodControl lets operators disable methods and adjust their limits
+	// at runtime, eg. to mitigate incidents without redeploying.
+	MethodControl struct {
+		mu       sync.Mutex
+		methods  map[string]*MethodStatus
+		inFlight map[string]int
+	}
+	// MethodStatus is the runtime configuration of a method.
+	MethodStatus struct {
+		Method      string
+		Disabled    bool
+		Reason      string        `json:",omitempty"` // why the method is disabled
+		MaxInFlight int           `json:",omitempty"` // concurrent calls allowed, if set
+		Timeout     time.Duration `json:",omitempty"` // overrides the method's timeout, if set
+	}
+	// methodControlAdmin exposes a MethodControl as methods.
+	methodControlAdmin struct {
+		c *MethodControl
+		s *Service
+	}
+)
+
+// controlService is the name the method control admin methods are
+// registered under, in the namespace reserved to the package.
+const controlService = "rpc.Methods"
+
+// reservedPrefix is the prefix of the names of the methods the package
+// registers, such as rpc.Ping, which can't be disabled or limited.
+const reservedPrefix = "rpc."
+
+// Middleware returns the middleware enforcing the runtime configuration
+// of methods. Calls to disabled methods fail with CodeDisabled, and calls
+// over a method's MaxInFlight with CodeUnavailable.
+func (c *MethodControl) Middleware(next Handler) Handler {
+	return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		if strings.HasPrefix(m.Name, reservedPrefix) {
+			return next(ctx, m, req)
+		}
+
+		c.mu.Lock()
+		st := c.methods[m.Name]
+		if st == nil {
+			c.mu.Unlock()
+			return next(ctx, m, req)
+		}
+		if st.Disabled {
+			c.mu.Unlock()
+			err := &Error{
+				Code:    CodeDisabled,
+				Message: "method " + m.Name + " is disabled",
+			}
+			if st.Reason != "" {
+				err.Details = map[string]string{"reason": st.Reason}
+			}
+			return nil, err
+		}
+		if st.MaxInFlight > 0 && c.inFlight[m.Name] >= st.MaxInFlight {
+			c.mu.Unlock()
+			return nil, &Error{
+				Code:    CodeUnavailable,
+				Message: "too many concurrent calls to " + m.Name,
+			}
+		}
+		if st.Timeout > 0 {
+			m.Timeout = st.Timeout
+		}
+		if c.inFlight == nil {
+			c.inFlight = map[string]int{}
+		}
+		c.inFlight[m.Name]++
+		c.mu.Unlock()
+
+		defer func() {
+			c.mu.Lock()
+			c.inFlight[m.Name]--
+			c.mu.Unlock()
+		}()
+		return next(ctx, m, req)
+	}
+}
+
+// Disable makes calls to the method fail with CodeDisabled, with the
+// given reason.
+func (c *MethodControl) Disable(method, reason string) {
+	c.update(method, func(st *MethodStatus) {
+		st.Disabled = true
+		st.Reason = reason
+	})
+}
+
+// Enable re-enables the method.
+func (c *MethodControl) Enable(method string) {
+	c.update(method, func(st *MethodStatus) {
+		st.Disabled = false
+		st.Reason = ""
+	})
+}
+
+// SetLimits sets the maximum number of concurrent calls to the method and
+// overrides its timeout. Zero values remove the limits.
+func (c *MethodControl) SetLimits(method string, maxInFlight int, timeout time.Duration) {
+	c.update(method, func(st *MethodStatus) {
+		st.MaxInFlight = maxInFlight
+		st.Timeout = timeout
+	})
+}
+
+// Status returns the runtime configuration of the methods that have one,
+// sorted by method.
+func (c *MethodControl) Status() []MethodStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := make([]MethodStatus, 0, len(c.methods))
+	for _, st := range c.methods {
+		status = append(status, *st)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Method < status[j].Method
+	})
+	return status
+}
+
+func (c *MethodControl) update(method string, fn func(st *MethodStatus)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.methods == nil {
+		c.methods = map[string]*MethodStatus{}
+	}
+	st, ok := c.methods[method]
+	if !ok {
+		st = &MethodStatus{Method: method}
+	}
+	fn(st)
+	if *st == (MethodStatus{Method: method}) {
+		delete(c.methods, method)
+		return
+	}
+	c.methods[method] = st
+}
+
+// RegisterAdmin registers methods managing the runtime configuration of
+// the service's methods, as "rpc.Methods.Disable", "rpc.Methods.Enable",
+// "rpc.Methods.SetLimits" and "rpc.Methods.Status", with the options
+// applied to each of them. The options must require roles, see WithRoles,
+// that the service's Authorizer enforces, and callers must be
+// authenticated, see WithPrincipal. The methods of the package, under
+// "rpc.", can't be disabled or limited.
+func (c *MethodControl) RegisterAdmin(s *Service, opts ...MethodOption) error {
+	if err := requireAdminRoles(s, "managing methods", opts); err != nil {
+		return err
+	}
+	if err := s.RegisterName(controlService, &methodControlAdmin{c: c, s: s}); err != nil {
+		return err
+	}
+	for _, name := range []string{"Disable", "Enable", "SetLimits", "Status"} {
+		if err := s.Configure(controlService+"."+name, opts...); err != nil {
+			return err
+		}
+	}
+	return s.Configure(controlService+".Status", WithReadOnly())
+}
+
+func (a *methodControlAdmin) Disable(ctx context.Context, req *MethodStatus, res *MethodStatus) error {
+	if err := requirePrincipal(ctx, "managing methods"); err != nil {
+		return err
+	}
+	method, err := a.check(req.Method)
+	if err != nil {
+		return err
+	}
+	a.c.Disable(method, req.Reason)
+	*res = a.status(method)
+	return nil
+}
+
+func (a *methodControlAdmin) Enable(ctx context.Context, req *MethodStatus, res *MethodStatus) error {
+	if err := requirePrincipal(ctx, "managing methods"); err != nil {
+		return err
+	}
+	method, err := a.check(req.Method)
+	if err != nil {
+		return err
+	}
+	a.c.Enable(method)
+	*res = a.status(method)
+	return nil
+}
+
+func (a *methodControlAdmin) SetLimits(ctx context.Context, req *MethodStatus, res *MethodStatus) error {
+	if err := requirePrincipal(ctx, "managing methods"); err != nil {
+		return err
+	}
+	method, err := a.check(req.Method)
+	if err != nil {
+		return err
+	}
+	if req.MaxInFlight < 0 || req.Timeout < 0 {
+		return &Error{
+			Code:    CodeInvalidRequest,
+			Message: "limits can't be negative",
+		}
+	}
+	a.c.SetLimits(method, req.MaxInFlight, req.Timeout)
+	*res = a.status(method)
+	return nil
+}
+
+func (a *methodControlAdmin) Status(ctx context.Context, req *struct{}, res *[]MethodStatus) error {
+	if err := requirePrincipal(ctx, "managing methods"); err != nil {
+		return err
+	}
+	*res = a.c.Status()
+	return nil
+}
+
+// check returns the name of the method, or an error if it can't be
+// managed.
+func (a *methodControlAdmin) check(method string) (string, error) {
+	m, ok := a.s.method(method)
+	if !ok || strings.HasPrefix(m.Name, reservedPrefix) {
+		return "", &Error{
+			Code:    CodeInvalidRequest,
+			Message: "unknown method " + method,
+		}
+	}
+	return m.Name, nil
+}
+
+func (a *methodControlAdmin) status(method string) MethodStatus {
+	for _, st := range a.c.Status() {
+		if st.Method == method {
+			return st
+		}
+	}
+	return MethodStatus{Method: method}
+}
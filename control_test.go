@@ -0,0 +1,116 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMethodControl(t *testing.T) {
+	control := &MethodControl{}
+	s := New(
+		WithAuthorizer(RoleAuthorizer{}),
+		WithMiddleware(control.Middleware),
+	)
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Register(&Clock{}))
+	require.NoError(t, control.RegisterAdmin(s, WithRoles("admin")))
+
+	admin := WithPrincipal(context.Background(), Principal{Subject: "ops", Roles: []string{"admin"}})
+	call := func(ctx context.Context, method string, req interface{}) (*Response, error) {
+		body, err := json.Marshal(req)
+		require.NoError(t, err)
+		return s.callContext(ctx, &Request{ServiceMethod: method, Body: body})
+	}
+	code := func(err error) string {
+		var rerr *Error
+		require.True(t, errors.As(err, &rerr), "%v", err)
+		return rerr.Code
+	}
+
+	// Admin methods need the admin role.
+	_, err := call(context.Background(), "rpc.Methods.Disable", &MethodStatus{Method: "Math.Add"})
+	require.Equal(t, CodePermissionDenied, code(err))
+
+	// Disabled methods fail with a specific error.
+	_, err = call(admin, "rpc.Methods.Disable", &MethodStatus{Method: "Math.Add", Reason: "incident"})
+	require.NoError(t, err)
+	_, err = call(context.Background(), "Math.Add", &AddRequest{})
+	require.Equal(t, CodeDisabled, code(err))
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, map[string]string{"reason": "incident"}, rerr.Details)
+
+	res, err := call(admin, "rpc.Methods.Status", &struct{}{})
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"Method":"Math.Add","Disabled":true,"Reason":"incident"}]`, string(res.Body))
+
+	_, err = call(admin, "rpc.Methods.Enable", &MethodStatus{Method: "Math.Add"})
+	require.NoError(t, err)
+	_, err = call(context.Background(), "Math.Add", &AddRequest{})
+	require.NoError(t, err)
+	require.Empty(t, control.Status())
+
+	// Limits apply at runtime.
+	_, err = call(admin, "rpc.Methods.SetLimits", &MethodStatus{Method: "Clock.Remaining", Timeout: time.Minute})
+	require.NoError(t, err)
+	res, err = call(context.Background(), "Clock.Remaining", &RemainingRequest{})
+	require.NoError(t, err)
+	require.Contains(t, string(res.Body), `"Deadline":true`)
+
+	// Unknown methods, and those of the package, can't be managed.
+	_, err = call(admin, "rpc.Methods.Disable", &MethodStatus{Method: "Math.Missing"})
+	require.Equal(t, CodeInvalidRequest, code(err))
+	_, err = call(admin, "rpc.Methods.Disable", &MethodStatus{Method: "rpc.Methods.Enable"})
+	require.Equal(t, CodeInvalidRequest, code(err))
+	_, err = call(admin, "rpc.Methods.Disable", &MethodStatus{Method: "rpc.Ping"})
+	require.Equal(t, CodeInvalidRequest, code(err))
+}
+
+func TestMethodControl_MaxInFlight(t *testing.T) {
+	control := &MethodControl{}
+	control.SetLimits("Clock.Sleep", 1, 0)
+	s := New(WithMiddleware(control.Middleware))
+	require.NoError(t, s.Register(&Clock{}))
+
+	done := make(chan error)
+	go func() {
+		_, err := s.callContext(context.Background(), &Request{ServiceMethod: "Clock.Sleep", Body: []byte(`100000000`)})
+		done <- err
+	}()
+	require.Eventually(t, func() bool {
+		control.mu.Lock()
+		defer control.mu.Unlock()
+		return control.inFlight["Clock.Sleep"] == 1
+	}, time.Second, time.Millisecond)
+
+	_, err := s.callContext(context.Background(), &Request{ServiceMethod: "Clock.Sleep", Body: []byte(`0`)})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeUnavailable, rerr.Code)
+	require.NoError(t, <-done)
+}
+
+func TestMethodControl_RegisterAdmin(t *testing.T) {
+	control := &MethodControl{}
+
+	// Admin methods are denied unless they require roles.
+	require.Error(t, control.RegisterAdmin(New()))
+	require.Error(t, control.RegisterAdmin(New(), WithRoles("admin")))
+	require.Error(t, control.RegisterAdmin(New(WithAuthorizer(RoleAuthorizer{}))))
+
+	// And don't replace the services of users.
+	s := New(WithAuthorizer(RoleAuthorizer{}), WithMiddleware(control.Middleware))
+	require.NoError(t, s.RegisterName("Admin", &Math{}))
+	require.NoError(t, control.RegisterAdmin(s, WithRoles("admin")))
+	require.Contains(t, s.Methods, "Admin.Add")
+	control.Disable("Admin.Add", "")
+	_, err := s.callContext(context.Background(), &Request{ServiceMethod: "Admin.Add", Body: []byte(`{}`)})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeDisabled, rerr.Code)
+}
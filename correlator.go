@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+)
+
+// Correlator makes calls over asynchronous transports, where requests are
+// sent one way and responses arrive separately, eg. Kafka or MQTT request
+// and reply topics. Each call gets a Seq, which the service echoes in its
+// response, and waits until Deliver is given a response with it. Seqs
+// start at a random value, so correlators sharing a reply topic tell their
+// responses apart.
+// On the service side, requests are handled with ServeMessage and the
+// result sent to the reply topic.
+type Correlator struct {
+	// Send sends an encoded request envelope, without waiting for the
+	// response.
+	Send  func(ctx context.Context, msg []byte) error
+	Codec Codec // defaults to JSONCodec
+	// Version is the envelope protocol version of requests, 1 if unset.
+	// With version 2, calls carry their headers, deadline and trace.
+	Version int
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]chan []byte
+}
+
+// Call calls the method, and waits for its response to be delivered or for
+// ctx to be done.
+func (c *Correlator) Call(ctx context.Context, method string, reqBody, resBody interface{}) error {
+	codec := c.codec()
+
+	c.mu.Lock()
+	if c.pending == nil {
+		c.pending = map[uint64]chan []byte{}
+		c.seq = rand.Uint64()
+	}
+	c.seq++
+	if c.seq == 0 {
+		// Seq 0 is that of errors of requests that couldn't be decoded.
+		c.seq++
+	}
+	seq := c.seq
+	ch := make(chan []byte, 1)
+	c.pending[seq] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, seq)
+		c.mu.Unlock()
+	}()
+
+	reqBytes, err := encodeCall(ctx, codec, method, reqBody, seq, c.Version)
+	if err != nil {
+		return err
+	}
+	if err := c.Send(ctx, reqBytes); err != nil {
+		return fmt.Errorf("rpc: error sending request: %v", err)
+	}
+
+	select {
+	case resBytes := <-ch:
+		return decodeReply(codec, resBytes, method, seq, resBody)
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+}
+
+// Deliver passes a response envelope received from the transport to the
+// call waiting on it. Responses of calls no longer waiting are dropped.
+// Errors of requests the service couldn't decode don't echo their Seq, and
+// fail every waiting call.
+func (c *Correlator) Deliver(msg []byte) error {
+	res := Response{}
+	if err := c.codec().Unmarshal(msg, &res); err != nil {
+		return fmt.Errorf("rpc: error reading response: %v", err)
+	}
+
+	c.mu.Lock()
+	if res.Seq == 0 && res.Error != "" && res.ServiceMethod == "" {
+		for seq, ch := range c.pending {
+			delete(c.pending, seq)
+			ch <- msg
+		}
+		c.mu.Unlock()
+		return nil
+	}
+	ch, ok := c.pending[res.Seq]
+	delete(c.pending, res.Seq)
+	c.mu.Unlock()
+	if ok {
+		ch <- msg
+	}
+	return nil
+}
+
+func (c *Correlator) codec() Codec {
+	if c.Codec == nil {
+		return JSONCodec{}
+	}
+	return c.Codec
+}
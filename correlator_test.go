@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorrelator(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+
+	// Request and reply topics, with the service consuming requests.
+	requests := make(chan []byte, 10)
+	c := &Correlator{
+		Send: func(ctx context.Context, msg []byte) error {
+			requests <- msg
+			return nil
+		},
+	}
+	go func() {
+		for msg := range requests {
+			require.NoError(t, c.Deliver(s.ServeMessage(context.Background(), msg)))
+		}
+	}()
+	defer close(requests)
+
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			res := &AddResponse{}
+			err := c.Call(context.Background(), "Math.Add", &AddRequest{A: i, B: i}, res)
+			if err == nil && res.X != 2*i {
+				err = errors.New("mismatched response")
+			}
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, <-errs)
+	}
+}
+
+func TestCorrelator_Timeout(t *testing.T) {
+	c := &Correlator{
+		Send: func(ctx context.Context, msg []byte) error {
+			return nil
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := c.Call(ctx, "Math.Add", &AddRequest{}, &AddResponse{})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeDeadlineExceeded, rerr.Code)
+	require.Empty(t, c.pending)
+
+	// Late responses are dropped.
+	require.NoError(t, c.Deliver([]byte(`{"Seq":1}`)))
+}
+
+func TestCorrelator_Seq(t *testing.T) {
+	seqs := make(chan uint64, 2)
+	send := func(ctx context.Context, msg []byte) error {
+		req := Request{}
+		require.NoError(t, JSONCodec{}.Unmarshal(msg, &req))
+		seqs <- req.Seq
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Correlators sharing a reply topic don't reuse each other's Seqs.
+	a, b := &Correlator{Send: send}, &Correlator{Send: send}
+	_ = a.Call(ctx, "Math.Add", &AddRequest{}, &AddResponse{})
+	_ = b.Call(ctx, "Math.Add", &AddRequest{}, &AddResponse{})
+	require.NotEqual(t, <-seqs, <-seqs)
+}
+
+func TestCorrelator_BadRequest(t *testing.T) {
+	s := New()
+	c := &Correlator{}
+	c.Send = func(ctx context.Context, msg []byte) error {
+		// The request is mangled on its way to the service.
+		go c.Deliver(s.ServeMessage(ctx, msg[1:])) // nolint: errcheck
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := c.Call(ctx, "Math.Add", &AddRequest{}, &AddResponse{})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+}
@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TimeoutHeader carries the time in milliseconds the caller is willing to
+// wait for a call. Servers subtract the time they have spent on the call
+// before passing the remaining time on to any calls they make.
+const TimeoutHeader = "Rpc-Timeout"
+
+// WithTimeout limits how long calls to the method can take.
+// Once the timeout passes, the context passed to the method is canceled and
+// the call fails with CodeDeadlineExceeded, without waiting for the method
+// to return.
+func WithTimeout(d time.Duration) MethodOption {
+	return func(m *Method) {
+		m.Timeout = d
+	}
+}
+
+// setTimeoutHeader sets the timeout header to the time remaining until the
+// deadline of ctx, if any.
+func setTimeoutHeader(ctx context.Context, h http.Header) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	ms := time.Until(deadline).Milliseconds()
+	if ms < 0 {
+		ms = 0
+	}
+	h.Set(TimeoutHeader, strconv.FormatInt(ms, 10))
+}
+
+// contextWithTimeoutHeader returns a context that is done once the timeout
+// of the timeout header, if any, has passed.
+func contextWithTimeoutHeader(ctx context.Context, h http.Header) (context.Context, context.CancelFunc) {
+	v := h.Get(TimeoutHeader)
+	if v == "" {
+		return ctx, func() {}
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || ms < 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+}
+
+// contextError converts a context error into an rpc error.
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &Error{
+			Code:    CodeDeadlineExceeded,
+			Message: "deadline exceeded",
+		}
+	}
+	return &Error{
+		Code:    CodeCanceled,
+		Message: "call canceled",
+	}
+}
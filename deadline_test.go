@@ -0,0 +1,96 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	Clock             struct{}
+	RemainingRequest  struct{}
+	RemainingResponse struct {
+		Remaining time.Duration
+		Deadline  bool
+	}
+)
+
+func (c *Clock) Remaining(ctx context.Context, req *RemainingRequest, res *RemainingResponse) error {
+	deadline, ok := ctx.Deadline()
+	res.Deadline = ok
+	res.Remaining = time.Until(deadline)
+	return nil
+}
+
+func TestService_CallContext_Deadline(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Clock{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// No deadline.
+	res := &RemainingResponse{}
+	err := s.Call(http.DefaultClient, srv.URL, "Clock.Remaining", &RemainingRequest{}, res)
+	require.NoError(t, err)
+	require.False(t, res.Deadline)
+
+	// Deadline is propagated.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = s.CallContext(ctx, http.DefaultClient, srv.URL, "Clock.Remaining", &RemainingRequest{}, res)
+	require.NoError(t, err)
+	require.True(t, res.Deadline)
+	require.True(t, res.Remaining <= time.Minute)
+	require.True(t, res.Remaining > 50*time.Second)
+}
+
+func TestService_Serve_DeadlineExceeded(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Clock{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			r.Header.Set(TimeoutHeader, "0")
+			return http.DefaultTransport.RoundTrip(r)
+		}),
+	}
+	err := s.Call(client, srv.URL, "Clock.Remaining", &RemainingRequest{}, &RemainingResponse{})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeDeadlineExceeded, rerr.Code)
+}
+
+func (c *Clock) Sleep(ctx context.Context, req *time.Duration, res *RemainingResponse) error {
+	time.Sleep(*req)
+	return nil
+}
+
+func TestService_Serve_MethodTimeout(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Clock{}))
+	require.NoError(t, s.Configure("Clock.Remaining", WithTimeout(time.Second)))
+	require.NoError(t, s.Configure("Clock.Sleep", WithTimeout(10*time.Millisecond)))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	res := &RemainingResponse{}
+	err := s.Call(http.DefaultClient, srv.URL, "Clock.Remaining", &RemainingRequest{}, res)
+	require.NoError(t, err)
+	require.True(t, res.Deadline)
+	require.True(t, res.Remaining <= time.Second)
+
+	d := time.Second
+	start := time.Now()
+	err = s.Call(http.DefaultClient, srv.URL, "Clock.Sleep", &d, res)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeDeadlineExceeded, rerr.Code)
+	require.True(t, time.Since(start) < d)
+}
@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ClientIDHeader is the request header carrying the identifier of the
+// client making a call, which Clients set. Together with the Seq of the
+// call it identifies the call, see Deduplication.
+const ClientIDHeader = "Rpc-Client-Id"
+
+// Deduplication detects calls delivered more than once, eg. resent by a
+// client or redelivered by a proxy or message broker, by the Seq and
+// ClientIDHeader of their request. Duplicates are given the response of
+// the first delivery, or rejected. Unlike Idempotency, callers don't need
+// to opt in, but calls are only deduplicated within a short window.
+// Calls without a client identifier, and to read-only methods, are always
+// executed.
+type Deduplication struct {
+	Store  IdempotencyStore // defaults to an in-memory store
+	Window time.Duration    // how long deliveries are remembered, defaults to 5m
+	// Reject makes duplicates fail with CodeAborted instead of being given
+	// the response of the first delivery.
+	Reject bool
+
+	once  sync.Once
+	store IdempotencyStore
+}
+
+// Middleware returns the middleware suppressing duplicate deliveries.
+// Duplicates delivered while the first delivery is in progress fail with
+// CodeUnavailable. Failed calls are not recorded, so they can be retried.
+func (d *Deduplication) Middleware(next Handler) Handler {
+	return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		client := HeaderFromContext(ctx).Get(ClientIDHeader)
+		if client == "" || m.ReadOnly {
+			return next(ctx, m, req)
+		}
+		// Seqs are only unique to a client, so other methods and callers
+		// claiming the same client identifier get their own keys.
+		p, _ := PrincipalFromContext(ctx)
+		key := "seq/" + m.Name + "/" + p.Subject + "/" + client + "/" + strconv.FormatUint(req.Seq, 10)
+
+		store := d.getStore()
+		window := d.Window
+		if window <= 0 {
+			window = 5 * time.Minute
+		}
+		// Deliveries are told apart by their Seq, so their bodies aren't
+		// hashed.
+		start, res, err := store.Begin(ctx, key, "", window)
+		if err != nil {
+			return nil, err
+		}
+		if !start && d.Reject {
+			return nil, &Error{
+				Code:    CodeAborted,
+				Message: "duplicate call",
+			}
+		}
+		if res != nil {
+			return res, nil
+		}
+		if !start {
+			return nil, &Error{
+				Code:    CodeUnavailable,
+				Message: "the call is already in progress",
+			}
+		}
+
+		res, err = next(ctx, m, req)
+		if err != nil {
+			_ = store.Abort(ctx, key)
+			return nil, err
+		}
+		if err := store.Complete(ctx, key, res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+func (d *Deduplication) getStore() IdempotencyStore {
+	d.once.Do(func() {
+		d.store = d.Store
+		if d.store == nil {
+			d.store = NewMemoryIdempotencyStore()
+		}
+	})
+	return d.store
+}
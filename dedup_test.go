@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func clientContext(client string) context.Context {
+	h := http.Header{}
+	h.Set(ClientIDHeader, client)
+	return context.WithValue(context.Background(), headerKey{}, h)
+}
+
+func TestDeduplication(t *testing.T) {
+	counter := &Counter{}
+	s := New(WithMiddleware((&Deduplication{}).Middleware))
+	require.NoError(t, s.Register(counter))
+
+	call := func(ctx context.Context, seq uint64) (*Response, error) {
+		return s.callContext(ctx, &Request{
+			ServiceMethod: "Counter.Inc",
+			Body:          []byte(`{}`),
+			Seq:           seq,
+		})
+	}
+
+	// Duplicates are given the first response.
+	res, err := call(clientContext("a"), 1)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":1}`, string(res.Body))
+	res, err = call(clientContext("a"), 1)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":1}`, string(res.Body))
+	require.Equal(t, 1, counter.calls)
+
+	// Other calls, of the same or other clients, are executed.
+	_, err = call(clientContext("a"), 2)
+	require.NoError(t, err)
+	_, err = call(clientContext("b"), 1)
+	require.NoError(t, err)
+	_, err = call(context.Background(), 1)
+	require.NoError(t, err)
+	_, err = call(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, 5, counter.calls)
+
+	// As are those of other callers claiming the same client.
+	_, err = call(WithPrincipal(clientContext("a"), Principal{Subject: "mallory"}), 1)
+	require.NoError(t, err)
+	require.Equal(t, 6, counter.calls)
+
+	// Failed calls can be retried.
+	counter.fail = true
+	_, err = call(clientContext("a"), 3)
+	require.Error(t, err)
+	counter.fail = false
+	_, err = call(clientContext("a"), 3)
+	require.NoError(t, err)
+	require.Equal(t, 8, counter.calls)
+}
+
+func TestDeduplication_Reject(t *testing.T) {
+	s := New(WithMiddleware((&Deduplication{Reject: true}).Middleware))
+	require.NoError(t, s.Register(&Counter{}))
+
+	req := &Request{
+		ServiceMethod: "Counter.Inc",
+		Body:          []byte(`{}`),
+		Seq:           1,
+	}
+	_, err := s.callContext(clientContext("a"), req)
+	require.NoError(t, err)
+	_, err = s.callContext(clientContext("a"), req)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeAborted, rerr.Code)
+}
+
+func TestDeduplication_Client(t *testing.T) {
+	counter := &Counter{}
+	s := New(WithMiddleware((&Deduplication{}).Middleware))
+	require.NoError(t, s.Register(counter))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// Calls of different clients, with the same Seq, are executed.
+	for i := 0; i < 2; i++ {
+		c, err := Dial(srv.URL)
+		require.NoError(t, err)
+		require.NoError(t, c.Call(context.Background(), "Counter.Inc", &AddRequest{}, &AddResponse{}))
+	}
+	require.Equal(t, 2, counter.calls)
+}
@@ -0,0 +1,163 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// DeltaHeader is set by callers accepting the messages of streams as
+// deltas, to the kind of deltas they accept, and by servers sending them.
+// The only kind of deltas is MergePatchDelta.
+const DeltaHeader = "Rpc-Delta"
+
+// MergePatchDelta is the kind of deltas which are JSON Merge Patches, see
+// RFC 7396, to apply to the previous message of the stream.
+const MergePatchDelta = "merge-patch"
+
+// WithDeltas sends the messages of streamed responses of the method, after
+// the first one, as JSON Merge Patches to apply to the previous message,
+// to callers accepting them, which CallStream and OpenBidiStream do. It
+// suits streams of successive states of a value, where few fields change
+// from one message to the next. Merge patches can't set fields to null,
+// they are removed instead, and replace arrays as a whole.
+func WithDeltas() MethodOption {
+	return func(m *Method) {
+		m.Deltas = true
+	}
+}
+
+// MergePatch applies a JSON Merge Patch to the JSON document doc, see RFC
+// 7396, and returns the resulting document.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var d, p interface{}
+	if len(bytes.TrimSpace(doc)) > 0 {
+		if err := json.Unmarshal(doc, &d); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatch(d, p))
+}
+
+func mergePatch(doc, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	d, ok := doc.(map[string]interface{})
+	if !ok {
+		d = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(d, k)
+			continue
+		}
+		d[k] = mergePatch(d[k], v)
+	}
+	return d
+}
+
+// mergeDiff returns the JSON Merge Patch turning the JSON document from
+// into to.
+func mergeDiff(from, to []byte) ([]byte, error) {
+	var f, t interface{}
+	if err := json.Unmarshal(from, &f); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to, &t); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeDiffValues(f, t))
+}
+
+func mergeDiffValues(from, to interface{}) interface{} {
+	f, ok := from.(map[string]interface{})
+	if !ok {
+		return to
+	}
+	t, ok := to.(map[string]interface{})
+	if !ok {
+		return to
+	}
+	patch := map[string]interface{}{}
+	for k := range f {
+		if _, ok := t[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	for k, v := range t {
+		prev, ok := f[k]
+		switch {
+		case !ok:
+			patch[k] = v
+		case !reflect.DeepEqual(prev, v):
+			patch[k] = mergeDiffValues(prev, v)
+		}
+	}
+	return patch
+}
+
+// deltaEncoder encodes the messages of a stream as deltas.
+type deltaEncoder struct {
+	last []byte
+}
+
+// acceptsDeltas returns a delta encoder for the streamed response of the
+// method, if it sends deltas and the caller accepts them.
+func (s *Service) acceptsDeltas(r *http.Request, m Method) *deltaEncoder {
+	if !m.Deltas || r.Header.Get(DeltaHeader) != MergePatchDelta {
+		return nil
+	}
+	if s.codec.ContentType() != (JSONCodec{}).ContentType() {
+		return nil
+	}
+	return &deltaEncoder{}
+}
+
+// encode returns the delta of the message from the previous one.
+func (e *deltaEncoder) encode(msg []byte) ([]byte, error) {
+	if e.last == nil {
+		e.last = msg
+		return msg, nil
+	}
+	patch, err := mergeDiff(e.last, msg)
+	if err != nil {
+		return nil, fmt.Errorf("rpc: error encoding delta: %v", err)
+	}
+	e.last = msg
+	return patch, nil
+}
+
+// deltaDecoder decodes the messages of a stream sent as deltas.
+type deltaDecoder struct {
+	last []byte
+}
+
+// receivesDeltas returns a delta decoder for the streamed response of
+// resp, if it is sent as deltas.
+func receivesDeltas(resp *http.Response) *deltaDecoder {
+	if resp.Header.Get(DeltaHeader) != MergePatchDelta {
+		return nil
+	}
+	return &deltaDecoder{}
+}
+
+// decode returns the message the delta applies to the previous one.
+func (d *deltaDecoder) decode(delta []byte) ([]byte, error) {
+	if d.last == nil {
+		d.last = delta
+		return delta, nil
+	}
+	msg, err := MergePatch(d.last, delta)
+	if err != nil {
+		return nil, fmt.Errorf("rpc: error decoding delta: %v", err)
+	}
+	d.last = msg
+	return msg, nil
+}
@@ -0,0 +1,140 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Watcher struct{}
+
+type (
+	WatchRequest struct {
+		Name string
+	}
+	Document struct {
+		Name    string
+		Version int
+		Tags    []string          `json:",omitempty"`
+		Labels  map[string]string `json:",omitempty"`
+	}
+)
+
+// Watch sends the successive versions of a document.
+func (w *Watcher) Watch(ctx context.Context, req *WatchRequest, stream *Stream[Document]) error {
+	versions := []Document{
+		{Name: req.Name, Version: 1, Labels: map[string]string{"a": "1", "b": "2"}},
+		{Name: req.Name, Version: 2, Labels: map[string]string{"a": "1", "b": "3"}},
+		{Name: req.Name, Version: 3, Tags: []string{"x"}, Labels: map[string]string{"a": "1"}},
+		{Name: req.Name, Version: 3, Tags: []string{"x"}, Labels: map[string]string{"a": "1"}},
+	}
+	for _, doc := range versions {
+		if err := stream.Send(ctx, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples of RFC 7396.
+	tests := []struct {
+		doc, patch, res string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		res, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+		require.NoError(t, err)
+		require.JSONEq(t, tt.res, string(res), "%s + %s", tt.doc, tt.patch)
+	}
+}
+
+func TestMergeDiff(t *testing.T) {
+	tests := []struct {
+		from, to, patch string
+	}{
+		{`{"a":1,"b":2}`, `{"a":1,"b":3}`, `{"b":3}`},
+		{`{"a":1,"b":2}`, `{"a":1}`, `{"b":null}`},
+		{`{"a":{"b":1,"c":2}}`, `{"a":{"b":1,"c":3}}`, `{"a":{"c":3}}`},
+		{`{"a":[1,2]}`, `{"a":[1,3]}`, `{"a":[1,3]}`},
+		{`{"a":1}`, `{"a":1}`, `{}`},
+		{`{"a":1}`, `[1]`, `[1]`},
+	}
+	for _, tt := range tests {
+		patch, err := mergeDiff([]byte(tt.from), []byte(tt.to))
+		require.NoError(t, err)
+		require.JSONEq(t, tt.patch, string(patch), "%s -> %s", tt.from, tt.to)
+		res, err := MergePatch([]byte(tt.from), patch)
+		require.NoError(t, err)
+		require.JSONEq(t, tt.to, string(res))
+	}
+}
+
+func TestWithDeltas(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Watcher{}))
+	require.NoError(t, s.Configure("Watcher.Watch", WithDeltas()))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// Messages after the first are sent as merge patches.
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"ServiceMethod":"Watcher.Watch","Body":{"Name":"doc"},"Seq":1}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", NDJSONContentType)
+	req.Header.Set(DeltaHeader, MergePatchDelta)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, MergePatchDelta, resp.Header.Get(DeltaHeader))
+	var bodies []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		res := Response{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &res))
+		bodies = append(bodies, string(res.Body))
+	}
+	require.Equal(t, []string{
+		`{"Name":"doc","Version":1,"Labels":{"a":"1","b":"2"}}`,
+		`{"Labels":{"b":"3"},"Version":2}`,
+		`{"Labels":{"b":null},"Tags":["x"],"Version":3}`,
+		`{}`,
+		`{}`,
+	}, bodies)
+
+	// CallStream applies them.
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	var docs []Document
+	for doc, err := range CallStream[Document](context.Background(), c, "Watcher.Watch", &WatchRequest{Name: "doc"}) {
+		require.NoError(t, err)
+		docs = append(docs, doc)
+	}
+	require.Equal(t, []Document{
+		{Name: "doc", Version: 1, Labels: map[string]string{"a": "1", "b": "2"}},
+		{Name: "doc", Version: 2, Labels: map[string]string{"a": "1", "b": "3"}},
+		{Name: "doc", Version: 3, Tags: []string{"x"}, Labels: map[string]string{"a": "1"}},
+		{Name: "doc", Version: 3, Tags: []string{"x"}, Labels: map[string]string{"a": "1"}},
+	}, docs)
+}
@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"time"
+)
+
+// DescribeMethod is the method Service.RegisterDescribe registers.
+const DescribeMethod = "rpc.Describe"
+
+type (
+	// DescribeRequest is the request of DescribeMethod.
+	DescribeRequest struct {
+		Method string
+	}
+	// DescribeResponse describes a method, for clients building and
+	// validating requests at runtime.
+	DescribeResponse struct {
+		Method   string
+		Request  *JSONSchema // schema of the request body
+		Response *JSONSchema // schema of the response body
+		Doc      MethodDoc
+		ReadOnly bool          `json:",omitempty"`
+		Roles    []string      `json:",omitempty"` // roles required to call the method
+		Timeout  time.Duration `json:",omitempty"`
+	}
+	// describeService implements DescribeMethod.
+	describeService struct {
+		s *Service
+	}
+)
+
+// RegisterDescribe registers DescribeMethod, returning the JSON Schemas and
+// documentation of a single method. The options, eg. WithRoles, are
+// applied to it.
+func (s *Service) RegisterDescribe(opts ...MethodOption) error {
+	if err := s.RegisterName("rpc", &describeService{s: s}); err != nil {
+		return err
+	}
+	return s.Configure(DescribeMethod, append([]MethodOption{WithReadOnly()}, opts...)...)
+}
+
+func (d *describeService) Describe(req *DescribeRequest, res *DescribeResponse) error {
+	m, ok := d.s.method(req.Method)
+	if !ok {
+		return &Error{
+			Code:    CodeInvalidRequest,
+			Message: "unknown method " + req.Method,
+		}
+	}
+	schemas := m.JSONSchemas()
+	*res = DescribeResponse{
+		Method:   m.Name,
+		Request:  schemas.Request,
+		Response: schemas.Response,
+		Doc:      m.Doc,
+		ReadOnly: m.ReadOnly,
+		Roles:    m.Roles,
+		Timeout:  m.Timeout,
+	}
+	return nil
+}
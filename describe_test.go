@@ -0,0 +1,38 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_RegisterDescribe(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Configure("Math.Add", WithDescription("Adds two numbers."), WithRoles("math")))
+	require.NoError(t, s.RegisterDescribe())
+
+	res, err := s.callContext(context.Background(), &Request{
+		ServiceMethod: DescribeMethod,
+		Body:          []byte(`{"Method":"Math.Add"}`),
+	})
+	require.NoError(t, err)
+	desc := DescribeResponse{}
+	require.NoError(t, json.Unmarshal(res.Body, &desc))
+	require.Equal(t, "Math.Add", desc.Method)
+	require.Equal(t, "Adds two numbers.", desc.Doc.Description)
+	require.Equal(t, []string{"math"}, desc.Roles)
+	require.Equal(t, "#/$defs/AddRequest", desc.Request.Ref)
+	require.Equal(t, "#/$defs/AddResponse", desc.Response.Ref)
+
+	_, err = s.callContext(context.Background(), &Request{
+		ServiceMethod: DescribeMethod,
+		Body:          []byte(`{"Method":"Math.Missing"}`),
+	})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+}
@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+)
+
+// Dispatcher is implemented by receivers calling their methods without
+// reflection, with a dispatch table generated by the codegen command.
+// DispatchRPC calls the method with the given name, that of the Go method,
+// with its request decoded by decode, and returns its response. Methods
+// it doesn't know return false, and are called with reflection.
+//
+// Streaming methods, and those whose bodies are pooled, see Resetter, are
+// always called with reflection.
+type Dispatcher interface {
+	DispatchRPC(ctx context.Context, method string, decode func(req interface{}) error) (res interface{}, ok bool, err error)
+}
+
+// decodeError is the error requests that can't be decoded fail with,
+// which isn't mapped like those of methods.
+type decodeError struct {
+	err *Error
+}
+
+func (e decodeError) Error() string {
+	return e.err.Error()
+}
+
+// invokeDispatcher is invoke for methods called through the Dispatcher of
+// their receiver.
+func (s *Service) invokeDispatcher(ctx context.Context, m Method, req *Request, codec Codec) (*Response, error) {
+	decode := func(v interface{}) error {
+		if err := unmarshalBody(codec, req.Body, v); err != nil {
+			return decodeError{&Error{
+				Code:    CodeInvalidRequest,
+				Message: "Bad request",
+			}}
+		}
+		attachRequestStream(ctx, v)
+		return nil
+	}
+
+	// Enforce the method's timeout, if any.
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+
+	var (
+		resBody interface{}
+		ok      bool
+	)
+	call := func() (err error) {
+		resBody, ok, err = m.dispatcher.DispatchRPC(ctx, m.Method.Name, decode)
+		return err
+	}
+	var err error
+	if m.Timeout > 0 {
+		err = m.callTimeout(ctx, call)
+	} else {
+		err = call()
+	}
+	var derr decodeError
+	if errors.As(err, &derr) {
+		return nil, derr.err
+	}
+	if err != nil {
+		if s.errorMapper != nil {
+			err = s.errorMapper(err)
+		}
+		return nil, err
+	}
+	if !ok {
+		m.dispatcher = nil
+		return s.invoke(ctx, m, req)
+	}
+
+	// Encode response body
+	if err := detachResponseStream(ctx, resBody); err != nil {
+		return nil, err
+	}
+	resBodyBytes, err := marshalBody(codec, resBody)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		ServiceMethod: req.ServiceMethod,
+		Body:          resBodyBytes,
+		Seq:           req.Seq,
+	}, nil
+}
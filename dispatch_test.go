@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// DispatchedMath is a Math with a dispatch table, as codegen generates,
+// leaving Sub out.
+type DispatchedMath struct {
+	dispatched []string
+}
+
+func (m *DispatchedMath) Add(req *AddRequest, res *AddResponse) error {
+	res.X = req.A + req.B
+	return nil
+}
+
+func (m *DispatchedMath) Sub(req *AddRequest, res *AddResponse) error {
+	res.X = req.A - req.B
+	return nil
+}
+
+func (m *DispatchedMath) Sleep(ctx context.Context, req *AddRequest, res *AddResponse) error {
+	select {
+	case <-time.After(time.Duration(req.A) * time.Millisecond):
+	case <-ctx.Done():
+	}
+	return errors.New("woke up")
+}
+
+func (m *DispatchedMath) DispatchRPC(ctx context.Context, method string, decode func(req interface{}) error) (interface{}, bool, error) {
+	switch method {
+	case "Add":
+		req := new(AddRequest)
+		if err := decode(req); err != nil {
+			return nil, true, err
+		}
+		m.dispatched = append(m.dispatched, method)
+		res := new(AddResponse)
+		err := m.Add(req, res)
+		return res, true, err
+	case "Sleep":
+		req := new(AddRequest)
+		if err := decode(req); err != nil {
+			return nil, true, err
+		}
+		m.dispatched = append(m.dispatched, method)
+		res := new(AddResponse)
+		err := m.Sleep(ctx, req, res)
+		return res, true, err
+	}
+	return nil, false, nil
+}
+
+func TestDispatcher(t *testing.T) {
+	s := New(WithErrorMapper(func(err error) error {
+		return &Error{Code: CodeAborted, Message: "mapped: " + err.Error()}
+	}))
+	m := &DispatchedMath{}
+	require.NoError(t, s.Register(m))
+	require.NotNil(t, s.Methods["DispatchedMath.Add"].dispatcher)
+	// DispatchRPC isn't a method of the service.
+	require.NotContains(t, s.Methods, "DispatchedMath.DispatchRPC")
+
+	call := func(method, body string) (*AddResponse, error) {
+		res, err := s.callContext(context.Background(), &Request{
+			ServiceMethod: "DispatchedMath." + method,
+			Body:          []byte(body),
+		})
+		if err != nil {
+			return nil, err
+		}
+		out := &AddResponse{}
+		require.NoError(t, json.Unmarshal(res.Body, out))
+		return out, nil
+	}
+
+	res, err := call("Add", `{"A":1,"B":2}`)
+	require.NoError(t, err)
+	require.Equal(t, 3, res.X)
+	require.Equal(t, []string{"Add"}, m.dispatched)
+
+	// Methods the table doesn't know are called with reflection.
+	res, err = call("Sub", `{"A":3,"B":1}`)
+	require.NoError(t, err)
+	require.Equal(t, 2, res.X)
+	require.Equal(t, []string{"Add"}, m.dispatched)
+
+	// Requests that can't be decoded fail without being mapped.
+	_, err = call("Add", `{"A":"x"}`)
+	rpcErr := &Error{}
+	require.True(t, errors.As(err, &rpcErr))
+	require.Equal(t, CodeInvalidRequest, rpcErr.Code)
+	require.Equal(t, []string{"Add"}, m.dispatched)
+
+	// Errors of methods are.
+	_, err = call("Sleep", `{"A":1}`)
+	require.True(t, errors.As(err, &rpcErr))
+	require.Equal(t, "mapped: woke up", rpcErr.Message)
+
+	// Timeouts apply to dispatched methods.
+	require.NoError(t, s.Configure("DispatchedMath.Sleep", WithTimeout(10*time.Millisecond)))
+	start := time.Now()
+	_, err = call("Sleep", `{"A":5000}`)
+	require.Error(t, err)
+	require.Less(t, time.Since(start), time.Second)
+}
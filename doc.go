@@ -0,0 +1,49 @@
+package rpc
+
+type (
+	// MethodDoc is the human-readable documentation of a method, surfaced
+	// in its JSON Schemas, OpenAPI and GraphQL schemas.
+	MethodDoc struct {
+		Description string          `json:",omitempty"`
+		Tags        []string        `json:",omitempty"` // eg. to group methods
+		Examples    []MethodExample `json:",omitempty"`
+	}
+	// MethodExample is an example call to a method.
+	MethodExample struct {
+		Name     string      `json:",omitempty"`
+		Request  interface{} // request body
+		Response interface{} // response body
+	}
+	// Describer is implemented by receivers documenting their methods. The
+	// documentation of each method, keyed by method name without the
+	// service name, is applied when the receiver is registered.
+	Describer interface {
+		Describe() map[string]MethodDoc
+	}
+)
+
+// WithDescription sets the description of the method.
+func WithDescription(description string) MethodOption {
+	return func(m *Method) {
+		m.Doc.Description = description
+	}
+}
+
+// WithTags adds tags to the method.
+func WithTags(tags ...string) MethodOption {
+	return func(m *Method) {
+		m.Doc.Tags = append(m.Doc.Tags, tags...)
+	}
+}
+
+// WithExample adds an example call to the method, with the given request
+// and response bodies.
+func WithExample(name string, req, res interface{}) MethodOption {
+	return func(m *Method) {
+		m.Doc.Examples = append(m.Doc.Examples, MethodExample{
+			Name:     name,
+			Request:  req,
+			Response: res,
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type DocumentedMath struct {
+	Math
+}
+
+func (m *DocumentedMath) Describe() map[string]MethodDoc {
+	return map[string]MethodDoc{
+		"Add": {
+			Description: "Adds two numbers.",
+			Tags:        []string{"arithmetic"},
+		},
+		"Missing": {
+			Description: "Ignored.",
+		},
+	}
+}
+
+func TestDescriber(t *testing.T) {
+	s := New(WithoutPing())
+	require.NoError(t, s.RegisterName("Math", &DocumentedMath{}))
+	require.Equal(t, MethodDoc{
+		Description: "Adds two numbers.",
+		Tags:        []string{"arithmetic"},
+	}, s.Methods["Math.Add"].Doc)
+
+	// Options add to the documentation.
+	require.NoError(t, s.Configure("Math.Add",
+		WithTags("public"),
+		WithExample("small", &AddRequest{A: 1, B: 2}, &AddResponse{X: 3}),
+	))
+	require.Equal(t, []string{"arithmetic", "public"}, s.Methods["Math.Add"].Doc.Tags)
+}
+
+func TestMethodDoc_Schemas(t *testing.T) {
+	s := New(WithoutPing())
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Configure("Math.Add",
+		WithReadOnly(),
+		WithDescription("Adds two numbers."),
+		WithTags("arithmetic"),
+		WithExample("small", &AddRequest{A: 1, B: 2}, &AddResponse{X: 3}),
+	))
+
+	schemas := s.JSONSchemas()["Math.Add"]
+	require.Equal(t, "Adds two numbers.", schemas.Request.Description)
+	require.Equal(t, []string{"arithmetic"}, schemas.Tags)
+	require.Equal(t, []interface{}{&AddRequest{A: 1, B: 2}}, schemas.Request.Examples)
+	require.Equal(t, []interface{}{&AddResponse{X: 3}}, schemas.Response.Examples)
+
+	doc, err := s.OpenAPI("Math", "/rpc")
+	require.NoError(t, err)
+	components := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	req := components["Math.Add.Request"].(map[string]interface{})
+	require.Equal(t, "Adds two numbers.", req["description"])
+	require.Equal(t, []string{"arithmetic"}, req["x-tags"])
+	require.Len(t, req["examples"], 1)
+
+	require.Contains(t, s.GraphQLSchema(), "type Query {\n  \"Adds two numbers.\"\n  Math_Add(input: AddRequestInput!): AddResponse!\n}")
+}
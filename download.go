@@ -0,0 +1,226 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// ChunkSizeHeader is set by callers downloading Blob responses in
+	// chunks, see Client.Download, to the size of the chunks.
+	ChunkSizeHeader = "Rpc-Chunk-Size"
+	// OffsetHeader is set by callers resuming a download to the offset of
+	// the body to resume from.
+	OffsetHeader = "Rpc-Offset"
+	// TotalSizeHeader carries the total size of a downloaded body, when
+	// it is known.
+	TotalSizeHeader = "Rpc-Total-Size"
+	// ContentTypeHeader carries the content type of a downloaded body.
+	ContentTypeHeader = "Rpc-Content-Type"
+	// ChunksContentType is the content type of responses downloaded in
+	// chunks. Their body is a sequence of frames, each prefixed with its
+	// length as a 4 byte big endian integer, holding the offset of the
+	// chunk as an 8 byte big endian integer, its data, and the CRC-32C
+	// checksum of both. The last chunk is empty, and its offset is the
+	// total size of the body.
+	ChunksContentType = "application/vnd.rpc.chunks"
+)
+
+// DefaultChunkSize is the size of the chunks of downloads.
+const DefaultChunkSize = 1 << 20
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// errDownloadInterrupted is returned when a download stops before its
+// last chunk, and can be resumed.
+var errDownloadInterrupted = errors.New("rpc: download interrupted")
+
+// writeChunks writes the body of a Blob response in chunks, starting at
+// the offset requested by the caller.
+func (s *Service) writeChunks(w http.ResponseWriter, r *http.Request, req *Request, contentType string, body io.Reader) {
+	size, err := strconv.Atoi(r.Header.Get(ChunkSizeHeader))
+	if err != nil || size <= 0 || size > maxFrameSize-12 {
+		size = DefaultChunkSize
+	}
+	var offset int64
+	if v := r.Header.Get(OffsetHeader); v != "" {
+		if offset, err = strconv.ParseInt(v, 10, 64); err != nil || offset < 0 {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	total := int64(-1)
+	switch b := body.(type) {
+	case *bytes.Reader:
+		total = b.Size()
+	case io.Seeker:
+		if total, err = b.Seek(0, io.SeekEnd); err == nil {
+			_, err = b.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			total = -1
+		}
+	}
+	if seeker, ok := body.(io.Seeker); ok && total >= 0 {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, body, offset)
+	}
+	if err != nil && err != io.EOF {
+		s.logf("rpc: error seeking response of %s: %v", req.ServiceMethod, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ChunksContentType)
+	w.Header().Set(ContentTypeHeader, contentType)
+	if total >= 0 {
+		w.Header().Set(TotalSizeHeader, strconv.FormatInt(total, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	buf := make([]byte, size)
+	for {
+		n, err := io.ReadFull(body, buf)
+		if n > 0 {
+			if werr := writeChunk(w, offset, buf[:n]); werr != nil {
+				return
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			s.logf("rpc: error streaming response of %s: %v", req.ServiceMethod, err)
+			return
+		}
+	}
+	_ = writeChunk(w, offset, nil)
+}
+
+// writeChunk writes a chunk of a body at the given offset.
+func writeChunk(w io.Writer, offset int64, data []byte) error {
+	frame := make([]byte, 8+len(data)+4)
+	binary.BigEndian.PutUint64(frame, uint64(offset))
+	copy(frame[8:], data)
+	binary.BigEndian.PutUint32(frame[8+len(data):], crc32.Checksum(frame[:8+len(data)], crc32c))
+	return writeFrame(w, frame)
+}
+
+// readChunk reads a chunk written with writeChunk.
+func readChunk(r io.Reader) (int64, []byte, error) {
+	frame, err := readFrame(r, maxFrameSize)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(frame) < 12 {
+		return 0, nil, errors.New("short chunk")
+	}
+	n := len(frame) - 4
+	if crc32.Checksum(frame[:n], crc32c) != binary.BigEndian.Uint32(frame[n:]) {
+		return 0, nil, errors.New("chunk checksum mismatch")
+	}
+	return int64(binary.BigEndian.Uint64(frame)), frame[8:n], nil
+}
+
+// Download calls a method returning a Blob, and writes its body to w as
+// it is received in chunks, returning its size. The integrity of each
+// chunk is checked against its checksum, and interrupted downloads are
+// resumed from the last chunk received, calling the method again, as
+// long as each attempt receives some of the body. Methods should return
+// the same body each time, and set the Blob's Reader to an io.Seeker, eg.
+// an *os.File, so resumed downloads don't produce the skipped part again.
+// With a RetryPolicy, downloads are resumed after the delays of its
+// Backoff.
+func (c *Client) Download(ctx context.Context, method string, reqBody interface{}, w io.Writer) (int64, error) {
+	var (
+		written int64
+		delay   time.Duration
+	)
+	for resume := 1; ; resume++ {
+		n, err := c.downloadFrom(ctx, method, reqBody, w, written)
+		written += n
+		if err == nil || !errors.Is(err, errDownloadInterrupted) || n == 0 || ctx.Err() != nil {
+			return written, err
+		}
+		if p := c.retryPolicy; p != nil {
+			delay = min(p.backoff().Delay(resume, delay), p.maxDelay())
+			if !sleep(ctx, delay) {
+				return written, err
+			}
+		}
+	}
+}
+
+// downloadFrom downloads the body of a call from the given offset.
+func (c *Client) downloadFrom(ctx context.Context, method string, reqBody interface{}, w io.Writer, offset int64) (int64, error) {
+	codec := c.codec
+	seq := c.nextSeq()
+	body, err := encodeCall(c.envelopeContext(ctx), codec, method, reqBody, seq, c.versions.current())
+	if err != nil {
+		return 0, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.uri, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("rpc: error creating request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", codec.ContentType())
+	httpReq.Header.Set(RawResponseHeader, "1")
+	httpReq.Header.Set(ChunkSizeHeader, strconv.Itoa(DefaultChunkSize))
+	httpReq.Header.Set(OffsetHeader, strconv.FormatInt(offset, 10))
+	setTimeoutHeader(ctx, httpReq.Header)
+	setOutgoingHeader(WithOutgoingHeader(ctx, ClientIDHeader, c.id), httpReq.Header)
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errDownloadInterrupted, err)
+	}
+
+	defer resp.Body.Close()
+	c.versions.update(resp.Header)
+	if resp.Header.Get("Content-Type") != ChunksContentType {
+		resBytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return 0, fmt.Errorf("rpc: error reading response body: %v", err)
+		}
+		if err := decodeReply(codec, resBytes, method, seq, &Blob{}); err != nil {
+			return 0, c.errorDecoder.decode(err)
+		}
+		return 0, fmt.Errorf("rpc: %s doesn't return a Blob", method)
+	}
+	if resp.Header.Get(MethodHeader) != method || resp.Header.Get(SeqHeader) != strconv.FormatUint(seq, 10) {
+		return 0, fmt.Errorf("%w: got %s #%s, expected %s #%d", ErrResponseMismatch, resp.Header.Get(MethodHeader), resp.Header.Get(SeqHeader), method, seq)
+	}
+
+	var n int64
+	for {
+		chunkOffset, data, err := readChunk(resp.Body)
+		if err != nil {
+			return n, fmt.Errorf("%w: %v", errDownloadInterrupted, err)
+		}
+		if chunkOffset != offset+n {
+			return n, fmt.Errorf("rpc: chunk at offset %d, expected %d", chunkOffset, offset+n)
+		}
+		if len(data) == 0 {
+			break
+		}
+		m, err := w.Write(data)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	if v := resp.Header.Get(TotalSizeHeader); v != "" && v != strconv.FormatInt(offset+n, 10) {
+		return n, fmt.Errorf("rpc: downloaded %d bytes, expected %s", offset+n, v)
+	}
+	return n, nil
+}
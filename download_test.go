@@ -0,0 +1,104 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Archive struct {
+	data []byte
+}
+
+func (a *Archive) Get(req *DownloadRequest, res *Blob) error {
+	if req.Size < 0 {
+		return &Error{Code: CodeInvalidRequest, Message: "invalid size"}
+	}
+	res.ContentType = "application/x-archive"
+	res.Reader = bytes.NewReader(a.data[:req.Size])
+	return nil
+}
+
+// truncatingWriter aborts the response once limit bytes were written.
+type truncatingWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *truncatingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.limit {
+		_, _ = w.ResponseWriter.Write(b[:w.limit])
+		panic(http.ErrAbortHandler)
+	}
+	w.limit -= len(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func TestClient_Download(t *testing.T) {
+	data := make([]byte, 3*DefaultChunkSize+1234)
+	rand.New(rand.NewSource(1)).Read(data)
+	s := New()
+	require.NoError(t, s.Register(&Archive{data: data}))
+
+	// Interrupt the first response half way through.
+	var (
+		calls   int32
+		offsets []string
+	)
+	handler := s.Serve()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offsets = append(offsets, r.Header.Get(OffsetHeader))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w = &truncatingWriter{ResponseWriter: w, limit: DefaultChunkSize + DefaultChunkSize/2}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// The download resumes after the last complete chunk.
+	buf := &bytes.Buffer{}
+	n, err := c.Download(ctx, "Archive.Get", &DownloadRequest{Size: len(data)}, buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.Equal(t, data, buf.Bytes())
+	require.Equal(t, []string{"0", strconv.Itoa(DefaultChunkSize)}, offsets)
+
+	// Empty bodies are downloaded too.
+	buf.Reset()
+	n, err = c.Download(ctx, "Archive.Get", &DownloadRequest{}, buf)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// Errors are returned as they are.
+	_, err = c.Download(ctx, "Archive.Get", &DownloadRequest{Size: -1}, buf)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+}
+
+func TestWriteChunk(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeChunk(buf, 42, []byte("hello")))
+	offset, data, err := readChunk(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, int64(42), offset)
+	require.Equal(t, []byte("hello"), data)
+
+	// Corrupted chunks are rejected.
+	b := buf.Bytes()
+	b[14] ^= 1
+	_, _, err = readChunk(bytes.NewReader(b))
+	require.Error(t, err)
+}
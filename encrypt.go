@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// WithEncryption requires the bodies of requests to be encrypted with
+// aead, eg. AES-GCM with a pre-shared key, and encrypts those of their
+// responses, so they stay confidential end-to-end where TLS terminates at
+// an untrusted proxy. Clients encrypt calls with WithCallEncryption.
+// Calls with unencrypted bodies fail with CodeInvalidRequest, including
+// batches, and calls streaming their requests or responses or sending
+// Blobs as is, whose bodies can't be encrypted. Errors and metadata are
+// not encrypted.
+func WithEncryption(aead cipher.AEAD) ServiceOption {
+	return func(s *Service) {
+		s.aead = aead
+	}
+}
+
+// WithCallEncryption encrypts the bodies of the client's calls with aead,
+// and decrypts those of their responses, see WithEncryption. Responses
+// with unencrypted bodies fail the calls.
+func WithCallEncryption(aead cipher.AEAD) Option {
+	return func(o *clientOptions) {
+		o.aead = aead
+	}
+}
+
+type encryptionKey struct{}
+
+// encryptionAAD returns the additional data bodies are encrypted with,
+// binding them to the request or response of the call they are sent in.
+func encryptionAAD(response bool, method string, seq uint64) []byte {
+	kind := "request"
+	if response {
+		kind = "response"
+	}
+	return []byte(kind + " " + method + " " + strconv.FormatUint(seq, 10))
+}
+
+// seal encrypts a body, encoded with codec as bytes.
+func seal(aead cipher.AEAD, codec Codec, body, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(body)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return codec.Marshal(aead.Seal(nonce, nonce, body, aad))
+}
+
+// open decrypts a body sealed with seal.
+func open(aead cipher.AEAD, codec Codec, body, aad []byte) ([]byte, error) {
+	var sealed []byte
+	if err := codec.Unmarshal(body, &sealed); err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("short body")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+// errNotEncrypted is returned for calls whose bodies aren't encrypted, to
+// services requiring encryption.
+var errNotEncrypted = &Error{
+	Code:    CodeInvalidRequest,
+	Message: "calls to this service must be encrypted",
+}
+
+// decryptRequest returns req with its body decrypted, failing if the
+// service requires encryption and it isn't.
+func (s *Service) decryptRequest(ctx context.Context, m Method, req *Request) (*Request, error) {
+	if !req.Encrypted {
+		if s.aead != nil {
+			return nil, errNotEncrypted
+		}
+		return req, nil
+	}
+	if s.aead == nil {
+		return nil, &Error{
+			Code:    CodeInvalidRequest,
+			Message: "this service doesn't support encryption",
+		}
+	}
+	if m.Streaming() || m.ClientStreaming() {
+		return nil, &Error{
+			Code:    CodeInvalidRequest,
+			Message: "streams can't be encrypted",
+		}
+	}
+	body, err := open(s.aead, s.requestCodec(ctx), req.Body, encryptionAAD(false, req.ServiceMethod, req.Seq))
+	if err != nil {
+		return nil, &Error{
+			Code:    CodeInvalidRequest,
+			Message: "error decrypting request",
+		}
+	}
+	out := *req
+	out.Body, out.Encrypted = body, false
+	return &out, nil
+}
+
+// encryptResponse returns the response to req with its body encrypted, if
+// that of req was.
+func (s *Service) encryptResponse(ctx context.Context, req *Request, res *Response) (*Response, error) {
+	if !req.Encrypted {
+		return res, nil
+	}
+	body, err := seal(s.aead, s.requestCodec(ctx), res.Body, encryptionAAD(true, req.ServiceMethod, req.Seq))
+	if err != nil {
+		return nil, fmt.Errorf("rpc: error encrypting response: %v", err)
+	}
+	out := *res
+	out.Body, out.Encrypted = body, true
+	return &out, nil
+}
+
+// encryptCall encrypts the body of req, if calls made with ctx are
+// encrypted.
+func encryptCall(ctx context.Context, codec Codec, req *Request) error {
+	aead, ok := ctx.Value(encryptionKey{}).(cipher.AEAD)
+	if !ok {
+		return nil
+	}
+	body, err := seal(aead, codec, req.Body, encryptionAAD(false, req.ServiceMethod, req.Seq))
+	if err != nil {
+		return fmt.Errorf("rpc: error encrypting request: %v", err)
+	}
+	req.Body, req.Encrypted = body, true
+	return nil
+}
+
+// decryptReply returns the response of a call made with ctx, with its
+// body decrypted if calls made with ctx are encrypted.
+func decryptReply(ctx context.Context, codec Codec, resBytes []byte) ([]byte, error) {
+	aead, ok := ctx.Value(encryptionKey{}).(cipher.AEAD)
+	if !ok {
+		return resBytes, nil
+	}
+	res := Response{}
+	if err := codec.Unmarshal(resBytes, &res); err != nil {
+		return nil, fmt.Errorf("rpc: error reading response body: %v", err)
+	}
+	if res.Error != "" {
+		return resBytes, nil
+	}
+	if !res.Encrypted {
+		return nil, errors.New("rpc: response is not encrypted")
+	}
+	body, err := open(aead, codec, res.Body, encryptionAAD(true, res.ServiceMethod, res.Seq))
+	if err != nil {
+		return nil, fmt.Errorf("rpc: error decrypting response: %v", err)
+	}
+	res.Body, res.Encrypted = body, false
+	return codec.Marshal(res)
+}
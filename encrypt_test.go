@@ -0,0 +1,102 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newAESGCM(t *testing.T, key string) cipher.AEAD {
+	block, err := aes.NewCipher([]byte(key))
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	return aead
+}
+
+func TestWithEncryption(t *testing.T) {
+	key := newAESGCM(t, "0123456789abcdef0123456789abcdef")
+	s := New(WithEncryption(key))
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Register(&Ticker{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// A proxy recording the bodies it sees.
+	var seen [][]byte
+	httpClient := &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			resp, err := http.DefaultTransport.RoundTrip(r)
+			if err != nil {
+				return nil, err
+			}
+			resBody, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+			seen = append(seen, body, resBody)
+			return resp, nil
+		}),
+	}
+	ctx := context.Background()
+
+	// Bodies are encrypted both ways.
+	c, err := Dial(srv.URL, WithHTTPClient(httpClient), WithCallEncryption(key), WithChecksums())
+	require.NoError(t, err)
+	res := &AddResponse{}
+	require.NoError(t, c.Call(ctx, "Math.Add", &AddRequest{A: 20, B: 22}, res))
+	require.Equal(t, 42, res.X)
+	require.Len(t, seen, 2)
+	require.NotContains(t, string(seen[0]), `"A":20`)
+	require.NotContains(t, string(seen[1]), `"X":42`)
+	require.Contains(t, string(seen[0]), `"Encrypted":true`)
+
+	// Unencrypted calls are rejected.
+	var rerr *Error
+	c, err = Dial(srv.URL)
+	require.NoError(t, err)
+	err = c.Call(ctx, "Math.Add", &AddRequest{}, res)
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+
+	// As are calls encrypted with another key.
+	c, err = Dial(srv.URL, WithCallEncryption(newAESGCM(t, "fedcba9876543210fedcba9876543210")))
+	require.NoError(t, err)
+	err = c.Call(ctx, "Math.Add", &AddRequest{}, res)
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+
+	// And streams, which can't be encrypted.
+	c, err = Dial(srv.URL, WithCallEncryption(key))
+	require.NoError(t, err)
+	for _, err := range CallStream[Tick](ctx, c, "Ticker.Ticks", &TickRequest{Count: 1}) {
+		require.True(t, errors.As(err, &rerr), "%v", err)
+	}
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+
+	// Services without encryption reject encrypted calls.
+	plainService := New()
+	require.NoError(t, plainService.Register(&Math{}))
+	plain := httptest.NewServer(plainService.Serve())
+	defer plain.Close()
+	c, err = Dial(plain.URL, WithCallEncryption(key))
+	require.NoError(t, err)
+	err = c.Call(ctx, "Math.Add", &AddRequest{}, res)
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+}
@@ -0,0 +1,195 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// TraceHeader is the W3C trace context header. Version 2 envelopes carry
+// it in their Trace field.
+const TraceHeader = "Traceparent"
+
+type (
+	// responseV2 is the encoding of version 2 response envelopes, whose
+	// errors are structured.
+	responseV2 struct {
+		ServiceMethod string
+		Body          json.RawMessage
+		Seq           uint64
+		Version       int
+		Checksum      string            `json:",omitempty"`
+		Encrypted     bool              `json:",omitempty"`
+		Metadata      map[string]string `json:",omitempty"`
+		More          bool              `json:",omitempty"`
+		Error         *Error            `json:",omitempty"`
+	}
+	// responseJSON is Response without its JSON methods.
+	responseJSON Response
+	// responseMetadata collects the metadata of the response of a call.
+	responseMetadata struct {
+		mu       sync.Mutex
+		metadata map[string]string
+	}
+	responseMetadataKey struct{}
+)
+
+// MarshalJSON encodes the response envelope. Errors of version 2 envelopes
+// are encoded as objects with their Code, Message and Details.
+func (r Response) MarshalJSON() ([]byte, error) {
+	if r.Version < 2 {
+		return json.Marshal(responseJSON(r))
+	}
+	res := responseV2{
+		ServiceMethod: r.ServiceMethod,
+		Body:          r.Body,
+		Seq:           r.Seq,
+		Version:       r.Version,
+		Checksum:      r.Checksum,
+		Encrypted:     r.Encrypted,
+		Metadata:      r.Metadata,
+		More:          r.More,
+	}
+	if r.Error != "" {
+		res.Error = &Error{
+			Code:    r.Code,
+			Message: r.Error,
+			Details: r.Details,
+			Chain:   r.Chain,
+		}
+	}
+	return json.Marshal(res)
+}
+
+// UnmarshalJSON decodes response envelopes of any version.
+func (r *Response) UnmarshalJSON(data []byte) error {
+	var res struct {
+		responseV2
+		Error   json.RawMessage
+		Code    string
+		Details map[string]string
+		Chain   []ErrorLink
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+	*r = Response{
+		ServiceMethod: res.ServiceMethod,
+		Body:          res.Body,
+		Seq:           res.Seq,
+		Version:       res.Version,
+		Checksum:      res.Checksum,
+		Encrypted:     res.Encrypted,
+		Metadata:      res.Metadata,
+		More:          res.More,
+		Code:          res.Code,
+		Details:       res.Details,
+		Chain:         res.Chain,
+	}
+	if len(res.Error) == 0 || string(res.Error) == "null" {
+		return nil
+	}
+	if res.Error[0] != '{' {
+		return json.Unmarshal(res.Error, &r.Error)
+	}
+	e := Error{}
+	if err := json.Unmarshal(res.Error, &e); err != nil {
+		return err
+	}
+	r.Error, r.Code, r.Details, r.Chain = e.Message, e.Code, e.Details, e.Chain
+	return nil
+}
+
+// SetResponseMetadata sets metadata returned with the response of the
+// call being served. Only version 2 envelopes carry metadata, it is
+// dropped for callers using version 1.
+func SetResponseMetadata(ctx context.Context, key, value string) {
+	md, ok := ctx.Value(responseMetadataKey{}).(*responseMetadata)
+	if !ok {
+		return
+	}
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	if md.metadata == nil {
+		md.metadata = map[string]string{}
+	}
+	md.metadata[key] = value
+}
+
+// withResponseMetadata returns a context collecting the response metadata
+// of a call made with a version 2 envelope.
+func withResponseMetadata(ctx context.Context, req *Request) (context.Context, *responseMetadata) {
+	if req.Version < 2 {
+		return ctx, nil
+	}
+	md := &responseMetadata{}
+	return context.WithValue(ctx, responseMetadataKey{}, md), md
+}
+
+// versioned returns the response to req, of the envelope version of req
+// and with the collected metadata, copying res if needed.
+func versioned(res *Response, req *Request, md *responseMetadata) *Response {
+	if res.Version == req.Version && md == nil {
+		return res
+	}
+	out := *res
+	out.Version = req.Version
+	if md != nil {
+		md.mu.Lock()
+		out.Metadata = md.metadata
+		md.mu.Unlock()
+	}
+	return &out
+}
+
+// envelopeHeader returns the headers of a call made with req: h, with the
+// metadata, timeout and trace of version 2 envelopes. Headers h already
+// has are kept.
+func envelopeHeader(req *Request, h http.Header) http.Header {
+	if req.Version < 2 {
+		return h
+	}
+	out := http.Header{}
+	if h != nil {
+		out = h.Clone()
+	}
+	add := func(key, value string) {
+		if value != "" && out.Get(key) == "" {
+			out.Set(key, value)
+		}
+	}
+	for k, v := range req.Metadata {
+		add(k, v)
+	}
+	if req.Timeout > 0 {
+		add(TimeoutHeader, strconv.FormatInt(req.Timeout, 10))
+	}
+	add(TraceHeader, req.Trace)
+	return out
+}
+
+// setEnvelope sets the fields of version 2 envelopes of req from ctx: the
+// headers set with WithOutgoingHeader as metadata, the time remaining
+// until its deadline, and the trace context header.
+func setEnvelope(ctx context.Context, req *Request) {
+	if req.Version < 2 {
+		return
+	}
+	h := http.Header{}
+	setTimeoutHeader(ctx, h)
+	setOutgoingHeader(ctx, h)
+	if ms, err := strconv.ParseInt(h.Get(TimeoutHeader), 10, 64); err == nil {
+		req.Timeout = ms
+	}
+	h.Del(TimeoutHeader)
+	req.Trace = h.Get(TraceHeader)
+	h.Del(TraceHeader)
+	for k := range h {
+		if req.Metadata == nil {
+			req.Metadata = map[string]string{}
+		}
+		req.Metadata[k] = h.Get(k)
+	}
+}
@@ -0,0 +1,127 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponse_JSON(t *testing.T) {
+	tests := []struct {
+		name string
+		res  Response
+		json string
+	}{{
+		name: "v1 error",
+		res:  Response{ServiceMethod: "Math.Add", Body: json.RawMessage(`null`), Seq: 1, Error: "failed", Code: CodeAborted},
+		json: `{"ServiceMethod":"Math.Add","Body":null,"Seq":1,"Error":"failed","Code":"aborted"}`,
+	}, {
+		name: "v2 error",
+		res:  Response{ServiceMethod: "Math.Add", Body: json.RawMessage(`null`), Seq: 1, Version: 2, Error: "failed", Code: CodeAborted, Details: map[string]string{"a": "b"}},
+		json: `{"ServiceMethod":"Math.Add","Body":null,"Seq":1,"Version":2,"Error":{"Code":"aborted","Message":"failed","Details":{"a":"b"}}}`,
+	}, {
+		name: "v2 metadata",
+		res:  Response{ServiceMethod: "Math.Add", Body: json.RawMessage(`{"X":3}`), Seq: 1, Version: 2, Metadata: map[string]string{"a": "b"}},
+		json: `{"ServiceMethod":"Math.Add","Body":{"X":3},"Seq":1,"Version":2,"Metadata":{"a":"b"}}`,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.res)
+			require.NoError(t, err)
+			require.JSONEq(t, tt.json, string(b))
+
+			res := Response{}
+			require.NoError(t, json.Unmarshal(b, &res))
+			require.Equal(t, tt.res, res)
+		})
+	}
+}
+
+type Envelope struct{}
+
+func (e *Envelope) Inspect(ctx context.Context, req *struct{}, res *map[string]string) error {
+	SetResponseMetadata(ctx, "Served-By", "test")
+	_, hasDeadline := ctx.Deadline()
+	*res = map[string]string{
+		"tenant":   HeaderFromContext(ctx).Get(TenantHeader),
+		"trace":    HeaderFromContext(ctx).Get(TraceHeader),
+		"deadline": time.Duration(0).String(),
+	}
+	if hasDeadline {
+		(*res)["deadline"] = "set"
+	}
+	return nil
+}
+
+func TestServeMessage_V2(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Envelope{}))
+
+	ctx := WithOutgoingHeader(context.Background(), TenantHeader, "acme")
+	ctx = WithOutgoingHeader(ctx, TraceHeader, "00-trace")
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	c := &Correlator{Version: 2}
+	c.Send = func(ctx context.Context, msg []byte) error {
+		req := Request{}
+		require.NoError(t, json.Unmarshal(msg, &req))
+		require.Equal(t, map[string]string{TenantHeader: "acme"}, req.Metadata)
+		require.Equal(t, "00-trace", req.Trace)
+		require.True(t, req.Timeout > 0)
+
+		res := s.ServeMessage(context.Background(), msg)
+		decoded := Response{}
+		require.NoError(t, json.Unmarshal(res, &decoded))
+		require.Equal(t, 2, decoded.Version)
+		require.Equal(t, map[string]string{"Served-By": "test"}, decoded.Metadata)
+		return c.Deliver(res)
+	}
+	res := map[string]string{}
+	require.NoError(t, c.Call(ctx, "Envelope.Inspect", &struct{}{}, &res))
+	require.Equal(t, map[string]string{
+		"tenant":   "acme",
+		"trace":    "00-trace",
+		"deadline": "set",
+	}, res)
+
+	// Errors are structured.
+	c.Send = func(ctx context.Context, msg []byte) error {
+		res := s.ServeMessage(context.Background(), msg)
+		require.Contains(t, string(res), `"Error":{"Code":"invalid_request"`)
+		return c.Deliver(res)
+	}
+	require.Error(t, c.Call(context.Background(), "Envelope.Inspect", "invalid", &res))
+}
+
+func TestClient_NegotiatesV2(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	var versions []int
+	s.Use(func(next Handler) Handler {
+		return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+			versions = append(versions, req.Version)
+			return next(ctx, m, req)
+		}
+	})
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		res := &AddResponse{}
+		require.NoError(t, c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res))
+		require.Equal(t, 3, res.X)
+	}
+	require.Equal(t, []int{0, 2}, versions)
+
+	err = c.Call(context.Background(), "Math.Add", "invalid", &AddResponse{})
+	var rerr *Error
+	require.ErrorAs(t, err, &rerr)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+}
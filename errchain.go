@@ -0,0 +1,151 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// ErrorLink is an error of the chain of wrapped errors a method failed
+// with, see RegisterError.
+type ErrorLink struct {
+	ID      string          `json:",omitempty"` // identifier the error is registered with, if any
+	Message string          // message of the error
+	Data    json.RawMessage `json:",omitempty"` // encoded error, of registered error types
+}
+
+type (
+	// errorRegistry holds the errors registered to be carried across
+	// calls.
+	errorRegistry struct {
+		mu        sync.RWMutex
+		sentinels map[string]error
+		types     map[reflect.Type]string
+		decoders  map[string]func(data []byte) (error, error)
+	}
+	// chainError is an error of a chain reconstructed from its links.
+	chainError struct {
+		msg  string
+		err  error // the registered error, if any
+		next *chainError
+	}
+)
+
+var registeredErrors = &errorRegistry{
+	sentinels: map[string]error{},
+	types:     map[reflect.Type]string{},
+	decoders:  map[string]func(data []byte) (error, error){},
+}
+
+// RegisterError registers a sentinel error, such as io.EOF, under an
+// identifier shared by servers and clients. Errors returned by methods
+// which wrap it, eg. with fmt.Errorf and %w, are returned to callers as an
+// *Error wrapping it, for which errors.Is(err, sentinel) holds.
+func RegisterError(id string, sentinel error) {
+	r := registeredErrors
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sentinels[id] = sentinel
+}
+
+// RegisterErrorType registers an error type under an identifier shared by
+// servers and clients. Errors of the type in the chain of errors returned
+// by methods are encoded as JSON, and decoded for callers, for which
+// errors.As finds them.
+func RegisterErrorType[T error](id string) {
+	r := registeredErrors
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[reflect.TypeOf((*T)(nil)).Elem()] = id
+	r.decoders[id] = func(data []byte) (error, error) {
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+}
+
+// encodeErrorChain returns the links of the chain of wrapped errors of
+// err, or nil if none of them are registered.
+func encodeErrorChain(err error) []ErrorLink {
+	r := registeredErrors
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var (
+		links      []ErrorLink
+		registered bool
+	)
+	for ; err != nil; err = errors.Unwrap(err) {
+		link := ErrorLink{Message: err.Error()}
+		if id, ok := r.types[reflect.TypeOf(err)]; ok {
+			if data, jerr := json.Marshal(err); jerr == nil {
+				link.ID, link.Data = id, data
+			}
+		}
+		if link.ID == "" {
+			for id, sentinel := range r.sentinels {
+				if sameError(err, sentinel) {
+					link.ID = id
+					break
+				}
+			}
+		}
+		registered = registered || link.ID != ""
+		links = append(links, link)
+	}
+	if !registered {
+		return nil
+	}
+	return links
+}
+
+// sameError returns whether a and b are the same error value.
+func sameError(a, b error) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// decodeErrorChain returns the chain of errors of the links, whose errors
+// are the registered errors they are encoded from.
+func decodeErrorChain(links []ErrorLink) error {
+	r := registeredErrors
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var next *chainError
+	for i := len(links) - 1; i >= 0; i-- {
+		link := links[i]
+		c := &chainError{msg: link.Message, next: next}
+		if sentinel, ok := r.sentinels[link.ID]; ok {
+			c.err = sentinel
+		} else if decode, ok := r.decoders[link.ID]; ok {
+			if err, derr := decode(link.Data); derr == nil {
+				c.err = err
+			}
+		}
+		next = c
+	}
+	if next == nil {
+		return nil
+	}
+	return next
+}
+
+func (e *chainError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the registered error of the link, and the next one.
+func (e *chainError) Unwrap() []error {
+	var errs []error
+	if e.err != nil {
+		errs = append(errs, e.err)
+	}
+	if e.next != nil {
+		errs = append(errs, e.next)
+	}
+	return errs
+}
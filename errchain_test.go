@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var ErrOutOfStock = errors.New("out of stock")
+
+type StockError struct {
+	Item      string
+	Available int
+}
+
+func (e *StockError) Error() string {
+	return fmt.Sprintf("%s: only %d available", e.Item, e.Available)
+}
+
+func (e *StockError) Unwrap() error {
+	return ErrOutOfStock
+}
+
+type Inventory struct{}
+
+type ReserveRequest struct {
+	Item  string
+	Count int
+}
+
+func (i *Inventory) Reserve(req *ReserveRequest, res *AddResponse) error {
+	switch req.Item {
+	case "widget":
+		return fmt.Errorf("reserving %d: %w", req.Count, &StockError{Item: req.Item, Available: 2})
+	case "gadget":
+		return fmt.Errorf("reserving %d: %w", req.Count, ErrOutOfStock)
+	default:
+		return fmt.Errorf("reserving %d: %w", req.Count, errors.New("unknown item"))
+	}
+}
+
+func TestRegisterError(t *testing.T) {
+	RegisterError("test.out_of_stock", ErrOutOfStock)
+	RegisterErrorType[*StockError]("test.stock")
+
+	s := New()
+	require.NoError(t, s.Register(&Inventory{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	for _, version := range []int32{1, 2} {
+		c, err := Dial(srv.URL)
+		require.NoError(t, err)
+		c.versions.version = version
+		ctx := context.Background()
+
+		// Registered errors are found in the chain, with their data.
+		err = c.Call(ctx, "Inventory.Reserve", &ReserveRequest{Item: "widget", Count: 3}, &AddResponse{})
+		require.EqualError(t, err, "rpc: server: reserving 3: widget: only 2 available")
+		require.True(t, errors.Is(err, ErrOutOfStock))
+		var serr *StockError
+		require.True(t, errors.As(err, &serr))
+		require.Equal(t, &StockError{Item: "widget", Available: 2}, serr)
+		var rerr *Error
+		require.True(t, errors.As(err, &rerr))
+		require.Equal(t, []ErrorLink{
+			{Message: "reserving 3: widget: only 2 available"},
+			{ID: "test.stock", Message: "widget: only 2 available", Data: []byte(`{"Item":"widget","Available":2}`)},
+			{ID: "test.out_of_stock", Message: "out of stock"},
+		}, rerr.Chain)
+
+		err = c.Call(ctx, "Inventory.Reserve", &ReserveRequest{Item: "gadget"}, &AddResponse{})
+		require.True(t, errors.Is(err, ErrOutOfStock))
+		require.False(t, errors.As(err, &serr))
+
+		// Chains without registered errors aren't sent.
+		err = c.Call(ctx, "Inventory.Reserve", &ReserveRequest{Item: "gizmo"}, &AddResponse{})
+		require.True(t, errors.As(err, &rerr))
+		require.Nil(t, rerr.Chain)
+		require.False(t, errors.Is(err, ErrOutOfStock))
+	}
+}
@@ -0,0 +1,59 @@
+package rpc
+
+import (
+	"errors"
+)
+
+type (
+	// ErrorEncoder returns the *Error sent to callers of a method failing
+	// with err, or nil to send it as usual. It lets applications with their
+	// own error types control the Code, Message and Details of responses.
+	ErrorEncoder func(err error) *Error
+	// ErrorDecoder returns the error a call failing with the given *Error
+	// returns, eg. a domain error rebuilt from its Code and Details, or nil
+	// to return it as usual.
+	ErrorDecoder func(e *Error) error
+)
+
+// WithErrorEncoder encodes the errors sent to callers with enc, including
+// those of calls the service rejects, such as unknown methods. Errors are
+// encoded after being mapped, see WithErrorMapper.
+func WithErrorEncoder(enc ErrorEncoder) ServiceOption {
+	return func(s *Service) {
+		s.errorEncoder = enc
+	}
+}
+
+// WithErrorDecoder decodes the errors calls made by the client fail with,
+// when the server returns them, with dec.
+func WithErrorDecoder(dec ErrorDecoder) Option {
+	return func(o *clientOptions) {
+		o.errorDecoder = dec
+	}
+}
+
+// encode returns the error err is sent to callers as.
+func (enc ErrorEncoder) encode(err error) error {
+	if enc == nil || err == nil {
+		return err
+	}
+	if e := enc(err); e != nil {
+		return e
+	}
+	return err
+}
+
+// decode returns the error a call failing with err returns.
+func (dec ErrorDecoder) decode(err error) error {
+	if dec == nil || err == nil {
+		return err
+	}
+	var rerr *Error
+	if !errors.As(err, &rerr) {
+		return err
+	}
+	if derr := dec(rerr); derr != nil {
+		return derr
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// LedgerError is an error of an application's own taxonomy.
+type LedgerError struct {
+	Kind    string
+	Account string
+}
+
+func (e *LedgerError) Error() string {
+	return e.Kind + " on " + e.Account
+}
+
+type Bank struct{}
+
+type WithdrawRequest struct {
+	Account string
+	Amount  int
+}
+
+func (b *Bank) Withdraw(req *WithdrawRequest, res *AddResponse) error {
+	if req.Amount > 10 {
+		return &LedgerError{Kind: "insufficient_funds", Account: req.Account}
+	}
+	if req.Amount < 0 {
+		return errors.New("negative amount")
+	}
+	return nil
+}
+
+func TestWithErrorEncoder(t *testing.T) {
+	s := New(WithErrorEncoder(func(err error) *Error {
+		var lerr *LedgerError
+		if errors.As(err, &lerr) {
+			return &Error{
+				Code:    "ledger." + lerr.Kind,
+				Message: "ledger error",
+				Details: map[string]string{"account": lerr.Account},
+			}
+		}
+		if errors.Is(err, ErrMethodNotFound) {
+			return nil
+		}
+		var rerr *Error
+		if errors.As(err, &rerr) {
+			if rerr.Code == CodeAborted {
+				return &Error{Code: "ledger.aborted", Message: rerr.Message}
+			}
+			return nil
+		}
+		return &Error{Code: "ledger.internal", Message: "internal error"}
+	}))
+	require.NoError(t, s.Register(&Bank{}))
+	require.NoError(t, s.Register(&Ticker{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	ctx := context.Background()
+	decoded := 0
+	c, err := Dial(srv.URL, WithErrorDecoder(func(e *Error) error {
+		if e.Code == "ledger.insufficient_funds" {
+			decoded++
+			return &LedgerError{Kind: "insufficient_funds", Account: e.Details["account"]}
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+
+	// Domain errors are encoded, and decoded back by clients.
+	err = c.Call(ctx, "Bank.Withdraw", &WithdrawRequest{Account: "acme", Amount: 20}, &AddResponse{})
+	require.Equal(t, &LedgerError{Kind: "insufficient_funds", Account: "acme"}, err)
+	require.Equal(t, 1, decoded)
+
+	// Errors the decoder leaves alone are returned as usual.
+	err = c.Call(ctx, "Bank.Withdraw", &WithdrawRequest{Amount: -1}, &AddResponse{})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, "ledger.internal", rerr.Code)
+	require.Equal(t, "internal error", rerr.Message)
+
+	// Errors of the service itself go through the encoder too.
+	err = c.Call(ctx, "Bank.Deposit", &WithdrawRequest{}, &AddResponse{})
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeMethodNotFound, rerr.Code)
+
+	// As do those of batches and streams.
+	calls := []*BatchCall{
+		{Method: "Bank.Withdraw", Request: &WithdrawRequest{Account: "acme", Amount: 20}, Response: &AddResponse{}},
+		{Method: "Bank.Withdraw", Request: &WithdrawRequest{Amount: 1}, Response: &AddResponse{}},
+	}
+	require.NoError(t, c.Batch(ctx, false, calls...))
+	require.Equal(t, &LedgerError{Kind: "insufficient_funds", Account: "acme"}, calls[0].Error)
+	require.NoError(t, calls[1].Error)
+
+	for _, err := range CallStream[Tick](ctx, c, "Ticker.Countdown", &TickRequest{Count: 1, Fail: true}) {
+		if err != nil {
+			require.True(t, errors.As(err, &rerr), "%v", err)
+		}
+	}
+	require.Equal(t, "ledger.aborted", rerr.Code)
+}
@@ -0,0 +1,159 @@
+package rpc
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error codes returned by the server.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodePermissionDenied = "permission_denied"
+	CodeUnauthenticated  = "unauthenticated"
+	CodeQuotaExceeded    = "quota_exceeded"
+	CodeUnavailable      = "unavailable"
+	CodeResponseTooLarge = "response_too_large"
+	CodeDeadlineExceeded = "deadline_exceeded"
+	CodeCanceled         = "canceled"
+	CodeRequestTooLarge  = "request_too_large"
+	CodeAborted          = "aborted"
+	CodeDisabled         = "disabled"
+	CodeMethodNotFound   = "method_not_found"
+	CodeChecksumMismatch = "checksum_mismatch" // see WithChecksums
+	CodeTooManyStreams   = "too_many_streams"  // see WithStreamLimits
+)
+
+// codeStatus maps error codes to the HTTP status they are served with.
+var codeStatus = map[string]int{
+	CodeInvalidRequest:   http.StatusBadRequest,
+	CodePermissionDenied: http.StatusForbidden,
+	CodeUnauthenticated:  http.StatusUnauthorized,
+	CodeQuotaExceeded:    http.StatusTooManyRequests,
+	CodeUnavailable:      http.StatusServiceUnavailable,
+	CodeResponseTooLarge: http.StatusInternalServerError,
+	CodeDeadlineExceeded: http.StatusGatewayTimeout,
+	CodeRequestTooLarge:  http.StatusRequestEntityTooLarge,
+	CodeAborted:          http.StatusConflict,
+	CodeDisabled:         http.StatusServiceUnavailable,
+	CodeMethodNotFound:   http.StatusNotFound,
+	CodeChecksumMismatch: http.StatusBadRequest,
+	CodeTooManyStreams:   http.StatusTooManyRequests,
+	// Nginx's non-standard "client closed request".
+	CodeCanceled: 499,
+}
+
+// retryableCodes are the error codes of calls that can safely be retried.
+var retryableCodes = map[string]bool{
+	CodeUnavailable: true,
+}
+
+// Error is an error carrying a machine readable code.
+// Errors returned by the server are decoded into an *Error by the client.
+type Error struct {
+	Code    string            // machine readable error code, if any
+	Message string            // human readable error message
+	Details map[string]string // additional information about the error
+	Chain   []ErrorLink       `json:",omitempty"` // wrapped errors, see RegisterError
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the chain of errors the error wraps, of which registered
+// errors can be found with errors.Is and errors.As, see RegisterError.
+func (e *Error) Unwrap() error {
+	return decodeErrorChain(e.Chain)
+}
+
+// Retryable returns whether the call was rejected without being processed,
+// and can be retried.
+func (e *Error) Retryable() bool {
+	return retryableCodes[e.Code] || e.RetryAfter() > 0
+}
+
+// RetryAfterDetail is the detail of errors holding how many seconds
+// callers should wait before retrying the call, see Error.RetryAfter.
+const RetryAfterDetail = "retry_after"
+
+// RetryAfter returns how long callers should wait before retrying the
+// call, or 0 if the error has no such hint.
+func (e *Error) RetryAfter() time.Duration {
+	secs, err := strconv.Atoi(e.Details[RetryAfterDetail])
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// SetRetryAfter sets how long callers should wait before retrying the
+// call, rounded up to the second, and returns e. Such errors are served
+// with a Retry-After header, and retried after the delay by clients with a
+// RetryPolicy.
+func (e *Error) SetRetryAfter(d time.Duration) *Error {
+	if d <= 0 {
+		return e
+	}
+	if e.Details == nil {
+		e.Details = map[string]string{}
+	}
+	secs := (d + time.Second - 1) / time.Second
+	e.Details[RetryAfterDetail] = strconv.FormatInt(int64(secs), 10)
+	return e
+}
+
+// writeError writes an error response for the given request.
+// req may be nil if the request could not be decoded.
+func writeError(w http.ResponseWriter, codec Codec, req *Request, err error) {
+	res, status := errorResponse(req, err)
+	var rerr *Error
+	if errors.As(err, &rerr) && rerr.RetryAfter() > 0 {
+		w.Header().Set("Retry-After", rerr.Details[RetryAfterDetail])
+	}
+	resBytes, err := codec.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.WriteHeader(status)
+	_, _ = w.Write(resBytes)
+}
+
+// errorResponse returns the response for the given request failing with
+// err, and its HTTP status.
+// req may be nil if the request could not be decoded.
+func errorResponse(req *Request, err error) (Response, int) {
+	res := Response{
+		Error: err.Error(),
+		Chain: encodeErrorChain(err),
+	}
+	if req != nil {
+		res.ServiceMethod = req.ServiceMethod
+		res.Seq = req.Seq
+		res.Version = req.Version
+	}
+
+	var rerr *Error
+	if errors.As(err, &rerr) {
+		res.Code = rerr.Code
+		res.Details = rerr.Details
+		if res.Chain == nil {
+			res.Chain = rerr.Chain
+		}
+	}
+	return res, errorStatus(err)
+}
+
+// errorStatus returns the HTTP status of responses failing with err.
+func errorStatus(err error) int {
+	var rerr *Error
+	if errors.As(err, &rerr) {
+		if s, ok := codeStatus[rerr.Code]; ok {
+			return s
+		}
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,70 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"path"
+)
+
+type (
+	// ServeOption configures a handler returned by Serve.
+	ServeOption func(*serveOptions)
+	// serveOptions holds the configuration of a handler returned by Serve.
+	serveOptions struct {
+		allow []string
+		deny  []string
+	}
+	exposeKey struct{}
+)
+
+// WithAllowedMethods only exposes the methods matching one of the
+// patterns through the handler, eg. a public endpoint exposing a safe
+// subset of the service. Patterns are matched with path.Match, so
+// "Math.*" matches every method of the Math service.
+// Other methods are handled as if they weren't registered.
+func WithAllowedMethods(patterns ...string) ServeOption {
+	return func(o *serveOptions) {
+		o.allow = append(o.allow, patterns...)
+	}
+}
+
+// WithDeniedMethods hides the methods matching one of the patterns from
+// the handler, like WithAllowedMethods. Denied methods are hidden even if
+// they are allowed.
+func WithDeniedMethods(patterns ...string) ServeOption {
+	return func(o *serveOptions) {
+		o.deny = append(o.deny, patterns...)
+	}
+}
+
+// exposes returns whether the handler exposes the method.
+func (o *serveOptions) exposes(method string) bool {
+	if matchAny(o.deny, method) {
+		return false
+	}
+	return len(o.allow) == 0 || matchAny(o.allow, method)
+}
+
+func matchAny(patterns []string, method string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// withExposed returns a copy of r whose context restricts the methods that
+// can be called to those the handler exposes, if it restricts them.
+func (o *serveOptions) withExposed(r *http.Request) *http.Request {
+	if len(o.allow) == 0 && len(o.deny) == 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), exposeKey{}, o))
+}
+
+// exposed returns whether the handler serving the call exposes the method.
+func exposed(ctx context.Context, method string) bool {
+	o, ok := ctx.Value(exposeKey{}).(*serveOptions)
+	return !ok || o.exposes(method)
+}
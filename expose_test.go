@@ -0,0 +1,35 @@
+package rpc
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Serve_ExposedMethods(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Register(&Counter{}))
+
+	internal := httptest.NewServer(s.Serve())
+	defer internal.Close()
+	public := httptest.NewServer(s.Serve(
+		WithAllowedMethods("Math.*", "Counter.*"),
+		WithDeniedMethods("Counter.Inc"),
+	))
+	defer public.Close()
+
+	call := func(uri, method string) error {
+		c, err := Dial(uri)
+		require.NoError(t, err)
+		return c.Call(context.Background(), method, &AddRequest{A: 1, B: 2}, &AddResponse{})
+	}
+	require.NoError(t, call(internal.URL, "Math.Add"))
+	require.NoError(t, call(internal.URL, "Counter.Inc"))
+	require.NoError(t, call(internal.URL, PingMethod))
+	require.NoError(t, call(public.URL, "Math.Add"))
+	require.Error(t, call(public.URL, "Counter.Inc"))
+	require.Error(t, call(public.URL, PingMethod))
+}
@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// FlatBuffersCodec encodes bodies that are FlatBuffers tables generated by
+// flatc as their finished buffers, and decodes them by pointing tables at
+// the bytes received, so consumers access their fields in place without a
+// deserialization pass. Tables are recognized by the Init and Table
+// methods flatc generates, so the codec doesn't depend on the flatbuffers
+// module.
+//
+// Envelopes are framed as the big-endian 4 byte length of their other
+// fields, encoded as JSON, followed by their body, which is decoded
+// without being copied.
+//
+// Methods whose request or response types aren't tables fail to register
+// with services using the codec, including the built-in ones, such as
+// PingMethod, which are left out.
+type FlatBuffersCodec struct{}
+
+func (FlatBuffersCodec) ContentType() string {
+	return "application/x-flatbuffers"
+}
+
+func (FlatBuffersCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case *Request:
+		req := *v
+		req.Body = nil
+		return frameFlatBuffersEnvelope(req, v.Body)
+	case Request:
+		return FlatBuffersCodec{}.Marshal(&v)
+	case *Response:
+		res := *v
+		res.Body = nil
+		return frameFlatBuffersEnvelope(res, v.Body)
+	case Response:
+		return FlatBuffersCodec{}.Marshal(&v)
+	}
+
+	rv := reflect.ValueOf(v)
+	if !isFlatBuffersTable(rv.Type()) {
+		return nil, fmt.Errorf("rpc: %T isn't a flatbuffers table", v)
+	}
+	if rv.IsNil() {
+		return nil, errors.New("rpc: can't encode a nil flatbuffers table")
+	}
+	// Table().Bytes is the buffer the table was finished in.
+	table := rv.MethodByName("Table").Call(nil)[0]
+	return table.FieldByName("Bytes").Bytes(), nil
+}
+
+func (FlatBuffersCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *Request:
+		body, err := unframeFlatBuffersEnvelope(data, v)
+		v.Body = body
+		return err
+	case *Response:
+		body, err := unframeFlatBuffersEnvelope(data, v)
+		v.Body = body
+		return err
+	}
+
+	// Allocate pointers to pointers to tables, as methods take.
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !isFlatBuffersTable(rv.Type()) {
+		if rv.Elem().Kind() != reflect.Ptr {
+			return fmt.Errorf("rpc: %T isn't a flatbuffers table", v)
+		}
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Type().Elem().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("rpc: can't decode flatbuffers into %T", v)
+	}
+	if len(data) < 4 {
+		return errors.New("rpc: flatbuffers buffer too short")
+	}
+	root := binary.LittleEndian.Uint32(data)
+	if int64(root) >= int64(len(data)) {
+		return errors.New("rpc: invalid flatbuffers root offset")
+	}
+	init := rv.MethodByName("Init")
+	init.Call([]reflect.Value{
+		reflect.ValueOf(data),
+		reflect.ValueOf(root).Convert(init.Type().In(1)),
+	})
+	return nil
+}
+
+// CheckType checks t, the type of the request or response of a method, is
+// a pointer to a table.
+func (FlatBuffersCodec) CheckType(t reflect.Type) error {
+	if !isFlatBuffersTable(t) {
+		return fmt.Errorf("%s isn't a flatbuffers table", t)
+	}
+	return nil
+}
+
+// isFlatBuffersTable returns whether t is a pointer to a table generated
+// by flatc, with methods:
+//
+//	func (rcv *T) Init(buf []byte, i flatbuffers.UOffsetT)
+//	func (rcv *T) Table() flatbuffers.Table
+func isFlatBuffersTable(t reflect.Type) bool {
+	if t.Kind() != reflect.Ptr {
+		return false
+	}
+	init, ok := t.MethodByName("Init")
+	if !ok || init.Type.NumIn() != 3 || init.Type.NumOut() != 0 ||
+		init.Type.In(1) != reflect.TypeOf([]byte(nil)) || init.Type.In(2).Kind() != reflect.Uint32 {
+		return false
+	}
+	table, ok := t.MethodByName("Table")
+	if !ok || table.Type.NumIn() != 1 || table.Type.NumOut() != 1 ||
+		table.Type.Out(0).Kind() != reflect.Struct {
+		return false
+	}
+	bytes, ok := table.Type.Out(0).FieldByName("Bytes")
+	return ok && bytes.Type == reflect.TypeOf([]byte(nil))
+}
+
+// frameFlatBuffersEnvelope returns the envelope, without its body, framed
+// with the body.
+func frameFlatBuffersEnvelope(envelope interface{}, body []byte) ([]byte, error) {
+	header, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 4, 4+len(header)+len(body))
+	binary.BigEndian.PutUint32(out, uint32(len(header)))
+	out = append(out, header...)
+	return append(out, body...), nil
+}
+
+// unframeFlatBuffersEnvelope decodes the framed envelope into v, returning
+// its body, which refers to data.
+func unframeFlatBuffersEnvelope(data []byte, v interface{}) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errors.New("rpc: flatbuffers envelope too short")
+	}
+	n := binary.BigEndian.Uint32(data)
+	if int64(n) > int64(len(data)-4) {
+		return nil, errors.New("rpc: flatbuffers envelope too short")
+	}
+	if err := json.Unmarshal(data[4:4+n], v); err != nil {
+		return nil, err
+	}
+	if body := data[4+n:]; len(body) > 0 {
+		return body, nil
+	}
+	return nil, nil
+}
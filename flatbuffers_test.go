@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Pair mimics the code flatc generates for:
+//
+//	table Pair { a:int; b:int; }
+type (
+	fbUOffsetT uint32
+	fbTable    struct {
+		Bytes []byte
+		Pos   fbUOffsetT
+	}
+	Pair struct {
+		_tab fbTable
+	}
+)
+
+func (rcv *Pair) Init(buf []byte, i fbUOffsetT) {
+	rcv._tab.Bytes = buf
+	rcv._tab.Pos = i
+}
+
+func (rcv *Pair) Table() fbTable {
+	return rcv._tab
+}
+
+func (rcv *Pair) A() int32 {
+	return rcv.field(0)
+}
+
+func (rcv *Pair) B() int32 {
+	return rcv.field(1)
+}
+
+func (rcv *Pair) field(i int) int32 {
+	buf, pos := rcv._tab.Bytes, int(rcv._tab.Pos)
+	vtable := pos - int(int32(binary.LittleEndian.Uint32(buf[pos:])))
+	if 4+2*i >= int(binary.LittleEndian.Uint16(buf[vtable:])) {
+		return 0
+	}
+	off := int(binary.LittleEndian.Uint16(buf[vtable+4+2*i:]))
+	return int32(binary.LittleEndian.Uint32(buf[pos+off:]))
+}
+
+// newPair builds a finished buffer holding a Pair, like a flatbuffers
+// Builder would.
+func newPair(a, b int32) *Pair {
+	buf := make([]byte, 24)
+	binary.LittleEndian.PutUint32(buf[0:], 12) // root table
+	binary.LittleEndian.PutUint16(buf[4:], 8)  // vtable size
+	binary.LittleEndian.PutUint16(buf[6:], 12) // table size
+	binary.LittleEndian.PutUint16(buf[8:], 4)  // offset of a
+	binary.LittleEndian.PutUint16(buf[10:], 8) // offset of b
+	binary.LittleEndian.PutUint32(buf[12:], 8) // table to vtable
+	binary.LittleEndian.PutUint32(buf[16:], uint32(a))
+	binary.LittleEndian.PutUint32(buf[20:], uint32(b))
+	p := &Pair{}
+	p.Init(buf, 12)
+	return p
+}
+
+type PairMath struct{}
+
+func (PairMath) Add(req *Pair, res *Pair) error {
+	if req.A() < 0 {
+		return errors.New("negative")
+	}
+	*res = *newPair(req.A()+req.B(), 0)
+	return nil
+}
+
+func TestFlatBuffersCodec(t *testing.T) {
+	s := New(WithCodec(FlatBuffersCodec{}))
+	require.NoError(t, s.Register(&PairMath{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	res := &Pair{}
+	require.NoError(t, s.Call(http.DefaultClient, srv.URL, "PairMath.Add", newPair(1, 2), res))
+	require.Equal(t, int32(3), res.A())
+
+	err := s.Call(http.DefaultClient, srv.URL, "PairMath.Add", newPair(-1, 2), res)
+	require.EqualError(t, err, "rpc: server: negative")
+
+	// Methods of other types fail to register, as a whole.
+	err = s.Register(&Math{})
+	require.EqualError(t, err, "rpc: method Math.Add: *rpc.AddRequest isn't a flatbuffers table")
+	_, ok := s.Methods["Math.Add"]
+	require.False(t, ok)
+	// Built-in methods are left out.
+	_, ok = s.Methods[PingMethod]
+	require.False(t, ok)
+}
+
+func TestFlatBuffersCodec_ZeroCopy(t *testing.T) {
+	codec := FlatBuffersCodec{}
+	body, err := codec.Marshal(newPair(4, 5))
+	require.NoError(t, err)
+	reqBytes, err := codec.Marshal(&Request{ServiceMethod: "PairMath.Add", Body: body, Seq: 1})
+	require.NoError(t, err)
+
+	// Bodies of envelopes, and the tables decoded from them, refer to the
+	// bytes received.
+	req := &Request{}
+	require.NoError(t, codec.Unmarshal(reqBytes, req))
+	require.Equal(t, "PairMath.Add", req.ServiceMethod)
+	require.Same(t, &reqBytes[len(reqBytes)-len(body)], &req.Body[0])
+	var p *Pair
+	require.NoError(t, codec.Unmarshal(req.Body, &p))
+	require.Same(t, &req.Body[0], &p.Table().Bytes[0])
+	require.Equal(t, int32(4), p.A())
+	require.Equal(t, int32(5), p.B())
+
+	_, err = codec.Marshal(&AddRequest{})
+	require.EqualError(t, err, "rpc: *rpc.AddRequest isn't a flatbuffers table")
+	require.Error(t, codec.Unmarshal([]byte{1}, &Pair{}))
+}
@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"net/http"
+)
+
+// ResponseFormatter writes the error responses of a service in place of
+// their envelopes, eg. to match the error shape an API gateway expects.
+// See WithResponseFormatter.
+type ResponseFormatter interface {
+	// FormatError writes the response of a request failing with err,
+	// which would be sent with the given HTTP status, setting its status
+	// and headers. err is encoded as callers would see it, see
+	// WithErrorEncoder, and req is nil if the request couldn't be decoded.
+	FormatError(w http.ResponseWriter, req *Request, err error, status int)
+}
+
+// ResponseFormatterFunc adapts a function to the ResponseFormatter
+// interface.
+type ResponseFormatterFunc func(w http.ResponseWriter, req *Request, err error, status int)
+
+func (f ResponseFormatterFunc) FormatError(w http.ResponseWriter, req *Request, err error, status int) {
+	f(w, req, err, status)
+}
+
+// WithResponseFormatter writes the error responses of calls, including
+// requests the service rejects before decoding them, with f. Clients of
+// the service only decode the errors of envelopes, so formatted errors
+// are meant for other callers, such as those behind an edge proxy.
+func WithResponseFormatter(f ResponseFormatter) ServiceOption {
+	return func(s *Service) {
+		s.formatter = f
+	}
+}
+
+// writeCodecError writes the error response of req, sent with the HTTP
+// request r, encoded with codec, or formatted by the service's
+// ResponseFormatter.
+func (s *Service) writeCodecError(w http.ResponseWriter, r *http.Request, codec Codec, req *Request, err error) {
+	err = s.errorEncoder.encode(err)
+	lang, err := s.localize(r.Header.Get("Accept-Language"), err)
+	if lang != "" {
+		w.Header().Set("Content-Language", lang)
+	}
+	if s.formatter != nil {
+		s.formatter.FormatError(w, req, err, errorStatus(err))
+		return
+	}
+	writeError(w, codec, req, err)
+}
+
+// errBadRequest is the error of requests that can't be decoded.
+var errBadRequest = &Error{
+	Code:    CodeInvalidRequest,
+	Message: "Bad request",
+}
+
+// httpError writes the plain text error of a request rejected with the
+// given status, or formats it as err.
+func (s *Service) httpError(w http.ResponseWriter, status int, err *Error) {
+	if s.formatter != nil {
+		s.formatter.FormatError(w, nil, err, status)
+		return
+	}
+	http.Error(w, err.Message, status)
+}
@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// edgeError is the error shape of an edge proxy.
+type edgeError struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+	Method string `json:"method,omitempty"`
+}
+
+func TestWithResponseFormatter(t *testing.T) {
+	s := New(
+		WithResponseFormatter(ResponseFormatterFunc(func(w http.ResponseWriter, req *Request, err error, status int) {
+			e := edgeError{Status: status, Code: "internal", Detail: err.Error()}
+			if rerr, ok := err.(*Error); ok {
+				e.Code = rerr.Code
+				e.Detail = rerr.Message
+			}
+			if req != nil {
+				e.Method = req.ServiceMethod
+			}
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.Header().Set("X-Edge-Error", e.Code)
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(e)
+		})),
+		WithErrorEncoder(func(err error) *Error {
+			if err == errOverflow {
+				return &Error{Code: CodeInvalidRequest, Message: "operands too large"}
+			}
+			return nil
+		}),
+	)
+	require.NoError(t, s.Register(&Checked{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	post := func(method, contentType, body string) (*http.Response, edgeError) {
+		req, err := http.NewRequest(method, srv.URL, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		e := edgeError{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&e))
+		require.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+		require.Equal(t, e.Code, resp.Header.Get("X-Edge-Error"))
+		return resp, e
+	}
+
+	// Errors of calls, encoded.
+	resp, e := post("POST", "application/json", `{"ServiceMethod":"Checked.Add","Body":{"A":1000}}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, edgeError{Status: 400, Code: CodeInvalidRequest, Detail: "operands too large", Method: "Checked.Add"}, e)
+
+	resp, e = post("POST", "application/json", `{"ServiceMethod":"Checked.Sub","Body":{}}`)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, CodeMethodNotFound, e.Code)
+
+	// Requests rejected before being decoded.
+	resp, e = post("POST", "application/json", `{`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, edgeError{Status: 400, Code: CodeInvalidRequest, Detail: "Bad request"}, e)
+
+	resp, _ = post("GET", "application/json", "")
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, _ = post("POST", "text/plain", "")
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	// Successful calls are sent as usual.
+	res := &AddResponse{}
+	require.NoError(t, s.Call(http.DefaultClient, srv.URL, "Checked.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 3, res.X)
+}
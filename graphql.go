@@ -0,0 +1,295 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type (
+	// GraphQLResolver resolves a field of the GraphQL schema of a service,
+	// given the field's arguments.
+	GraphQLResolver func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+	// graphQLBuilder builds GraphQL type definitions, collecting named
+	// struct types so recursive types can be described.
+	graphQLBuilder struct {
+		defs   map[string]string
+		names  []string
+		types  map[reflect.Type]string // names of structs, without the suffix of inputs
+		named  map[string]bool         // names of structs taken
+		scalar bool                    // whether the JSON scalar is used
+	}
+)
+
+// graphQLReserved are the names of GraphQL types not available to structs.
+var graphQLReserved = map[string]bool{
+	"Query": true, "Mutation": true, "JSON": true,
+	"String": true, "Int": true, "Float": true, "Boolean": true, "ID": true,
+}
+
+// graphQLName matches valid GraphQL names.
+var graphQLName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// graphQLInvalid matches the characters invalid in GraphQL names.
+var graphQLInvalid = regexp.MustCompile(`[^_0-9A-Za-z]`)
+
+// WithReadOnly marks the method as having no side effects.
+func WithReadOnly() MethodOption {
+	return func(m *Method) {
+		m.ReadOnly = true
+	}
+}
+
+// GraphQLSchema returns the GraphQL schema, in SDL, of the service's
+// methods. Read-only methods are fields of the Query type, and other
+// methods are fields of the Mutation type. Fields are named after methods,
+// with "." replaced by "_", and take the request body as an "input"
+// argument unless it has no fields. Descriptions of methods, see
+// WithDescription, are the descriptions of their fields.
+// GraphQL requires a Query type, so at least one method should be marked
+// with WithReadOnly.
+func (s *Service) GraphQLSchema() string {
+	b := &graphQLBuilder{defs: map[string]string{}}
+	roots := map[string][]string{}
+	for _, name := range s.graphQLFields() {
+		m := s.Methods[name]
+		field := graphQLFieldName(name)
+		// Bodies are always sent, so they are never null.
+		if input := b.typeRef(m.RequestType.Elem(), true); input != "" {
+			field += "(input: " + input + ")"
+		}
+		field += ": " + b.typeRef(m.ResponseType.Elem(), false)
+		if m.Doc.Description != "" {
+			field = graphQLDescription(m.Doc.Description) + "\n  " + field
+		}
+		root := graphQLRoot(m)
+		roots[root] = append(roots[root], field)
+	}
+
+	sb := &strings.Builder{}
+	if b.scalar {
+		sb.WriteString("scalar JSON\n\n")
+	}
+	for _, root := range []string{"Query", "Mutation"} {
+		if len(roots[root]) == 0 {
+			continue
+		}
+		fmt.Fprintf(sb, "type %s {\n", root)
+		for _, field := range roots[root] {
+			fmt.Fprintf(sb, "  %s\n", field)
+		}
+		sb.WriteString("}\n\n")
+	}
+	sort.Strings(b.names)
+	for _, name := range b.names {
+		sb.WriteString(b.defs[name])
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// graphQLDescription returns the description as a GraphQL string.
+func graphQLDescription(description string) string {
+	b, _ := json.Marshal(description)
+	return string(b)
+}
+
+// GraphQLResolvers returns the resolvers of the fields of GraphQLSchema,
+// keyed by type and field name, to be plugged into a GraphQL engine.
+// Resolvers call the methods the same way the service does, through its
+// authorizer and middleware, and return response bodies decoded into
+// maps, slices and scalars.
+func (s *Service) GraphQLResolvers() map[string]map[string]GraphQLResolver {
+	resolvers := map[string]map[string]GraphQLResolver{}
+	for _, name := range s.graphQLFields() {
+		root := graphQLRoot(s.Methods[name])
+		if resolvers[root] == nil {
+			resolvers[root] = map[string]GraphQLResolver{}
+		}
+		resolvers[root][graphQLFieldName(name)] = s.graphQLResolver(name)
+	}
+	return resolvers
+}
+
+func (s *Service) graphQLResolver(method string) GraphQLResolver {
+	return func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		body, err := s.codec.Marshal(args["input"])
+		if err != nil {
+			return nil, &Error{
+				Code:    CodeInvalidRequest,
+				Message: "invalid input: " + err.Error(),
+			}
+		}
+		res, err := s.callContext(ctx, &Request{
+			ServiceMethod: method,
+			Body:          body,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var out interface{}
+		if err := s.codec.Unmarshal(res.Body, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+}
+
+// graphQLFields returns the sorted names of the methods that can be
+// described in GraphQL.
+func (s *Service) graphQLFields() []string {
+	names := make([]string, 0, len(s.Methods))
+	for name := range s.Methods {
+		if graphQLName.MatchString(graphQLFieldName(name)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func graphQLFieldName(method string) string {
+	return strings.Replace(method, ".", "_", 1)
+}
+
+func graphQLRoot(m Method) string {
+	if m.ReadOnly {
+		return "Query"
+	}
+	return "Mutation"
+}
+
+// typeRef returns a reference to the GraphQL type of t, defining the types
+// it refers to. For inputs, it returns an empty string for structs without
+// fields.
+func (b *graphQLBuilder) typeRef(t reflect.Type, input bool) string {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var ref string
+	switch {
+	case t == typeOfTime:
+		ref = "String"
+	case t == typeOfRawMessage || t == typeOfEmptyInterface ||
+		t.Implements(typeOfJSONMarshaler) ||
+		reflect.PointerTo(t).Implements(typeOfJSONMarshaler):
+		ref = b.jsonScalar()
+	case t.Implements(typeOfTextMarshaler) ||
+		reflect.PointerTo(t).Implements(typeOfTextMarshaler):
+		ref = "String"
+	default:
+		switch t.Kind() {
+		case reflect.Bool:
+			ref = "Boolean"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Uintptr:
+			ref = "Int"
+		case reflect.Float32, reflect.Float64:
+			ref = "Float"
+		case reflect.String:
+			ref = "String"
+		case reflect.Slice, reflect.Array:
+			if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+				ref = "String"
+				break
+			}
+			nullable = nullable || t.Kind() == reflect.Slice
+			ref = "[" + b.typeRef(t.Elem(), input) + "]"
+		case reflect.Struct:
+			ref = b.structRef(t, input)
+			if ref == "" {
+				if input {
+					return ""
+				}
+				ref = b.jsonScalar()
+			}
+		default:
+			// Maps and other kinds have no GraphQL equivalent.
+			nullable = true
+			ref = b.jsonScalar()
+		}
+	}
+
+	if !nullable {
+		ref += "!"
+	}
+	return ref
+}
+
+// structName returns the name of the GraphQL types of the struct t. Structs
+// named like another struct, or a type of the schema, are qualified by
+// their package.
+func (b *graphQLBuilder) structName(t reflect.Type) string {
+	if name, ok := b.types[t]; ok {
+		return name
+	}
+	if b.types == nil {
+		b.types = map[reflect.Type]string{}
+		b.named = map[string]bool{}
+	}
+	name := t.Name()
+	if b.named[name] || graphQLReserved[name] {
+		name = graphQLInvalid.ReplaceAllString(qualifiedTypeName(t), "_")
+	}
+	b.types[t] = name
+	b.named[name] = true
+	return name
+}
+
+// structRef returns the name of the GraphQL type of the struct t, or an
+// empty string if t is unnamed or has no fields GraphQL can describe.
+func (b *graphQLBuilder) structRef(t reflect.Type, input bool) string {
+	if t.Name() == "" || !graphQLName.MatchString(t.Name()) {
+		return ""
+	}
+	name, kind := b.structName(t), "type"
+	if input {
+		name, kind = name+"Input", "input"
+	}
+	if def, ok := b.defs[name]; ok {
+		if def == "" {
+			return ""
+		}
+		return name
+	}
+
+	// Reserve the definition before building it, in case the type refers
+	// to itself.
+	b.defs[name] = name
+	fields := []string{}
+	for _, f := range jsonFields(t) {
+		if !graphQLName.MatchString(f.Name) {
+			continue
+		}
+		ref := "String!"
+		if !f.String {
+			ref = b.typeRef(f.Type, input)
+		}
+		if ref == "" {
+			continue
+		}
+		if input && f.OmitEmpty {
+			ref = strings.TrimSuffix(ref, "!")
+		}
+		fields = append(fields, "  "+f.Name+": "+ref+"\n")
+	}
+	if len(fields) == 0 {
+		b.defs[name] = ""
+		return ""
+	}
+	b.defs[name] = kind + " " + name + " {\n" + strings.Join(fields, "") + "}\n\n"
+	b.names = append(b.names, name)
+	return name
+}
+
+func (b *graphQLBuilder) jsonScalar() string {
+	b.scalar = true
+	return "JSON"
+}
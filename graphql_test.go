@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_GraphQLSchema(t *testing.T) {
+	s := New(WithoutPing())
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Register(&Clock{}))
+	require.NoError(t, s.Configure("Clock.Remaining", WithReadOnly()))
+
+	require.Equal(t, `type Query {
+  Clock_Remaining: RemainingResponse!
+}
+
+type Mutation {
+  Clock_Sleep(input: Int!): RemainingResponse!
+  Math_Add(input: AddRequestInput!): AddResponse!
+}
+
+input AddRequestInput {
+  A: Int!
+  B: Int!
+}
+
+type AddResponse {
+  X: Int!
+}
+
+type RemainingResponse {
+  Remaining: Int!
+  Deadline: Boolean!
+}
+`, s.GraphQLSchema())
+}
+
+func TestGraphQLSchema_Types(t *testing.T) {
+	s := New(WithoutPing())
+	require.NoError(t, s.RegisterName("Nodes", &nodes{}))
+
+	require.Equal(t, `scalar JSON
+
+type Mutation {
+  Nodes_Put(input: SchemaNodeInput!): SchemaNode!
+}
+
+type SchemaNode {
+  name: String!
+  count: String!
+  data: String!
+  labels: JSON
+  children: [SchemaNode]
+  id: String!
+  Created: String!
+}
+
+input SchemaNodeInput {
+  name: String
+  count: String!
+  data: String!
+  labels: JSON
+  children: [SchemaNodeInput]
+  id: String!
+  Created: String!
+}
+`, s.GraphQLSchema())
+}
+
+type nodes struct{}
+
+func (n *nodes) Put(req *SchemaNode, res *SchemaNode) error {
+	*res = *req
+	return nil
+}
+
+func TestService_GraphQLResolvers(t *testing.T) {
+	s := New(WithoutPing())
+	s.Authorizer = RoleAuthorizer{}
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Configure("Math.Add", WithRoles("math")))
+
+	resolvers := s.GraphQLResolvers()
+	require.Len(t, resolvers, 1)
+	add := resolvers["Mutation"]["Math_Add"]
+	require.NotNil(t, add)
+
+	args := map[string]interface{}{
+		"input": map[string]interface{}{"A": 1, "B": 2},
+	}
+
+	// Calls go through the authorizer.
+	_, err := add(context.Background(), args)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodePermissionDenied, rerr.Code)
+
+	ctx := WithPrincipal(context.Background(), Principal{Roles: []string{"math"}})
+	res, err := add(ctx, args)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"X": float64(3)}, res)
+}
+
+func TestGraphQLSchema_SameName(t *testing.T) {
+	pkg := reflect.TypeOf(AddRequest{})
+	type AddRequest struct {
+		C int
+	}
+	type Query struct {
+		D int
+	}
+	b := &graphQLBuilder{defs: map[string]string{}}
+	require.Equal(t, "AddRequest!", b.typeRef(pkg, false))
+
+	// Types named like another type, or a root type, are qualified by
+	// their package.
+	require.Equal(t, "github_com_geoah_go_rpc_AddRequest!", b.typeRef(reflect.TypeOf(AddRequest{}), false))
+	require.Equal(t, "github_com_geoah_go_rpc_AddRequestInput!", b.typeRef(reflect.TypeOf(AddRequest{}), true))
+	require.Equal(t, "github_com_geoah_go_rpc_Query!", b.typeRef(reflect.TypeOf(Query{}), false))
+	require.Equal(t, "github_com_geoah_go_rpc_AddRequest!", b.typeRef(reflect.TypeOf(AddRequest{}), false))
+}
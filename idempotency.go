@@ -0,0 +1,189 @@
+package rpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header callers set to make retries
+// of a call safe. Calls to the same method with the same key, by the same
+// principal, are only executed once.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ErrIdempotencyKeyReused is returned by IdempotencyStores beginning a
+// call with a key already recorded for a call with another request.
+var ErrIdempotencyKeyReused = errors.New("rpc: idempotency key reused for another request")
+
+// IdempotencyStore records calls made with idempotency keys and their
+// responses. Stores shared by every replica, and persisted, suppress
+// duplicate calls across replicas and restarts.
+type IdempotencyStore interface {
+	// Begin records the start of the call with the given key, and the
+	// hash of its request, unless a call with it was already started and
+	// hasn't expired. It returns whether the call should be executed and,
+	// if the earlier call completed, its response. It fails with
+	// ErrIdempotencyKeyReused if the earlier call had another hash. The
+	// record expires after ttl.
+	Begin(ctx context.Context, key, hash string, ttl time.Duration) (start bool, res *Response, err error)
+	// Complete records the response of the call started with the key.
+	Complete(ctx context.Context, key string, res *Response) error
+	// Abort forgets the call started with the key, so it can be retried.
+	Abort(ctx context.Context, key string) error
+}
+
+// Idempotency executes calls made with an IdempotencyKeyHeader only once,
+// replaying the response of the first call to retries. Failed calls are
+// not recorded, so they can be retried. Calls reusing the key of a call
+// with another request body fail with CodeInvalidRequest.
+// Read-only methods, see WithReadOnly, are always executed. Each call of a
+// batch sent with the header is executed once, see Client.Batch.
+type Idempotency struct {
+	Store IdempotencyStore // defaults to an in-memory store
+	TTL   time.Duration    // how long responses are kept, defaults to 24h
+
+	once  sync.Once
+	store IdempotencyStore
+}
+
+// Middleware returns the middleware suppressing duplicate calls.
+// Calls made while a call with the same key is in progress fail with
+// CodeUnavailable.
+func (i *Idempotency) Middleware(next Handler) Handler {
+	return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		key := HeaderFromContext(ctx).Get(IdempotencyKeyHeader)
+		if key == "" || m.ReadOnly {
+			return next(ctx, m, req)
+		}
+		p, _ := PrincipalFromContext(ctx)
+		key = m.Name + "/" + p.Subject + "/" + key
+		if isBatchCall(ctx) {
+			// Calls of a batch share its key, and are told apart by
+			// their Seq, which retries of the batch keep.
+			key += "/" + strconv.FormatUint(req.Seq, 10)
+		}
+
+		store := i.getStore()
+		ttl := i.TTL
+		if ttl <= 0 {
+			ttl = 24 * time.Hour
+		}
+		hash := sha256.Sum256(req.Body)
+		start, res, err := store.Begin(ctx, key, hex.EncodeToString(hash[:]), ttl)
+		if errors.Is(err, ErrIdempotencyKeyReused) {
+			return nil, &Error{
+				Code:    CodeInvalidRequest,
+				Message: "the idempotency key was used for another request",
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if res != nil {
+			replay := *res
+			replay.Seq = req.Seq
+			return &replay, nil
+		}
+		if !start {
+			return nil, &Error{
+				Code:    CodeUnavailable,
+				Message: "a call with the same idempotency key is in progress",
+			}
+		}
+
+		// Calls panicking are forgotten like failed ones.
+		defer func() {
+			if r := recover(); r != nil {
+				_ = store.Abort(ctx, key)
+				panic(r)
+			}
+		}()
+		res, err = next(ctx, m, req)
+		if err != nil {
+			_ = store.Abort(ctx, key)
+			return nil, err
+		}
+		if err := store.Complete(ctx, key, res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+func (i *Idempotency) getStore() IdempotencyStore {
+	i.once.Do(func() {
+		i.store = i.Store
+		if i.store == nil {
+			i.store = NewMemoryIdempotencyStore()
+		}
+	})
+	return i.store
+}
+
+type (
+	// MemoryIdempotencyStore is an IdempotencyStore keeping records in
+	// memory, for services with a single replica.
+	MemoryIdempotencyStore struct {
+		mu        sync.Mutex
+		records   map[string]idempotencyRecord
+		nextPrune time.Time
+	}
+	idempotencyRecord struct {
+		hash    string
+		res     *Response
+		expires time.Time
+	}
+)
+
+// NewMemoryIdempotencyStore returns an empty in-memory store.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: map[string]idempotencyRecord{},
+	}
+}
+
+// Begin implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Begin(ctx context.Context, key, hash string, ttl time.Duration) (bool, *Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.After(s.nextPrune) {
+		for k, r := range s.records {
+			if now.After(r.expires) {
+				delete(s.records, k)
+			}
+		}
+		s.nextPrune = now.Add(time.Minute)
+	}
+	if r, ok := s.records[key]; ok && now.Before(r.expires) {
+		if r.hash != hash {
+			return false, nil, ErrIdempotencyKeyReused
+		}
+		return false, r.res, nil
+	}
+	s.records[key] = idempotencyRecord{hash: hash, expires: now.Add(ttl)}
+	return true, nil, nil
+}
+
+// Complete implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key string, res *Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.records[key]; ok {
+		r.res = res
+		s.records[key] = r
+	}
+	return nil
+}
+
+// Abort implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Abort(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Counter struct {
+	calls int
+	fail  bool
+}
+
+func (c *Counter) Inc(req *AddRequest, res *AddResponse) error {
+	c.calls++
+	if c.fail {
+		return errors.New("failed")
+	}
+	res.X = c.calls
+	return nil
+}
+
+func idempotentContext(key string) context.Context {
+	h := http.Header{}
+	h.Set(IdempotencyKeyHeader, key)
+	return context.WithValue(context.Background(), headerKey{}, h)
+}
+
+func TestIdempotency(t *testing.T) {
+	counter := &Counter{}
+	idem := &Idempotency{}
+	s := New(WithMiddleware(idem.Middleware))
+	require.NoError(t, s.Register(counter))
+
+	call := func(ctx context.Context, seq uint64) (*Response, error) {
+		return s.callContext(ctx, &Request{
+			ServiceMethod: "Counter.Inc",
+			Body:          []byte(`{}`),
+			Seq:           seq,
+		})
+	}
+
+	// Retries replay the first response.
+	res, err := call(idempotentContext("a"), 1)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":1}`, string(res.Body))
+	res, err = call(idempotentContext("a"), 2)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":1}`, string(res.Body))
+	require.Equal(t, uint64(2), res.Seq)
+	require.Equal(t, 1, counter.calls)
+
+	// Other keys, and calls without keys, are executed.
+	_, err = call(idempotentContext("b"), 3)
+	require.NoError(t, err)
+	_, err = call(context.Background(), 4)
+	require.NoError(t, err)
+	require.Equal(t, 3, counter.calls)
+
+	// Failed calls can be retried.
+	counter.fail = true
+	_, err = call(idempotentContext("c"), 5)
+	require.Error(t, err)
+	counter.fail = false
+	_, err = call(idempotentContext("c"), 6)
+	require.NoError(t, err)
+	require.Equal(t, 5, counter.calls)
+	// Keys can't be reused for other requests.
+	_, err = s.callContext(idempotentContext("a"), &Request{
+		ServiceMethod: "Counter.Inc",
+		Body:          []byte(`{"A":1}`),
+		Seq:           7,
+	})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+	require.Equal(t, 5, counter.calls)
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryIdempotencyStore()
+
+	start, res, err := s.Begin(ctx, "k", "h", time.Hour)
+	require.NoError(t, err)
+	require.True(t, start)
+	require.Nil(t, res)
+
+	// In progress.
+	start, res, err = s.Begin(ctx, "k", "h", time.Hour)
+	require.NoError(t, err)
+	require.False(t, start)
+	require.Nil(t, res)
+
+	// Completed.
+	require.NoError(t, s.Complete(ctx, "k", &Response{Body: []byte(`1`)}))
+	start, res, err = s.Begin(ctx, "k", "h", time.Hour)
+	require.NoError(t, err)
+	require.False(t, start)
+	require.Equal(t, &Response{Body: []byte(`1`)}, res)
+
+	// Reused for another request.
+	_, _, err = s.Begin(ctx, "k", "other", time.Hour)
+	require.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	// Expired.
+	start, _, err = s.Begin(ctx, "e", "h", -time.Second)
+	require.NoError(t, err)
+	require.True(t, start)
+	start, _, err = s.Begin(ctx, "e", "h", time.Hour)
+	require.NoError(t, err)
+	require.True(t, start)
+}
+
+func TestIdempotency_Batch(t *testing.T) {
+	counter := &Counter{}
+	idem := &Idempotency{}
+	s := New(WithMiddleware(idem.Middleware))
+	require.NoError(t, s.Register(counter))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	ctx := WithOutgoingHeader(context.Background(), IdempotencyKeyHeader, "a")
+
+	batch := func() []int {
+		first, second := &AddResponse{}, &AddResponse{}
+		require.NoError(t, c.Batch(ctx, false,
+			&BatchCall{Method: "Counter.Inc", Request: &AddRequest{}, Response: first},
+			&BatchCall{Method: "Counter.Inc", Request: &AddRequest{}, Response: second},
+		))
+		return []int{first.X, second.X}
+	}
+
+	// Each call of a batch is executed, once.
+	require.Equal(t, []int{1, 2}, batch())
+	require.Equal(t, []int{1, 2}, batch())
+	require.Equal(t, 2, counter.calls)
+}
+
+func TestIdempotency_Panic(t *testing.T) {
+	idem := &Idempotency{}
+	m := Method{Name: "Counter.Inc"}
+	ctx := idempotentContext("a")
+	require.Panics(t, func() {
+		idem.Middleware(func(ctx context.Context, m Method, req *Request) (*Response, error) {
+			panic("boom")
+		})(ctx, m, &Request{}) // nolint: errcheck
+	})
+
+	// Calls that panicked can be retried.
+	res, err := idem.Middleware(func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		return &Response{Body: []byte(`1`)}, nil
+	})(ctx, m, &Request{})
+	require.NoError(t, err)
+	require.Equal(t, []byte(`1`), []byte(res.Body))
+}
@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Implement returns a T whose func fields call the methods of the same
+// name of the given remote service, giving typed clients without
+// generating code.
+//
+// Go can't construct types implementing an interface at runtime, so T
+// must be a struct whose exported fields are funcs of the shape
+//
+//	func(ctx context.Context, req *Request) (*Response, error)
+//
+// For example:
+//
+//	type MathClient struct {
+//		Add func(context.Context, *AddRequest) (*AddResponse, error)
+//	}
+//
+//	math, err := rpc.Implement[MathClient](client, "Math")
+//	res, err := math.Add(ctx, &AddRequest{A: 1, B: 2})
+//
+// Use the codegen tool for clients implementing an interface.
+func Implement[T any](client *Client, service string) (T, error) {
+	var t T
+	v := reflect.ValueOf(&t).Elem()
+	if v.Kind() != reflect.Struct {
+		return t, fmt.Errorf("rpc: can't implement %s, it must be a struct of funcs", v.Type())
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() != reflect.Func ||
+			ft.NumIn() != 2 || ft.In(0) != typeOfContext || ft.In(1).Kind() != reflect.Ptr ||
+			ft.NumOut() != 2 || ft.Out(0).Kind() != reflect.Ptr || ft.Out(1) != typeOfError {
+			return t, fmt.Errorf(
+				"rpc: can't implement %s.%s, it must be a func(context.Context, *Request) (*Response, error)",
+				v.Type(), f.Name,
+			)
+		}
+
+		method := service + "." + f.Name
+		resType := ft.Out(0).Elem()
+		v.Field(i).Set(reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+			ctx, _ := args[0].Interface().(context.Context)
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			res := reflect.New(resType)
+			err := client.Call(ctx, method, args[1].Interface(), res.Interface())
+			if err != nil {
+				return []reflect.Value{
+					reflect.Zero(ft.Out(0)),
+					reflect.ValueOf(&err).Elem(),
+				}
+			}
+			return []reflect.Value{
+				res,
+				reflect.Zero(typeOfError),
+			}
+		}))
+	}
+
+	return t, nil
+}
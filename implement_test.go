@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type MathClient struct {
+	Add func(context.Context, *AddRequest) (*AddResponse, error)
+	Sub func(context.Context, *AddRequest) (*AddResponse, error)
+}
+
+func TestImplement(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+
+	math, err := Implement[MathClient](c, "Math")
+	require.NoError(t, err)
+
+	res, err := math.Add(context.Background(), &AddRequest{A: 1, B: 2})
+	require.NoError(t, err)
+	require.Equal(t, 3, res.X)
+
+	res, err = math.Sub(context.Background(), &AddRequest{A: 1, B: 2})
+	require.Error(t, err)
+	require.Nil(t, res)
+}
+
+func TestImplement_Invalid(t *testing.T) {
+	c, err := Dial("http://localhost")
+	require.NoError(t, err)
+
+	_, err = Implement[interface{ Add() }](c, "Math")
+	require.Error(t, err)
+
+	_, err = Implement[struct{ Add func(int) int }](c, "Math")
+	require.Error(t, err)
+}
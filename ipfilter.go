@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPFilter allows or denies requests based on the client's IP address.
+// Deny rules take precedence over Allow rules; if Allow is empty all
+// addresses that are not denied are allowed.
+// X-Forwarded-For is only trusted for requests coming from TrustedProxies.
+type IPFilter struct {
+	Allow          []*net.IPNet
+	Deny           []*net.IPNet
+	TrustedProxies []*net.IPNet
+}
+
+// ParseCIDRs parses a list of CIDRs, or plain IP addresses, for use with
+// IPFilter.
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("rpc: invalid ip %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("rpc: invalid cidr %q: %v", cidr, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Middleware returns an http middleware that rejects requests from clients
+// that are not allowed by the filter.
+func (f *IPFilter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := f.ClientIP(r)
+		if ip == nil || !f.Allowed(ip) {
+			writeError(w, JSONCodec{}, nil, &Error{
+				Code:    CodePermissionDenied,
+				Message: "permission denied: address not allowed",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allowed returns whether the given address is allowed by the filter.
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	if containsIP(f.Deny, ip) {
+		return false
+	}
+	return len(f.Allow) == 0 || containsIP(f.Allow, ip)
+}
+
+// ClientIP returns the address of the client that made the request.
+// If the request came through trusted proxies, the right-most untrusted
+// address of the X-Forwarded-For header is used.
+func (f *IPFilter) ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(f.TrustedProxies, ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// Garbage in the header, we can't trust anything left of it.
+			return ip
+		}
+		ip = hop
+		if !containsIP(f.TrustedProxies, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package rpc
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPFilter_ClientIP(t *testing.T) {
+	proxies, err := ParseCIDRs("10.0.0.0/8")
+	require.NoError(t, err)
+	f := &IPFilter{TrustedProxies: proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"direct", "192.0.2.1:1234", "", "192.0.2.1"},
+		{"untrusted proxy", "192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"trusted proxy", "10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.0.0.1:1234", "203.0.113.9, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"garbage", "10.0.0.1:1234", "nope", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			require.Equal(t, tt.want, f.ClientIP(r).String())
+		})
+	}
+}
+
+func TestIPFilter_Allowed(t *testing.T) {
+	allow, err := ParseCIDRs("10.0.0.0/8", "192.0.2.1")
+	require.NoError(t, err)
+	deny, err := ParseCIDRs("10.1.0.0/16")
+	require.NoError(t, err)
+	f := &IPFilter{Allow: allow, Deny: deny}
+
+	require.True(t, f.Allowed(net.ParseIP("10.0.0.1")))
+	require.True(t, f.Allowed(net.ParseIP("192.0.2.1")))
+	require.False(t, f.Allowed(net.ParseIP("192.0.2.2")))
+	require.False(t, f.Allowed(net.ParseIP("10.1.0.1")))
+}
+
+func TestIPFilter_Middleware(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+
+	allow, err := ParseCIDRs("192.0.2.0/24")
+	require.NoError(t, err)
+	f := &IPFilter{Allow: allow}
+	srv := httptest.NewServer(f.Middleware(s.Serve()))
+	defer srv.Close()
+
+	err = s.Call(http.DefaultClient, srv.URL, "Math.Add", &AddRequest{}, &AddResponse{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "address not allowed")
+}
@@ -0,0 +1,280 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Journal is a write-ahead journal of calls to mutating methods, kept in
+	// a file. Calls are recorded before they are executed, and marked as
+	// completed once they return, so calls interrupted by a crash can be
+	// found with Pending when the journal is opened again, and replayed or
+	// reported.
+	Journal struct {
+		// ManualCompletion leaves marking calls as completed to the
+		// application, with Complete and the ID from JournalIDFromContext,
+		// eg. once their effects are durable.
+		ManualCompletion bool
+		// ErrorLog logs the errors of marking calls as completed in
+		// Middleware, which aren't returned to callers. It defaults to the
+		// standard logger of the log package.
+		ErrorLog *log.Logger
+
+		mu      sync.Mutex
+		f       *os.File
+		size    int64 // of the records written in full
+		next    uint64
+		pending map[uint64]JournalEntry
+	}
+	// JournalEntry is a call recorded in a journal.
+	JournalEntry struct {
+		ID            uint64
+		ServiceMethod string
+		Body          json.RawMessage
+		Time          time.Time
+		Principal     *Principal `json:",omitempty"` // of the caller, if authenticated
+	}
+	// journalRecord is a line of the journal file, recording the start of
+	// a call or its completion.
+	journalRecord struct {
+		Entry     *JournalEntry `json:",omitempty"`
+		Completed uint64        `json:",omitempty"`
+	}
+	journalIDKey struct{}
+)
+
+// OpenJournal opens the journal at path, creating it if needed. Calls the
+// journal records as started but not completed are returned by Pending.
+// The file is compacted to hold only those calls.
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{
+		next:    1,
+		pending: map[uint64]JournalEntry{},
+	}
+	if err := j.load(path); err != nil {
+		return nil, err
+	}
+
+	// Rewrite the journal with only the pending calls, and swap it in.
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("rpc: error compacting journal: %v", err)
+	}
+	j.f = f
+	for _, e := range j.Pending() {
+		e := e
+		if err := j.write(journalRecord{Entry: &e}); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("rpc: error compacting journal: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("rpc: error compacting journal: %v", err)
+	}
+	return j, nil
+}
+
+// load reads the journal file at path, if any.
+func (j *Journal) load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("rpc: error opening journal: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		rec := journalRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A torn write, from a crash. Records written after it, if
+			// any, were written in full.
+			continue
+		}
+		switch {
+		case rec.Entry != nil:
+			j.pending[rec.Entry.ID] = *rec.Entry
+			if rec.Entry.ID >= j.next {
+				j.next = rec.Entry.ID + 1
+			}
+		case rec.Completed != 0:
+			delete(j.pending, rec.Completed)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("rpc: error reading journal: %v", err)
+	}
+	return nil
+}
+
+// Middleware records calls to methods that aren't read-only in the
+// journal before executing them. Calls are marked as completed when they
+// return, unless ManualCompletion is set.
+// Calls fail with CodeUnavailable if they can't be recorded. Calls that
+// can't be marked as completed return their result, and the error is
+// logged to ErrorLog, leaving them pending.
+func (j *Journal) Middleware(next Handler) Handler {
+	return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		if m.ReadOnly {
+			return next(ctx, m, req)
+		}
+
+		id, err := j.begin(ctx, req)
+		if err != nil {
+			return nil, &Error{
+				Code:    CodeUnavailable,
+				Message: err.Error(),
+			}
+		}
+		res, err := next(context.WithValue(ctx, journalIDKey{}, id), m, req)
+		if !j.ManualCompletion {
+			if cerr := j.Complete(id); cerr != nil {
+				j.logf("rpc: completing call %d to %s: %v", id, m.Name, cerr)
+			}
+		}
+		return res, err
+	}
+}
+
+// JournalIDFromContext returns the ID of the journal entry of the call
+// being served, if it was recorded in a journal.
+func JournalIDFromContext(ctx context.Context) (uint64, bool) {
+	id, ok := ctx.Value(journalIDKey{}).(uint64)
+	return id, ok
+}
+
+// Complete marks the call with the given ID as completed.
+func (j *Journal) Complete(id uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.pending[id]; !ok {
+		return nil
+	}
+	if err := j.write(journalRecord{Completed: id}); err != nil {
+		return err
+	}
+	delete(j.pending, id)
+	return nil
+}
+
+// Pending returns the calls that were started but not completed, ordered
+// by ID.
+func (j *Journal) Pending() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries := make([]JournalEntry, 0, len(j.pending))
+	for _, e := range j.pending {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].ID < entries[b].ID
+	})
+	return entries
+}
+
+// Replay calls the pending calls again on the service, through its
+// authorizer and middleware, as the principals that made them, and marks
+// the ones that succeed as completed. It returns the errors of the calls
+// that failed, which are left pending.
+// Replayed calls are recorded as new entries if the journal's middleware
+// is in use by the service, so they shouldn't be replayed concurrently
+// with calls being served.
+func (j *Journal) Replay(ctx context.Context, s *Service) error {
+	var errs []error
+	for _, e := range j.Pending() {
+		ctx := ctx
+		if e.Principal != nil {
+			ctx = WithPrincipal(ctx, *e.Principal)
+		}
+		_, err := s.callContext(ctx, &Request{
+			ServiceMethod: e.ServiceMethod,
+			Body:          e.Body,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rpc: replaying call %d to %s: %w", e.ID, e.ServiceMethod, err))
+			continue
+		}
+		if err := j.Complete(e.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+// begin records the start of the call made with ctx, durably.
+func (j *Journal) begin(ctx context.Context, req *Request) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e := JournalEntry{
+		ID:            j.next,
+		ServiceMethod: req.ServiceMethod,
+		Body:          req.Body,
+		Time:          time.Now().UTC(),
+	}
+	if p, ok := PrincipalFromContext(ctx); ok {
+		e.Principal = &p
+	}
+	// IDs aren't reused, even if the entry fails to be recorded, since
+	// it may have been written in part.
+	j.next++
+	if err := j.write(journalRecord{Entry: &e}); err != nil {
+		return 0, err
+	}
+	if err := j.f.Sync(); err != nil {
+		return 0, fmt.Errorf("rpc: error writing journal: %v", err)
+	}
+	j.pending[e.ID] = e
+	return e.ID, nil
+}
+
+// write appends rec to the journal file. Records failing to be written
+// are truncated, so the records written after them aren't torn.
+func (j *Journal) write(rec journalRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("rpc: error encoding journal record: %v", err)
+	}
+	n, err := j.f.Write(append(b, '\n'))
+	if err != nil {
+		if n > 0 && j.f.Truncate(j.size) == nil {
+			_, _ = j.f.Seek(j.size, io.SeekStart)
+		}
+		return fmt.Errorf("rpc: error writing journal: %v", err)
+	}
+	j.size += int64(n)
+	return nil
+}
+
+func (j *Journal) logf(format string, args ...interface{}) {
+	if j.ErrorLog != nil {
+		j.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
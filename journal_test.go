@@ -0,0 +1,206 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := OpenJournal(path)
+	require.NoError(t, err)
+
+	counter := &Counter{}
+	s := New(WithMiddleware(j.Middleware))
+	require.NoError(t, s.Register(counter))
+	require.NoError(t, s.Register(&Clock{}))
+	require.NoError(t, s.Configure("Clock.Remaining", WithReadOnly()))
+
+	// Completed calls aren't pending.
+	_, err = s.callContext(context.Background(), &Request{ServiceMethod: "Counter.Inc", Body: []byte(`{}`)})
+	require.NoError(t, err)
+	require.Empty(t, j.Pending())
+
+	// Neither are read-only ones.
+	_, err = s.callContext(context.Background(), &Request{ServiceMethod: "Clock.Remaining", Body: []byte(`{}`)})
+	require.NoError(t, err)
+
+	// Calls interrupted by a crash are.
+	j.ManualCompletion = true
+	_, err = s.callContext(context.Background(), &Request{ServiceMethod: "Counter.Inc", Body: []byte(`{"A":1}`)})
+	require.NoError(t, err)
+	require.NoError(t, j.Close())
+
+	j, err = OpenJournal(path)
+	require.NoError(t, err)
+	defer j.Close()
+	pending := j.Pending()
+	require.Len(t, pending, 1)
+	require.Equal(t, uint64(2), pending[0].ID)
+	require.Equal(t, "Counter.Inc", pending[0].ServiceMethod)
+	require.JSONEq(t, `{"A":1}`, string(pending[0].Body))
+
+	// The journal was compacted to the pending call.
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Len(t, strings.Split(strings.TrimSpace(string(b)), "\n"), 1)
+
+	// Replaying calls them again.
+	s = New()
+	require.NoError(t, s.Register(counter))
+	require.NoError(t, j.Replay(context.Background(), s))
+	require.Equal(t, 3, counter.calls)
+	require.Empty(t, j.Pending())
+}
+
+func TestJournal_ReplayFailure(t *testing.T) {
+	j, err := OpenJournal(filepath.Join(t.TempDir(), "journal"))
+	require.NoError(t, err)
+	defer j.Close()
+	j.ManualCompletion = true
+
+	var id uint64
+	capture := func(next Handler) Handler {
+		return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+			id, _ = JournalIDFromContext(ctx)
+			return next(ctx, m, req)
+		}
+	}
+	counter := &Counter{}
+	s := New(WithMiddleware(j.Middleware, capture))
+	require.NoError(t, s.Register(counter))
+	_, err = s.callContext(context.Background(), &Request{ServiceMethod: "Counter.Inc", Body: []byte(`{}`)})
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(1), id)
+
+	// Failed calls are left pending, until the application completes them.
+	counter.fail = true
+	require.Error(t, j.Replay(context.Background(), New()))
+	require.Len(t, j.Pending(), 1)
+	require.NoError(t, j.Complete(id))
+	require.Empty(t, j.Pending())
+}
+
+func TestJournal_ReplayPrincipal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := OpenJournal(path)
+	require.NoError(t, err)
+	defer j.Close()
+	j.ManualCompletion = true
+
+	counter := &Counter{}
+	newService := func() *Service {
+		s := New(WithAuthorizer(RoleAuthorizer{}))
+		require.NoError(t, s.Register(counter))
+		require.NoError(t, s.Configure("Counter.Inc", WithRoles("counter")))
+		return s
+	}
+	s := newService()
+	s.Use(j.Middleware)
+	ctx := WithPrincipal(context.Background(), Principal{Subject: "alice", Roles: []string{"counter"}})
+	_, err = s.callContext(ctx, &Request{ServiceMethod: "Counter.Inc", Body: []byte(`{}`)})
+	require.NoError(t, err)
+	require.Equal(t, &Principal{Subject: "alice", Roles: []string{"counter"}}, j.Pending()[0].Principal)
+
+	// Calls are replayed as the principal that made them.
+	require.NoError(t, j.Replay(context.Background(), newService()))
+	require.Equal(t, 2, counter.calls)
+	require.Empty(t, j.Pending())
+}
+
+func TestJournal_BeginFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := OpenJournal(path)
+	require.NoError(t, err)
+	defer j.Close()
+	j.ManualCompletion = true
+
+	var id uint64
+	capture := func(next Handler) Handler {
+		return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+			id, _ = JournalIDFromContext(ctx)
+			return next(ctx, m, req)
+		}
+	}
+	s := New(WithMiddleware(j.Middleware, capture))
+	require.NoError(t, s.Register(&Counter{}))
+	call := func() error {
+		_, err := s.callContext(context.Background(), &Request{ServiceMethod: "Counter.Inc", Body: []byte(`{}`)})
+		return err
+	}
+
+	// Calls that can't be recorded fail, and their ID isn't reused.
+	f := j.f
+	j.f, err = os.Open(path)
+	require.NoError(t, err)
+	err = call()
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeUnavailable, rerr.Code)
+	require.NoError(t, j.f.Close())
+	j.f = f
+
+	require.NoError(t, call())
+	require.Equal(t, uint64(2), id)
+}
+
+func TestJournal_TornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	records := `{"Entry":{"ID":1,"ServiceMethod":"Counter.Inc","Body":{}}}
+{"Entry":{"ID":2,"Servi
+{"Entry":{"ID":3,"ServiceMethod":"Counter.Inc","Body":{}}}
+{"Completed":1}
+`
+	require.NoError(t, os.WriteFile(path, []byte(records), 0600))
+
+	// Records after a torn one are still read.
+	j, err := OpenJournal(path)
+	require.NoError(t, err)
+	defer j.Close()
+	pending := j.Pending()
+	require.Len(t, pending, 1)
+	require.Equal(t, uint64(3), pending[0].ID)
+}
+
+func TestJournal_CompleteFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := OpenJournal(path)
+	require.NoError(t, err)
+	defer j.Close()
+	logs := &strings.Builder{}
+	j.ErrorLog = log.New(logs, "", 0)
+
+	// The journal fails once the call has been recorded.
+	f := j.f
+	fail := func(next Handler) Handler {
+		return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+			var err error
+			j.f, err = os.Open(path)
+			require.NoError(t, err)
+			return next(ctx, m, req)
+		}
+	}
+	s := New(WithMiddleware(j.Middleware, fail))
+	require.NoError(t, s.Register(&Counter{}))
+
+	// The call returns its result, and stays pending.
+	res, err := s.callContext(context.Background(), &Request{ServiceMethod: "Counter.Inc", Body: []byte(`{}`)})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":1}`, string(res.Body))
+	require.Contains(t, logs.String(), "rpc: completing call 1 to Counter.Inc")
+	require.Len(t, j.Pending(), 1)
+
+	require.NoError(t, j.f.Close())
+	j.f = f
+	require.NoError(t, j.Complete(1))
+	require.Empty(t, j.Pending())
+}
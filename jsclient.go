@@ -0,0 +1,200 @@
+package rpc
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// jsClientTemplate is a dependency free ES module calling the service's
+// methods with fetch.
+// Names are written as JSON strings, which are valid JavaScript strings,
+// since services registered with RegisterName needn't be named like
+// identifiers.
+var jsClientTemplate = template.Must(template.New("client.js").Funcs(template.FuncMap{
+	"json": jsString,
+}).Parse(`// Code generated by go-rpc. DO NOT EDIT.
+
+export class RPCError extends Error {
+  constructor(message, code, details) {
+    super(message);
+    this.name = "RPCError";
+    this.code = code;
+    this.details = details;
+  }
+}
+
+// createClient returns a client calling the service served at url.
+// options.headers are added to every request, and options.fetch can
+// replace the global fetch.
+export function createClient(url, options = {}) {
+  const fetchFn = options.fetch || globalThis.fetch.bind(globalThis);
+  let seq = 0;
+
+  // send sends a call to the given method.
+  function send(method, body, opts, headers) {
+    headers = {
+      "Content-Type": "application/json",
+      ...headers,
+      ...(options.headers || {}),
+    };
+    if (opts.timeout) {
+      headers[{{ json .TimeoutHeader }}] = String(Math.ceil(opts.timeout));
+    }
+    return fetchFn(url, {
+      method: "POST",
+      headers,
+      body: JSON.stringify({ ServiceMethod: method, Body: body, Seq: ++seq }),
+      signal: opts.signal,
+    });
+  }
+
+  // call calls the given method. opts.timeout (in milliseconds) is sent
+  // to the server as the call's deadline, and opts.signal aborts the call.
+  async function call(method, body, opts = {}) {
+    const res = await send(method, body, opts, {});
+    let envelope;
+    try {
+      envelope = await res.json();
+    } catch (err) {
+      throw new RPCError(res.statusText || "invalid response", "", {});
+    }
+    if (envelope.Error) {
+      throw new RPCError(envelope.Error, envelope.Code || "", envelope.Details || {});
+    }
+    return envelope.Body;
+  }
+
+  // stream calls the given method streaming its response, read as NDJSON,
+  // and returns an async iterator over its messages, which throws the
+  // error of the call, if any. Exiting the loop early aborts the call.
+  async function* stream(method, body, opts = {}) {
+    const res = await send(method, body, opts, { Accept: {{ json .NDJSONContentType }} });
+    if (!res.body) {
+      throw new RPCError(res.statusText || "invalid response", "", {});
+    }
+    const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+    // next returns the body of a message, or undefined at the end of the
+    // stream.
+    const next = (line) => {
+      let envelope;
+      try {
+        envelope = JSON.parse(line);
+      } catch (err) {
+        throw new RPCError(res.statusText || "invalid response", "", {});
+      }
+      if (envelope.Error) {
+        throw new RPCError(envelope.Error, envelope.Code || "", envelope.Details || {});
+      }
+      return envelope.More ? envelope.Body : undefined;
+    };
+    let buffer = "";
+    try {
+      for (;;) {
+        const { value, done } = await reader.read();
+        buffer += value || "";
+        // Responses which weren't streamed, eg. errors, may not end with
+        // a newline.
+        const lines = buffer.split("\n");
+        buffer = done ? "" : lines.pop();
+        for (const line of lines) {
+          if (!line.trim()) {
+            continue;
+          }
+          const message = next(line);
+          if (message === undefined) {
+            return;
+          }
+          yield message;
+        }
+        if (done) {
+          throw new RPCError("stream ended unexpectedly", "", {});
+        }
+      }
+    } finally {
+      reader.cancel().catch(() => {});
+    }
+  }
+
+  return {
+    call,
+    stream,
+{{- range .Services }}
+    {{ json .Name }}: {
+{{- range .Methods }}
+      {{ json .Name }}: (body, opts) => {{ if .Streaming }}stream{{ else }}call{{ end }}({{ json .FullName }}, body, opts),
+{{- end }}
+    },
+{{- end }}
+  };
+}
+`))
+
+// jsString returns s as a JavaScript string literal.
+func jsString(s string) (string, error) {
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+type (
+	jsService struct {
+		Name    string
+		Methods []jsMethod
+	}
+	jsMethod struct {
+		Name      string
+		FullName  string
+		Streaming bool // whether it's called with stream, see Stream
+	}
+)
+
+// WriteJavaScriptClient writes a dependency free JavaScript client for the
+// registered methods, as an ES module exporting createClient. Methods
+// streaming their response, see Stream, return async iterators over their
+// messages.
+func (s *Service) WriteJavaScriptClient(w io.Writer) error {
+	names := make([]string, 0, len(s.Methods))
+	for name := range s.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	services := []jsService{}
+	for _, name := range names {
+		i := strings.LastIndex(name, ".")
+		service, method := name[:i], name[i+1:]
+		if len(services) == 0 || services[len(services)-1].Name != service {
+			services = append(services, jsService{Name: service})
+		}
+		last := &services[len(services)-1]
+		last.Methods = append(last.Methods, jsMethod{
+			Name:      method,
+			FullName:  name,
+			Streaming: s.Methods[name].Streaming(),
+		})
+	}
+
+	return jsClientTemplate.Execute(w, struct {
+		TimeoutHeader     string
+		NDJSONContentType string
+		Services          []jsService
+	}{
+		TimeoutHeader:     TimeoutHeader,
+		NDJSONContentType: NDJSONContentType,
+		Services:          services,
+	})
+}
+
+// JavaScriptClientHandler returns a handler serving the JavaScript client
+// written by WriteJavaScriptClient.
+func (s *Service) JavaScriptClientHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		if err := s.WriteJavaScriptClient(w); err != nil {
+			s.logf("rpc: error writing javascript client: %v", err)
+		}
+	})
+}
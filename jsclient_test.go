@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_WriteJavaScriptClient(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Register(&Clock{}))
+	require.NoError(t, s.Register(&Ticker{}))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, s.WriteJavaScriptClient(buf))
+
+	js := buf.String()
+	require.Contains(t, js, "export function createClient(url, options = {})")
+	require.Contains(t, js, `headers["Rpc-Timeout"]`)
+	require.Contains(t, js, `
+    "Clock": {
+      "Remaining": (body, opts) => call("Clock.Remaining", body, opts),
+      "Sleep": (body, opts) => call("Clock.Sleep", body, opts),
+    },
+    "Math": {
+      "Add": (body, opts) => call("Math.Add", body, opts),
+    },
+`)
+	// Streamed responses are read as NDJSON.
+	require.Contains(t, js, `{ Accept: "application/x-ndjson" }`)
+	require.Contains(t, js, `
+    "Ticker": {
+      "Countdown": (body, opts) => stream("Ticker.Countdown", body, opts),
+      "Ticks": (body, opts) => stream("Ticker.Ticks", body, opts),
+    },
+`)
+}
+
+func TestService_WriteJavaScriptClient_Names(t *testing.T) {
+	s := New(WithoutPing())
+	require.NoError(t, s.RegisterName(`math"); alert("x`, &Math{}))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, s.WriteJavaScriptClient(buf))
+
+	// Names are quoted, whatever they hold.
+	require.Contains(t, buf.String(), `
+    "math\"); alert(\"x": {
+      "Add": (body, opts) => call("math\"); alert(\"x.Add", body, opts),
+    },
+`)
+}
@@ -0,0 +1,278 @@
+package rpc
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type (
+	// JSONSchema is a JSON Schema (draft 2020-12) describing a type.
+	JSONSchema struct {
+		Schema               string                 `json:"$schema,omitempty"`
+		Ref                  string                 `json:"$ref,omitempty"`
+		Description          string                 `json:"description,omitempty"`
+		Examples             []interface{}          `json:"examples,omitempty"`
+		Type                 string                 `json:"type,omitempty"`
+		Format               string                 `json:"format,omitempty"`
+		ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+		Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+		Required             []string               `json:"required,omitempty"`
+		Items                *JSONSchema            `json:"items,omitempty"`
+		AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+		Defs                 map[string]*JSONSchema `json:"$defs,omitempty"`
+	}
+	// MethodSchemas are the JSON Schemas of a method's request and
+	// response bodies.
+	MethodSchemas struct {
+		Request  *JSONSchema `json:"request"`
+		Response *JSONSchema `json:"response"`
+		Tags     []string    `json:"tags,omitempty"`
+	}
+	// schemaBuilder builds schemas, collecting named struct types into
+	// definitions so recursive types can be described.
+	schemaBuilder struct {
+		defs      map[string]*JSONSchema
+		names     map[reflect.Type]string // of the definitions of types
+		reserved  map[string]bool         // names not available to types
+		refPrefix string
+	}
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	typeOfTime           = reflect.TypeOf(time.Time{})
+	typeOfRawMessage     = reflect.TypeOf(json.RawMessage{})
+	typeOfJSONMarshaler  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	typeOfTextMarshaler  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	typeOfEmptyInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+	typeOfMarshaler      = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	typeOfUnmarshaler    = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+// JSONSchemas returns the JSON Schemas of the request and response bodies
+// of every registered method, keyed by method name.
+// Schemas follow encoding/json's rules for field names, omitted fields
+// and embedded structs.
+func (s *Service) JSONSchemas() map[string]MethodSchemas {
+	schemas := map[string]MethodSchemas{}
+	for name, m := range s.Methods {
+		schemas[name] = m.JSONSchemas()
+	}
+	return schemas
+}
+
+// JSONSchemas returns the JSON Schemas of the method's request and
+// response bodies, with its documentation: the request schema has the
+// method's description, and both have the bodies of its examples.
+func (m Method) JSONSchemas() MethodSchemas {
+	schemas := MethodSchemas{
+		Request:  JSONSchemaOf(m.RequestType),
+		Response: JSONSchemaOf(m.ResponseType),
+		Tags:     m.Doc.Tags,
+	}
+	schemas.Request.Description = m.Doc.Description
+	for _, e := range m.Doc.Examples {
+		schemas.Request.Examples = append(schemas.Request.Examples, e.Request)
+		schemas.Response.Examples = append(schemas.Response.Examples, e.Response)
+	}
+	return schemas
+}
+
+// JSONSchemaOf returns the JSON Schema of the given type, as encoded by
+// encoding/json.
+func JSONSchemaOf(t reflect.Type) *JSONSchema {
+	b := &schemaBuilder{
+		defs:      map[string]*JSONSchema{},
+		refPrefix: "#/$defs/",
+	}
+	schema := b.schema(t)
+	if t.Implements(typeOfMarshaler) {
+		// Bodies encoding themselves are carried as byte strings.
+		schema = &JSONSchema{Type: "string", ContentEncoding: "base64"}
+	}
+	schema.Schema = jsonSchemaDialect
+	if len(b.defs) > 0 {
+		schema.Defs = b.defs
+	}
+	return schema
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == typeOfTime:
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	case t == typeOfRawMessage || t == typeOfEmptyInterface:
+		return &JSONSchema{}
+	case t.Implements(typeOfJSONMarshaler) ||
+		reflect.PointerTo(t).Implements(typeOfJSONMarshaler):
+		// We can't know what custom marshalers produce.
+		return &JSONSchema{}
+	case t.Implements(typeOfTextMarshaler) ||
+		reflect.PointerTo(t).Implements(typeOfTextMarshaler):
+		return &JSONSchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &JSONSchema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name, ok := b.defName(t)
+		if !ok {
+			// Reserve the definition before building it, in case the
+			// type refers to itself.
+			b.defs[name] = nil
+			b.defs[name] = b.structSchema(t)
+		}
+		return &JSONSchema{Ref: b.refPrefix + name}
+	default:
+		return &JSONSchema{}
+	}
+}
+
+// defName returns the name of the definition of the named type t, and
+// whether it was already given one. Types named like another type, or a
+// reserved name, are qualified by their package path.
+func (b *schemaBuilder) defName(t reflect.Type) (string, bool) {
+	if name, ok := b.names[t]; ok {
+		return name, true
+	}
+	if b.names == nil {
+		b.names = map[reflect.Type]string{}
+	}
+	name := t.Name()
+	if _, taken := b.defs[name]; taken || b.reserved[name] {
+		name = qualifiedTypeName(t)
+	}
+	b.names[t] = name
+	return name, false
+}
+
+// qualifiedTypeName returns the name of t prefixed with its package path,
+// with "/" replaced by ".".
+func qualifiedTypeName(t reflect.Type) string {
+	if t.PkgPath() == "" {
+		return t.Name()
+	}
+	return strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + t.Name()
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) *JSONSchema {
+	schema := &JSONSchema{
+		Type:       "object",
+		Properties: map[string]*JSONSchema{},
+	}
+	for _, f := range jsonFields(t) {
+		prop := b.schema(f.Type)
+		if f.String {
+			prop = &JSONSchema{Type: "string"}
+		}
+		schema.Properties[f.Name] = prop
+		if !f.OmitEmpty {
+			schema.Required = append(schema.Required, f.Name)
+		}
+	}
+	return schema
+}
+
+// jsonField is a field of a struct as encoded by encoding/json.
+type jsonField struct {
+	Name      string
+	Type      reflect.Type
+	Index     []int // of the field, see reflect.Value.FieldByIndex
+	OmitEmpty bool
+	String    bool
+}
+
+// jsonFields returns the fields of the struct encoded by encoding/json,
+// promoting the fields of embedded structs. Fields of the outer struct
+// take precedence over promoted ones, like with encoding/json.
+func jsonFields(t reflect.Type) []jsonField {
+	return appendJSONFields(nil, t, nil, map[string]bool{})
+}
+
+func appendJSONFields(fields []jsonField, t reflect.Type, index []int, seen map[string]bool) []jsonField {
+	type embed struct {
+		t     reflect.Type
+		index []int
+	}
+	embedded := []embed{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, embed{ft, append(index[:len(index):len(index)], i)})
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		fields = append(fields, jsonField{
+			Name:      name,
+			Type:      f.Type,
+			Index:     append(index[:len(index):len(index)], i),
+			OmitEmpty: hasTagOption(opts, "omitempty"),
+			String:    hasTagOption(opts, "string"),
+		})
+	}
+
+	for _, e := range embedded {
+		fields = appendJSONFields(fields, e.t, e.index, seen)
+	}
+	return fields
+}
+
+func hasTagOption(opts, opt string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
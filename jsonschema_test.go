@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	schemaBase struct {
+		ID      string `json:"id"`
+		Created time.Time
+	}
+	SchemaNode struct {
+		schemaBase
+		Name     string            `json:"name,omitempty"`
+		Count    int64             `json:"count,string"`
+		Data     []byte            `json:"data"`
+		Labels   map[string]string `json:"labels,omitempty"`
+		Children []*SchemaNode     `json:"children"`
+		Ignored  string            `json:"-"`
+		internal string
+	}
+)
+
+func TestJSONSchemaOf(t *testing.T) {
+	schema := JSONSchemaOf(reflect.TypeOf(&SchemaNode{}))
+	b, err := json.Marshal(schema)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$ref": "#/$defs/SchemaNode",
+		"$defs": {
+			"SchemaNode": {
+				"type": "object",
+				"properties": {
+					"id": {"type": "string"},
+					"Created": {"type": "string", "format": "date-time"},
+					"name": {"type": "string"},
+					"count": {"type": "string"},
+					"data": {"type": "string", "contentEncoding": "base64"},
+					"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+					"children": {"type": "array", "items": {"$ref": "#/$defs/SchemaNode"}}
+				},
+				"required": ["count", "data", "children", "id", "Created"]
+			}
+		}
+	}`, string(b))
+}
+
+func TestService_JSONSchemas(t *testing.T) {
+	s := New(WithoutPing())
+	require.NoError(t, s.Register(&Math{}))
+
+	schemas := s.JSONSchemas()
+	require.Len(t, schemas, 1)
+	require.Equal(t, "#/$defs/AddRequest", schemas["Math.Add"].Request.Ref)
+	require.Equal(t, "integer", schemas["Math.Add"].Request.Defs["AddRequest"].Properties["A"].Type)
+	require.Equal(t, "#/$defs/AddResponse", schemas["Math.Add"].Response.Ref)
+}
+
+func TestJSONSchemaOf_SameName(t *testing.T) {
+	pkg := reflect.TypeOf(AddRequest{})
+	type AddRequest struct {
+		C int
+	}
+	schema := JSONSchemaOf(reflect.StructOf([]reflect.StructField{
+		{Name: "Package", Type: pkg},
+		{Name: "Local", Type: reflect.TypeOf(AddRequest{})},
+	}))
+	require.Len(t, schema.Defs, 2)
+
+	// Types named like another type are qualified by their package.
+	require.Equal(t, "#/$defs/AddRequest", schema.Properties["Package"].Ref)
+	require.Contains(t, schema.Defs["AddRequest"].Properties, "A")
+	require.Equal(t, "#/$defs/github.com.geoah.go-rpc.AddRequest", schema.Properties["Local"].Ref)
+	require.Contains(t, schema.Defs["github.com.geoah.go-rpc.AddRequest"].Properties, "C")
+}
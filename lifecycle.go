@@ -0,0 +1,144 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+type (
+	// Starter is implemented by receivers acquiring resources, such as
+	// database pools or background workers, when the service starts
+	// serving, see Service.Start.
+	Starter interface {
+		OnStart(ctx context.Context) error
+	}
+	// Stopper is implemented by receivers releasing resources when the
+	// service stops serving, once calls in flight are done, see
+	// Service.Stop.
+	Stopper interface {
+		OnStop(ctx context.Context) error
+	}
+	// lifecycle is the state of the Starters and Stoppers of a service.
+	lifecycle struct {
+		mu        sync.Mutex
+		receivers []interface{} // implementing Starter or Stopper, in registration order
+		running   int           // Starts not matched by Stops
+	}
+)
+
+// addReceiver records i, if it implements Starter or Stopper.
+func (l *lifecycle) addReceiver(i interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.add(i)
+}
+
+// add records i, if it implements Starter or Stopper, after the receivers
+// already recorded. l.mu must be held.
+func (l *lifecycle) add(i interface{}) {
+	_, starter := i.(Starter)
+	_, stopper := i.(Stopper)
+	if !starter && !stopper {
+		return
+	}
+	for _, r := range l.receivers {
+		if sameReceiver(r, i) {
+			return
+		}
+	}
+	l.receivers = append(l.receivers, i)
+}
+
+// remove forgets i, returning whether it was recorded. l.mu must be held.
+func (l *lifecycle) remove(i interface{}) bool {
+	for n, r := range l.receivers {
+		if sameReceiver(r, i) {
+			l.receivers = append(l.receivers[:n:n], l.receivers[n+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// start starts i, if the service is running and it implements Starter,
+// for receivers registered while serving. l.mu must be held.
+func (l *lifecycle) start(ctx context.Context, i interface{}) error {
+	if starter, ok := i.(Starter); ok && l.running > 0 {
+		return starter.OnStart(ctx)
+	}
+	return nil
+}
+
+// stop stops i, if the service is running and it implements Stopper, for
+// receivers unregistered while serving. l.mu must be held.
+func (l *lifecycle) stop(ctx context.Context, i interface{}) error {
+	if stopper, ok := i.(Stopper); ok && l.running > 0 {
+		return stopper.OnStop(ctx)
+	}
+	return nil
+}
+
+// sameReceiver returns whether a and b are the same receiver.
+func sameReceiver(a, b interface{}) bool {
+	t := reflect.TypeOf(a)
+	return reflect.TypeOf(b) == t && t.Comparable() && a == b
+}
+
+// Start calls OnStart on the registered receivers implementing Starter, in
+// the order they were registered. If any fails, those already started are
+// stopped, and its error is returned.
+// ServeListener, and so ListenAndServe, start services before serving
+// them. Starting an already started service only counts the starts, to
+// be matched by as many Stops.
+func (s *Service) Start(ctx context.Context) error {
+	l := &s.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running++; l.running > 1 {
+		return nil
+	}
+	for i, r := range l.receivers {
+		starter, ok := r.(Starter)
+		if !ok {
+			continue
+		}
+		if err := starter.OnStart(ctx); err != nil {
+			l.running--
+			stopReceivers(ctx, l.receivers[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop calls OnStop on the registered receivers implementing Stopper, in
+// the reverse order they were registered, returning their errors.
+// ServeListener stops services when shut down, once calls in flight are
+// done or its shutdown timeout is reached, which ctx is done by.
+func (s *Service) Stop(ctx context.Context) error {
+	l := &s.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running == 0 {
+		return nil
+	}
+	if l.running--; l.running > 0 {
+		return nil
+	}
+	return stopReceivers(ctx, l.receivers)
+}
+
+// stopReceivers stops the given receivers, in reverse order.
+func stopReceivers(ctx context.Context, receivers []interface{}) error {
+	errs := []error{}
+	for i := len(receivers) - 1; i >= 0; i-- {
+		if stopper, ok := receivers[i].(Stopper); ok {
+			if err := stopper.OnStop(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
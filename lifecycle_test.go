@@ -0,0 +1,117 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Pool is a Math keeping a log of its lifecycle.
+type Pool struct {
+	Math
+	name     string
+	log      *[]string
+	startErr error
+}
+
+func (p *Pool) OnStart(ctx context.Context) error {
+	*p.log = append(*p.log, "start "+p.name)
+	return p.startErr
+}
+
+func (p *Pool) OnStop(ctx context.Context) error {
+	*p.log = append(*p.log, "stop "+p.name)
+	return nil
+}
+
+func TestService_Lifecycle(t *testing.T) {
+	log := []string{}
+	s := New(WithStrictRegistration())
+	db := &Pool{name: "db", log: &log}
+	require.NoError(t, s.RegisterName("DB", db))
+	require.NoError(t, s.RegisterName("Cache", &Pool{name: "cache", log: &log}))
+	// Receivers registered twice are started once.
+	require.NoError(t, s.RegisterName("Alias", db))
+	require.NotContains(t, s.Methods, "DB.OnStart")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.ServeListener(l, WithShutdown(ctx, time.Second))
+	}()
+
+	c, err := Dial("http://" + l.Addr().String())
+	require.NoError(t, err)
+	res := &AddResponse{}
+	require.NoError(t, c.Call(context.Background(), "DB.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, []string{"start db", "start cache"}, log)
+
+	cancel()
+	require.NoError(t, <-errc)
+	require.Equal(t, []string{"start db", "start cache", "stop cache", "stop db"}, log)
+}
+
+func TestService_Start(t *testing.T) {
+	log := []string{}
+	s := New()
+	require.NoError(t, s.RegisterName("DB", &Pool{name: "db", log: &log}))
+	require.NoError(t, s.RegisterName("Cache", &Pool{name: "cache", log: &log, startErr: errors.New("no cache")}))
+	require.NoError(t, s.RegisterName("Queue", &Pool{name: "queue", log: &log}))
+
+	// Receivers already started are stopped when others fail to start.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.EqualError(t, s.ServeListener(l), "no cache")
+	require.Equal(t, []string{"start db", "start cache", "stop db"}, log)
+	require.NoError(t, s.Stop(context.Background()))
+	require.Len(t, log, 3)
+
+	// Services started several times are stopped by as many stops.
+	log = log[:0]
+	s = New()
+	require.NoError(t, s.RegisterName("DB", &Pool{name: "db", log: &log}))
+	require.NoError(t, s.Start(context.Background()))
+	require.NoError(t, s.Start(context.Background()))
+	require.NoError(t, s.Stop(context.Background()))
+	require.Equal(t, []string{"start db"}, log)
+	require.NoError(t, s.Stop(context.Background()))
+	require.Equal(t, []string{"start db", "stop db"}, log)
+}
+
+func TestService_Replace_Lifecycle(t *testing.T) {
+	log := []string{}
+	s := New()
+	a := &Pool{name: "a", log: &log}
+	require.NoError(t, s.RegisterName("DB", a))
+	require.NoError(t, s.RegisterName("Alias", a))
+	require.NoError(t, s.Start(context.Background()))
+	require.Equal(t, []string{"start a"}, log)
+
+	// Replacements are started, and the receivers they replace stopped
+	// once no longer registered.
+	require.NoError(t, s.Replace("DB", &Pool{name: "b", log: &log}))
+	require.Equal(t, []string{"start a", "start b"}, log)
+	require.NoError(t, s.Replace("Alias", &Pool{name: "c", log: &log}))
+	require.Equal(t, []string{"start a", "start b", "start c", "stop a"}, log)
+
+	// Replacements failing to start don't replace anything.
+	err := s.Replace("DB", &Pool{name: "d", log: &log, startErr: errors.New("no db")})
+	require.EqualError(t, err, "rpc: error starting *rpc.Pool: no db")
+	require.Equal(t, "b", s.Methods["DB.Add"].Receiver.Interface().(*Pool).name)
+
+	// Services added and removed while running are started and stopped.
+	log = log[:0]
+	require.NoError(t, s.add("Cache", &Pool{name: "cache", log: &log}))
+	s.remove("Cache")
+	require.Equal(t, []string{"start cache", "stop cache"}, log)
+
+	log = log[:0]
+	require.NoError(t, s.Stop(context.Background()))
+	require.Equal(t, []string{"stop c", "stop b"}, log)
+}
@@ -0,0 +1,34 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// MaxResponseSize returns a middleware that fails calls whose encoded
+// response body is larger than limit bytes with CodeResponseTooLarge,
+// instead of sending it to the client.
+func MaxResponseSize(limit int) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+			res, err := next(ctx, m, req)
+			if err != nil {
+				return nil, err
+			}
+			if len(res.Body) > limit {
+				return nil, &Error{
+					Code: CodeResponseTooLarge,
+					Message: fmt.Sprintf(
+						"response of %d bytes exceeds limit of %d bytes",
+						len(res.Body), limit,
+					),
+					Details: map[string]string{
+						"limit": strconv.Itoa(limit),
+					},
+				}
+			}
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package rpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	s := New()
+	s.Use(MaxResponseSize(8))
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// {"X":3}
+	res := &AddResponse{}
+	err := s.Call(http.DefaultClient, srv.URL, "Math.Add", &AddRequest{A: 1, B: 2}, res)
+	require.NoError(t, err)
+	require.Equal(t, 3, res.X)
+
+	// {"X":300}
+	err = s.Call(http.DefaultClient, srv.URL, "Math.Add", &AddRequest{A: 100, B: 200}, res)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeResponseTooLarge, rerr.Code)
+}
@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// ListenUnix listens on a Unix socket at the given path, and sets the
+// socket's permissions to mode.
+// A stale socket left behind at the path by a previous process is removed.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("rpc: %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("rpc: error removing stale socket: %v", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close() // nolint: errcheck
+		return nil, fmt.Errorf("rpc: error setting socket permissions: %v", err)
+	}
+
+	return l, nil
+}
+
+// ListenAndServeUnix listens on a Unix socket at the given path with the
+// given permissions, and serves the service like ListenAndServe.
+func (s *Service) ListenAndServeUnix(path string, mode os.FileMode, opts ...ServerOption) error {
+	l, err := ListenUnix(path, mode)
+	if err != nil {
+		return err
+	}
+	return s.ServeListener(l, opts...)
+}
+
+// SystemdListeners returns the listeners passed to the process by systemd
+// socket activation, keyed by their FileDescriptorName, in the order they
+// were passed, or nil if there are none. Sockets sharing a name, such as
+// those of a socket unit listening on several addresses, are listed under
+// that name together.
+// The environment variables used by socket activation are unset, so child
+// processes don't inherit them.
+func SystemdListeners() (map[string][]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")     // nolint: errcheck
+		os.Unsetenv("LISTEN_FDS")     // nolint: errcheck
+		os.Unsetenv("LISTEN_FDNAMES") // nolint: errcheck
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := map[string][]net.Listener{}
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		l, err := net.FileListener(f)
+		f.Close() // nolint: errcheck
+		if err != nil {
+			for _, ls := range listeners {
+				for _, l := range ls {
+					l.Close() // nolint: errcheck
+				}
+			}
+			return nil, fmt.Errorf("rpc: error using systemd socket %s: %v", name, err)
+		}
+		listeners[name] = append(listeners[name], l)
+	}
+
+	return listeners, nil
+}
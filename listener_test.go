@@ -0,0 +1,62 @@
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenUnix(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+
+	path := filepath.Join(t.TempDir(), "rpc.sock")
+
+	// Leave a stale socket behind.
+	l, err := ListenUnix(path, 0600)
+	require.NoError(t, err)
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+
+	// Stale sockets are replaced.
+	l, err = ListenUnix(path, 0600)
+	require.NoError(t, err)
+	defer l.Close()
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	}
+
+	go s.ServeListener(l) // nolint: errcheck
+
+	c, err := Dial("unix://" + path)
+	require.NoError(t, err)
+	res := &AddResponse{}
+	err = c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res)
+	require.NoError(t, err)
+	require.Equal(t, 3, res.X)
+}
+
+func TestListenUnix_NotASocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, ioutil.WriteFile(path, nil, 0600))
+	_, err := ListenUnix(path, 0600)
+	require.Error(t, err)
+}
+
+func TestSystemdListeners_OtherProcess(t *testing.T) {
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1)) // nolint: errcheck
+	os.Setenv("LISTEN_FDS", "1")                         // nolint: errcheck
+	ls, err := SystemdListeners()
+	require.NoError(t, err)
+	require.Nil(t, ls)
+	require.Empty(t, os.Getenv("LISTEN_FDS"))
+}
@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MessageCatalog holds the messages of errors sent to callers in languages
+// other than that of their canonical messages, by language tag, such as
+// "fr" or "pt-BR", then by error code. Messages refer to the details of
+// errors as {detail}, which are replaced by their values.
+type MessageCatalog map[string]map[string]string
+
+// WithMessageCatalog translates the messages of the errors sent to callers
+// to the language they prefer most in their Accept-Language header among
+// those the catalog has a message for their code in, and sets the
+// Content-Language header of their responses. Regional languages, such as
+// "fr-CA", fall back to their base language. Logs, and errors of codes
+// without translations, keep the canonical message.
+func WithMessageCatalog(c MessageCatalog) ServiceOption {
+	return func(s *Service) {
+		// Language tags are case-insensitive.
+		s.catalog = MessageCatalog{}
+		for lang, messages := range c {
+			s.catalog[strings.ToLower(lang)] = messages
+		}
+	}
+}
+
+// localize returns err with its message translated to the language the
+// caller prefers in acceptLanguage, along with the language, or an empty
+// one if it isn't translated.
+func (s *Service) localize(acceptLanguage string, err error) (string, error) {
+	var rerr *Error
+	if len(s.catalog) == 0 || acceptLanguage == "" || !errors.As(err, &rerr) || rerr.Code == "" {
+		return "", err
+	}
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		for _, lang := range []string{tag, baseLanguage(tag)} {
+			msg, ok := s.catalog[lang][rerr.Code]
+			if !ok {
+				continue
+			}
+			translated := *rerr
+			translated.Message = expandDetails(msg, rerr.Details)
+			return lang, &translated
+		}
+	}
+	return "", err
+}
+
+// parseAcceptLanguage returns the lower case language tags of an
+// Accept-Language header, most preferred first, leaving out unacceptable
+// and wildcard ones.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	tags := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{tag, q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.tag
+	}
+	return names
+}
+
+// baseLanguage returns the language of a tag without its region or
+// script, eg. "pt" for "pt-br".
+func baseLanguage(tag string) string {
+	base, _, _ := strings.Cut(tag, "-")
+	return base
+}
+
+// expandDetails replaces the {detail} references of msg by the values of
+// the details.
+func expandDetails(msg string, details map[string]string) string {
+	if len(details) == 0 || !strings.Contains(msg, "{") {
+		return msg
+	}
+	pairs := make([]string, 0, 2*len(details))
+	for k, v := range details {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(msg)
+}
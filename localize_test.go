@@ -0,0 +1,96 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Bounded struct{}
+
+func (Bounded) Add(req *AddRequest, res *AddResponse) error {
+	if req.A > 100 || req.B > 100 {
+		return &Error{
+			Code:    CodeInvalidRequest,
+			Message: "operands must be at most 100",
+			Details: map[string]string{"limit": "100"},
+		}
+	}
+	res.X = req.A + req.B
+	return nil
+}
+
+func TestWithMessageCatalog(t *testing.T) {
+	logs := &bytes.Buffer{}
+	s := New(
+		WithLogger(log.New(logs, "", 0)),
+		WithMessageCatalog(MessageCatalog{
+			"fr": {
+				CodeInvalidRequest: "les opérandes doivent être au plus {limit}",
+				CodeMethodNotFound: "méthode introuvable",
+			},
+			"pt-BR": {
+				CodeInvalidRequest: "os operandos devem ser no máximo {limit}",
+			},
+		}),
+	)
+	require.NoError(t, s.Register(&Bounded{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	call := func(method, acceptLanguage string) (*Error, string) {
+		contentLanguage := ""
+		c, err := Dial(srv.URL, WithHTTPClient(&http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				if acceptLanguage != "" {
+					r.Header.Set("Accept-Language", acceptLanguage)
+				}
+				resp, err := http.DefaultTransport.RoundTrip(r)
+				if err == nil {
+					contentLanguage = resp.Header.Get("Content-Language")
+				}
+				return resp, err
+			}),
+		}))
+		require.NoError(t, err)
+		err = c.Call(context.Background(), method, &AddRequest{A: 1000}, &AddResponse{})
+		rerr := &Error{}
+		require.True(t, errors.As(err, &rerr), "%v", err)
+		return rerr, contentLanguage
+	}
+
+	rerr, lang := call("Bounded.Add", "fr-CA, en;q=0.8")
+	require.Equal(t, "les opérandes doivent être au plus 100", rerr.Message)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+	require.Equal(t, "fr", lang)
+
+	rerr, lang = call("Bounded.Add", "de;q=0.5, pt-br;q=0.9")
+	require.Equal(t, "os operandos devem ser no máximo 100", rerr.Message)
+	require.Equal(t, "pt-br", lang)
+
+	// Codes without translations in preferred languages fall back to
+	// less preferred ones, then to the canonical message.
+	rerr, _ = call("Bounded.Sub", "pt-BR, fr;q=0.1")
+	require.Equal(t, "méthode introuvable", rerr.Message)
+	rerr, lang = call("Bounded.Add", "de")
+	require.Equal(t, "operands must be at most 100", rerr.Message)
+	require.Empty(t, lang)
+	rerr, _ = call("Bounded.Add", "")
+	require.Equal(t, "operands must be at most 100", rerr.Message)
+
+	// Logs keep the canonical message.
+	require.Contains(t, logs.String(), "call to Bounded.Add failed: operands must be at most 100")
+	require.NotContains(t, logs.String(), "opérandes")
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	require.Equal(t, []string{"fr-ca", "fr", "en"}, parseAcceptLanguage("fr-CA,fr;q=0.9, en;q=0.8, *;q=0.5"))
+	require.Equal(t, []string{"en", "de"}, parseAcceptLanguage("de;q=0.1, en, es;q=0, it;q=x"))
+	require.Empty(t, parseAcceptLanguage(""))
+}
@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+)
+
+// WithLoopback calls the methods registered on s in-process, instead of
+// over HTTP. Requests and responses are still encoded with the service's
+// codec, and calls go through its authorizer and middleware, so they
+// behave like remote calls. The caller's context, including its values,
+// is passed to the service.
+// Methods s doesn't have are called on the target.
+func WithLoopback(s *Service) Option {
+	return func(o *clientOptions) {
+		o.loopback = s
+		o.direct = false
+	}
+}
+
+// WithDirectLoopback is like WithLoopback, but passes requests and
+// responses to methods as they are, without encoding them and without
+// going through the service's authorizer and middleware.
+func WithDirectLoopback(s *Service) Option {
+	return func(o *clientOptions) {
+		o.loopback = s
+		o.direct = true
+	}
+}
+
+// lookup returns the method with the given name, if s is set and has it.
+func (s *Service) lookup(method string) (Method, bool) {
+	if s == nil {
+		return Method{}, false
+	}
+	return s.method(method)
+}
+
+// callLoopback calls the method of the client's loopback service.
+func (c *Client) callLoopback(ctx context.Context, m Method, reqBody, resBody interface{}) error {
+	s := c.loopback
+	if c.direct {
+		req, res := reflect.ValueOf(reqBody), reflect.ValueOf(resBody)
+		if req.IsValid() && res.IsValid() &&
+			req.Type() == m.RequestType && res.Type() == m.ResponseType {
+			args := []reflect.Value{m.Receiver}
+			if m.TakesContext {
+				args = append(args, reflect.ValueOf(ctx))
+			}
+			return m.call(append(args, req, res))
+		}
+		// Values of other types need converting, by encoding them.
+	}
+
+	reqBytes, err := encodeCall(ctx, s.codec, m.Name, reqBody, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	// Make the headers the call would have been sent with available.
+	h := http.Header{}
+	setTimeoutHeader(ctx, h)
+	setOutgoingHeader(ctx, h)
+	ctx = context.WithValue(ctx, headerKey{}, h)
+
+	return decodeReply(s.codec, s.ServeMessage(ctx, reqBytes), m.Name, 0, resBody)
+}
@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Loopback(t *testing.T) {
+	remote := New()
+	require.NoError(t, remote.Register(&Clock{}))
+	srv := httptest.NewServer(remote.Serve())
+	defer srv.Close()
+
+	calls := 0
+	local := New(WithMiddleware(func(next Handler) Handler {
+		return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+			calls++
+			return next(ctx, m, req)
+		}
+	}))
+	require.NoError(t, local.Register(&Math{}))
+	require.NoError(t, local.Register(&Counter{fail: true}))
+
+	c, err := Dial(srv.URL, WithLoopback(local))
+	require.NoError(t, err)
+
+	// Local methods are called in-process, through the middleware.
+	res := &AddResponse{}
+	require.NoError(t, c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 3, res.X)
+	require.Equal(t, 1, calls)
+
+	// Errors are those of remote calls.
+	err = c.Call(context.Background(), "Counter.Inc", &AddRequest{}, res)
+	require.EqualError(t, err, "rpc: server: failed")
+
+	// Other methods are called on the target.
+	remaining := &RemainingResponse{}
+	require.NoError(t, c.Call(context.Background(), "Clock.Remaining", &RemainingRequest{}, remaining))
+	require.Equal(t, 2, calls)
+}
+
+func TestClient_DirectLoopback(t *testing.T) {
+	calls := 0
+	local := New(WithMiddleware(func(next Handler) Handler {
+		return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+			calls++
+			return next(ctx, m, req)
+		}
+	}))
+	require.NoError(t, local.Register(&Math{}))
+	require.NoError(t, local.Register(&Counter{fail: true}))
+
+	c, err := Dial("http://localhost:1", WithDirectLoopback(local))
+	require.NoError(t, err)
+
+	res := &AddResponse{}
+	require.NoError(t, c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 3, res.X)
+	require.Equal(t, 0, calls)
+
+	// Errors are returned as they are.
+	err = c.Call(context.Background(), "Counter.Inc", &AddRequest{}, res)
+	require.EqualError(t, err, "failed")
+
+	// Values of other types are encoded.
+	require.NoError(t, c.Call(context.Background(), "Math.Add", map[string]int{"A": 2, "B": 2}, res))
+	require.Equal(t, 4, res.X)
+	require.Equal(t, 1, calls)
+
+	var rerr *Error
+	err = c.Call(context.Background(), "Math.Add", "invalid", res)
+	require.True(t, errors.As(err, &rerr))
+}
@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MessageTransport sends an encoded request envelope and returns the
+// encoded response envelope, for transports other than HTTP.
+// With NATS for example, it is a request on the method's subject:
+//
+//	func(ctx context.Context, msg []byte) ([]byte, error) {
+//		reply, err := nc.RequestWithContext(ctx, "rpc."+method, msg)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return reply.Data, nil
+//	}
+type MessageTransport func(ctx context.Context, msg []byte) ([]byte, error)
+
+// ServeMessage handles an encoded request envelope received over a
+// transport other than HTTP, and returns the encoded response envelope.
+// Calls go through the service's authorizer and middleware, like calls
+// served over HTTP, but have no headers.
+func (s *Service) ServeMessage(ctx context.Context, msg []byte) []byte {
+	var req Request
+	if err := s.codec.Unmarshal(msg, &req); err != nil {
+		return s.encodeError(nil, &Error{
+			Code:    CodeInvalidRequest,
+			Message: "Bad request",
+		})
+	}
+
+	if err := checkVersion(&req); err != nil {
+		return s.encodeError(&req, err)
+	}
+	if req.Version >= 2 {
+		var cancel context.CancelFunc
+		h := envelopeHeader(&req, nil)
+		ctx = context.WithValue(ctx, headerKey{}, h)
+		ctx, cancel = contextWithTimeoutHeader(ctx, h)
+		defer cancel()
+	}
+	ctx, md := withResponseMetadata(ctx, &req)
+
+	res, err := s.callContext(ctx, &req)
+	if errors.Is(err, ErrMethodNotFound) {
+		err = s.methodNotFound(ctx, req.ServiceMethod)
+	}
+	if err != nil {
+		return s.encodeError(&req, err)
+	}
+
+	resBytes, err := s.codec.Marshal(versioned(res, &req, md))
+	if err != nil {
+		s.logf("rpc: error encoding response of %s: %v", req.ServiceMethod, err)
+		return s.encodeError(&req, err)
+	}
+	return resBytes
+}
+
+// encodeError encodes the response for the given request failing with
+// err.
+func (s *Service) encodeError(req *Request, err error) []byte {
+	res, _ := errorResponse(req, s.errorEncoder.encode(err))
+	resBytes, _ := s.codec.Marshal(res)
+	return resBytes
+}
+
+// CallMessage calls the method over the given transport, with the service
+// at the other end handling the message with ServeMessage.
+func CallMessage(ctx context.Context, t MessageTransport, codec Codec, method string, reqBody, resBody interface{}) error {
+	reqBytes, err := encodeCall(ctx, codec, method, reqBody, 0, 0)
+	if err != nil {
+		return err
+	}
+	resBytes, err := t(ctx, reqBytes)
+	if err != nil {
+		return fmt.Errorf("rpc: error sending request: %v", err)
+	}
+	return decodeReply(codec, resBytes, method, 0, resBody)
+}
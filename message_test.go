@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ServeMessage(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	transport := func(ctx context.Context, msg []byte) ([]byte, error) {
+		return s.ServeMessage(ctx, msg), nil
+	}
+
+	res := &AddResponse{}
+	err := CallMessage(context.Background(), transport, JSONCodec{}, "Math.Add", &AddRequest{A: 1, B: 2}, res)
+	require.NoError(t, err)
+	require.Equal(t, 3, res.X)
+
+	err = CallMessage(context.Background(), transport, JSONCodec{}, "Math.Missing", &AddRequest{}, res)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeMethodNotFound, rerr.Code)
+}
+
+func TestService_ServeMessage_Invalid(t *testing.T) {
+	s := New()
+	require.JSONEq(t,
+		`{"ServiceMethod":"","Body":null,"Seq":0,"Error":"Bad request","Code":"invalid_request"}`,
+		string(s.ServeMessage(context.Background(), []byte("{"))),
+	)
+}
+
+func TestCallMessage_TransportError(t *testing.T) {
+	transport := func(ctx context.Context, msg []byte) ([]byte, error) {
+		return nil, errors.New("no responders")
+	}
+	err := CallMessage(context.Background(), transport, JSONCodec{}, "Math.Add", &AddRequest{}, &AddResponse{})
+	require.EqualError(t, err, "rpc: error sending request: no responders")
+}
@@ -0,0 +1,64 @@
+package rpc
+
+import (
+	"strings"
+)
+
+type (
+	// Namer is implemented by receivers naming their service, instead of
+	// Register using the name of their type.
+	Namer interface {
+		RPCName() string
+	}
+	// MethodNamer is implemented by receivers controlling the names their
+	// methods are registered under. RPCMethodNames maps the names of Go
+	// methods to the names they are exposed as, or to "-" to exclude them.
+	// Methods it doesn't map keep their names.
+	MethodNamer interface {
+		RPCMethodNames() map[string]string
+	}
+)
+
+// WithCaseInsensitiveMethods resolves method names that aren't registered
+// ignoring case, eg. calls to "math.add" are calls to "Math.Add". Names
+// matching more than one method, in different cases, are not resolved.
+func WithCaseInsensitiveMethods() ServiceOption {
+	return func(s *Service) {
+		s.caseInsensitive = true
+	}
+}
+
+// WithMethodNameNormalizer resolves method names that aren't registered by
+// looking up the name returned by normalize instead, eg. to map the names
+// of clients following other naming conventions. It is applied before
+// WithCaseInsensitiveMethods.
+func WithMethodNameNormalizer(normalize func(name string) string) ServiceOption {
+	return func(s *Service) {
+		s.normalize = normalize
+	}
+}
+
+// resolve returns the method a name that isn't registered refers to, if
+// any. Callers must hold s.mu.
+func (s *Service) resolve(name string) (Method, bool) {
+	if s.normalize != nil {
+		name = s.normalize(name)
+		if m, ok := s.Methods[name]; ok {
+			return m, true
+		}
+	}
+	if !s.caseInsensitive {
+		return Method{}, false
+	}
+	var (
+		found Method
+		n     int
+	)
+	for method, m := range s.Methods {
+		if strings.EqualFold(method, name) {
+			found = m
+			n++
+		}
+	}
+	return found, n == 1
+}
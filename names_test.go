@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCaseInsensitiveMethods(t *testing.T) {
+	s := New(WithCaseInsensitiveMethods())
+	require.NoError(t, s.Register(&Math{}))
+
+	for _, name := range []string{"Math.Add", "math.add", "MATH.ADD"} {
+		res, err := s.callContext(context.Background(), &Request{
+			ServiceMethod: name,
+			Body:          []byte(`{"A":1,"B":2}`),
+		})
+		require.NoError(t, err, name)
+		require.Equal(t, name, res.ServiceMethod)
+		require.JSONEq(t, `{"X":3}`, string(res.Body))
+	}
+
+	// Ambiguous names are not resolved.
+	require.NoError(t, s.RegisterName("math", &Math{}))
+	_, err := s.callContext(context.Background(), &Request{
+		ServiceMethod: "MATH.ADD",
+		Body:          []byte(`{"A":1,"B":2}`),
+	})
+	require.True(t, errors.Is(err, ErrMethodNotFound))
+
+	// Methods are case sensitive by default.
+	s = New()
+	require.NoError(t, s.Register(&Math{}))
+	_, err = s.callContext(context.Background(), &Request{
+		ServiceMethod: "math.add",
+		Body:          []byte(`{"A":1,"B":2}`),
+	})
+	require.True(t, errors.Is(err, ErrMethodNotFound))
+}
+
+func TestWithMethodNameNormalizer(t *testing.T) {
+	// Maps "math/add" to "Math.Add".
+	normalize := func(name string) string {
+		parts := strings.Split(name, "/")
+		for i, p := range parts {
+			if p != "" {
+				parts[i] = strings.ToUpper(p[:1]) + p[1:]
+			}
+		}
+		return strings.Join(parts, ".")
+	}
+	s := New(WithMethodNameNormalizer(normalize))
+	require.NoError(t, s.Register(&Math{}))
+
+	res, err := s.callContext(context.Background(), &Request{
+		ServiceMethod: "math/add",
+		Body:          []byte(`{"A":1,"B":2}`),
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":3}`, string(res.Body))
+}
+
+type RenamedMath struct {
+	Math
+}
+
+func (m *RenamedMath) Sub(req *AddRequest, res *AddResponse) error {
+	res.X = req.A - req.B
+	return nil
+}
+
+func (m *RenamedMath) Reset(req *AddRequest, res *AddResponse) error {
+	return nil
+}
+
+func (m *RenamedMath) RPCName() string {
+	return "Arith"
+}
+
+func (m *RenamedMath) RPCMethodNames() map[string]string {
+	return map[string]string{
+		"Add":   "Sum",
+		"Reset": "-",
+	}
+}
+
+func TestRegister_Names(t *testing.T) {
+	s := New(WithoutPing())
+	require.NoError(t, s.Register(&RenamedMath{}))
+
+	names := []string{}
+	for name := range s.Methods {
+		names = append(names, name)
+	}
+	require.ElementsMatch(t, []string{"Arith.Sum", "Arith.Sub"}, names)
+
+	res, err := s.callContext(context.Background(), &Request{
+		ServiceMethod: "Arith.Sum",
+		Body:          []byte(`{"A":1,"B":2}`),
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":3}`, string(res.Body))
+}
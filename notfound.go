@@ -0,0 +1,143 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is the number of methods suggested when calling a method
+// which isn't found.
+const maxSuggestions = 3
+
+// FallbackHandler handles calls to methods that aren't registered, see
+// SetFallback.
+type FallbackHandler func(ctx context.Context, req *Request) (*Response, error)
+
+// SetFallback sets the handler of calls to methods that aren't registered,
+// eg. to proxy them to another service, to answer calls to removed methods
+// with a deprecation notice, or to synthesize methods at runtime. It
+// returns ErrMethodNotFound for calls it doesn't handle, which fail as if
+// it wasn't set.
+// Fallbacks are called with the request as received, neither authorized
+// nor wrapped in middleware, and only for the methods exposed by the
+// handler, see WithAllowedMethods.
+// This method is not thread safe.
+func (s *Service) SetFallback(f FallbackHandler) {
+	s.fallback = f
+}
+
+// callFallback calls the fallback with the request of a method which
+// isn't registered.
+func (s *Service) callFallback(ctx context.Context, req *Request) (*Response, error) {
+	res, err := s.fallback(ctx, req)
+	if err != nil {
+		if !errors.Is(err, ErrMethodNotFound) {
+			s.logf("rpc: call to %s failed: %v", req.ServiceMethod, err)
+		}
+		return nil, err
+	}
+	if res == nil {
+		res = &Response{}
+	}
+	if res.ServiceMethod == "" {
+		res.ServiceMethod = req.ServiceMethod
+	}
+	res.Seq = req.Seq
+	return res, nil
+}
+
+// methodNotFound returns the error of a call to a method which isn't
+// found, suggesting the exposed methods with the closest names in its
+// "suggestions" detail, comma separated.
+func (s *Service) methodNotFound(ctx context.Context, name string) error {
+	err := &Error{
+		Code:    CodeMethodNotFound,
+		Message: fmt.Sprintf("method %q not found", name),
+	}
+	if suggestions := s.suggest(ctx, name); len(suggestions) > 0 {
+		err.Message += fmt.Sprintf(", did you mean %q?", suggestions[0])
+		err.Details = map[string]string{
+			"suggestions": strings.Join(suggestions, ","),
+		}
+	}
+	return err
+}
+
+// suggest returns the names of the exposed methods closest to name, by
+// their edit distance ignoring case, closest first.
+func (s *Service) suggest(ctx context.Context, name string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	lower := strings.ToLower(name)
+	// Names further away than a third of their length are unrelated.
+	limit := len(name) / 3
+	if limit < 2 {
+		limit = 2
+	}
+
+	var candidates []candidate
+	s.mu.RLock()
+	for method := range s.Methods {
+		if !exposed(ctx, method) {
+			continue
+		}
+		if d := levenshtein(lower, strings.ToLower(method)); d <= limit {
+			candidates = append(candidates, candidate{method, d})
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	if len(candidates) > maxSuggestions {
+		candidates = candidates[:maxSuggestions]
+	}
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = c.name
+	}
+	return names
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// writeRequestError writes the error of a request to the method which
+// can't be made. Calls to methods which aren't found get their structured
+// error, other requests are bad requests.
+func (s *Service) writeRequestError(w http.ResponseWriter, r *http.Request, method string, err error) {
+	if errors.Is(err, ErrMethodNotFound) {
+		s.writeError(w, r, nil, s.methodNotFound(r.Context(), method))
+		return
+	}
+	s.httpError(w, http.StatusBadRequest, errBadRequest)
+}
@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Serve_MethodNotFound(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Register(&Counter{}))
+	srv := httptest.NewServer(s.Serve(WithDeniedMethods("Counter.*")))
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	call := func(method string) *Error {
+		err := c.Call(context.Background(), method, &AddRequest{}, &AddResponse{})
+		var rerr *Error
+		require.True(t, errors.As(err, &rerr), "%v", err)
+		require.Equal(t, CodeMethodNotFound, rerr.Code)
+		return rerr
+	}
+
+	// Close names are suggested, closest first.
+	rerr := call("Math.Ad")
+	require.Equal(t, `method "Math.Ad" not found, did you mean "Math.Add"?`, rerr.Message)
+	require.Equal(t, map[string]string{"suggestions": "Math.Add"}, rerr.Details)
+	require.Equal(t, "Math.Add", call("math.add").Details["suggestions"])
+
+	// Unrelated names and methods which aren't exposed aren't.
+	require.Nil(t, call("Storage.Put").Details)
+	require.Nil(t, call("Counter.Incr").Details)
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		d    int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"Math.Add", "Math.Ad", 1},
+		{"Math.Add", "Math.Dda", 2},
+		{"héllo", "hello", 1},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.d, levenshtein(tt.a, tt.b), "%s %s", tt.a, tt.b)
+	}
+}
+
+func TestService_SetFallback(t *testing.T) {
+	upstream := New()
+	require.NoError(t, upstream.RegisterName("Legacy", &Math{}))
+
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	called := []string{}
+	s.SetFallback(func(ctx context.Context, req *Request) (*Response, error) {
+		called = append(called, req.ServiceMethod)
+		switch {
+		case strings.HasPrefix(req.ServiceMethod, "Legacy."):
+			// Proxy the call.
+			return upstream.callContext(ctx, req)
+		case req.ServiceMethod == "Math.Sub":
+			return nil, &Error{Code: CodeDisabled, Message: "Math.Sub was removed, use Math.Add"}
+		}
+		return nil, ErrMethodNotFound
+	})
+	srv := httptest.NewServer(s.Serve(WithDeniedMethods("Hidden.*")))
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+
+	res := &AddResponse{}
+	require.NoError(t, c.Call(context.Background(), "Legacy.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 3, res.X)
+	require.NoError(t, c.Call(context.Background(), "Math.Add", &AddRequest{A: 2, B: 2}, res))
+	require.Equal(t, 4, res.X)
+
+	var rerr *Error
+	err = c.Call(context.Background(), "Math.Sub", &AddRequest{}, res)
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeDisabled, rerr.Code)
+
+	// Calls the fallback doesn't handle fail as if it wasn't set.
+	err = c.Call(context.Background(), "Math.Ad", &AddRequest{}, res)
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeMethodNotFound, rerr.Code)
+	require.Equal(t, "Math.Add", rerr.Details["suggestions"])
+
+	// Methods that aren't exposed don't reach it.
+	err = c.Call(context.Background(), "Hidden.Add", &AddRequest{}, res)
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeMethodNotFound, rerr.Code)
+	require.Equal(t, []string{"Legacy.Add", "Math.Sub", "Math.Ad"}, called)
+}
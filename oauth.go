@@ -0,0 +1,366 @@
+package rpc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // register hash functions used by JWT algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// TokenValidator validates OAuth2/OIDC bearer tokens (JWTs) against the
+	// keys published on a JWKS endpoint.
+	// Keys are cached and refetched when they expire or when a token is
+	// signed with an unknown key id, so keys can be rotated by the issuer.
+	TokenValidator struct {
+		JWKSURL  string        // url of the JWKS document
+		Issuer   string        // if set, the required "iss" claim
+		Audience string        // if set, required to be in the "aud" claim
+		Client   *http.Client  // defaults to http.DefaultClient
+		CacheTTL time.Duration // how long keys are cached, defaults to 1h
+		Leeway   time.Duration // allowed clock skew for "exp" and "nbf"
+
+		mu        sync.Mutex
+		keys      map[string]crypto.PublicKey
+		fetchedAt time.Time
+	}
+	// TokenClaims are the registered claims checked by the TokenValidator.
+	TokenClaims struct {
+		Issuer    string   `json:"iss"`
+		Subject   string   `json:"sub"`
+		Audience  audience `json:"aud"`
+		ExpiresAt float64  `json:"exp"`
+		NotBefore float64  `json:"nbf"`
+		Scope     string   `json:"scope"`
+		Roles     []string `json:"roles"`
+	}
+	audience []string
+	jwk      struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	jwtHeader struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+)
+
+// jwksMinRefresh limits how often unknown key ids can trigger a refetch.
+const jwksMinRefresh = time.Minute
+
+type claimsKey struct{}
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
+	}
+	*a = ss
+	return nil
+}
+
+// Middleware returns an http middleware that rejects requests without a
+// valid bearer token, and attaches the token's claims and Principal to the
+// request context of the ones that have one.
+func (v *TokenValidator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || token == r.Header.Get("Authorization") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, JSONCodec{}, nil, &Error{
+				Code:    CodeUnauthenticated,
+				Message: "missing bearer token",
+			})
+			return
+		}
+
+		claims, raw, err := v.validate(r.Context(), token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, JSONCodec{}, nil, &Error{
+				Code:    CodeUnauthenticated,
+				Message: "invalid token: " + err.Error(),
+			})
+			return
+		}
+
+		roles := append(strings.Fields(claims.Scope), claims.Roles...)
+		ctx := context.WithValue(r.Context(), claimsKey{}, raw)
+		ctx = WithPrincipal(ctx, Principal{
+			Subject: claims.Subject,
+			Roles:   roles,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ClaimsFromContext decodes the claims of the bearer token validated by
+// TokenValidator.Middleware into a T, eg. a struct embedding TokenClaims
+// along with the application's own claims. It returns false if ctx has no
+// claims, or they can't be decoded into a T.
+func ClaimsFromContext[T any](ctx context.Context) (T, bool) {
+	var claims T
+	raw, ok := ctx.Value(claimsKey{}).(json.RawMessage)
+	if !ok {
+		return claims, false
+	}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return claims, false
+	}
+	return claims, true
+}
+
+// Validate verifies the token's signature and registered claims.
+func (v *TokenValidator) Validate(ctx context.Context, token string) (*TokenClaims, error) {
+	claims, _, err := v.validate(ctx, token)
+	return claims, err
+}
+
+func (v *TokenValidator) validate(ctx context.Context, token string) (*TokenClaims, json.RawMessage, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("malformed token")
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed header: %v", err)
+	}
+	header := jwtHeader{}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, nil, fmt.Errorf("malformed header: %v", err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed signature: %v", err)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := verifyJWT(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed payload: %v", err)
+	}
+	claims := &TokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, nil, fmt.Errorf("malformed payload: %v", err)
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == 0 {
+		return nil, nil, fmt.Errorf("token has no expiry")
+	}
+	if now.Add(-v.Leeway).After(unixTime(claims.ExpiresAt)) {
+		return nil, nil, fmt.Errorf("token expired")
+	}
+	if claims.NotBefore != 0 && now.Add(v.Leeway).Before(unixTime(claims.NotBefore)) {
+		return nil, nil, fmt.Errorf("token not yet valid")
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return nil, nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if v.Audience != "" && !claims.Audience.contains(v.Audience) {
+		return nil, nil, fmt.Errorf("token not intended for audience %q", v.Audience)
+	}
+
+	return claims, payload, nil
+}
+
+// key returns the public key for the given key id, fetching the JWKS if
+// the cached keys have expired or don't include it.
+func (v *TokenValidator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	ttl := v.CacheTTL
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+
+	key, ok := v.keys[kid]
+	age := time.Since(v.fetchedAt)
+	if ok && age < ttl {
+		return key, nil
+	}
+	if ok || v.keys == nil || age >= jwksMinRefresh {
+		if err := v.fetch(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (v *TokenValidator) fetch(ctx context.Context) error {
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.JWKSURL, nil)
+	if err != nil {
+		return fmt.Errorf("error creating jwks request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching jwks: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error fetching jwks: %s", resp.Status)
+	}
+
+	doc := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("error decoding jwks: %v", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range doc.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			// Skip keys we don't understand, the issuer might be
+			// publishing keys for algorithms we don't support.
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	return nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func verifyJWT(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write(signed) // nolint: errcheck
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' {
+			return fmt.Errorf("algorithm %q doesn't match key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, sig); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if alg[0] != 'E' || len(sig)%2 != 0 {
+			return fmt.Errorf("algorithm %q doesn't match key", alg)
+		}
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key")
+	}
+
+	return nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+func unixTime(f float64) time.Time {
+	return time.Unix(int64(f), 0)
+}
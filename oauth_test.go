@@ -0,0 +1,158 @@
+package rpc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestTokenValidator_Middleware(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "k1",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer jwks.Close()
+
+	s := New()
+	s.Authorizer = RoleAuthorizer{}
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Register(WhoAmI{}))
+	require.NoError(t, s.Configure("Math.Add", WithRoles("math:add")))
+
+	v := &TokenValidator{
+		JWKSURL:  jwks.URL,
+		Issuer:   "issuer",
+		Audience: "rpc",
+	}
+	srv := httptest.NewServer(v.Middleware(s.Serve()))
+	defer srv.Close()
+
+	call := func(token string) error {
+		client := &http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				r.Header.Set("Authorization", "Bearer "+token)
+				return http.DefaultTransport.RoundTrip(r)
+			}),
+		}
+		res := &AddResponse{}
+		return s.Call(client, srv.URL, "Math.Add", &AddRequest{A: 1, B: 2}, res)
+	}
+	code := func(err error) string {
+		var rerr *Error
+		require.True(t, errors.As(err, &rerr))
+		return rerr.Code
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	claims := map[string]interface{}{
+		"iss":   "issuer",
+		"sub":   "alice",
+		"aud":   []string{"rpc"},
+		"exp":   exp,
+		"scope": "math:add",
+	}
+	require.NoError(t, call(signTestJWT(t, key, "k1", claims)))
+
+	// Methods find the claims of the token in their context.
+	claims["tenant"] = "acme"
+	token := signTestJWT(t, key, "k1", claims)
+	client := &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			r.Header.Set("Authorization", "Bearer "+token)
+			return http.DefaultTransport.RoundTrip(r)
+		}),
+	}
+	tenant := &TenantClaims{}
+	require.NoError(t, s.Call(client, srv.URL, "WhoAmI.Tenant", &struct{}{}, tenant))
+	require.Equal(t, "acme", tenant.Tenant)
+	require.Equal(t, "alice", tenant.Subject)
+
+	claims["aud"] = "other"
+	require.Equal(t, CodeUnauthenticated, code(call(signTestJWT(t, key, "k1", claims))))
+
+	claims["aud"] = "rpc"
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	require.Equal(t, CodeUnauthenticated, code(call(signTestJWT(t, key, "k1", claims))))
+
+	claims["exp"] = exp
+	claims["scope"] = "math:sub"
+	require.Equal(t, CodePermissionDenied, code(call(signTestJWT(t, key, "k1", claims))))
+
+	require.Equal(t, CodeUnauthenticated, code(call(signTestJWT(t, key, "k2", claims))))
+}
+
+type (
+	TenantClaims struct {
+		TokenClaims
+		Tenant string `json:"tenant"`
+	}
+	WhoAmI struct{}
+)
+
+func (WhoAmI) Tenant(ctx context.Context, req *struct{}, res *TenantClaims) error {
+	claims, ok := ClaimsFromContext[TenantClaims](ctx)
+	if !ok {
+		return errors.New("no claims")
+	}
+	*res = claims
+	return nil
+}
+
+func TestClaimsFromContext(t *testing.T) {
+	_, ok := ClaimsFromContext[TokenClaims](context.Background())
+	require.False(t, ok)
+
+	ctx := context.WithValue(context.Background(), claimsKey{}, json.RawMessage(`{"sub":"alice","tenant":"acme","roles":["admin"]}`))
+	claims, ok := ClaimsFromContext[TenantClaims](ctx)
+	require.True(t, ok)
+	require.Equal(t, "alice", claims.Subject)
+	require.Equal(t, "acme", claims.Tenant)
+	require.Equal(t, []string{"admin"}, claims.Roles)
+
+	m, ok := ClaimsFromContext[map[string]interface{}](ctx)
+	require.True(t, ok)
+	require.Equal(t, "acme", m["tenant"])
+
+	_, ok = ClaimsFromContext[[]string](ctx)
+	require.False(t, ok)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,170 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	// OfflineQueue persists calls made with Client.Send while the server
+	// is unreachable, until they can be flushed.
+	OfflineQueue struct {
+		// OnFailure, if set, is called with queued calls the server
+		// rejected when they were flushed. They are dropped from the queue.
+		OnFailure func(QueuedCall, error)
+
+		mu    sync.Mutex
+		path  string
+		calls []QueuedCall
+	}
+	// QueuedCall is a call waiting in an OfflineQueue.
+	QueuedCall struct {
+		Method         string
+		Body           json.RawMessage
+		IdempotencyKey string // sent with the call, see Idempotency
+		Time           time.Time
+	}
+)
+
+// ErrQueued is returned by Client.Send when the call was queued.
+var ErrQueued = errors.New("rpc: call queued until the server is reachable")
+
+// OpenOfflineQueue opens the queue persisted at path, creating it if
+// needed.
+func OpenOfflineQueue(path string) (*OfflineQueue, error) {
+	q := &OfflineQueue{
+		path: path,
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rpc: error opening offline queue: %v", err)
+	}
+	if err := json.Unmarshal(b, &q.calls); err != nil {
+		return nil, fmt.Errorf("rpc: error reading offline queue: %v", err)
+	}
+	return q, nil
+}
+
+// WithOfflineQueue queues calls made with Client.Send in q while the
+// server is unreachable.
+func WithOfflineQueue(q *OfflineQueue) Option {
+	return func(o *clientOptions) {
+		o.queue = q
+	}
+}
+
+// Pending returns the queued calls, in the order they were made.
+func (q *OfflineQueue) Pending() []QueuedCall {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]QueuedCall{}, q.calls...)
+}
+
+// save persists the queue, replacing the file atomically.
+// Callers must hold q.mu.
+func (q *OfflineQueue) save() error {
+	b, err := json.Marshal(q.calls)
+	if err != nil {
+		return fmt.Errorf("rpc: error encoding offline queue: %v", err)
+	}
+	tmp := q.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("rpc: error writing offline queue: %v", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return fmt.Errorf("rpc: error writing offline queue: %v", err)
+	}
+	return nil
+}
+
+// Send makes a call whose response isn't needed, typically a mutating
+// one. If the client has an OfflineQueue, calls that can't reach the
+// server are queued, and Send returns ErrQueued. Queued calls are flushed
+// in order before any later call is sent, so calls are never reordered.
+// Each call carries an IdempotencyKeyHeader, so calls the server received
+// before the connection was lost are not executed twice.
+func (c *Client) Send(ctx context.Context, method string, reqBody interface{}) error {
+	if c.queue == nil {
+		return c.Call(ctx, method, reqBody, &json.RawMessage{})
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("rpc: error encoding request: %v", err)
+	}
+	qc := QueuedCall{
+		Method:         method,
+		Body:           body,
+		IdempotencyKey: randomID(),
+		Time:           time.Now().UTC(),
+	}
+
+	q := c.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := c.flush(ctx); err != nil {
+		return err
+	}
+	if len(q.calls) == 0 {
+		callCtx := WithOutgoingHeader(ctx, IdempotencyKeyHeader, qc.IdempotencyKey)
+		err := c.call(callCtx, method, qc.Body, &json.RawMessage{})
+		if !unreachable(err) {
+			return err
+		}
+	}
+	q.calls = append(q.calls, qc)
+	if err := q.save(); err != nil {
+		q.calls = q.calls[:len(q.calls)-1]
+		return err
+	}
+	return ErrQueued
+}
+
+// Flush sends the queued calls in order. It stops, leaving the remaining
+// calls queued, once the server can't be reached.
+func (c *Client) Flush(ctx context.Context) error {
+	if c.queue == nil {
+		return nil
+	}
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+	return c.flush(ctx)
+}
+
+// flush sends the queued calls. Callers must hold c.queue.mu.
+// Failing to reach the server is not an error, the calls stay queued.
+func (c *Client) flush(ctx context.Context) error {
+	q := c.queue
+	for len(q.calls) > 0 {
+		qc := q.calls[0]
+		callCtx := WithOutgoingHeader(ctx, IdempotencyKeyHeader, qc.IdempotencyKey)
+		err := c.call(callCtx, qc.Method, qc.Body, &json.RawMessage{})
+		if unreachable(err) {
+			return nil
+		}
+		q.calls = q.calls[1:]
+		if serr := q.save(); serr != nil {
+			return serr
+		}
+		if err != nil && q.OnFailure != nil {
+			q.OnFailure(qc, err)
+		}
+	}
+	return nil
+}
+
+// unreachable returns whether the call failed without reaching the server.
+func unreachable(err error) bool {
+	var uerr *url.Error
+	return errors.As(err, &uerr)
+}
@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Send_OfflineQueue(t *testing.T) {
+	counter := &Counter{}
+	idem := &Idempotency{}
+	s := New(WithMiddleware(idem.Middleware))
+	require.NoError(t, s.Register(counter))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	offline := true
+	keys := []string{}
+	httpClient := &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if offline {
+				return nil, errors.New("network unreachable")
+			}
+			keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+			return http.DefaultTransport.RoundTrip(r)
+		}),
+	}
+
+	path := filepath.Join(t.TempDir(), "queue")
+	q, err := OpenOfflineQueue(path)
+	require.NoError(t, err)
+	c, err := Dial(srv.URL, WithHTTPClient(httpClient), WithOfflineQueue(q))
+	require.NoError(t, err)
+
+	// Calls are queued while offline, and persisted.
+	require.Equal(t, ErrQueued, c.Send(context.Background(), "Counter.Inc", &AddRequest{A: 1}))
+	require.Equal(t, ErrQueued, c.Send(context.Background(), "Counter.Inc", &AddRequest{A: 2}))
+	require.Equal(t, 0, counter.calls)
+
+	q, err = OpenOfflineQueue(path)
+	require.NoError(t, err)
+	pending := q.Pending()
+	require.Len(t, pending, 2)
+	require.JSONEq(t, `{"A":1,"B":0}`, string(pending[0].Body))
+	require.JSONEq(t, `{"A":2,"B":0}`, string(pending[1].Body))
+	c, err = Dial(srv.URL, WithHTTPClient(httpClient), WithOfflineQueue(q))
+	require.NoError(t, err)
+
+	// Queued calls are flushed in order before later calls.
+	offline = false
+	require.NoError(t, c.Send(context.Background(), "Counter.Inc", &AddRequest{A: 3}))
+	require.Equal(t, 3, counter.calls)
+	require.Empty(t, q.Pending())
+	require.Equal(t, []string{pending[0].IdempotencyKey, pending[1].IdempotencyKey}, keys[:2])
+
+	// Flushing a call twice doesn't execute it twice.
+	q.calls = append(q.calls, pending[0])
+	require.NoError(t, c.Flush(context.Background()))
+	require.Equal(t, 3, counter.calls)
+}
+
+func TestClient_Send_OfflineQueue_Rejected(t *testing.T) {
+	counter := &Counter{fail: true}
+	s := New()
+	require.NoError(t, s.Register(counter))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	q, err := OpenOfflineQueue(filepath.Join(t.TempDir(), "queue"))
+	require.NoError(t, err)
+	failed := []QueuedCall{}
+	q.OnFailure = func(qc QueuedCall, err error) {
+		failed = append(failed, qc)
+	}
+	c, err := Dial(srv.URL, WithOfflineQueue(q))
+	require.NoError(t, err)
+
+	// Calls rejected by the server return their error.
+	err = c.Send(context.Background(), "Counter.Inc", &AddRequest{})
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrQueued))
+	require.Empty(t, q.Pending())
+
+	// Queued calls rejected when flushed are reported.
+	q.calls = append(q.calls, QueuedCall{Method: "Counter.Inc", Body: []byte(`{}`)})
+	require.NoError(t, c.Flush(context.Background()))
+	require.Len(t, failed, 1)
+	require.Empty(t, q.Pending())
+}
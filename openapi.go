@@ -0,0 +1,289 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// swaggerUITemplate is a page rendering the OpenAPI document at SpecURL
+// with Swagger UI, loaded from Assets.
+var swaggerUITemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{ .Title }}</title>
+  <link rel="stylesheet" href="{{ .Assets.CSS }}"{{ with .Assets.CSSIntegrity }} integrity="{{ . }}"{{ end }} crossorigin="anonymous">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="{{ .Assets.Bundle }}"{{ with .Assets.BundleIntegrity }} integrity="{{ . }}"{{ end }} crossorigin="anonymous"></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: {{ .SpecURL }}, dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`))
+
+type (
+	// SwaggerUIAssets are the urls of the stylesheet and script of Swagger
+	// UI loaded by the page of DocsHandler, and their subresource
+	// integrity hashes, eg. "sha384-...", which browsers check them
+	// against before using them.
+	SwaggerUIAssets struct {
+		CSS, CSSIntegrity       string
+		Bundle, BundleIntegrity string
+	}
+	// DocsOption configures the handler returned by DocsHandler.
+	DocsOption  func(*docsOptions)
+	docsOptions struct {
+		auth   func(http.Handler) http.Handler
+		assets SwaggerUIAssets
+	}
+)
+
+// SwaggerUIVersion is the version of Swagger UI loaded by default.
+const SwaggerUIVersion = "5.17.14"
+
+// DefaultSwaggerUIAssets load SwaggerUIVersion from unpkg. They carry no
+// integrity hashes; pass the hashes of the version, as published by
+// unpkg with ?meta, to WithSwaggerUI to have browsers check them.
+var DefaultSwaggerUIAssets = SwaggerUIAssets{
+	CSS:    "https://unpkg.com/swagger-ui-dist@" + SwaggerUIVersion + "/swagger-ui.css",
+	Bundle: "https://unpkg.com/swagger-ui-dist@" + SwaggerUIVersion + "/swagger-ui-bundle.js",
+}
+
+// WithDocsAuth wraps the handlers of the document and of the Swagger UI
+// page with auth, eg. the authentication middleware used for the service,
+// so the documentation is only served to those it lets through.
+func WithDocsAuth(auth func(http.Handler) http.Handler) DocsOption {
+	return func(o *docsOptions) {
+		o.auth = auth
+	}
+}
+
+// WithSwaggerUI loads Swagger UI from the given assets, eg. ones served by
+// the application, instead of DefaultSwaggerUIAssets.
+func WithSwaggerUI(assets SwaggerUIAssets) DocsOption {
+	return func(o *docsOptions) {
+		o.assets = assets
+	}
+}
+
+// OpenAPI returns an OpenAPI 3.1 document describing calls to the service
+// served at endpoint, which is either a path or an absolute url.
+// All methods are called through the same endpoint, so the document has a
+// single operation whose request and response envelopes are one of each
+// method's.
+func (s *Service) OpenAPI(title, endpoint string) (map[string]interface{}, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("rpc: invalid endpoint %q: %v", endpoint, err)
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	b := &schemaBuilder{
+		defs: map[string]*JSONSchema{},
+		// The envelope of errors is described as Error.
+		reserved:  map[string]bool{"Error": true},
+		refPrefix: "#/components/schemas/",
+	}
+	schemas := map[string]interface{}{}
+
+	names := make([]string, 0, len(s.Methods))
+	for name := range s.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	requests := []interface{}{}
+	responses := []interface{}{}
+	for _, name := range names {
+		m := s.Methods[name]
+		reqSchema := envelopeSchema(name, b.schema(m.RequestType))
+		resSchema := envelopeSchema(name, b.schema(m.ResponseType))
+		documentEnvelopes(name, m.Doc, reqSchema, resSchema)
+		schemas[name+".Request"] = reqSchema
+		schemas[name+".Response"] = resSchema
+		requests = append(requests, ref("#/components/schemas/"+name+".Request"))
+		responses = append(responses, ref("#/components/schemas/"+name+".Response"))
+	}
+	for name, def := range b.defs {
+		schemas[name] = def
+	}
+	schemas["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"ServiceMethod": map[string]string{"type": "string"},
+			"Seq":           map[string]string{"type": "integer"},
+			"Error":         map[string]string{"type": "string"},
+			"Code":          map[string]string{"type": "string"},
+			"Details": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": map[string]string{"type": "string"},
+			},
+		},
+		"required": []string{"Error"},
+	}
+
+	contentType := s.codec.ContentType()
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]string{
+			"title":   title,
+			"version": "1.0.0",
+		},
+		"paths": map[string]interface{}{
+			path: map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "call",
+					"summary":     "Call a method",
+					"requestBody": map[string]interface{}{
+						"required": true,
+						"content": map[string]interface{}{
+							contentType: map[string]interface{}{
+								"schema": oneOf(requests),
+							},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "The method's result",
+							"content": map[string]interface{}{
+								contentType: map[string]interface{}{
+									"schema": oneOf(responses),
+								},
+							},
+						},
+						"default": map[string]interface{}{
+							"description": "The call failed",
+							"content": map[string]interface{}{
+								contentType: map[string]interface{}{
+									"schema": ref("#/components/schemas/Error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+	if u.Host != "" {
+		doc["servers"] = []map[string]string{{
+			"url": u.Scheme + "://" + u.Host,
+		}}
+	}
+
+	return doc, nil
+}
+
+// DocsHandler returns a handler serving the OpenAPI document of the
+// service served at endpoint under path + "openapi.json", and a Swagger UI
+// page rendering it under path.
+// The handler doesn't authenticate callers unless given WithDocsAuth.
+func (s *Service) DocsHandler(path, title, endpoint string, opts ...DocsOption) http.Handler {
+	o := &docsOptions{
+		auth:   func(h http.Handler) http.Handler { return h },
+		assets: DefaultSwaggerUIAssets,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	specPath := path + "openapi.json"
+
+	mux := http.NewServeMux()
+	mux.Handle(specPath, o.auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, err := s.OpenAPI(title, endpoint)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(doc)
+	})))
+	mux.Handle(path, o.auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = swaggerUITemplate.Execute(w, struct {
+			Title   string
+			SpecURL string
+			Assets  SwaggerUIAssets
+		}{
+			Title:   title,
+			SpecURL: specPath,
+			Assets:  o.assets,
+		})
+	})))
+	return mux
+}
+
+// envelopeSchema returns the schema of a request or response envelope of
+// the given method, with the given body.
+func envelopeSchema(method string, body *JSONSchema) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"ServiceMethod": map[string]string{"const": method},
+			"Body":          body,
+			"Seq":           map[string]string{"type": "integer"},
+		},
+		"required": []string{"ServiceMethod", "Body"},
+	}
+}
+
+// documentEnvelopes adds the documentation of the method to the schemas
+// of its request and response envelopes. Tags, which OpenAPI only has for
+// operations, are added as the "x-tags" extension.
+func documentEnvelopes(method string, doc MethodDoc, req, res map[string]interface{}) {
+	if doc.Description != "" {
+		req["description"] = doc.Description
+	}
+	if len(doc.Tags) > 0 {
+		req["x-tags"] = doc.Tags
+	}
+	if len(doc.Examples) == 0 {
+		return
+	}
+	reqExamples := make([]interface{}, 0, len(doc.Examples))
+	resExamples := make([]interface{}, 0, len(doc.Examples))
+	for _, e := range doc.Examples {
+		reqExamples = append(reqExamples, map[string]interface{}{
+			"ServiceMethod": method,
+			"Body":          e.Request,
+		})
+		resExamples = append(resExamples, map[string]interface{}{
+			"ServiceMethod": method,
+			"Body":          e.Response,
+		})
+	}
+	req["examples"] = reqExamples
+	res["examples"] = resExamples
+}
+
+func oneOf(schemas []interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"oneOf": schemas,
+	}
+}
+
+func ref(to string) map[string]string {
+	return map[string]string{"$ref": to}
+}
@@ -0,0 +1,146 @@
+package rpc
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_OpenAPI(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+
+	doc, err := s.OpenAPI("Math", "https://example.com/rpc")
+	require.NoError(t, err)
+
+	b, err := json.Marshal(doc)
+	require.NoError(t, err)
+	parsed := struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths      map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}{}
+	require.NoError(t, json.Unmarshal(b, &parsed))
+
+	require.Equal(t, "https://example.com", parsed.Servers[0].URL)
+	require.Contains(t, parsed.Paths, "/rpc")
+	require.Contains(t, parsed.Components.Schemas, "AddRequest")
+	require.Contains(t, parsed.Components.Schemas, "Error")
+	require.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"ServiceMethod": {"const": "Math.Add"},
+			"Body": {"$ref": "#/components/schemas/AddRequest"},
+			"Seq": {"type": "integer"}
+		},
+		"required": ["ServiceMethod", "Body"]
+	}`, string(parsed.Components.Schemas["Math.Add.Request"]))
+}
+
+func TestService_DocsHandler(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.DocsHandler("/docs", "Math", "/rpc"))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/docs/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, string(body), `url: "/docs/openapi.json"`)
+
+	resp, err = http.Get(srv.URL + "/docs/openapi.json")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	doc := map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	require.Equal(t, "3.1.0", doc["openapi"])
+}
+
+func TestService_DocsHandler_Options(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer docs" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	assets := SwaggerUIAssets{
+		CSS:             "/assets/swagger-ui.css",
+		CSSIntegrity:    "sha384-css",
+		Bundle:          "/assets/swagger-ui-bundle.js",
+		BundleIntegrity: "sha384-bundle",
+	}
+	srv := httptest.NewServer(s.DocsHandler("/docs", "Math", "/rpc", WithDocsAuth(auth), WithSwaggerUI(assets)))
+	defer srv.Close()
+
+	get := func(path, token string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	// Both the page and the document are authenticated.
+	status, _ := get("/docs/", "")
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = get("/docs/openapi.json", "")
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = get("/docs/openapi.json", "docs")
+	require.Equal(t, http.StatusOK, status)
+
+	// The page loads the assets given, checking their hashes.
+	status, body := get("/docs/", "docs")
+	require.Equal(t, http.StatusOK, status)
+	require.Contains(t, body, `href="/assets/swagger-ui.css" integrity="sha384-css" crossorigin="anonymous"`)
+	require.Contains(t, body, `src="/assets/swagger-ui-bundle.js" integrity="sha384-bundle" crossorigin="anonymous"`)
+
+	// The default ones are pinned.
+	require.Contains(t, DefaultSwaggerUIAssets.Bundle, "@"+SwaggerUIVersion+"/")
+}
+
+type (
+	Outcomes struct{}
+	Outcome  struct {
+		Err *Error
+	}
+)
+
+func (Outcomes) Check(req *AddRequest, res *Outcome) error {
+	return nil
+}
+
+func TestService_OpenAPI_ErrorType(t *testing.T) {
+	s := New(WithoutPing())
+	require.NoError(t, s.Register(Outcomes{}))
+	doc, err := s.OpenAPI("Outcomes", "https://example.com/rpc")
+	require.NoError(t, err)
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	// Types named Error don't replace the envelope of errors.
+	require.Contains(t, schemas["Error"].(map[string]interface{})["properties"], "ServiceMethod")
+	require.Contains(t, schemas["github.com.geoah.go-rpc.Error"].(*JSONSchema).Properties, "Message")
+	require.Equal(t, "#/components/schemas/github.com.geoah.go-rpc.Error", schemas["Outcome"].(*JSONSchema).Properties["Err"].Ref)
+}
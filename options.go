@@ -0,0 +1,70 @@
+package rpc
+
+import (
+	"log"
+)
+
+// ServiceOption configures a Service.
+type ServiceOption func(*Service)
+
+// WithCodec sets the codec requests and responses are encoded with.
+// Defaults to JSONCodec.
+func WithCodec(c Codec) ServiceOption {
+	return func(s *Service) {
+		s.codec = c
+	}
+}
+
+// WithMiddleware appends middleware applied to every call.
+func WithMiddleware(mw ...Middleware) ServiceOption {
+	return func(s *Service) {
+		s.Use(mw...)
+	}
+}
+
+// WithAuthorizer sets the authorizer consulted before every call.
+func WithAuthorizer(a Authorizer) ServiceOption {
+	return func(s *Service) {
+		s.Authorizer = a
+	}
+}
+
+// WithTransactor sets the Transactor atomic batches are run with.
+func WithTransactor(t Transactor) ServiceOption {
+	return func(s *Service) {
+		s.transactor = t
+	}
+}
+
+// WithMaxRequestSize rejects requests larger than limit bytes with
+// CodeRequestTooLarge. Envelopes and batches are limited to
+// DefaultMaxRequestSize unless set.
+func WithMaxRequestSize(limit int64) ServiceOption {
+	return func(s *Service) {
+		s.maxRequestSize = limit
+	}
+}
+
+// WithMaxResponseSize fails calls whose response body is larger than limit
+// bytes with CodeResponseTooLarge. See MaxResponseSize.
+func WithMaxResponseSize(limit int) ServiceOption {
+	return func(s *Service) {
+		s.Use(MaxResponseSize(limit))
+	}
+}
+
+// WithLogger logs failed calls to the given logger.
+func WithLogger(l *log.Logger) ServiceOption {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithErrorMapper sets a function mapping errors returned by methods to the
+// errors sent to callers, for example to assign codes to domain errors or
+// to hide internal details.
+func WithErrorMapper(f func(error) error) ServiceOption {
+	return func(s *Service) {
+		s.errorMapper = f
+	}
+}
@@ -0,0 +1,84 @@
+package rpc
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errOverflow = errors.New("overflow")
+
+type Checked struct{}
+
+func (c *Checked) Add(req *AddRequest, res *AddResponse) error {
+	if req.A > 100 || req.B > 100 {
+		return errOverflow
+	}
+	res.X = req.A + req.B
+	return nil
+}
+
+func TestNew_Options(t *testing.T) {
+	logs := &bytes.Buffer{}
+	s := New(
+		WithLogger(log.New(logs, "", 0)),
+		WithMaxRequestSize(128),
+		WithErrorMapper(func(err error) error {
+			if errors.Is(err, errOverflow) {
+				return &Error{Code: CodeInvalidRequest, Message: "operands too large"}
+			}
+			return err
+		}),
+	)
+	require.NoError(t, s.Register(&Checked{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	res := &AddResponse{}
+	err := s.Call(http.DefaultClient, srv.URL, "Checked.Add", &AddRequest{A: 1, B: 2}, res)
+	require.NoError(t, err)
+	require.Equal(t, 3, res.X)
+
+	// Mapped errors.
+	err = s.Call(http.DefaultClient, srv.URL, "Checked.Add", &AddRequest{A: 1000}, res)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+	require.Contains(t, logs.String(), "call to Checked.Add failed: operands too large")
+
+	// Request too large.
+	err = s.Call(http.DefaultClient, srv.URL, "Checked.Add", strings.Repeat("a", 128), res)
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeRequestTooLarge, rerr.Code)
+}
+
+type testCodec struct {
+	JSONCodec
+}
+
+func (testCodec) ContentType() string {
+	return "application/x-test"
+}
+
+func TestNew_WithCodec(t *testing.T) {
+	s := New(WithCodec(testCodec{}))
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	res := &AddResponse{}
+	err := s.Call(http.DefaultClient, srv.URL, "Math.Add", &AddRequest{A: 1, B: 2}, res)
+	require.NoError(t, err)
+	require.Equal(t, 3, res.X)
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"context"
+	"time"
+)
+
+// PingMethod is the method services register by default, see WithoutPing,
+// for clients to check they are reachable and measure round-trip times.
+const PingMethod = "rpc.Ping"
+
+type (
+	// PingRequest is the request of PingMethod.
+	PingRequest struct {
+		Payload string `json:",omitempty"` // echoed in the response
+	}
+	// PingResponse is the response of PingMethod.
+	PingResponse struct {
+		Payload  string    `json:",omitempty"` // echoes that of the request
+		Time     time.Time // time the server handled the ping
+		Versions []int     // envelope protocol versions the server supports
+	}
+	// ping implements PingMethod.
+	ping struct{}
+)
+
+func (ping) Ping(req *PingRequest, res *PingResponse) error {
+	res.Payload = req.Payload
+	res.Time = time.Now().UTC()
+	res.Versions = supportedVersions
+	return nil
+}
+
+// WithoutPing doesn't register PingMethod.
+func WithoutPing() ServiceOption {
+	return func(s *Service) {
+		s.noPing = true
+	}
+}
+
+// registerPing registers PingMethod, as a read-only method.
+func (s *Service) registerPing() {
+	_ = s.RegisterName("rpc", ping{})
+	_ = s.Configure(PingMethod, WithReadOnly())
+}
+
+// Ping calls the server's PingMethod, and returns the measured round-trip
+// time, eg. for health checks or to keep connections alive.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	if err := c.call(ctx, PingMethod, &PingRequest{}, &PingResponse{}); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Ping(t *testing.T) {
+	s := New()
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	rtt, err := c.Ping(context.Background())
+	require.NoError(t, err)
+	require.True(t, rtt > 0)
+
+	require.True(t, s.Methods[PingMethod].ReadOnly)
+}
+
+func TestService_Ping(t *testing.T) {
+	s := New()
+	res, err := s.callContext(context.Background(), &Request{
+		ServiceMethod: PingMethod,
+		Body:          []byte(`{"Payload":"hello"}`),
+	})
+	require.NoError(t, err)
+	require.Contains(t, string(res.Body), `"Payload":"hello"`)
+}
+
+func TestWithoutPing(t *testing.T) {
+	s := New(WithoutPing())
+	_, ok := s.Methods[PingMethod]
+	require.False(t, ok)
+
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	_, err = c.Ping(context.Background())
+	require.Error(t, err)
+}
@@ -0,0 +1,205 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// DefaultPipelineWindow is the number of calls that can be outstanding on
+// a pipelined connection, when not set.
+const DefaultPipelineWindow = 64
+
+// maxFrameSize limits the size of the envelopes sent over pipelined
+// connections.
+const maxFrameSize = 64 << 20
+
+// PipelineConn makes calls over a persistent connection to a service
+// served with ServePipelined. Unlike over HTTP/1.1, many calls can be
+// outstanding at once: their requests are written as they are made, and
+// responses, which can arrive in any order, are matched to calls by Seq.
+// Envelopes are written to the connection as frames, prefixed with their
+// length as a 4 byte big endian integer.
+type PipelineConn struct {
+	conn       net.Conn
+	correlator *Correlator
+	window     chan struct{}
+
+	writeMu sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	err     error
+}
+
+// NewPipelineConn returns a client making calls over conn, with at most
+// window calls outstanding at once, DefaultPipelineWindow if zero.
+// Further calls wait until earlier calls complete. It takes ownership of
+// conn, which is closed by Close.
+func NewPipelineConn(conn net.Conn, window int) *PipelineConn {
+	if window <= 0 {
+		window = DefaultPipelineWindow
+	}
+	p := &PipelineConn{
+		conn:   conn,
+		window: make(chan struct{}, window),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.correlator = &Correlator{
+		Version: ProtocolVersion,
+		Send: func(ctx context.Context, msg []byte) error {
+			p.writeMu.Lock()
+			defer p.writeMu.Unlock()
+			return writeFrame(p.conn, msg)
+		},
+	}
+	go p.read()
+	return p
+}
+
+// Call calls the given method, and decodes its result into resBody.
+// Calls fail once the connection is closed or broken.
+func (p *PipelineConn) Call(ctx context.Context, method string, reqBody, resBody interface{}) error {
+	select {
+	case p.window <- struct{}{}:
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	case <-p.ctx.Done():
+		return p.err
+	}
+	defer func() { <-p.window }()
+
+	// Fail the call when the connection breaks.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
+
+	err := p.correlator.Call(ctx, method, reqBody, resBody)
+	if err != nil && p.ctx.Err() != nil {
+		return p.err
+	}
+	return err
+}
+
+// Close closes the connection. Outstanding calls fail.
+func (p *PipelineConn) Close() error {
+	return p.conn.Close()
+}
+
+// read delivers the responses read from the connection until it fails.
+func (p *PipelineConn) read() {
+	r := bufio.NewReader(p.conn)
+	for {
+		msg, err := readFrame(r, maxFrameSize)
+		if err == nil {
+			err = p.correlator.Deliver(msg)
+		}
+		if err != nil {
+			p.err = fmt.Errorf("rpc: connection closed: %w", err)
+			p.cancel()
+			p.conn.Close() // nolint: errcheck
+			return
+		}
+	}
+}
+
+// ServePipelined serves the service to PipelineConn clients connecting to
+// the listener, with at most window calls of each connection handled at
+// once, DefaultPipelineWindow if zero. Once a connection has window calls
+// in progress, its requests are no longer read, pushing back on the
+// client. Calls have no headers, like calls served with ServeMessage.
+// It blocks until the listener fails.
+func (s *Service) ServePipelined(l net.Listener, window int) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn, window) // nolint: errcheck
+	}
+}
+
+// ServeConn serves the calls made over a single pipelined connection, see
+// ServePipelined, until the connection is closed.
+func (s *Service) ServeConn(conn net.Conn, window int) error {
+	if window <= 0 {
+		window = DefaultPipelineWindow
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		writeMu sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, window)
+	)
+	defer func() {
+		cancel()
+		wg.Wait()
+		conn.Close() // nolint: errcheck
+	}()
+
+	// Requests over the size limit are rejected before reading them.
+	limit := maxFrameSize
+	if s.maxRequestSize > 0 && s.maxRequestSize < int64(limit) {
+		limit = int(s.maxRequestSize)
+	}
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := readFrame(r, limit)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			res := s.ServeMessage(ctx, msg)
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if err := writeFrame(conn, res); err != nil {
+				s.logf("rpc: error writing response: %v", err)
+			}
+		}()
+	}
+}
+
+// writeFrame writes msg prefixed with its length.
+func writeFrame(w io.Writer, msg []byte) error {
+	if len(msg) > maxFrameSize {
+		return fmt.Errorf("rpc: message exceeds limit of %d bytes", maxFrameSize)
+	}
+	frame := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(frame, uint32(len(msg)))
+	copy(frame[4:], msg)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads a message written with writeFrame, failing without
+// reading it if it is over limit bytes.
+func readFrame(r io.Reader, limit int) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if int64(n) > int64(limit) {
+		return nil, fmt.Errorf("rpc: message exceeds limit of %d bytes", limit)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Gate struct {
+	open chan struct{}
+}
+
+func (g *Gate) Wait(ctx context.Context, req *AddRequest, res *AddResponse) error {
+	select {
+	case <-g.open:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	res.X = req.A
+	return nil
+}
+
+func servePipelined(t *testing.T, s *Service, window int) net.Addr {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go s.ServePipelined(l, window) // nolint: errcheck
+	return l.Addr()
+}
+
+func TestPipelineConn(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	addr := servePipelined(t, s, 0)
+
+	conn, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	p := NewPipelineConn(conn, 0)
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res := &AddResponse{}
+			require.NoError(t, p.Call(context.Background(), "Math.Add", &AddRequest{A: i, B: 1}, res))
+			require.Equal(t, i+1, res.X)
+		}(i)
+	}
+	wg.Wait()
+
+	// Errors are returned to the caller.
+	require.Error(t, p.Call(context.Background(), "Math.Missing", &AddRequest{}, &AddResponse{}))
+
+	// Calls fail once the connection is closed.
+	require.NoError(t, p.Close())
+	require.Error(t, p.Call(context.Background(), "Math.Add", &AddRequest{}, &AddResponse{}))
+}
+
+func TestPipelineConn_OutOfOrder(t *testing.T) {
+	gate := &Gate{open: make(chan struct{})}
+	s := New()
+	require.NoError(t, s.Register(gate))
+	require.NoError(t, s.Register(&Math{}))
+	addr := servePipelined(t, s, 0)
+
+	conn, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	p := NewPipelineConn(conn, 0)
+	defer p.Close()
+
+	// A slow call doesn't hold back the calls made after it.
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Call(context.Background(), "Gate.Wait", &AddRequest{A: 1}, &AddResponse{})
+	}()
+	res := &AddResponse{}
+	require.NoError(t, p.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 3, res.X)
+	close(gate.open)
+	require.NoError(t, <-done)
+}
+
+func TestPipelineConn_Window(t *testing.T) {
+	gate := &Gate{open: make(chan struct{})}
+	s := New()
+	require.NoError(t, s.Register(gate))
+	addr := servePipelined(t, s, 0)
+
+	conn, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	p := NewPipelineConn(conn, 2)
+	defer p.Close()
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- p.Call(context.Background(), "Gate.Wait", &AddRequest{}, &AddResponse{})
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// The window is full, so further calls wait.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = p.Call(ctx, "Gate.Wait", &AddRequest{}, &AddResponse{})
+	require.Error(t, err)
+
+	close(gate.open)
+	require.NoError(t, <-done)
+	require.NoError(t, <-done)
+	require.NoError(t, p.Call(context.Background(), "Gate.Wait", &AddRequest{}, &AddResponse{}))
+}
+
+func TestService_ServeConn_RequestTooLarge(t *testing.T) {
+	s := New(WithMaxRequestSize(100))
+	require.NoError(t, s.Register(&Math{}))
+	client, server := net.Pipe()
+	defer client.Close()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.ServeConn(server, 0)
+	}()
+
+	// Requests over the limit are rejected from their length alone.
+	_, err := client.Write([]byte{0x10, 0, 0, 0})
+	require.NoError(t, err)
+	require.EqualError(t, <-errc, "rpc: message exceeds limit of 100 bytes")
+}
@@ -0,0 +1,147 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"plugin"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PluginSymbol is the symbol Go plugins loaded by a PluginLoader export
+// their services with, keyed by service name:
+//
+//	var Services = map[string]interface{}{
+//		"Math": &Math{},
+//	}
+const PluginSymbol = "Services"
+
+// PluginLoader registers the services of Go plugins into a running
+// service. Services already registered are replaced, see Replace, so a
+// new build of a plugin can replace a previous one.
+// Go can't unload plugins, so unloading a plugin only unregisters its
+// services, and plugins are only opened once per path.
+type PluginLoader struct {
+	Service *Service
+
+	mu     sync.Mutex
+	loaded map[string][]string
+}
+
+// Load opens the plugin at path and registers its services.
+func (l *PluginLoader) Load(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("rpc: error opening plugin: %v", err)
+	}
+	sym, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return fmt.Errorf("rpc: error loading plugin: %v", err)
+	}
+	var services map[string]interface{}
+	switch v := sym.(type) {
+	case *map[string]interface{}:
+		services = *v
+	case map[string]interface{}:
+		services = v
+	default:
+		return fmt.Errorf("rpc: plugin symbol %s is a %T, not a map[string]interface{}", PluginSymbol, sym)
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, name := range names {
+		if l.Service.registered(name) {
+			err = l.Service.Replace(name, services[name])
+		} else {
+			err = l.Service.add(name, services[name])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if l.loaded == nil {
+		l.loaded = map[string][]string{}
+	}
+	l.loaded[path] = names
+	return nil
+}
+
+// Unload unregisters the services of the plugin at path.
+func (l *PluginLoader) Unload(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names, ok := l.loaded[path]
+	if !ok {
+		return fmt.Errorf("rpc: plugin %s is not loaded", path)
+	}
+	for _, name := range names {
+		l.Service.remove(name)
+	}
+	delete(l.loaded, path)
+	return nil
+}
+
+// registered returns whether a service is registered under name.
+func (s *Service) registered(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for method := range s.Methods {
+		if strings.HasPrefix(method, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// add registers the methods of i under name, like RegisterName, but is
+// safe to call while the service is serving calls. If the service was
+// started, i is started before its methods are registered.
+func (s *Service) add(name string, i interface{}) error {
+	next := New(WithoutPing())
+	if err := next.RegisterName(name, i); err != nil {
+		return err
+	}
+	l := &s.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ctx := context.Background()
+	if err := l.start(ctx, i); err != nil {
+		return fmt.Errorf("rpc: error starting %T: %w", i, err)
+	}
+	s.mu.Lock()
+	for method, m := range next.Methods {
+		s.Methods[method] = m
+	}
+	s.mu.Unlock()
+	s.swapReceiver(ctx, nil, i)
+	return nil
+}
+
+// remove unregisters the methods of the service registered under name.
+// If the service was started, their receiver is stopped, unless it is
+// still registered under another name.
+func (s *Service) remove(name string) {
+	l := &s.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s.mu.Lock()
+	var prev interface{}
+	for method, m := range s.Methods {
+		if strings.HasPrefix(method, name+".") {
+			if m.Receiver.IsValid() {
+				prev = m.Receiver.Interface()
+			}
+			delete(s.Methods, method)
+		}
+	}
+	s.mu.Unlock()
+	s.swapReceiver(context.Background(), prev, nil)
+}
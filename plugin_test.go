@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginLoader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "greeter.so")
+	out, err := exec.Command("go", "build", "-buildmode=plugin", "-o", path, "./testdata/plugin").CombinedOutput()
+	if err != nil {
+		t.Skipf("can't build plugins: %v: %s", err, out)
+	}
+
+	s := New()
+	l := &PluginLoader{Service: s}
+	err = l.Load(path)
+	if err != nil && strings.Contains(err.Error(), "different version of package") {
+		// Eg. when testing with -race, which the plugin isn't built with.
+		t.Skipf("can't load plugins built for another configuration: %v", err)
+	}
+	require.NoError(t, err)
+
+	res, err := s.callContext(context.Background(), &Request{
+		ServiceMethod: "Greeter.Greet",
+		Body:          []byte(`{"Name":"plugin"}`),
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Greeting":"Hello, plugin"}`, string(res.Body))
+
+	require.NoError(t, l.Unload(path))
+	_, ok := s.Methods["Greeter.Greet"]
+	require.False(t, ok)
+	require.Error(t, l.Unload(path))
+}
+
+func TestPluginLoader_NotFound(t *testing.T) {
+	l := &PluginLoader{Service: New()}
+	require.Error(t, l.Load(filepath.Join(t.TempDir(), "missing.so")))
+}
@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Resetter is implemented by request and response types opting into
+// pooling. Instead of allocating a request and a response per call, the
+// service reuses those of previous calls to the method, reset with Reset,
+// which must clear every field.
+//
+// Methods must not retain their request or response once they return.
+// Bodies of streaming methods, and of methods with a timeout, whose calls
+// may outlive them, aren't pooled.
+type Resetter interface {
+	Reset()
+}
+
+var typeOfResetter = reflect.TypeOf((*Resetter)(nil)).Elem()
+
+// bodyPool pools the requests and responses of a method, whichever
+// implement Resetter.
+type bodyPool struct {
+	req, res *sync.Pool
+}
+
+// newBodyPool returns the pool of the bodies of m, or nil if they can't
+// be pooled.
+func newBodyPool(m Method) *bodyPool {
+	if m.Streaming() || m.ClientStreaming() {
+		return nil
+	}
+	p := &bodyPool{
+		req: newTypePool(m.RequestType),
+		res: newTypePool(m.ResponseType),
+	}
+	if p.req == nil && p.res == nil {
+		return nil
+	}
+	return p
+}
+
+// newTypePool returns a pool of values of t, a pointer type, or nil if t
+// doesn't implement Resetter.
+func newTypePool(t reflect.Type) *sync.Pool {
+	if !t.Implements(typeOfResetter) {
+		return nil
+	}
+	return &sync.Pool{
+		New: func() interface{} {
+			return reflect.New(t.Elem())
+		},
+	}
+}
+
+// pooled returns the pool of the bodies of calls to m, or nil if they
+// aren't pooled.
+func (m Method) pooled() *bodyPool {
+	if m.Timeout > 0 {
+		return nil
+	}
+	return m.pool
+}
+
+// getBody returns a value of t from pool, allocating it if pool is nil.
+func getBody(pool *sync.Pool, t reflect.Type) reflect.Value {
+	if pool == nil {
+		return reflect.New(t.Elem())
+	}
+	return pool.Get().(reflect.Value)
+}
+
+// putBody resets v and returns it to pool, if any.
+func putBody(pool *sync.Pool, v reflect.Value) {
+	if pool == nil || v.IsNil() {
+		return
+	}
+	v.Interface().(Resetter).Reset()
+	pool.Put(v)
+}
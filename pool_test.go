@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type PooledRequest struct {
+	Name  string
+	Count int
+}
+
+// pooledResets counts the resets of PooledRequests.
+var pooledResets int
+
+func (r *PooledRequest) Reset() {
+	pooledResets++
+	*r = PooledRequest{}
+}
+
+type PooledResponse struct {
+	Greeting string
+	Count    int
+}
+
+func (r *PooledResponse) Reset() {
+	*r = PooledResponse{}
+}
+
+type Greeter struct{}
+
+func (Greeter) Greet(req *PooledRequest, res *PooledResponse) error {
+	if req.Name != "" {
+		res.Greeting = "hello " + req.Name
+	}
+	res.Count = req.Count
+	return nil
+}
+
+func TestResetter(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Greeter{}))
+	m := s.Methods["Greeter.Greet"]
+	require.NotNil(t, m.pool)
+	require.NotNil(t, m.pool.req)
+	require.NotNil(t, m.pool.res)
+
+	pooledResets = 0
+	call := func(body string) PooledResponse {
+		res, err := s.callContext(context.Background(), &Request{
+			ServiceMethod: "Greeter.Greet",
+			Body:          []byte(body),
+		})
+		require.NoError(t, err)
+		var out PooledResponse
+		require.NoError(t, json.Unmarshal(res.Body, &out))
+		return out
+	}
+	require.Equal(t, PooledResponse{Greeting: "hello a", Count: 1}, call(`{"Name":"a","Count":1}`))
+	// Fields of previous calls don't leak into the next ones.
+	require.Equal(t, PooledResponse{Count: 2}, call(`{"Count":2}`))
+	require.Equal(t, 2, pooledResets)
+
+	// Calls to methods with a timeout may outlive them, so their bodies
+	// aren't pooled.
+	require.NoError(t, s.Configure("Greeter.Greet", WithTimeout(time.Second)))
+	require.Equal(t, PooledResponse{Count: 3}, call(`{"Count":3}`))
+	require.Equal(t, 2, pooledResets)
+
+	// Nor are those of types not implementing Resetter.
+	require.NoError(t, s.Register(&Math{}))
+	require.Nil(t, s.Methods["Math.Add"].pool)
+}
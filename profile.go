@@ -0,0 +1,96 @@
+package rpc
+
+import (
+	"context"
+	"math/rand/v2"
+	"runtime/metrics"
+	"runtime/pprof"
+	"time"
+)
+
+// ProfileLabel is the pprof label naming the method of profiled calls,
+// see WithProfiling.
+const ProfileLabel = "rpc.method"
+
+type (
+	// StatsOption configures Stats.
+	StatsOption func(*Stats)
+	// MethodProfile is the resource usage of the profiled calls of a
+	// method, see WithProfiling.
+	MethodProfile struct {
+		Samples      uint64        // profiled calls
+		CPUTime      time.Duration // user CPU time
+		AllocBytes   uint64        // bytes allocated on the heap
+		AllocObjects uint64        // objects allocated on the heap
+		GCAssist     time.Duration // CPU time spent assisting the GC
+	}
+)
+
+// profileMetrics are the runtime/metrics profiled calls record, in the
+// order of the fields of MethodProfile.
+var profileMetrics = []string{
+	"/cpu/classes/user:cpu-seconds",
+	"/gc/heap/allocs:bytes",
+	"/gc/heap/allocs:objects",
+	"/cpu/classes/gc/mark/assist:cpu-seconds",
+}
+
+// WithProfiling profiles a sample of calls, at the given rate between 0
+// and 1. Profiled calls run with the pprof label ProfileLabel set to their
+// method, so CPU and goroutine profiles can be broken down by method, and
+// their resource usage is added to the Profile of their MethodStats. Heap
+// profiles don't record labels: compare the allocations of methods with
+// their Profile instead.
+//
+// Resource usage is read from runtime/metrics, whose counters are those of
+// the whole process, so it includes the work done concurrently with the
+// calls: compare methods by their mean usage over many samples.
+func WithProfiling(rate float64) StatsOption {
+	return func(st *Stats) {
+		st.profileRate = rate
+	}
+}
+
+// profile calls next with ctx, profiling the call if it's sampled.
+func (st *Stats) profile(ctx context.Context, ms *MethodStats, next func(ctx context.Context)) {
+	if st.profileRate <= 0 || rand.Float64() >= st.profileRate {
+		next(ctx)
+		return
+	}
+
+	before := make([]metrics.Sample, len(profileMetrics))
+	after := make([]metrics.Sample, len(profileMetrics))
+	for i, name := range profileMetrics {
+		before[i].Name, after[i].Name = name, name
+	}
+	metrics.Read(before)
+	pprof.Do(ctx, pprof.Labels(ProfileLabel, ms.Method), next)
+	metrics.Read(after)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	p := &ms.Profile
+	p.Samples++
+	p.CPUTime += cpuSecondsDelta(before[0], after[0])
+	p.AllocBytes += uint64Delta(before[1], after[1])
+	p.AllocObjects += uint64Delta(before[2], after[2])
+	p.GCAssist += cpuSecondsDelta(before[3], after[3])
+}
+
+// cpuSecondsDelta returns the CPU time between two samples of a metric in
+// cpu-seconds, or zero if the runtime doesn't support it.
+func cpuSecondsDelta(before, after metrics.Sample) time.Duration {
+	if before.Value.Kind() != metrics.KindFloat64 {
+		return 0
+	}
+	return time.Duration((after.Value.Float64() - before.Value.Float64()) * float64(time.Second))
+}
+
+// uint64Delta returns the difference between two samples of a counter, or
+// zero if the runtime doesn't support it.
+func uint64Delta(before, after metrics.Sample) uint64 {
+	if before.Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return after.Value.Uint64() - before.Value.Uint64()
+}
@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Profiled struct {
+	label string
+}
+
+type AllocRequest struct {
+	Size int
+}
+
+var allocSink []byte
+
+func (p *Profiled) Alloc(ctx context.Context, req *AllocRequest, res *struct{}) error {
+	p.label, _ = pprof.Label(ctx, ProfileLabel)
+	allocSink = make([]byte, req.Size)
+	return nil
+}
+
+func TestWithProfiling(t *testing.T) {
+	st := NewStats(WithProfiling(1))
+	s := New(WithMiddleware(st.Middleware))
+	p := &Profiled{}
+	require.NoError(t, s.Register(p))
+
+	for i := 0; i < 3; i++ {
+		_, err := s.callContext(context.Background(), &Request{
+			ServiceMethod: "Profiled.Alloc",
+			Body:          []byte(`{"Size":1048576}`),
+		})
+		require.NoError(t, err)
+	}
+	require.Equal(t, "Profiled.Alloc", p.label)
+
+	methods := st.Methods()
+	require.Len(t, methods, 1)
+	profile := methods[0].Profile
+	require.Equal(t, uint64(3), profile.Samples)
+	require.GreaterOrEqual(t, profile.AllocBytes, uint64(3<<20))
+	require.GreaterOrEqual(t, profile.AllocObjects, uint64(3))
+
+	// Calls aren't profiled by default.
+	st = NewStats()
+	s = New(WithMiddleware(st.Middleware))
+	p = &Profiled{}
+	require.NoError(t, s.Register(p))
+	_, err := s.callContext(context.Background(), &Request{
+		ServiceMethod: "Profiled.Alloc",
+		Body:          []byte(`{"Size":1}`),
+	})
+	require.NoError(t, err)
+	require.Empty(t, p.label)
+	require.Equal(t, MethodProfile{}, st.Methods()[0].Profile)
+}
@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ProgressHeader is the request header callers set to receive the
+// progress of calls, see WithProgress.
+const ProgressHeader = "Rpc-Progress"
+
+// ProgressContentType is the content type of responses carrying progress
+// updates. Their body is a sequence of frames, each prefixed with its
+// length as a 4 byte big endian integer: the progress updates of the call,
+// followed by the response.
+const ProgressContentType = "application/vnd.rpc.progress"
+
+// Progress of a long running call.
+type Progress struct {
+	Percent float64 `json:",omitempty"`
+	Message string  `json:",omitempty"`
+}
+
+// progressFrame is a frame of a response carrying progress updates, either
+// an update or, last, the encoded response.
+type progressFrame struct {
+	Seq      uint64
+	Progress *Progress `json:",omitempty"`
+	Body     []byte    `json:",omitempty"`
+}
+
+type (
+	progressKey         struct{}
+	progressCallbackKey struct{}
+)
+
+// ReportProgress sends the progress of the call being served to the
+// caller, if it asked for it with WithProgress. Updates sent once the
+// method has returned are dropped.
+func ReportProgress(ctx context.Context, p Progress) {
+	if pw, ok := ctx.Value(progressKey{}).(*progressWriter); ok {
+		pw.report(p)
+	}
+}
+
+// WithProgress returns a context for which calls made with it receive the
+// progress updates the method reports with ReportProgress, and pass them
+// to fn as they arrive.
+func WithProgress(ctx context.Context, fn func(Progress)) context.Context {
+	return context.WithValue(ctx, progressCallbackKey{}, fn)
+}
+
+// progressWriter sends the progress updates of a call ahead of its
+// response. Until the first update the response is written as is, after
+// it the response is written as the last frame once the call is served.
+type progressWriter struct {
+	http.ResponseWriter
+	codec Codec
+
+	mu      sync.Mutex
+	seq     uint64
+	started bool // whether updates were written
+	done    bool // whether the response is being written
+	body    bytes.Buffer
+}
+
+// withProgress returns a context to which the method reports the
+// progress of the call with the given seq, if w sends progress updates.
+func withProgress(ctx context.Context, w http.ResponseWriter, seq uint64) context.Context {
+	pw, ok := w.(*progressWriter)
+	if !ok {
+		return ctx
+	}
+	pw.mu.Lock()
+	pw.seq = seq
+	pw.mu.Unlock()
+	// Calls reporting progress may outlast the write timeout.
+	clearDeadlines(pw.ResponseWriter, false)
+	return context.WithValue(ctx, progressKey{}, pw)
+}
+
+func (w *progressWriter) report(p Progress) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return
+	}
+	if !w.started {
+		w.started = true
+		w.ResponseWriter.Header().Set("Content-Type", ProgressContentType)
+		w.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+	w.writeFrame(progressFrame{Seq: w.seq, Progress: &p})
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *progressWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done = true
+	if !w.started {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done = true
+	if !w.started {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *progressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the response as the last frame, if updates were written.
+func (w *progressWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done = true
+	if w.started {
+		w.writeFrame(progressFrame{Seq: w.seq, Body: w.body.Bytes()})
+	}
+}
+
+func (w *progressWriter) writeFrame(f progressFrame) {
+	b, err := w.codec.Marshal(f)
+	if err != nil {
+		return
+	}
+	_ = writeFrame(w.ResponseWriter, b)
+}
+
+// readProgress reads a response carrying progress updates, passing them
+// to fn, and returns the encoded response.
+func readProgress(codec Codec, r io.Reader, seq uint64, fn func(Progress)) ([]byte, error) {
+	for {
+		b, err := readFrame(r, maxFrameSize)
+		if err != nil {
+			return nil, fmt.Errorf("rpc: error reading response body: %v", err)
+		}
+		var f progressFrame
+		if err := codec.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("rpc: error decoding progress: %v", err)
+		}
+		if f.Progress == nil {
+			return f.Body, nil
+		}
+		if f.Seq == seq && fn != nil {
+			fn(*f.Progress)
+		}
+	}
+}
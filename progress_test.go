@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Job struct{}
+
+type JobRequest struct {
+	Steps int
+	Fail  bool
+}
+
+type JobResponse struct {
+	Done int
+}
+
+func (j *Job) Run(ctx context.Context, req *JobRequest, res *JobResponse) error {
+	for i := 1; i <= req.Steps; i++ {
+		ReportProgress(ctx, Progress{
+			Percent: float64(i) * 100 / float64(req.Steps),
+			Message: fmt.Sprintf("step %d", i),
+		})
+		res.Done = i
+	}
+	if req.Fail {
+		return &Error{Code: CodeAborted, Message: "job failed"}
+	}
+	return nil
+}
+
+func TestReportProgress(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Job{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+
+	// Callers asking for progress receive the updates, then the response.
+	var updates []Progress
+	ctx := WithProgress(context.Background(), func(p Progress) {
+		updates = append(updates, p)
+	})
+	res := &JobResponse{}
+	require.NoError(t, c.Call(ctx, "Job.Run", &JobRequest{Steps: 4}, res))
+	require.Equal(t, 4, res.Done)
+	require.Equal(t, []Progress{
+		{Percent: 25, Message: "step 1"},
+		{Percent: 50, Message: "step 2"},
+		{Percent: 75, Message: "step 3"},
+		{Percent: 100, Message: "step 4"},
+	}, updates)
+
+	// Errors still reach the caller after progress was reported.
+	updates = nil
+	err = c.Call(ctx, "Job.Run", &JobRequest{Steps: 2, Fail: true}, res)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeAborted, rerr.Code)
+	require.Len(t, updates, 2)
+
+	// Methods not reporting progress respond as usual.
+	updates = nil
+	require.NoError(t, c.Call(ctx, "Job.Run", &JobRequest{}, res))
+	require.Empty(t, updates)
+
+	// Callers not asking for progress don't receive it.
+	require.NoError(t, c.Call(context.Background(), "Job.Run", &JobRequest{Steps: 2}, res))
+	require.Equal(t, 2, res.Done)
+}
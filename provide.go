@@ -0,0 +1,58 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+)
+
+type (
+	// Provider creates a value scoped to a call, such as a database
+	// transaction or a logger tagged with the call's method, see Provide.
+	// It returns the value along with a function releasing it once the
+	// call is done, given the error the call failed with, if any, for
+	// example to commit or roll back the transaction.
+	Provider[T any]    func(ctx context.Context, m Method, req *Request) (T, func(err error) error, error)
+	providedKey[T any] struct{}
+	provided[T any]    struct {
+		value T
+	}
+)
+
+// Provide returns a middleware creating a T with provider for every call,
+// which methods, and the middleware after it, retrieve with
+// ProvidedFromContext. Calls fail with the error of provider if it fails.
+//
+// The value is released once the call returns, or panics, and the call
+// fails with the error of releasing it, if it didn't already fail.
+// Methods that outlive their calls, such as those timed out, must not use
+// it once the context of the call is done.
+func Provide[T any](provider Provider[T]) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m Method, req *Request) (res *Response, err error) {
+			v, release, err := provider(ctx, m, req)
+			if err != nil {
+				return nil, err
+			}
+			if release != nil {
+				defer func() {
+					if r := recover(); r != nil {
+						_ = release(fmt.Errorf("rpc: method %s panicked: %v", m.Name, r))
+						panic(r)
+					}
+					if releaseErr := release(err); releaseErr != nil && err == nil {
+						res, err = nil, releaseErr
+					}
+				}()
+			}
+			ctx = context.WithValue(ctx, providedKey[T]{}, provided[T]{value: v})
+			return next(ctx, m, req)
+		}
+	}
+}
+
+// ProvidedFromContext returns the T provided for the call by the Provide
+// middleware. It returns false if the call has none.
+func ProvidedFromContext[T any](ctx context.Context) (T, bool) {
+	p, ok := ctx.Value(providedKey[T]{}).(provided[T])
+	return p.value, ok
+}
@@ -0,0 +1,104 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tx is a transaction provided to calls.
+type Tx struct {
+	Method string
+	Writes []int
+	Result error // of the call, once released
+}
+
+type Accounts struct{}
+
+func (Accounts) Write(ctx context.Context, req *AddRequest, res *AddResponse) error {
+	tx, ok := ProvidedFromContext[*Tx](ctx)
+	if !ok {
+		return errors.New("no transaction")
+	}
+	if req.A < 0 {
+		return errors.New("negative")
+	}
+	tx.Writes = append(tx.Writes, req.A)
+	res.X = len(tx.Writes)
+	return nil
+}
+
+func TestProvide(t *testing.T) {
+	txs := []*Tx{}
+	var commitErr error
+	s := New(WithMiddleware(Provide(func(ctx context.Context, m Method, req *Request) (*Tx, func(error) error, error) {
+		if req.ServiceMethod == "Accounts.Closed" {
+			return nil, nil, &Error{Code: CodeUnavailable, Message: "closed"}
+		}
+		tx := &Tx{Method: m.Name}
+		txs = append(txs, tx)
+		return tx, func(err error) error {
+			tx.Result = err
+			return commitErr
+		}, nil
+	})))
+	require.NoError(t, s.Register(Accounts{}))
+
+	call := func(body string) (*Response, error) {
+		return s.callContext(context.Background(), &Request{
+			ServiceMethod: "Accounts.Write",
+			Body:          json.RawMessage(body),
+		})
+	}
+
+	res, err := call(`{"A":1}`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":1}`, string(res.Body))
+	require.Len(t, txs, 1)
+	require.Equal(t, &Tx{Method: "Accounts.Write", Writes: []int{1}}, txs[0])
+
+	// Values are released with the errors of their calls.
+	_, err = call(`{"A":-1}`)
+	require.EqualError(t, err, "negative")
+	require.Len(t, txs, 2)
+	require.EqualError(t, txs[1].Result, "negative")
+
+	// Calls fail with the errors of releasing their values.
+	commitErr = errors.New("conflict")
+	_, err = call(`{"A":1}`)
+	require.EqualError(t, err, "conflict")
+	commitErr = nil
+
+	// And with those of providers.
+	s.Methods["Accounts.Closed"] = s.Methods["Accounts.Write"]
+	_, err = s.callContext(context.Background(), &Request{ServiceMethod: "Accounts.Closed"})
+	rpcErr := &Error{}
+	require.True(t, errors.As(err, &rpcErr))
+	require.Equal(t, CodeUnavailable, rpcErr.Code)
+	require.Len(t, txs, 3)
+
+	// Calls without providers have no values.
+	_, ok := ProvidedFromContext[*Tx](context.Background())
+	require.False(t, ok)
+}
+
+func TestProvide_Panic(t *testing.T) {
+	var released error
+	h := Provide(func(ctx context.Context, m Method, req *Request) (string, func(error) error, error) {
+		return "logger", func(err error) error {
+			released = err
+			return nil
+		}, nil
+	})(func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		logger, _ := ProvidedFromContext[string](ctx)
+		panic(logger)
+	})
+
+	require.PanicsWithValue(t, "logger", func() {
+		h(context.Background(), Method{Name: "Log.Write"}, &Request{}) // nolint: errcheck
+	})
+	require.EqualError(t, released, "rpc: method Log.Write panicked: logger")
+}
@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Quota limits how many calls each caller can make to a set of methods
+// within a fixed window, such as a minute or a day.
+// Windows are aligned to the window duration (e.g. daily quotas reset at
+// midnight UTC) and all callers share the same reset time.
+// Unlike rate limiting, usage is counted across the whole window.
+type Quota struct {
+	Methods []string      // methods the quota applies to, all if empty
+	Limit   int           // calls allowed per caller per window
+	Window  time.Duration // length of the quota window, defaults to a day
+	// Key identifies the caller, defaults to the subject of the principal.
+	// Callers without a key share a single quota.
+	Key func(ctx context.Context) string
+
+	mu          sync.Mutex
+	windowStart time.Time
+	usage       map[string]int
+}
+
+// Middleware returns the middleware enforcing the quota.
+// Calls over quota fail with CodeQuotaExceeded, and the time the quota
+// resets at in the "reset" detail, formatted as RFC 3339, and as a
+// retry-after hint, see Error.RetryAfter.
+func (q *Quota) Middleware(next Handler) Handler {
+	methods := map[string]bool{}
+	for _, m := range q.Methods {
+		methods[m] = true
+	}
+	return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		if len(methods) > 0 && !methods[m.Name] {
+			return next(ctx, m, req)
+		}
+
+		ok, reset := q.take(q.key(ctx))
+		if !ok {
+			err := &Error{
+				Code:    CodeQuotaExceeded,
+				Message: fmt.Sprintf("quota of %d calls exceeded", q.Limit),
+				Details: map[string]string{
+					"limit": strconv.Itoa(q.Limit),
+					"reset": reset.Format(time.RFC3339),
+				},
+			}
+			return nil, err.SetRetryAfter(time.Until(reset))
+		}
+
+		return next(ctx, m, req)
+	}
+}
+
+// Usage returns the number of calls the caller has made in the current
+// window.
+func (q *Quota) Usage(key string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(time.Now())
+	return q.usage[key]
+}
+
+// take records a call for the given caller if it is within quota, and
+// returns whether it was and when the current window resets.
+func (q *Quota) take(key string) (bool, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(time.Now())
+	reset := q.windowStart.Add(q.window())
+	if q.usage[key] >= q.Limit {
+		return false, reset
+	}
+	q.usage[key]++
+	return true, reset
+}
+
+// roll starts a new window, discarding all usage, once the current one is
+// over.
+func (q *Quota) roll(now time.Time) {
+	start := now.UTC().Truncate(q.window())
+	if q.usage == nil || start.After(q.windowStart) {
+		q.windowStart = start
+		q.usage = map[string]int{}
+	}
+}
+
+func (q *Quota) window() time.Duration {
+	if q.Window <= 0 {
+		return 24 * time.Hour
+	}
+	return q.Window
+}
+
+func (q *Quota) key(ctx context.Context) string {
+	if q.Key != nil {
+		return q.Key(ctx)
+	}
+	p, _ := PrincipalFromContext(ctx)
+	return p.Subject
+}
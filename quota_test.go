@@ -0,0 +1,65 @@
+package rpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuota_Middleware(t *testing.T) {
+	q := &Quota{
+		Methods: []string{"Math.Add"},
+		Limit:   2,
+		Window:  24 * time.Hour,
+	}
+
+	s := New()
+	s.Use(q.Middleware)
+	require.NoError(t, s.Register(&Math{}))
+
+	subject := "alice"
+	authn := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithPrincipal(r.Context(), Principal{Subject: subject})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+	srv := httptest.NewServer(authn(s.Serve()))
+	defer srv.Close()
+
+	call := func() error {
+		return s.Call(http.DefaultClient, srv.URL, "Math.Add", &AddRequest{}, &AddResponse{})
+	}
+
+	require.NoError(t, call())
+	require.NoError(t, call())
+
+	err := call()
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeQuotaExceeded, rerr.Code)
+	reset, err := time.Parse(time.RFC3339, rerr.Details["reset"])
+	require.NoError(t, err)
+	require.True(t, reset.After(time.Now()))
+	require.True(t, rerr.Retryable())
+	require.InDelta(t, time.Until(reset).Seconds(), rerr.RetryAfter().Seconds(), 1)
+	require.Equal(t, 2, q.Usage("alice"))
+
+	// Other callers have their own quota.
+	subject = "bob"
+	require.NoError(t, call())
+}
+
+func TestQuota_DefaultWindow(t *testing.T) {
+	// Quotas without a window are daily, instead of reset by every call.
+	q := &Quota{Limit: 1}
+	ok, reset := q.take("alice")
+	require.True(t, ok)
+	ok, _ = q.take("alice")
+	require.False(t, ok)
+	require.Equal(t, time.Now().UTC().Truncate(24*time.Hour).Add(24*time.Hour), reset)
+}
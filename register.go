@@ -0,0 +1,131 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// WithStrictRegistration makes Register and RegisterName fail when exported
+// methods of receivers don't have the shape of methods, rather than skip
+// them. Methods excluded with MethodNamer, and those of interfaces of this
+// package such as Describer, are still skipped.
+func WithStrictRegistration() ServiceOption {
+	return func(s *Service) {
+		s.strict = true
+	}
+}
+
+// RegisterMethods registers the given functions, typically method values,
+// as the methods of the service with the given name, under their keys.
+// Unlike RegisterName, which skips methods of receivers not having the
+// shape of methods, it fails if any of the functions doesn't have it:
+//
+//	func([ctx context.Context,] req *Request, res *Response) error
+//
+// This method is not thread safe.
+func (s *Service) RegisterMethods(name string, methods map[string]interface{}) error {
+	if name == "" {
+		return errors.New("rpc: no service name")
+	}
+
+	keys := make([]string, 0, len(methods))
+	for key := range methods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Methods are only registered once all are checked.
+	registered := map[string]Method{}
+	for _, key := range keys {
+		methodName := name + "." + key
+		if key == "" || strings.Contains(key, ".") {
+			return fmt.Errorf("rpc: invalid method name %q", methodName)
+		}
+
+		fn := reflect.ValueOf(methods[key])
+		if fn.Kind() != reflect.Func || fn.IsNil() {
+			return fmt.Errorf("rpc: method %s: %T isn't a function", methodName, methods[key])
+		}
+		takesContext, requestType, responseType, err := methodShape(fn.Type(), 0)
+		if err != nil {
+			return fmt.Errorf("rpc: method %s: %v", methodName, err)
+		}
+		if err := s.checkTypes(requestType, responseType); err != nil {
+			return fmt.Errorf("rpc: method %s: %v", methodName, err)
+		}
+
+		meth := Method{
+			Name:         methodName,
+			Receiver:     fn,
+			Method:       reflect.Method{Name: key, Type: fn.Type()},
+			RequestType:  requestType,
+			ResponseType: responseType,
+			TakesContext: takesContext,
+		}
+		meth.pool = newBodyPool(meth)
+		registered[methodName] = meth
+	}
+	for methodName, m := range registered {
+		s.Methods[methodName] = m
+	}
+	return nil
+}
+
+// methodShape returns whether t, the type of a method whose arguments
+// start at in, takes a context, and the types of its request and response,
+// or why it doesn't have the shape of methods.
+func methodShape(t reflect.Type, in int) (bool, reflect.Type, reflect.Type, error) {
+	// Methods can optionally take a context as their first argument.
+	takesContext := t.NumIn() > in && t.In(in) == typeOfContext
+	arg := in
+	if takesContext {
+		arg++
+	}
+
+	if t.NumIn() != arg+2 {
+		return false, nil, nil, errors.New("must take a request and a response, optionally after a context")
+	}
+	types := [2]reflect.Type{t.In(arg), t.In(arg + 1)}
+	for i, what := range []string{"request", "response"} {
+		if types[i].Kind() != reflect.Ptr {
+			return false, nil, nil, fmt.Errorf("%s type %s isn't a pointer", what, types[i])
+		}
+		if !token.IsExported(types[i].Name()) && types[i].PkgPath() != "" {
+			return false, nil, nil, fmt.Errorf("%s type %s isn't exported", what, types[i])
+		}
+	}
+	if t.NumOut() != 1 || t.Out(0) != typeOfError {
+		return false, nil, nil, errors.New("must return only an error")
+	}
+	return takesContext, types[0], types[1], nil
+}
+
+// packageInterfaces are the interfaces receivers implement besides their
+// methods.
+var packageInterfaces = []reflect.Type{
+	reflect.TypeOf((*Namer)(nil)).Elem(),
+	reflect.TypeOf((*MethodNamer)(nil)).Elem(),
+	reflect.TypeOf((*Describer)(nil)).Elem(),
+	reflect.TypeOf((*Dispatcher)(nil)).Elem(),
+	reflect.TypeOf((*Starter)(nil)).Elem(),
+	reflect.TypeOf((*Stopper)(nil)).Elem(),
+}
+
+// packageMethods returns the names of the methods of t implementing
+// packageInterfaces.
+func packageMethods(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for _, iface := range packageInterfaces {
+		if !t.Implements(iface) {
+			continue
+		}
+		for i := 0; i < iface.NumMethod(); i++ {
+			names[iface.Method(i).Name] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// SloppyMath has exported methods that aren't methods of services.
+type SloppyMath struct {
+	Math
+}
+
+func (SloppyMath) Double(x int) int {
+	return 2 * x
+}
+
+func (SloppyMath) Describe() map[string]MethodDoc {
+	return map[string]MethodDoc{"Add": {Description: "Adds"}}
+}
+
+func TestService_RegisterMethods(t *testing.T) {
+	s := New()
+	m := &Math{}
+	require.NoError(t, s.RegisterMethods("Calc", map[string]interface{}{
+		"Sum": m.Add,
+		"Sub": func(ctx context.Context, req *AddRequest, res *AddResponse) error {
+			res.X = req.A - req.B
+			return nil
+		},
+	}))
+	require.Contains(t, s.Methods, "Calc.Sum")
+	require.True(t, s.Methods["Calc.Sub"].TakesContext)
+
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	res := &AddResponse{}
+	require.NoError(t, s.Call(http.DefaultClient, srv.URL, "Calc.Sum", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 3, res.X)
+	require.NoError(t, s.Call(http.DefaultClient, srv.URL, "Calc.Sub", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, -1, res.X)
+
+	out, err := s.callContext(context.Background(), &Request{
+		ServiceMethod: "Calc.Sum",
+		Body:          json.RawMessage(`{"A":2,"B":2}`),
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":4}`, string(out.Body))
+
+	// Functions that aren't methods fail with why, registering none.
+	for msg, methods := range map[string]map[string]interface{}{
+		"rpc: method Bad.Double: must take a request and a response, optionally after a context": {
+			"Add":    m.Add,
+			"Double": SloppyMath{}.Double,
+		},
+		"rpc: method Bad.Add: request type rpc.AddRequest isn't a pointer": {
+			"Add": func(req AddRequest, res *AddResponse) error { return nil },
+		},
+		"rpc: method Bad.Add: must return only an error": {
+			"Add": func(req *AddRequest, res *AddResponse) {},
+		},
+		"rpc: method Bad.Add: string isn't a function": {
+			"Add": "add",
+		},
+		`rpc: invalid method name "Bad.A.B"`: {
+			"A.B": m.Add,
+		},
+	} {
+		require.EqualError(t, s.RegisterMethods("Bad", methods), msg)
+	}
+	for name := range s.Methods {
+		require.NotContains(t, name, "Bad.")
+	}
+}
+
+func TestWithStrictRegistration(t *testing.T) {
+	// Methods that aren't methods of services are skipped by default.
+	s := New()
+	require.NoError(t, s.Register(&SloppyMath{}))
+	require.Contains(t, s.Methods, "SloppyMath.Add")
+	require.NotContains(t, s.Methods, "SloppyMath.Double")
+
+	// Unless registration is strict, Describe of Describer aside.
+	s = New(WithStrictRegistration())
+	require.EqualError(t, s.Register(&SloppyMath{}), "rpc: method SloppyMath.Double: must take a request and a response, optionally after a context")
+	require.NotContains(t, s.Methods, "SloppyMath.Add")
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Register(&DispatchedMath{}))
+}
@@ -0,0 +1,123 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// method returns the registered method with the given name, or the one
+// it resolves to, see WithCaseInsensitiveMethods.
+func (s *Service) method(name string) (Method, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if m, ok := s.Methods[name]; ok {
+		return m, true
+	}
+	return s.resolve(name)
+}
+
+// Replace swaps the implementation of the service registered under name
+// for i, atomically. Calls already being handled finish against the
+// previous implementation, and later calls are handled by i.
+// i must have the same methods as the previous implementation, with the
+// same request and response types. The configuration of the methods,
+// such as their roles and timeout, is kept.
+// If the service was started, i is started before it replaces the
+// previous implementation, which is stopped once replaced, unless it is
+// also registered under another name, see Starter and Stopper. Replace
+// fails if i can't be started, leaving the previous implementation in
+// place.
+// Replace is safe to call while the service is serving calls.
+func (s *Service) Replace(name string, i interface{}) error {
+	next := New(WithoutPing())
+	if err := next.RegisterName(name, i); err != nil {
+		return err
+	}
+
+	l := &s.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := s.checkReplacement(name, next, i); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := l.start(ctx, i); err != nil {
+		return fmt.Errorf("rpc: error starting %T: %w", i, err)
+	}
+
+	s.mu.Lock()
+	var prev interface{}
+	for method, nm := range next.Methods {
+		m := s.Methods[method]
+		if m.Receiver.IsValid() {
+			prev = m.Receiver.Interface()
+		}
+		m.Receiver = nm.Receiver
+		m.Method = nm.Method
+		m.TakesContext = nm.TakesContext
+		m.pool = nm.pool
+		m.dispatcher = nm.dispatcher
+		s.Methods[method] = m
+	}
+	s.mu.Unlock()
+
+	s.swapReceiver(ctx, prev, i)
+	return nil
+}
+
+// checkReplacement returns an error unless i, registered on next under
+// name, has the methods of the service registered under name.
+func (s *Service) checkReplacement(name string, next *Service, i interface{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	registered := 0
+	for method := range s.Methods {
+		if strings.HasPrefix(method, name+".") {
+			registered++
+		}
+	}
+	if registered == 0 {
+		return fmt.Errorf("rpc: service %q is not registered", name)
+	}
+	if len(next.Methods) != registered {
+		return fmt.Errorf("rpc: %T doesn't have the methods of service %q", i, name)
+	}
+	for method, nm := range next.Methods {
+		m, ok := s.Methods[method]
+		if !ok {
+			return fmt.Errorf("rpc: %T doesn't have the methods of service %q", i, name)
+		}
+		if nm.RequestType != m.RequestType || nm.ResponseType != m.ResponseType {
+			return fmt.Errorf("rpc: method %s of %T has different request or response types", method, i)
+		}
+	}
+	return nil
+}
+
+// swapReceiver records i in the lifecycle of the service in place of
+// prev, which is stopped unless it is still registered under another
+// name. s.lifecycle.mu must be held.
+func (s *Service) swapReceiver(ctx context.Context, prev, i interface{}) {
+	l := &s.lifecycle
+	if prev != nil && !s.hasReceiver(prev) && l.remove(prev) {
+		if err := l.stop(ctx, prev); err != nil {
+			s.logf("rpc: error stopping %T: %v", prev, err)
+		}
+	}
+	if i != nil {
+		l.add(i)
+	}
+}
+
+// hasReceiver returns whether i is the receiver of a registered method.
+func (s *Service) hasReceiver(i interface{}) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, m := range s.Methods {
+		if m.Receiver.IsValid() && sameReceiver(m.Receiver.Interface(), i) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type slowMath struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *slowMath) Add(req *AddRequest, res *AddResponse) error {
+	close(m.started)
+	<-m.release
+	res.X = req.A + req.B
+	return nil
+}
+
+func TestService_Replace(t *testing.T) {
+	s := New()
+	old := &slowMath{started: make(chan struct{}), release: make(chan struct{})}
+	require.NoError(t, s.RegisterName("Math", old))
+	require.NoError(t, s.Configure("Math.Add", WithRoles("math")))
+
+	call := func() string {
+		res, err := s.callContext(context.Background(), &Request{
+			ServiceMethod: "Math.Add",
+			Body:          []byte(`{"A":1,"B":2}`),
+		})
+		require.NoError(t, err)
+		return string(res.Body)
+	}
+
+	// A call in flight on the old implementation.
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	var inFlight string
+	go func() {
+		defer wg.Done()
+		inFlight = call()
+	}()
+	<-old.started
+
+	require.NoError(t, s.Replace("Math", &doubleMath{}))
+	require.JSONEq(t, `{"X":6}`, call())
+	require.Equal(t, []string{"math"}, s.Methods["Math.Add"].Roles)
+
+	close(old.release)
+	wg.Wait()
+	require.JSONEq(t, `{"X":3}`, inFlight)
+}
+
+func TestService_Replace_Mismatch(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+
+	require.Error(t, s.Replace("Clock", &Clock{}))
+	require.Error(t, s.Replace("Math", &Clock{}))
+	require.Error(t, s.Replace("Math", &otherMath{}))
+	require.NoError(t, s.Replace("Math", &Checked{}))
+}
+
+type otherMath struct{}
+
+func (m *otherMath) Add(req *RemainingRequest, res *AddResponse) error {
+	return nil
+}
+
+func TestService_Replace_Dispatcher(t *testing.T) {
+	s := New()
+	old, next := &DispatchedMath{}, &DispatchedMath{}
+	require.NoError(t, s.RegisterName("Math", old))
+	require.NoError(t, s.Replace("Math", next))
+
+	res, err := s.callContext(context.Background(), &Request{
+		ServiceMethod: "Math.Add",
+		Body:          []byte(`{"A":1,"B":2}`),
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":3}`, string(res.Body))
+	require.Empty(t, old.dispatched)
+	require.Equal(t, []string{"Add"}, next.dispatched)
+}
@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Environment variables used to pass listeners to a new process.
+const (
+	envListenFDs     = "RPC_LISTEN_FDS"
+	envListenFDNames = "RPC_LISTEN_FDNAMES"
+)
+
+// PassListeners configures cmd to pass the given listeners to the process
+// it starts, which can pick them up with InheritedListeners.
+//
+// Unix listeners are changed to no longer remove their socket file when
+// closed, so the old process closing them doesn't pull the socket out from
+// under the new one.
+func PassListeners(cmd *exec.Cmd, listeners map[string]net.Listener) error {
+	names := make([]string, 0, len(listeners))
+	for name := range listeners {
+		if strings.Contains(name, ":") {
+			return fmt.Errorf("rpc: invalid listener name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		l, ok := listeners[name].(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			return fmt.Errorf("rpc: listener %s can't be passed to another process", name)
+		}
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+		f, err := l.File()
+		if err != nil {
+			return fmt.Errorf("rpc: error passing listener %s: %v", name, err)
+		}
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env,
+		envListenFDs+"="+strconv.Itoa(len(names)),
+		envListenFDNames+"="+strings.Join(names, ":"),
+	)
+	return nil
+}
+
+// Restart starts a new instance of the running executable with the same
+// arguments, passing it the given listeners.
+//
+// It enables zero-downtime restarts: the new process starts accepting
+// connections on the listeners with InheritedListeners, while the old
+// process stops accepting new ones and drains in-flight calls, by
+// canceling the context given to WithShutdown.
+func Restart(listeners map[string]net.Listener) (*os.Process, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("rpc: error finding executable: %v", err)
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := PassListeners(cmd, listeners); err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range cmd.ExtraFiles {
+			f.Close() // nolint: errcheck
+		}
+	}()
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("rpc: error starting process: %v", err)
+	}
+	return cmd.Process, nil
+}
+
+// InheritedListeners returns the listeners passed to the process with
+// PassListeners or Restart, keyed by name, or nil if there are none.
+func InheritedListeners() (map[string]net.Listener, error) {
+	defer func() {
+		os.Unsetenv(envListenFDs)     // nolint: errcheck
+		os.Unsetenv(envListenFDNames) // nolint: errcheck
+	}()
+
+	n, err := strconv.Atoi(os.Getenv(envListenFDs))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv(envListenFDNames), ":")
+	if len(names) != n {
+		return nil, fmt.Errorf("rpc: expected %d listener names, got %d", n, len(names))
+	}
+
+	listeners := map[string]net.Listener{}
+	for i, name := range names {
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		l, err := net.FileListener(f)
+		f.Close() // nolint: errcheck
+		if err != nil {
+			for _, l := range listeners {
+				l.Close() // nolint: errcheck
+			}
+			return nil, fmt.Errorf("rpc: error using inherited listener %s: %v", name, err)
+		}
+		listeners[name] = l
+	}
+
+	return listeners, nil
+}
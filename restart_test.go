@@ -0,0 +1,57 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPassListeners(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("passing files to child processes is not supported on windows")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperInheritedListeners")
+	cmd.Env = append(os.Environ(), "RPC_TEST_HELPER=1")
+	require.NoError(t, PassListeners(cmd, map[string]net.Listener{"rpc": l}))
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill() // nolint: errcheck
+
+	// The old process stops accepting connections.
+	require.NoError(t, l.Close())
+
+	c, err := Dial("http://" + addr)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res := &AddResponse{}
+	err = c.Call(ctx, "Math.Add", &AddRequest{A: 1, B: 2}, res)
+	require.NoError(t, err)
+	require.Equal(t, 3, res.X)
+}
+
+func TestHelperInheritedListeners(t *testing.T) {
+	if os.Getenv("RPC_TEST_HELPER") != "1" {
+		return
+	}
+
+	ls, err := InheritedListeners()
+	require.NoError(t, err)
+	require.Contains(t, ls, "rpc")
+
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, s.ServeListener(ls["rpc"], WithShutdown(ctx, time.Second)))
+}
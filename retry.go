@@ -0,0 +1,92 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy retries calls the server rejected without processing them,
+// see Error.Retryable, waiting between attempts. Retry-after hints sent by
+// the server, see Error.RetryAfter, take precedence over the backoff.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts per call, including the first one
+	Backoff     Backoff       // delays between attempts, defaults to an ExponentialBackoff
+	MaxDelay    time.Duration // longest delay waited between attempts, defaults to 10s
+	Budget      *RetryBudget  // if set, limits retries across calls
+}
+
+// Defaults of RetryPolicy, and of the backoffs.
+const (
+	DefaultRetryBackoff  = 100 * time.Millisecond
+	DefaultRetryMaxDelay = 10 * time.Second
+)
+
+// WithRetry retries calls made with Call according to the policy. Calls
+// whose retry-after hint exceeds the policy's MaxDelay, or the deadline of
+// their context, fail right away.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *clientOptions) {
+		o.retry = &p
+	}
+}
+
+// retry makes a call with the client's retry policy, if any.
+func (c *Client) retry(ctx context.Context, call func() error) error {
+	p := c.retryPolicy
+	if p == nil {
+		return call()
+	}
+	var prev time.Duration
+	if p.Budget != nil {
+		p.Budget.call()
+	}
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= p.MaxAttempts {
+			return err
+		}
+		delay, ok := p.delay(err, attempt, prev)
+		if !ok {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		if p.Budget != nil && !p.Budget.retry() {
+			return err
+		}
+		if !sleep(ctx, delay) {
+			return err
+		}
+		prev = delay
+	}
+}
+
+// delay returns how long to wait before the given retry of a call failing
+// with err, given the delay before the previous one, and whether it can be
+// retried.
+func (p *RetryPolicy) delay(err error, retry int, prev time.Duration) (time.Duration, bool) {
+	var rerr *Error
+	if !errors.As(err, &rerr) || !rerr.Retryable() {
+		return 0, false
+	}
+	if d := rerr.RetryAfter(); d > 0 {
+		return d, d <= p.maxDelay()
+	}
+	return min(p.backoff().Delay(retry, prev), p.maxDelay()), true
+}
+
+func (p *RetryPolicy) backoff() Backoff {
+	if p.Backoff != nil {
+		return p.Backoff
+	}
+	return ExponentialBackoff{Max: p.maxDelay()}
+}
+
+func (p *RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelay > 0 {
+		return p.MaxDelay
+	}
+	return DefaultRetryMaxDelay
+}
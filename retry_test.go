@@ -0,0 +1,102 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Flaky rejects the first calls made to it.
+type Flaky struct {
+	rejects    int
+	retryAfter time.Duration
+	calls      int
+}
+
+func (f *Flaky) Add(req *AddRequest, res *AddResponse) error {
+	f.calls++
+	if f.calls <= f.rejects {
+		err := &Error{Code: CodeUnavailable, Message: "try again"}
+		return err.SetRetryAfter(f.retryAfter)
+	}
+	res.X = req.A + req.B
+	return nil
+}
+
+func TestWithRetry(t *testing.T) {
+	flaky := &Flaky{}
+	s := New()
+	require.NoError(t, s.Register(flaky))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL, WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: ConstantBackoff(time.Millisecond)}))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Rejected calls are retried with backoff.
+	flaky.rejects = 2
+	res := &AddResponse{}
+	require.NoError(t, c.Call(ctx, "Flaky.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 3, res.X)
+	require.Equal(t, 3, flaky.calls)
+
+	// Up to MaxAttempts.
+	flaky.calls, flaky.rejects = 0, 3
+	err = c.Call(ctx, "Flaky.Add", &AddRequest{}, &AddResponse{})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeUnavailable, rerr.Code)
+	require.Equal(t, 3, flaky.calls)
+
+	// Retry-after hints are honored.
+	flaky.calls, flaky.rejects, flaky.retryAfter = 0, 1, time.Second
+	start := time.Now()
+	require.NoError(t, c.Call(ctx, "Flaky.Add", &AddRequest{}, &AddResponse{}))
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+	require.Equal(t, 2, flaky.calls)
+
+	// Unless they exceed the deadline of the call.
+	flaky.calls, flaky.rejects = 0, 1
+	dctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	err = c.Call(dctx, "Flaky.Add", &AddRequest{}, &AddResponse{})
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, time.Second, rerr.RetryAfter())
+	require.Equal(t, 1, flaky.calls)
+
+	// Or the policy's MaxDelay.
+	flaky.calls, flaky.rejects, flaky.retryAfter = 0, 1, time.Minute
+	err = c.Call(ctx, "Flaky.Add", &AddRequest{}, &AddResponse{})
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, 1, flaky.calls)
+
+	// Other errors aren't retried.
+	flaky.calls, flaky.rejects = 0, 0
+	err = c.Call(ctx, "Flaky.Sub", &AddRequest{}, &AddResponse{})
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeMethodNotFound, rerr.Code)
+}
+
+func TestError_SetRetryAfter(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Flaky{rejects: 1, retryAfter: 1500 * time.Millisecond}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// Hints are rounded up to the second, and sent as a Retry-After header.
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"ServiceMethod":"Flaky.Add","Body":{},"Seq":1}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, "2", resp.Header.Get("Retry-After"))
+
+	err = (&Error{Code: CodeQuotaExceeded}).SetRetryAfter(0)
+	require.False(t, err.(*Error).Retryable())
+}
@@ -1,20 +1,58 @@
 // package rpc is a proof of concept RPC based on Go's net/rpc with a couple of tweaks.
 // - adds support for JSON payloads
-// - adds support for streaming using SSE
+// - adds support for streaming using SSE and NDJSON
 package rpc
 
 import (
 	"bytes"
+	"context"
+	"crypto/cipher"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go/token"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"os"
+	"path"
 	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type (
 	Service struct {
-		Methods map[string]Method
+		Methods    map[string]Method
+		Authorizer Authorizer   // if set, consulted before every call
+		Middleware []Middleware // applied to every call, outermost first
+
+		scoped   []scopedMiddleware // applied to the calls of some methods, see UseFor
+		fallback FallbackHandler    // of methods not registered, see SetFallback
+
+		codec           Codec
+		codecs          map[string]Codec // accepted besides codec, by media type
+		logger          *log.Logger
+		errorMapper     func(error) error
+		errorEncoder    ErrorEncoder
+		formatter       ResponseFormatter // of error responses, see WithResponseFormatter
+		catalog         MessageCatalog    // translating error messages, see WithMessageCatalog
+		aead            cipher.AEAD       // encrypting bodies, see WithEncryption
+		maxRequestSize  int64
+		transactor      Transactor
+		mu              sync.RWMutex // guards Methods while serving, see Replace
+		seq             uint64       // last Seq of calls made with CallContext
+		noPing          bool
+		versions        versionNegotiator // of calls made with CallContext
+		caseInsensitive bool
+		normalize       func(string) string
+		spoolThreshold  int64
+		strict          bool // see WithStrictRegistration
+		lifecycle       lifecycle
+		openStreams     int64 // streams of requests and responses open, see Status
+		streamLimits    streamLimits
 	}
 	Method struct {
 		Name         string
@@ -22,35 +60,88 @@ type (
 		Method       reflect.Method
 		RequestType  reflect.Type
 		ResponseType reflect.Type
+		Roles        []string      // roles required to call the method
+		Priority     Priority      // priority of calls to the method
+		TakesContext bool          // whether the method takes a context.Context
+		Timeout      time.Duration // maximum duration of calls, if set
+		ReadOnly     bool          // whether calls have no side effects
+		Doc          MethodDoc     // documentation of the method
+		Compress     bool          // whether streamed responses are compressed, see WithCompression
+		Deltas       bool          // whether streamed responses are sent as deltas, see WithDeltas
+
+		pool       *bodyPool  // of requests and responses, if pooled, see Resetter
+		dispatcher Dispatcher // of the receiver, if it implements it
 	}
 	Request struct {
 		ServiceMethod string          // format: "Service.Method"
 		Body          json.RawMessage // body of request
 		Seq           uint64          // sequence number chosen by client
+		Version       int             `json:",omitempty"` // envelope protocol version, 1 if unset
+		Checksum      string          `json:",omitempty"` // CRC-32C of Body before encryption, if set, see WithChecksums
+		Encrypted     bool            `json:",omitempty"` // whether Body is encrypted, see WithEncryption
+
+		// Fields of version 2 envelopes.
+		Metadata map[string]string `json:",omitempty"` // headers of the call
+		Timeout  int64             `json:",omitempty"` // milliseconds the caller will wait, see TimeoutHeader
+		Trace    string            `json:",omitempty"` // see TraceHeader
 	}
 	Response struct {
-		ServiceMethod string          // echoes that of the Request
-		Body          json.RawMessage // body of request
-		Seq           uint64          // echoes that of the request
-		Error         string          // error, if any.
+		ServiceMethod string            // echoes that of the Request
+		Body          json.RawMessage   // body of request
+		Seq           uint64            // echoes that of the request
+		Version       int               `json:",omitempty"` // echoes that of the request
+		Checksum      string            `json:",omitempty"` // CRC-32C of Body before encryption, if set, see WithChecksums
+		Encrypted     bool              `json:",omitempty"` // whether Body is encrypted, see WithEncryption
+		Metadata      map[string]string `json:",omitempty"` // of version 2 envelopes, see SetResponseMetadata
+		More          bool              `json:",omitempty"` // whether more responses follow, see Stream
+		Error         string            // error, if any.
+		Code          string            // error code, if any.
+		Details       map[string]string `json:",omitempty"` // error details, if any.
+		Chain         []ErrorLink       `json:",omitempty"` // wrapped errors, if any, see RegisterError
+	}
+	// Handler handles a call to a method.
+	Handler func(ctx context.Context, m Method, req *Request) (*Response, error)
+	// scopedMiddleware is middleware applied to the methods matching a
+	// pattern.
+	scopedMiddleware struct {
+		pattern string
+		mw      Middleware
 	}
+	// Middleware wraps a Handler to run code before and after calls.
+	Middleware func(next Handler) Handler
 )
 
-func New() *Service {
-	return &Service{
+// MethodOption configures a registered method.
+type MethodOption func(*Method)
+
+func New(opts ...ServiceOption) *Service {
+	s := &Service{
 		Methods: map[string]Method{},
+		codec:   JSONCodec{},
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	if !s.noPing {
+		s.registerPing()
+	}
+	return s
 }
 
-var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
 
 // Register the given interface and register all the methods.
+// The service is named after the receiver's type, unless it implements
+// Namer, and its methods can be renamed or excluded with MethodNamer.
 // This method is not thread safe.
 func (s *Service) Register(i interface{}) error {
-	it := reflect.TypeOf(i)
-	iv := reflect.ValueOf(i)
-
-	name := reflect.Indirect(iv).Type().Name()
+	name := reflect.Indirect(reflect.ValueOf(i)).Type().Name()
+	if n, ok := i.(Namer); ok {
+		name = n.RPCName()
+	}
 	if name == "" {
 		return fmt.Errorf("rpc: type name not found")
 	}
@@ -59,6 +150,28 @@ func (s *Service) Register(i interface{}) error {
 		return fmt.Errorf("rpc: type name %s is not exported", name)
 	}
 
+	return s.RegisterName(name, i)
+}
+
+// RegisterName is like Register but uses the provided name for the type
+// instead of the receiver's concrete type.
+// This method is not thread safe.
+func (s *Service) RegisterName(name string, i interface{}) error {
+	it := reflect.TypeOf(i)
+	iv := reflect.ValueOf(i)
+
+	if name == "" {
+		return fmt.Errorf("rpc: no service name for type %s", it)
+	}
+
+	var names map[string]string
+	if n, ok := i.(MethodNamer); ok {
+		names = n.RPCMethodNames()
+	}
+
+	// Methods are only registered once all are checked.
+	methods := map[string]Method{}
+	ignored := packageMethods(it)
 	for m := 0; m < it.NumMethod(); m++ {
 		method := it.Method(m)
 		methodType := method.Type
@@ -68,91 +181,240 @@ func (s *Service) Register(i interface{}) error {
 			continue
 		}
 
-		if methodType.NumIn() != 3 {
-			continue
-		}
-
-		requestType := methodType.In(1)
-		if requestType.Kind() != reflect.Ptr {
-			continue
-		}
-
-		if !token.IsExported(requestType.Name()) && requestType.PkgPath() != "" {
-			continue
-		}
-
-		responseType := methodType.In(2)
-		if responseType.Kind() != reflect.Ptr {
-			continue
-		}
-
-		if !token.IsExported(responseType.Name()) && responseType.PkgPath() != "" {
-			continue
+		if exposed := names[method.Name]; exposed != "" {
+			if exposed == "-" {
+				continue
+			}
+			methodName = name + "." + exposed
 		}
 
-		if methodType.NumOut() != 1 {
+		// Arguments start after the receiver.
+		takesContext, requestType, responseType, err := methodShape(methodType, 1)
+		if err != nil {
+			if s.strict && !ignored[method.Name] {
+				return fmt.Errorf("rpc: method %s: %v", methodName, err)
+			}
 			continue
 		}
 
-		returnType := methodType.Out(0)
-		if returnType != typeOfError {
-			continue
+		if err := s.checkTypes(requestType, responseType); err != nil {
+			return fmt.Errorf("rpc: method %s: %v", methodName, err)
 		}
 
-		s.Methods[methodName] = Method{
+		meth := Method{
 			Name:         methodName,
 			Receiver:     iv,
 			Method:       method,
 			RequestType:  requestType,
 			ResponseType: responseType,
+			TakesContext: takesContext,
+		}
+		meth.pool = newBodyPool(meth)
+		meth.dispatcher, _ = i.(Dispatcher)
+		methods[methodName] = meth
+	}
+	for methodName, m := range methods {
+		s.Methods[methodName] = m
+	}
+	s.lifecycle.addReceiver(i)
+
+	if d, ok := i.(Describer); ok {
+		for method, doc := range d.Describe() {
+			if m, ok := s.Methods[name+"."+method]; ok {
+				m.Doc = doc
+				s.Methods[name+"."+method] = m
+			}
 		}
 	}
 
 	return nil
 }
 
+// Use appends middleware to the service.
+// This method is not thread safe.
+func (s *Service) Use(mw ...Middleware) {
+	s.Middleware = append(s.Middleware, mw...)
+}
+
+// UseFor appends middleware applied only to the calls of methods matching
+// the pattern, eg. expensive checks of the methods needing them. Patterns
+// are matched with path.Match, so "Billing.*" matches every method of the
+// Billing service. Such middleware runs after that of every call, in the
+// order it was added.
+// This method is not thread safe.
+func (s *Service) UseFor(pattern string, mw ...Middleware) {
+	for _, m := range mw {
+		s.scoped = append(s.scoped, scopedMiddleware{pattern: pattern, mw: m})
+	}
+}
+
+// Configure applies the given options to a registered method.
+// This method is not thread safe.
+func (s *Service) Configure(method string, opts ...MethodOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.Methods[method]
+	if !ok {
+		return fmt.Errorf("rpc: can't find method %q", method)
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	s.Methods[method] = m
+	return nil
+}
+
 func (s *Service) Call(httpClient *http.Client, uri string, method string, reqBody, resBody interface{}) error {
+	return s.CallContext(context.Background(), httpClient, uri, method, reqBody, resBody)
+}
+
+// CallContext calls the method like Call, but aborts the call when ctx is
+// done. If ctx has a deadline, the remaining time is sent to the server so
+// it can stop working on the call once the caller has given up on it.
+func (s *Service) CallContext(ctx context.Context, httpClient *http.Client, uri string, method string, reqBody, resBody interface{}) error {
 	// Look up method, fail if not found.
 	m, ok := s.Methods[method]
 	if !ok {
 		return fmt.Errorf("rpc: can't find method %q", method)
 	}
 
-	// Encode the request.
-	reqBodyBytes, err := json.Marshal(reqBody)
+	seq := atomic.AddUint64(&s.seq, 1)
+	return call(ctx, httpClient, s.codec, uri, m.Name, seq, &s.versions, reqBody, resBody)
+}
+
+// call sends a call with the given Seq to the server at uri, and decodes
+// the result into resBody. The envelope version is negotiated with v.
+func call(ctx context.Context, httpClient *http.Client, codec Codec, uri string, method string, seq uint64, v *versionNegotiator, reqBody, resBody interface{}) error {
+	_, rawRequest := reqBody.(*Blob)
+	_, rawResponse := resBody.(*Blob)
+	if rawRequest || rawResponse {
+		return callRaw(ctx, httpClient, codec, uri, method, seq, v, reqBody, resBody)
+	}
+
+	reqBytes, err := encodeCall(ctx, codec, method, reqBody, seq, v.current())
+	if err != nil {
+		return err
+	}
+
+	// Send the request.
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(reqBytes))
+	if err != nil {
+		return fmt.Errorf("rpc: error creating request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", codec.ContentType())
+	setTimeoutHeader(ctx, httpReq.Header)
+	setOutgoingHeader(ctx, httpReq.Header)
+	onProgress, _ := ctx.Value(progressCallbackKey{}).(func(Progress))
+	if onProgress != nil {
+		httpReq.Header.Set(ProgressHeader, "1")
+	}
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("rpc: error sending request: %w", err)
+	}
+
+	// Decode the response.
+	defer resp.Body.Close()
+	v.update(resp.Header)
+	if resp.Header.Get("Content-Type") == ProgressContentType {
+		resBytes, err := readProgress(codec, resp.Body, seq, onProgress)
+		if err != nil {
+			return err
+		}
+		if resBytes, err = decryptReply(ctx, codec, resBytes); err != nil {
+			return err
+		}
+		return decodeReply(codec, resBytes, method, seq, resBody)
+	}
+	resBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("rpc: error reading response body: %v", err)
+	}
+	if resBytes, err = decryptReply(ctx, codec, resBytes); err != nil {
+		return err
+	}
+	return decodeReply(codec, resBytes, method, seq, resBody)
+}
+
+// encodeCall encodes the request envelope of a call made with ctx, of the
+// given envelope version.
+func encodeCall(ctx context.Context, codec Codec, method string, reqBody interface{}, seq uint64, version int) ([]byte, error) {
+	reqBodyBytes, err := marshalBody(codec, reqBody)
 	if err != nil {
-		return fmt.Errorf("rpc: error encoding request: %v", err)
+		return nil, fmt.Errorf("rpc: error encoding request: %v", err)
 	}
 
 	req := Request{
-		ServiceMethod: m.Name,
+		ServiceMethod: method,
 		Body:          reqBodyBytes,
+		Seq:           seq,
+		Version:       version,
+	}
+	if ctx.Value(checksumKey{}) != nil {
+		req.Checksum = checksum(reqBodyBytes)
+	}
+	if err := encryptCall(ctx, codec, &req); err != nil {
+		return nil, err
 	}
-	reqBytes, err := json.Marshal(req)
+	setEnvelope(ctx, &req)
+	reqBytes, err := codec.Marshal(req)
 	if err != nil {
-		return fmt.Errorf("rpc: error marshalling request: %v", err)
+		return nil, fmt.Errorf("rpc: error marshalling request: %v", err)
 	}
+	return reqBytes, nil
+}
 
-	// Send the request.
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(reqBytes))
+// decodeResult decodes the response envelope of a call, and its body into
+// resBody.
+func decodeResult(codec Codec, resBytes []byte, resBody interface{}) error {
+	res := Response{}
+	err := codec.Unmarshal(resBytes, &res)
 	if err != nil {
-		return fmt.Errorf("rpc: error sending request: %v", err)
+		return fmt.Errorf("rpc: error reading response body: %v", err)
 	}
+	return decodeResponse(codec, res, resBody)
+}
 
-	// Decode the response.
+// ErrResponseMismatch is returned by calls whose response doesn't echo the
+// ServiceMethod and Seq of their request.
+var ErrResponseMismatch = errors.New("rpc: response doesn't match the request")
+
+// decodeReply decodes the response envelope of the call to method with
+// the given Seq, and its body into resBody. It fails with
+// ErrResponseMismatch if the response is not that of the call.
+func decodeReply(codec Codec, resBytes []byte, method string, seq uint64, resBody interface{}) error {
 	res := Response{}
-	err = json.NewDecoder(resp.Body).Decode(&res)
+	err := codec.Unmarshal(resBytes, &res)
 	if err != nil {
 		return fmt.Errorf("rpc: error reading response body: %v", err)
 	}
-	defer resp.Body.Close()
+	// Errors returned before the request could be decoded don't echo it.
+	if res.Error != "" && res.ServiceMethod == "" && res.Seq == 0 {
+		return decodeResponse(codec, res, resBody)
+	}
+	if res.ServiceMethod != method || res.Seq != seq {
+		return fmt.Errorf("%w: got %s #%d, expected %s #%d", ErrResponseMismatch, res.ServiceMethod, res.Seq, method, seq)
+	}
+	return decodeResponse(codec, res, resBody)
+}
 
+// decodeResponse returns the error of the response, if any, or decodes
+// its body into resBody.
+func decodeResponse(codec Codec, res Response, resBody interface{}) error {
 	// Handle error.
 	if res.Error != "" {
-		return fmt.Errorf("rpc: server: %s", res.Error)
+		return fmt.Errorf("rpc: server: %w", &Error{
+			Code:    res.Code,
+			Message: res.Error,
+			Details: res.Details,
+			Chain:   res.Chain,
+		})
+	}
+	if err := verifyChecksum(res.Body, res.Checksum); err != nil {
+		return fmt.Errorf("rpc: %w", err)
 	}
 
-	err = json.Unmarshal(res.Body, resBody)
+	err := unmarshalBody(codec, res.Body, resBody)
 	if err != nil {
 		return fmt.Errorf("rpc: %s", err)
 	}
@@ -160,77 +422,480 @@ func (s *Service) Call(httpClient *http.Client, uri string, method string, reqBo
 	return nil
 }
 
-func (s *Service) Serve() http.Handler {
+// Serve returns the handler serving calls to the service's methods.
+// The options can restrict the methods it exposes, so the same service
+// can back several endpoints.
+func (s *Service) Serve(opts ...ServeOption) http.Handler {
+	o := &serveOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = o.withExposed(r)
+		if r.Header.Get(ProgressHeader) != "" {
+			pw := &progressWriter{ResponseWriter: w, codec: s.codec}
+			defer pw.finish()
+			w = pw
+		}
 		if r.Method != "POST" {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			s.httpError(w, http.StatusMethodNotAllowed, &Error{
+				Code:    CodeInvalidRequest,
+				Message: "Method not allowed",
+			})
 			return
 		}
 
-		if r.Header.Get("Content-Type") != "application/json" {
-			http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		advertiseVersions(w.Header())
+		rawMethod := r.Header.Get(MethodHeader)
+		multipart := isMultipart(r)
+		streamed := rawMethod != "" && isStreamRequest(r)
+		codec, ok := s.negotiateCodec(r)
+		if rawMethod == "" && (!ok || codec != s.codec && r.Header.Get(BatchHeader) != "") {
+			// Batches are only accepted in the service's own codec.
+			s.httpError(w, http.StatusUnsupportedMediaType, &Error{
+				Code:    CodeInvalidRequest,
+				Message: "Content-Type must be " + s.codec.ContentType(),
+			})
 			return
 		}
 
-		// Decode the request.
-		var req Request
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Bad request", http.StatusBadRequest)
+		// Read the request, up to the size limit.
+		var (
+			req      Request
+			reqBytes []byte
+			spooled  *os.File
+			err      error
+		)
+		batch := r.Header.Get(BatchHeader) != ""
+		switch {
+		case multipart:
+			r, reqBytes, err = s.readMultipart(r)
+			if r.MultipartForm != nil {
+				defer r.MultipartForm.RemoveAll() // nolint: errcheck
+			}
+		case streamed:
+			// Streams of requests are read by the method.
+		case rawMethod != "":
+			reqBytes, spooled, err = s.readRaw(r)
+			if spooled != nil {
+				defer removeSpool(spooled)
+			}
+		case batch:
+			reqBytes, err = s.readRequest(r)
+		default:
+			// Envelopes are decoded as they're read.
+			err = s.decodeRequest(w, r, codec, &req)
+		}
+		if err != nil {
+			var rerr *Error
+			if errors.As(err, &rerr) {
+				s.writeError(w, r, nil, err)
+				return
+			}
+			s.httpError(w, http.StatusBadRequest, errBadRequest)
 			return
 		}
 
-		// Look up method, fail if not found.
-		m, ok := s.Methods[req.ServiceMethod]
-		if !ok {
-			http.Error(w, "Bad request", http.StatusBadRequest)
+		if batch {
+			s.serveBatch(w, r, reqBytes)
 			return
 		}
 
-		// Decode the request body.
-		reqBody := reflect.New(m.RequestType).Interface()
-		err := json.Unmarshal(req.Body, reqBody)
-		if err != nil {
-			http.Error(w, "Bad request", http.StatusBadRequest)
-			return
+		// Make the request from a raw blob or form, if it isn't one.
+		if multipart {
+			raw, err := s.formRequest(r, rawMethod, reqBytes)
+			if err != nil {
+				s.writeRequestError(w, r, rawMethod, err)
+				return
+			}
+			req = *raw
+		} else if streamed {
+			raw, err := s.streamRequest(r, rawMethod)
+			if err != nil {
+				s.writeRequestError(w, r, rawMethod, err)
+				return
+			}
+			req = *raw
+		} else if rawMethod != "" {
+			raw, err := s.rawRequest(r, rawMethod, reqBytes)
+			if err != nil {
+				s.writeRequestError(w, r, rawMethod, err)
+				return
+			}
+			req = *raw
 		}
 
-		// Call the method, marshal the result.
-		resBody := reflect.New(m.ResponseType.Elem())
-		args := []reflect.Value{
-			m.Receiver,
-			reflect.ValueOf(reqBody).Elem(),
-			resBody,
+		if err := checkVersion(&req); err != nil {
+			s.writeCodecError(w, r, codec, &req, err)
+			return
 		}
-		callRes := m.Method.Func.Call(args)
-		if len(callRes) == 1 && callRes[0].Interface() != nil {
-			err := callRes[0].Interface().(error)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		ctx, md := withResponseMetadata(r.Context(), &req)
+		if codec != s.codec {
+			ctx = context.WithValue(ctx, codecKey{}, codec)
+		}
+		var spooledReader io.Reader
+		if spooled != nil {
+			spooledReader = spooled
+		}
+		ctx = withBlobStreams(ctx, r, spooledReader)
+		if streamed {
+			if err := s.admitStream(r); err != nil {
+				s.writeCodecError(w, r, codec, &req, err)
+				return
+			}
+			ctx = s.withRecvStream(ctx, w, r)
+			// Bidirectional streams read requests while writing responses.
+			_ = http.NewResponseController(w).EnableFullDuplex()
+		}
+		ctx = withProgress(ctx, w, req.Seq)
+		ctx, stream, err := s.withStream(ctx, w, r, &req, md)
+		if err != nil {
+			s.writeCodecError(w, r, codec, &req, err)
 			return
 		}
+		r = r.WithContext(ctx)
+		r.Header = envelopeHeader(&req, r.Header)
 
-		// Encode response body
-		resBodyBytes, err := json.Marshal(resBody.Interface())
+		// Call the method.
+		res, err := s.dispatch(r, &req)
+		if stream.finish(res, err) {
+			return
+		}
+		if errors.Is(err, ErrMethodNotFound) {
+			err = s.methodNotFound(r.Context(), req.ServiceMethod)
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			s.writeCodecError(w, r, codec, &req, err)
 			return
 		}
 
 		// Write the response.
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		res := Response{
-			ServiceMethod: req.ServiceMethod,
-			Body:          resBodyBytes,
-			Seq:           req.Seq,
-		}
-		err = json.NewEncoder(w).Encode(res)
-		if err != nil {
+		if s.writeRawResponse(w, r, &req, res) {
+			return
+		}
+		res = versioned(res, &req, md)
+		if err := writeResponse(w, codec, res); err != nil {
+			s.logf("rpc: error encoding response of %s: %v", req.ServiceMethod, err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	})
 }
 
+// writeResponse writes the response encoded with codec. Codecs that can
+// encode envelopes around their body write it as is, so responses aren't
+// buffered again whole, halving their peak memory.
+func writeResponse(w http.ResponseWriter, codec Codec, res *Response) error {
+	var chunks [][]byte
+	if enc, ok := codec.(envelopeEncoder); ok && len(res.Body) > 0 {
+		head, tail, err := enc.encodeEnvelope(res)
+		if err != nil {
+			return err
+		}
+		chunks = [][]byte{head, res.Body, tail}
+	} else {
+		resBytes, err := codec.Marshal(res)
+		if err != nil {
+			return err
+		}
+		chunks = [][]byte{resBytes}
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.WriteHeader(http.StatusOK)
+	for _, chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			// The caller is gone.
+			return nil
+		}
+	}
+	return nil
+}
+
+// DefaultMaxRequestSize is the size limit of request envelopes and
+// batches of services not configured with WithMaxRequestSize.
+const DefaultMaxRequestSize = 32 << 20
+
+// envelopeLimit returns the size limit of request envelopes and batches.
+func (s *Service) envelopeLimit() int64 {
+	if s.maxRequestSize > 0 {
+		return s.maxRequestSize
+	}
+	return DefaultMaxRequestSize
+}
+
+// readRequest reads the body of the request, failing with
+// CodeRequestTooLarge if it is over the size limit.
+func (s *Service) readRequest(r *http.Request) ([]byte, error) {
+	limit := s.envelopeLimit()
+	reqBytes, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(reqBytes)) > limit {
+		return nil, requestTooLarge(limit)
+	}
+	return reqBytes, nil
+}
+
+// decodeRequest decodes the request envelope from the body of r with
+// codec, failing with CodeRequestTooLarge if it is over the size limit.
+// Codecs that can decode envelopes as they're read do so, rejecting data
+// trailing them.
+func (s *Service) decodeRequest(w http.ResponseWriter, r *http.Request, codec Codec, req *Request) error {
+	dec, ok := codec.(envelopeDecoder)
+	if !ok {
+		reqBytes, err := s.readRequest(r)
+		if err != nil {
+			return err
+		}
+		return codec.Unmarshal(reqBytes, req)
+	}
+
+	limit := s.envelopeLimit()
+	err := dec.decodeEnvelope(http.MaxBytesReader(w, r.Body, limit), req)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return requestTooLarge(limit)
+	}
+	return err
+}
+
+func requestTooLarge(limit int64) error {
+	return &Error{
+		Code:    CodeRequestTooLarge,
+		Message: fmt.Sprintf("request exceeds limit of %d bytes", limit),
+	}
+}
+
+// ErrMethodNotFound is returned by dispatch for requests of methods that
+// are not registered, and by fallbacks for those they don't handle, see
+// SetFallback.
+var ErrMethodNotFound = errors.New("rpc: method not found")
+
+// dispatch calls the method of the request on behalf of the HTTP request
+// r, making its headers and deadline available to the call.
+func (s *Service) dispatch(r *http.Request, req *Request) (*Response, error) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	return s.callContext(ctx, req)
+}
+
+// requestContext returns the context of calls made on behalf of the HTTP
+// request r, carrying its headers and deadline.
+func requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := context.WithValue(r.Context(), headerKey{}, r.Header)
+	return contextWithTimeoutHeader(ctx, r.Header)
+}
+
+// callContext looks up the method of the request, checks the caller is
+// allowed to call it, and calls it through the middleware chain.
+func (s *Service) callContext(ctx context.Context, req *Request) (*Response, error) {
+	// Look up method, fail if not found.
+	m, ok := s.method(req.ServiceMethod)
+	if !ok && s.fallback != nil && exposed(ctx, req.ServiceMethod) {
+		return s.callFallback(ctx, req)
+	}
+	if !ok || !exposed(ctx, m.Name) {
+		return nil, ErrMethodNotFound
+	}
+
+	plain, err := s.decryptRequest(ctx, m, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChecksum(plain.Body, plain.Checksum); err != nil {
+		return nil, err
+	}
+
+	// Check the caller is allowed to call the method.
+	if s.Authorizer != nil {
+		if err := s.Authorizer.Authorize(ctx, m); err != nil {
+			return nil, &Error{
+				Code:    CodePermissionDenied,
+				Message: "permission denied: " + err.Error(),
+			}
+		}
+	}
+
+	// Call the method through the middleware chain.
+	res, err := s.handler()(ctx, m, plain)
+	if err != nil {
+		s.logf("rpc: call to %s failed: %v", req.ServiceMethod, err)
+		return nil, err
+	}
+	return s.encryptResponse(ctx, req, checksummed(res, req))
+}
+
+// writeError writes the error response of the HTTP request r encoded with
+// the service's codec.
+func (s *Service) writeError(w http.ResponseWriter, r *http.Request, req *Request, err error) {
+	s.writeCodecError(w, r, s.codec, req, err)
+}
+
+func (s *Service) logf(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, args...)
+	}
+}
+
+type headerKey struct{}
+
+// HeaderFromContext returns the HTTP headers of the request being served.
+func HeaderFromContext(ctx context.Context) http.Header {
+	h, _ := ctx.Value(headerKey{}).(http.Header)
+	return h
+}
+
+// useScoped wraps next in the scoped middleware matching the method of
+// each call.
+func (s *Service) useScoped(next Handler) Handler {
+	return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		h := next
+		for i := len(s.scoped) - 1; i >= 0; i-- {
+			if ok, _ := path.Match(s.scoped[i].pattern, m.Name); ok {
+				h = s.scoped[i].mw(h)
+			}
+		}
+		return h(ctx, m, req)
+	}
+}
+
+// handler returns the method invocation wrapped in the service's middleware.
+func (s *Service) handler() Handler {
+	h := Handler(s.invoke)
+	if len(s.scoped) > 0 {
+		h = s.useScoped(h)
+	}
+	for i := len(s.Middleware) - 1; i >= 0; i-- {
+		h = s.Middleware[i](h)
+	}
+	return h
+}
+
+// invoke decodes the request body, calls the method, and encodes its result.
+func (s *Service) invoke(ctx context.Context, m Method, req *Request) (*Response, error) {
+	// Don't bother if the caller has already given up.
+	if ctx.Err() != nil {
+		return nil, contextError(ctx.Err())
+	}
+
+	// Decode the request body, into a pooled request if any.
+	codec := s.requestCodec(ctx)
+	pool := m.pooled()
+	if pool == nil && m.dispatcher != nil && !m.Streaming() && !m.ClientStreaming() {
+		return s.invokeDispatcher(ctx, m, req, codec)
+	}
+	reqPtr := reflect.New(m.RequestType)
+	if pool != nil && pool.req != nil {
+		reqPtr.Elem().Set(getBody(pool.req, m.RequestType))
+		defer func() { putBody(pool.req, reqPtr.Elem()) }()
+	}
+	reqBody := reqPtr.Interface()
+	err := unmarshalBody(codec, req.Body, reqBody)
+	if err != nil {
+		return nil, &Error{
+			Code:    CodeInvalidRequest,
+			Message: "Bad request",
+		}
+	}
+	attachRequestStream(ctx, reflect.ValueOf(reqBody).Elem().Interface())
+	if err := openRecvStream(ctx, reflect.ValueOf(reqBody).Elem().Interface()); err != nil {
+		return nil, err
+	}
+	var resBody reflect.Value
+	if pool != nil {
+		resBody = getBody(pool.res, m.ResponseType)
+		defer putBody(pool.res, resBody)
+	} else {
+		resBody = reflect.New(m.ResponseType.Elem())
+	}
+	if err := openStream(ctx, resBody.Interface()); err != nil {
+		return nil, err
+	}
+
+	// Enforce the method's timeout, if any.
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+
+	// Call the method, marshal the result.
+	args := []reflect.Value{
+		m.Receiver,
+	}
+	if m.TakesContext {
+		args = append(args, reflect.ValueOf(ctx))
+	}
+	args = append(args,
+		reflect.ValueOf(reqBody).Elem(),
+		resBody,
+	)
+	if m.Timeout > 0 {
+		err = m.callTimeout(ctx, func() error { return m.call(args) })
+	} else {
+		err = m.call(args)
+	}
+	if err != nil {
+		if s.errorMapper != nil {
+			err = s.errorMapper(err)
+		}
+		return nil, err
+	}
+
+	// Encode response body
+	if err := detachResponseStream(ctx, resBody.Interface()); err != nil {
+		return nil, err
+	}
+	resBodyBytes, err := marshalBody(codec, resBody.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		ServiceMethod: req.ServiceMethod,
+		Body:          resBodyBytes,
+		Seq:           req.Seq,
+	}, nil
+}
+
+// call calls the method with the given arguments, the first of which is
+// its receiver.
+func (m Method) call(args []reflect.Value) error {
+	var callRes []reflect.Value
+	if m.Method.Func.IsValid() {
+		callRes = m.Method.Func.Call(args)
+	} else {
+		// Functions, see RegisterMethods, are their own receivers.
+		callRes = m.Receiver.Call(args[1:])
+	}
+	if len(callRes) == 1 && callRes[0].Interface() != nil {
+		return callRes[0].Interface().(error)
+	}
+	return nil
+}
+
+// callTimeout calls the method with call, but returns as soon as ctx is
+// done without waiting for the method to return.
+func (m Method) callTimeout(ctx context.Context, call func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errc <- fmt.Errorf("rpc: method %s panicked: %v", m.Name, r)
+			}
+		}()
+		errc <- call()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+}
+
 // Is this type exported or a builtin?
 func isExportedOrBuiltinType(t reflect.Type) bool {
 	for t.Kind() == reflect.Ptr {
@@ -1,7 +1,13 @@
 package rpc
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -25,8 +31,10 @@ func (m *Math) Add(req *AddRequest, res *AddResponse) error {
 
 func TestService_Integration(t *testing.T) {
 	// Start http server.
+	l, err := net.Listen("tcp", "localhost:10123")
+	require.NoError(t, err)
 	go func() {
-		err := http.ListenAndServe("localhost:10123", nil)
+		err := http.Serve(l, nil)
 		require.NoError(t, err)
 	}()
 
@@ -34,7 +42,7 @@ func TestService_Integration(t *testing.T) {
 	s := New()
 
 	// Register methods.
-	err := s.Register(&Math{})
+	err = s.Register(&Math{})
 	require.NoError(t, err)
 
 	// Register handler.
@@ -47,3 +55,68 @@ func TestService_Integration(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 3, res.X)
 }
+
+func TestService_DecodeRequest(t *testing.T) {
+	s := New(WithMaxRequestSize(64))
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	post := func(body string) (int, string) {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	status, _ := post(`{"ServiceMethod":"Math.Add","Body":{"A":1}}` + "\n")
+	require.Equal(t, http.StatusOK, status)
+
+	// Data trailing envelopes is rejected.
+	status, _ = post(`{"ServiceMethod":"Math.Add","Body":{"A":1}}{}`)
+	require.Equal(t, http.StatusBadRequest, status)
+	status, _ = post(`{"ServiceMethod":"Math.Add","Body":{"A":1}} x`)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	// As are envelopes over the limit, as they're read.
+	status, body := post(`{"ServiceMethod":"Math.Add","Body":{"A":1},"Metadata":{"k":"` + strings.Repeat("v", 64) + `"}}`)
+	require.Equal(t, http.StatusRequestEntityTooLarge, status)
+	require.Contains(t, body, CodeRequestTooLarge)
+
+	// Envelopes are limited by default.
+	require.Equal(t, int64(DefaultMaxRequestSize), New().envelopeLimit())
+}
+
+func TestService_UseFor(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Register(&Checked{}))
+
+	calls := []string{}
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+				calls = append(calls, name+" "+m.Name)
+				return next(ctx, m, req)
+			}
+		}
+	}
+	s.UseFor("Math.*", record("math"), record("math2"))
+	s.Use(record("all"))
+	s.UseFor("*.Add", record("add"))
+
+	call := func(method string) {
+		_, err := s.callContext(context.Background(), &Request{
+			ServiceMethod: method,
+			Body:          json.RawMessage(`{"A":1,"B":2}`),
+		})
+		require.NoError(t, err)
+	}
+	call("Math.Add")
+	require.Equal(t, []string{"all Math.Add", "math Math.Add", "math2 Math.Add", "add Math.Add"}, calls)
+	calls = calls[:0]
+	call("Checked.Add")
+	require.Equal(t, []string{"all Checked.Add", "add Checked.Add"}, calls)
+}
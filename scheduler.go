@@ -0,0 +1,143 @@
+package rpc
+
+import (
+	"container/heap"
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Scheduler limits the number of calls handled concurrently, and queues the
+// rest so that higher priority calls are served first.
+// Calls of the same priority are served in the order they arrived.
+type Scheduler struct {
+	Workers  int // calls handled concurrently, defaults to GOMAXPROCS
+	MaxQueue int // if set, calls beyond are rejected with CodeUnavailable
+	// RetryAfter is how long rejected callers are told to wait before
+	// retrying, see Error.RetryAfter.
+	RetryAfter time.Duration
+
+	mu      sync.Mutex
+	running int
+	queue   waiters
+	seq     uint64
+}
+
+type (
+	waiter struct {
+		priority Priority
+		seq      uint64
+		ready    chan struct{}
+		index    int // index in the queue, -1 once dequeued
+	}
+	waiters []*waiter
+)
+
+// Middleware returns the middleware scheduling calls.
+func (s *Scheduler) Middleware(next Handler) Handler {
+	return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		if err := s.acquire(ctx, callPriority(ctx, m)); err != nil {
+			return nil, err
+		}
+		defer s.release()
+		return next(ctx, m, req)
+	}
+}
+
+// Queued returns the number of calls waiting to be handled.
+func (s *Scheduler) Queued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queue.Len()
+}
+
+func (s *Scheduler) acquire(ctx context.Context, p Priority) error {
+	s.mu.Lock()
+	if s.running < s.workers() && s.queue.Len() == 0 {
+		s.running++
+		s.mu.Unlock()
+		return nil
+	}
+	if s.MaxQueue > 0 && s.queue.Len() >= s.MaxQueue {
+		s.mu.Unlock()
+		err := &Error{
+			Code:    CodeUnavailable,
+			Message: "server overloaded",
+		}
+		return err.SetRetryAfter(s.RetryAfter)
+	}
+	s.seq++
+	w := &waiter{
+		priority: p,
+		seq:      s.seq,
+		ready:    make(chan struct{}),
+	}
+	heap.Push(&s.queue, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if w.index >= 0 {
+			heap.Remove(&s.queue, w.index)
+			s.mu.Unlock()
+			return contextError(ctx.Err())
+		}
+		s.mu.Unlock()
+		// We were handed a worker while giving up, pass it on.
+		s.release()
+		return contextError(ctx.Err())
+	}
+}
+
+func (s *Scheduler) workers() int {
+	if s.Workers <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return s.Workers
+}
+
+// release hands the worker over to the next call in the queue, if any.
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queue.Len() == 0 {
+		s.running--
+		return
+	}
+	w := heap.Pop(&s.queue).(*waiter)
+	close(w.ready)
+}
+
+func (q waiters) Len() int { return len(q) }
+
+func (q waiters) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waiters) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waiters) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waiters) Pop() interface{} {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_Middleware(t *testing.T) {
+	s := &Scheduler{
+		Workers:  1,
+		MaxQueue: 2,
+	}
+
+	block := make(chan struct{})
+	mu := sync.Mutex{}
+	order := []string{}
+	h := s.Middleware(func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		if m.Name == "Block" {
+			<-block
+		}
+		mu.Lock()
+		order = append(order, m.Name)
+		mu.Unlock()
+		return &Response{}, nil
+	})
+
+	wg := sync.WaitGroup{}
+	call := func(m Method) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := h(context.Background(), m, &Request{})
+			require.NoError(t, err)
+		}()
+	}
+	waitQueued := func(n int) {
+		require.Eventually(t, func() bool {
+			return s.Queued() == n
+		}, time.Second, time.Millisecond)
+	}
+
+	// Occupy the only worker.
+	call(Method{Name: "Block"})
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.running == 1
+	}, time.Second, time.Millisecond)
+
+	call(Method{Name: "Low", Priority: PriorityLow})
+	waitQueued(1)
+	call(Method{Name: "High", Priority: PriorityHigh})
+	waitQueued(2)
+
+	// The queue is full.
+	_, err := h(context.Background(), Method{Name: "Rejected"}, &Request{})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeUnavailable, rerr.Code)
+
+	close(block)
+	wg.Wait()
+	require.Equal(t, []string{"Block", "High", "Low"}, order)
+}
+
+func TestScheduler_Cancel(t *testing.T) {
+	s := &Scheduler{
+		Workers: 1,
+	}
+
+	block := make(chan struct{})
+	h := s.Middleware(func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		<-block
+		return &Response{}, nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = h(context.Background(), Method{}, &Request{})
+	}()
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.running == 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := h(ctx, Method{}, &Request{})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeDeadlineExceeded, rerr.Code)
+	require.Equal(t, 0, s.Queued())
+
+	close(block)
+	<-done
+	require.Equal(t, 0, s.running)
+}
+
+func TestScheduler_DefaultWorkers(t *testing.T) {
+	s := &Scheduler{}
+	h := s.Middleware(func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		return &Response{}, nil
+	})
+	_, err := h(context.Background(), Method{}, &Request{})
+	require.NoError(t, err)
+	require.Equal(t, 0, s.Queued())
+}
@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SchemaRegistry stores Avro schemas by ID, see AvroCodec.
+type SchemaRegistry interface {
+	// Schema returns the schema with the given ID.
+	Schema(ctx context.Context, id int) (string, error)
+	// Register registers schema under subject, returning its ID. Schemas
+	// already registered return their existing ID.
+	Register(ctx context.Context, subject, schema string) (int, error)
+}
+
+// SchemaRegistryClient is a SchemaRegistry backed by the REST API of a
+// Confluent schema registry.
+type SchemaRegistryClient struct {
+	URL        string       // base URL of the registry
+	HTTPClient *http.Client // defaults to http.DefaultClient
+}
+
+const schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+func (c *SchemaRegistryClient) Schema(ctx context.Context, id int) (string, error) {
+	var res struct {
+		Schema string `json:"schema"`
+	}
+	err := c.do(ctx, "GET", "/schemas/ids/"+strconv.Itoa(id), nil, &res)
+	return res.Schema, err
+}
+
+func (c *SchemaRegistryClient) Register(ctx context.Context, subject, schema string) (int, error) {
+	var res struct {
+		ID int `json:"id"`
+	}
+	req := map[string]string{"schema": schema}
+	err := c.do(ctx, "POST", "/subjects/"+url.PathEscape(subject)+"/versions", req, &res)
+	return res.ID, err
+}
+
+// do makes a request to the registry, decoding its response into res.
+func (c *SchemaRegistryClient) do(ctx context.Context, method, path string, req, res interface{}) error {
+	var body bytes.Buffer
+	if req != nil {
+		if err := json.NewEncoder(&body).Encode(req); err != nil {
+			return err
+		}
+	}
+	r, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+path, &body)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Accept", schemaRegistryContentType)
+	if req != nil {
+		r.Header.Set("Content-Type", schemaRegistryContentType)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(r)
+	if err != nil {
+		return fmt.Errorf("rpc: schema registry: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var rerr struct {
+			Code    int    `json:"error_code"`
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&rerr); err != nil || rerr.Message == "" {
+			return fmt.Errorf("rpc: schema registry: %s", resp.Status)
+		}
+		return fmt.Errorf("rpc: schema registry: %s (%d)", rerr.Message, rerr.Code)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return fmt.Errorf("rpc: schema registry: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// ServerOption configures the http server created by ListenAndServe.
+	ServerOption  func(*serverOptions)
+	serverOptions struct {
+		server          *http.Server
+		path            string
+		ctx             context.Context
+		shutdownTimeout time.Duration
+	}
+)
+
+// Default timeouts of the http server created by ListenAndServe.
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultWriteTimeout      = 30 * time.Second
+	DefaultIdleTimeout       = 2 * time.Minute
+	DefaultMaxHeaderBytes    = 64 << 10
+	DefaultShutdownTimeout   = 30 * time.Second
+)
+
+// WithReadTimeout limits how long reading a request, including its body,
+// can take.
+func WithReadTimeout(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.server.ReadTimeout = d
+	}
+}
+
+// WithReadHeaderTimeout limits how long reading a request's headers can
+// take.
+func WithReadHeaderTimeout(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.server.ReadHeaderTimeout = d
+	}
+}
+
+// WithWriteTimeout limits how long handling a request and writing its
+// response can take.
+func WithWriteTimeout(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.server.WriteTimeout = d
+	}
+}
+
+// WithIdleTimeout limits how long keep-alive connections are kept open
+// while idle.
+func WithIdleTimeout(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.server.IdleTimeout = d
+	}
+}
+
+// WithMaxHeaderBytes limits the size of request headers.
+func WithMaxHeaderBytes(n int) ServerOption {
+	return func(o *serverOptions) {
+		o.server.MaxHeaderBytes = n
+	}
+}
+
+// WithServePath sets the path the service is served on, defaults to
+// serving it on every path.
+func WithServePath(path string) ServerOption {
+	return func(o *serverOptions) {
+		o.path = path
+	}
+}
+
+// WithH2C additionally serves HTTP/2 without TLS to clients with prior
+// knowledge of it, such as ones dialing h2c:// targets, so calls can be
+// multiplexed on a single connection.
+func WithH2C() ServerOption {
+	return func(o *serverOptions) {
+		p := &http.Protocols{}
+		p.SetHTTP1(true)
+		p.SetUnencryptedHTTP2(true)
+		o.server.Protocols = p
+	}
+}
+
+// WithServeReceiveWindow sets the HTTP/2 flow control windows of the
+// server: how many bytes of request bodies each stream, and all the
+// streams of a connection, can send before the server reads them. A
+// window per stream smaller than that of the connection keeps a stream of
+// requests the method is slow to read from stalling the other calls
+// multiplexed on the connection.
+func WithServeReceiveWindow(stream, conn int) ServerOption {
+	return func(o *serverOptions) {
+		o.server.HTTP2 = &http.HTTP2Config{
+			MaxReceiveBufferPerStream:     stream,
+			MaxReceiveBufferPerConnection: conn,
+		}
+	}
+}
+
+// WithShutdown gracefully shuts the server down once ctx is done, waiting
+// up to timeout for in-flight calls to finish before closing their
+// connections. Calls received while draining them fail with
+// CodeUnavailable, and a retry-after hint of a second.
+func WithShutdown(ctx context.Context, timeout time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.ctx = ctx
+		o.shutdownTimeout = timeout
+	}
+}
+
+// ListenAndServe listens on the given TCP address and serves the service.
+// Unlike http.ListenAndServe, the server has timeouts and limits suitable
+// for serving untrusted clients.
+// It blocks until the server fails, or is shut down via WithShutdown in
+// which case it returns nil.
+// The service is started before serving, and stopped once the server is
+// shut down or fails, see Service.Start and Service.Stop.
+func (s *Service) ListenAndServe(addr string, opts ...ServerOption) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeListener(l, opts...)
+}
+
+// ServeListener serves the service on the given listener, like
+// ListenAndServe.
+func (s *Service) ServeListener(l net.Listener, opts ...ServerOption) error {
+	o := &serverOptions{
+		server: &http.Server{
+			ReadHeaderTimeout: DefaultReadHeaderTimeout,
+			ReadTimeout:       DefaultReadTimeout,
+			WriteTimeout:      DefaultWriteTimeout,
+			IdleTimeout:       DefaultIdleTimeout,
+			MaxHeaderBytes:    DefaultMaxHeaderBytes,
+		},
+		shutdownTimeout: DefaultShutdownTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	startCtx := o.ctx
+	if startCtx == nil {
+		startCtx = context.Background()
+	}
+	if err := s.Start(startCtx); err != nil {
+		l.Close()
+		return err
+	}
+
+	var draining atomic.Bool
+	handler := s.Serve()
+	if o.path != "" {
+		mux := http.NewServeMux()
+		mux.Handle(o.path, handler)
+		handler = mux
+	}
+	o.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			err := &Error{
+				Code:    CodeUnavailable,
+				Message: "server shutting down",
+			}
+			s.writeError(w, r, nil, err.SetRetryAfter(time.Second))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	errc := make(chan error, 1)
+	go func() {
+		if o.server.TLSConfig != nil {
+			errc <- o.server.ServeTLS(l, "", "")
+			return
+		}
+		errc <- o.server.Serve(l)
+	}()
+
+	done := make(<-chan struct{})
+	if o.ctx != nil {
+		done = o.ctx.Done()
+	}
+
+	select {
+	case err := <-errc:
+		ctx, cancel := context.WithTimeout(context.Background(), o.shutdownTimeout)
+		defer cancel()
+		if stopErr := s.Stop(ctx); stopErr != nil {
+			s.logf("rpc: error stopping service: %v", stopErr)
+		}
+		return err
+	case <-done:
+	}
+
+	draining.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), o.shutdownTimeout)
+	defer cancel()
+	err := o.server.Shutdown(ctx)
+	if serveErr := <-errc; err == nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		err = serveErr
+	}
+	// Receivers are stopped once calls in flight are done, or the timeout
+	// is reached.
+	if stopErr := s.Stop(ctx); err == nil {
+		err = stopErr
+	}
+	return err
+}
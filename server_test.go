@@ -0,0 +1,169 @@
+package rpc
+
+import (
+	"context"
+	"iter"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ServeListener(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.ServeListener(l,
+			WithServePath("/rpc"),
+			WithWriteTimeout(time.Second),
+			WithShutdown(ctx, time.Second),
+		)
+	}()
+
+	c, err := Dial("http://" + l.Addr().String() + "/rpc")
+	require.NoError(t, err)
+	res := &AddResponse{}
+	err = c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res)
+	require.NoError(t, err)
+	require.Equal(t, 3, res.X)
+
+	cancel()
+	require.NoError(t, <-errc)
+}
+
+func TestService_ServeListener_H2C(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ServeListener(l, WithH2C(), WithShutdown(ctx, time.Second)) // nolint: errcheck
+
+	tests := []struct {
+		target string
+		proto  string
+	}{
+		{"h2c://" + l.Addr().String(), "HTTP/2.0"},
+		// HTTP/1 clients are still served.
+		{"http://" + l.Addr().String(), "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		c, err := Dial(tt.target)
+		require.NoError(t, err)
+
+		proto := ""
+		transport := c.httpClient.Transport
+		c.httpClient.Transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			resp, err := transport.RoundTrip(r)
+			if err == nil {
+				proto = resp.Proto
+			}
+			return resp, err
+		})
+
+		res := &AddResponse{}
+		err = c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 2}, res)
+		require.NoError(t, err)
+		require.Equal(t, 3, res.X)
+		require.Equal(t, tt.proto, proto)
+	}
+}
+
+func TestWithReceiveWindow(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Ticker{stopped: make(chan error, 1)}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ServeListener(l, WithH2C(), WithServeReceiveWindow(64<<10, 1<<20), WithShutdown(ctx, time.Second)) // nolint: errcheck
+
+	c, err := Dial("h2c://"+l.Addr().String(), WithReceiveWindow(64<<10, 1<<20))
+	require.NoError(t, err)
+
+	// A stream the caller doesn't read from fills its own window only.
+	next, stop := iter.Pull2(CallStream[Tick](ctx, c, "Ticker.Ticks", &TickRequest{}))
+	defer stop()
+	tick, err, ok := next()
+	require.True(t, ok)
+	require.NoError(t, err)
+	require.Equal(t, 1, tick.N)
+
+	// Other calls on the connection go on.
+	callCtx, cancelCall := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelCall()
+	var ticks int
+	for _, err := range CallStream[Tick](callCtx, c, "Ticker.Ticks", &TickRequest{Count: 10000}) {
+		require.NoError(t, err)
+		ticks++
+	}
+	require.Equal(t, 10000, ticks)
+}
+
+// Slow sends ticks further apart than the timeouts of the server.
+type Slow struct{}
+
+func (Slow) Ticks(ctx context.Context, req *TickRequest, stream *Stream[Tick]) error {
+	for i := 1; i <= req.Count; i++ {
+		time.Sleep(150 * time.Millisecond)
+		if err := stream.Send(ctx, Tick{N: i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestService_ServeListener_Streams(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(Slow{}))
+	require.NoError(t, s.Register(&Ingester{}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.ServeListener(l,
+			WithReadTimeout(200*time.Millisecond),
+			WithWriteTimeout(200*time.Millisecond),
+			WithShutdown(ctx, time.Second),
+		)
+	}()
+
+	c, err := Dial("http://" + l.Addr().String())
+	require.NoError(t, err)
+
+	// Streams of responses outlast the write timeout.
+	var ticks []int
+	for tick, err := range CallStream[Tick](context.Background(), c, "Slow.Ticks", &TickRequest{Count: 4}) {
+		require.NoError(t, err)
+		ticks = append(ticks, tick.N)
+	}
+	require.Equal(t, []int{1, 2, 3, 4}, ticks)
+
+	// Streams of requests outlast the read timeout.
+	res := &IngestResponse{}
+	stream, err := OpenClientStream[Record](context.Background(), c, "Ingester.Ingest", res)
+	require.NoError(t, err)
+	for i := 1; i <= 4; i++ {
+		time.Sleep(150 * time.Millisecond)
+		require.NoError(t, stream.Send(Record{Value: i}))
+	}
+	require.NoError(t, stream.Close())
+	require.Equal(t, &IngestResponse{Count: 4, Sum: 10}, res)
+
+	cancel()
+	require.NoError(t, <-errc)
+}
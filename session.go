@@ -0,0 +1,302 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SessionHeader is the header holding the session token issued by
+// Sessions, sent back by callers on their next calls and streams.
+const SessionHeader = "Rpc-Session"
+
+// DefaultSessionTTL is how long sessions are kept after their last call by
+// default.
+const DefaultSessionTTL = time.Hour
+
+// ErrSessionTokenNotSent is returned when setting the first value of a
+// new session once the response header of the call was sent, eg. by
+// streaming a message, since the token of the session can't be sent
+// anymore. Methods streaming their response set values first.
+var ErrSessionTokenNotSent = errors.New("rpc: session token can't be sent once the response header was")
+
+type (
+	// Sessions issues a session token to callers once a call first sets a
+	// value of their session, and finds the session of the calls they
+	// send it on, so methods can keep state across calls and streams,
+	// such as the filters of a subscription, that survives reconnects.
+	// Clients send the token back with WithSessions.
+	Sessions struct {
+		// Store holds the values of sessions, defaults to a
+		// MemorySessionStore. Replicas of a service must share it for
+		// sessions to move between them.
+		Store SessionStore
+		TTL   time.Duration // how long sessions are kept after their last call, defaults to DefaultSessionTTL
+
+		once sync.Once
+	}
+	// SessionStore holds the values of sessions.
+	SessionStore interface {
+		// Load returns the values of the session, and extends it by ttl.
+		// It returns false if the session is unknown or expired.
+		Load(ctx context.Context, id string, ttl time.Duration) (map[string][]byte, bool, error)
+		// Save replaces the values of the session, keeping it for ttl.
+		Save(ctx context.Context, id string, values map[string][]byte, ttl time.Duration) error
+	}
+	// Session is the session of a call, see SessionFromContext.
+	Session struct {
+		id    string
+		store SessionStore
+		ttl   time.Duration
+
+		mu         sync.Mutex
+		values     map[string][]byte
+		header     http.Header // of the response to send the token in, until the session is saved
+		headerSent bool        // whether header was sent, see sessionWriter
+	}
+	// MemorySessionStore is a SessionStore keeping sessions in memory, for
+	// services served by a single process.
+	MemorySessionStore struct {
+		mu        sync.Mutex
+		sessions  map[string]*memorySession
+		nextPrune time.Time
+	}
+	memorySession struct {
+		values  map[string][]byte
+		expires time.Time
+	}
+	sessionKey struct{}
+	// sessionWriter tells the session of a call once the response header
+	// is sent, after which the token of a new session can't be.
+	sessionWriter struct {
+		http.ResponseWriter
+		sess *Session
+	}
+	// sessionTransport sends the session token of a client with its
+	// requests, and keeps the one of responses.
+	sessionTransport struct {
+		base http.RoundTripper
+
+		mu    sync.Mutex
+		token string
+	}
+)
+
+// Middleware returns an http middleware attaching the session of requests
+// to their context, and sending its token back in the SessionHeader.
+// Requests without a known session token get a new session, which is only
+// saved, and its token sent, once the call sets a value of it, which
+// fails with ErrSessionTokenNotSent once the response header was sent.
+func (s *Sessions) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := s.session(r.Context(), r.Header.Get(SessionHeader), w.Header())
+		if err != nil {
+			writeError(w, JSONCodec{}, nil, &Error{
+				Code:    CodeUnavailable,
+				Message: err.Error(),
+			})
+			return
+		}
+		ctx := context.WithValue(r.Context(), sessionKey{}, sess)
+		next.ServeHTTP(&sessionWriter{ResponseWriter: w, sess: sess}, r.WithContext(ctx))
+	})
+}
+
+// session returns the session with the given token, or a new one if it
+// isn't known, setting its token in the response header h once it is
+// saved.
+func (s *Sessions) session(ctx context.Context, token string, h http.Header) (*Session, error) {
+	s.once.Do(func() {
+		if s.Store == nil {
+			s.Store = &MemorySessionStore{}
+		}
+	})
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	if token != "" {
+		values, ok, err := s.Store.Load(ctx, token, ttl)
+		if err != nil {
+			return nil, fmt.Errorf("error loading session: %v", err)
+		}
+		if ok {
+			h.Set(SessionHeader, token)
+			return &Session{id: token, store: s.Store, ttl: ttl, values: values}, nil
+		}
+	}
+	return &Session{id: randomID(), store: s.Store, ttl: ttl, header: h}, nil
+}
+
+// SessionFromContext returns the session of the call, if it is served
+// with Sessions.
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	sess, ok := ctx.Value(sessionKey{}).(*Session)
+	return sess, ok
+}
+
+// ID returns the token of the session. The tokens of new sessions are
+// only sent to callers once a value of the session is set.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Get decodes the value of the session with the given key into v, and
+// returns whether it has one. Calls see the values of their session as of
+// their start, along with their own changes.
+func (s *Session) Get(key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	b, ok := s.values[key]
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// Set sets the value of the session with the given key, encoded as JSON,
+// and saves the session. Setting the first value of a new session fails
+// with ErrSessionTokenNotSent once the response header was sent.
+func (s *Session) Set(ctx context.Context, key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.update(ctx, func(values map[string][]byte) {
+		values[key] = b
+	})
+}
+
+// Delete removes the value of the session with the given key, and saves
+// the session, failing like Set.
+func (s *Session) Delete(ctx context.Context, key string) error {
+	return s.update(ctx, func(values map[string][]byte) {
+		delete(values, key)
+	})
+}
+
+func (s *Session) update(ctx context.Context, f func(values map[string][]byte)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.header != nil && s.headerSent {
+		return ErrSessionTokenNotSent
+	}
+	values := make(map[string][]byte, len(s.values)+1)
+	for k, v := range s.values {
+		values[k] = v
+	}
+	f(values)
+	if err := s.store.Save(ctx, s.id, values, s.ttl); err != nil {
+		return err
+	}
+	s.values = values
+	if s.header != nil {
+		s.header.Set(SessionHeader, s.id)
+		s.header = nil
+	}
+	return nil
+}
+
+// sent records that the response header of the call was sent.
+func (s *Session) sent() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.headerSent = true
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	// Informational responses don't carry the token, the final one can.
+	if code >= http.StatusOK {
+		w.sess.sent()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.sess.sent()
+	return w.ResponseWriter.Write(b)
+}
+
+// FlushError flushes the response, for http.ResponseController.
+func (w *sessionWriter) FlushError() error {
+	w.sess.sent()
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Load implements SessionStore.
+func (m *MemorySessionStore) Load(ctx context.Context, id string, ttl time.Duration) (map[string][]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess, ok := m.sessions[id]
+	if !ok || time.Now().After(sess.expires) {
+		delete(m.sessions, id)
+		return nil, false, nil
+	}
+	sess.expires = time.Now().Add(ttl)
+	return sess.values, true, nil
+}
+
+// Save implements SessionStore.
+func (m *MemorySessionStore) Save(ctx context.Context, id string, values map[string][]byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if m.sessions == nil {
+		m.sessions = map[string]*memorySession{}
+	}
+	if now.After(m.nextPrune) {
+		for id, sess := range m.sessions {
+			if now.After(sess.expires) {
+				delete(m.sessions, id)
+			}
+		}
+		m.nextPrune = now.Add(time.Minute)
+	}
+	m.sessions[id] = &memorySession{values: values, expires: now.Add(ttl)}
+	return nil
+}
+
+// WithSessions sends the session token issued by servers using Sessions
+// with the client's calls and streams, so they share a session.
+func WithSessions() Option {
+	return func(o *clientOptions) {
+		o.sessions = true
+	}
+}
+
+func (t *sessionTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	token := t.token
+	t.mu.Unlock()
+	if token != "" {
+		r = r.Clone(r.Context())
+		r.Header.Set(SessionHeader, token)
+	}
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if token := resp.Header.Get(SessionHeader); token != "" {
+		t.mu.Lock()
+		t.token = token
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the underlying
+// transport.
+func (t *sessionTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,166 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	Subscriptions struct{}
+	TopicRequest  struct {
+		Topic string
+	}
+	TopicsResponse struct {
+		Session string
+		Topics  []string
+	}
+)
+
+func (Subscriptions) Subscribe(ctx context.Context, req *TopicRequest, res *TopicsResponse) error {
+	sess, ok := SessionFromContext(ctx)
+	if !ok {
+		return errors.New("no session")
+	}
+	if _, err := sess.Get("topics", &res.Topics); err != nil {
+		return err
+	}
+	res.Topics = append(res.Topics, req.Topic)
+	res.Session = sess.ID()
+	return sess.Set(ctx, "topics", res.Topics)
+}
+
+// Watch streams the topics of the session.
+func (Subscriptions) Watch(ctx context.Context, req *TopicRequest, stream *Stream[TopicRequest]) error {
+	sess, _ := SessionFromContext(ctx)
+	var topics []string
+	if _, err := sess.Get("topics", &topics); err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		if err := stream.Send(ctx, TopicRequest{Topic: topic}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSessions(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(Subscriptions{}))
+	sessions := &Sessions{TTL: time.Minute}
+	srv := httptest.NewServer(sessions.Middleware(s.Serve()))
+	defer srv.Close()
+	ctx := context.Background()
+
+	// Calls of a client share its session, across connections.
+	c, err := Dial(srv.URL, WithSessions())
+	require.NoError(t, err)
+	res := &TopicsResponse{}
+	require.NoError(t, c.Call(ctx, "Subscriptions.Subscribe", &TopicRequest{Topic: "a"}, res))
+	id := res.Session
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Call(ctx, "Subscriptions.Subscribe", &TopicRequest{Topic: "b"}, res))
+	require.Equal(t, id, res.Session)
+	require.Equal(t, []string{"a", "b"}, res.Topics)
+
+	// And its streams.
+	var topics []string
+	for topic, err := range CallStream[TopicRequest](ctx, c, "Subscriptions.Watch", &TopicRequest{}) {
+		require.NoError(t, err)
+		topics = append(topics, topic.Topic)
+	}
+	require.Equal(t, []string{"a", "b"}, topics)
+
+	// Clients without sessions start a new one on every call.
+	c, err = Dial(srv.URL)
+	require.NoError(t, err)
+	require.NoError(t, c.Call(ctx, "Subscriptions.Subscribe", &TopicRequest{Topic: "c"}, res))
+	require.NotEqual(t, id, res.Session)
+	require.Equal(t, []string{"c"}, res.Topics)
+
+	// Calls that don't set values of their session don't start one.
+	store := sessions.Store.(*MemorySessionStore)
+	require.Len(t, store.sessions, 2)
+	for range CallStream[TopicRequest](ctx, c, "Subscriptions.Watch", &TopicRequest{}) {
+		t.Fatal("unexpected topic")
+	}
+	require.Len(t, store.sessions, 2)
+}
+
+func TestSessions_Header(t *testing.T) {
+	sessions := &Sessions{}
+	h := sessions.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := SessionFromContext(r.Context())
+		if r.URL.Query().Has("set") {
+			require.NoError(t, sess.Set(r.Context(), "k", 1))
+		}
+	}))
+	serve := func(target, token string) string {
+		r := httptest.NewRequest(http.MethodPost, target, nil)
+		r.Header.Set(SessionHeader, token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Header().Get(SessionHeader)
+	}
+
+	// Tokens of new sessions are only sent once they are saved.
+	require.Empty(t, serve("/", ""))
+	token := serve("/?set", "")
+	require.NotEmpty(t, token)
+
+	// Known sessions keep their token.
+	require.Equal(t, token, serve("/", token))
+	require.Empty(t, serve("/", "unknown"))
+}
+
+func TestSessions_HeaderSent(t *testing.T) {
+	sessions := &Sessions{}
+	var setErr error
+	h := sessions.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := SessionFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+		require.NoError(t, http.NewResponseController(w).Flush())
+		setErr = sess.Set(r.Context(), "k", 1)
+	}))
+	serve := func(token string) string {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set(SessionHeader, token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Header().Get(SessionHeader)
+	}
+
+	// New sessions can't be started once the header was sent, since their
+	// token can't be.
+	require.Empty(t, serve(""))
+	require.ErrorIs(t, setErr, ErrSessionTokenNotSent)
+	require.Empty(t, sessions.Store.(*MemorySessionStore).sessions)
+
+	// Known sessions can still be updated.
+	token := randomID()
+	require.NoError(t, sessions.Store.Save(context.Background(), token, nil, time.Minute))
+	require.Equal(t, token, serve(token))
+	require.NoError(t, setErr)
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	m := &MemorySessionStore{}
+	ctx := context.Background()
+	require.NoError(t, m.Save(ctx, "s", map[string][]byte{"k": []byte(`1`)}, time.Minute))
+	values, ok, err := m.Load(ctx, "s", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []byte(`1`), values["k"])
+
+	// Expired sessions are unknown.
+	require.NoError(t, m.Save(ctx, "s", nil, -time.Second))
+	_, ok, err = m.Load(ctx, "s", time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,129 @@
+package rpc
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Priority of a call, used to decide which calls to serve first and which
+// to reject when the server is overloaded.
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// PriorityHeader is the request header callers can use to lower the
+// priority of a single call, eg. for background work. Calls can't be given
+// a higher priority than that of their method, see WithPriority.
+const PriorityHeader = "Rpc-Priority"
+
+// WithPriority sets the priority of calls to the method.
+func WithPriority(p Priority) MethodOption {
+	return func(m *Method) {
+		m.Priority = p
+	}
+}
+
+// callPriority returns the priority of a call, as requested by the caller
+// or configured on the method, whichever is lower.
+func callPriority(ctx context.Context, m Method) Priority {
+	if v := HeaderFromContext(ctx).Get(PriorityHeader); v != "" {
+		if p, err := strconv.Atoi(v); err == nil && Priority(p) < m.Priority {
+			return Priority(p)
+		}
+	}
+	return m.Priority
+}
+
+// LoadShedder rejects calls below a priority while the server is
+// overloaded, so they fail fast instead of timing out along with every
+// other call.
+// The server is considered overloaded when MaxInFlight calls are already
+// being handled, or the average latency of recent calls is over
+// MaxLatency. Zero values disable either check. The average decays while
+// no calls complete, halving every second, so that shedding stops once
+// the server only receives shed calls.
+type LoadShedder struct {
+	MaxInFlight int
+	MaxLatency  time.Duration
+	// MinPriority is the lowest priority still served while overloaded,
+	// defaults to PriorityNormal.
+	MinPriority Priority
+	// RetryAfter is how long shed callers are told to wait before retrying,
+	// see Error.RetryAfter.
+	RetryAfter time.Duration
+
+	inFlight int64
+	mu       sync.Mutex
+	latency  time.Duration // exponentially weighted moving average
+	observed time.Time     // of the latest call in latency
+}
+
+// latencyHalfLife is how long it takes the average latency of a
+// LoadShedder to halve while no calls complete.
+const latencyHalfLife = time.Second
+
+// Middleware returns the middleware shedding calls.
+// Shed calls fail with CodeUnavailable and can be retried, after
+// RetryAfter if set.
+func (l *LoadShedder) Middleware(next Handler) Handler {
+	return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		if l.Overloaded() && callPriority(ctx, m) < l.MinPriority {
+			err := &Error{
+				Code:    CodeUnavailable,
+				Message: "server overloaded",
+			}
+			return nil, err.SetRetryAfter(l.RetryAfter)
+		}
+
+		atomic.AddInt64(&l.inFlight, 1)
+		start := time.Now()
+		defer func() {
+			atomic.AddInt64(&l.inFlight, -1)
+			l.observe(time.Since(start))
+		}()
+
+		return next(ctx, m, req)
+	}
+}
+
+// Overloaded returns whether the server is currently overloaded.
+func (l *LoadShedder) Overloaded() bool {
+	if l.MaxInFlight > 0 && atomic.LoadInt64(&l.inFlight) >= int64(l.MaxInFlight) {
+		return true
+	}
+	if l.MaxLatency > 0 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.average(time.Now()) > l.MaxLatency
+	}
+	return false
+}
+
+func (l *LoadShedder) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	// Weigh the latest call at 1/8th, enough to react within a few calls
+	// without flapping on a single slow one.
+	l.latency = l.average(now)
+	l.latency += (d - l.latency) / 8
+	l.observed = now
+}
+
+// average returns the average latency of calls at now, decayed since the
+// latest one completed. l.mu must be held.
+func (l *LoadShedder) average(now time.Time) time.Duration {
+	idle := now.Sub(l.observed)
+	if l.observed.IsZero() || idle <= 0 {
+		return l.latency
+	}
+	return time.Duration(float64(l.latency) * math.Exp2(-float64(idle)/float64(latencyHalfLife)))
+}
@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadShedder_Middleware(t *testing.T) {
+	l := &LoadShedder{
+		MaxLatency: time.Millisecond,
+	}
+
+	s := New()
+	s.Use(l.Middleware)
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	call := func(client *http.Client) error {
+		return s.Call(client, srv.URL, "Math.Add", &AddRequest{}, &AddResponse{})
+	}
+
+	// Not overloaded.
+	require.False(t, l.Overloaded())
+	require.NoError(t, call(http.DefaultClient))
+
+	// Simulate slow calls.
+	slow := l.Middleware(func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		time.Sleep(5 * time.Millisecond)
+		return &Response{}, nil
+	})
+	for i := 0; i < 32; i++ {
+		_, err := slow(context.Background(), Method{}, &Request{})
+		require.NoError(t, err)
+	}
+	require.True(t, l.Overloaded())
+
+	// Normal priority calls are still served.
+	require.NoError(t, call(http.DefaultClient))
+
+	// Low priority calls are shed.
+	require.NoError(t, s.Configure("Math.Add", WithPriority(PriorityLow)))
+	err := call(http.DefaultClient)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeUnavailable, rerr.Code)
+	require.True(t, rerr.Retryable())
+
+	// Even if the caller asks for a higher priority.
+	priority := func(p string) *http.Client {
+		return &http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				r.Header.Set(PriorityHeader, p)
+				return http.DefaultTransport.RoundTrip(r)
+			}),
+		}
+	}
+	err = call(priority("1"))
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeUnavailable, rerr.Code)
+
+	// But callers can lower the priority of their calls.
+	require.NoError(t, s.Configure("Math.Add", WithPriority(PriorityNormal)))
+	require.NoError(t, call(priority("1")))
+	err = call(priority("-1"))
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeUnavailable, rerr.Code)
+}
+
+func TestLoadShedder_Decay(t *testing.T) {
+	l := &LoadShedder{MaxLatency: time.Millisecond}
+	l.observe(time.Second)
+	require.True(t, l.Overloaded())
+
+	// Without calls completing, the average latency decays until the
+	// server is no longer overloaded.
+	l.observed = l.observed.Add(-5 * latencyHalfLife)
+	require.True(t, l.Overloaded())
+	l.observed = l.observed.Add(-5 * latencyHalfLife)
+	require.False(t, l.Overloaded())
+}
+
+func TestLoadShedder_MaxInFlight(t *testing.T) {
+	l := &LoadShedder{MaxInFlight: 2}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := l.Middleware(func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		started <- struct{}{}
+		<-release
+		return &Response{}, nil
+	})
+	m := Method{Priority: PriorityLow}
+	errc := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := h(context.Background(), m, &Request{})
+			errc <- err
+		}()
+		<-started
+	}
+
+	// MaxInFlight calls are served at most.
+	require.True(t, l.Overloaded())
+	_, err := h(context.Background(), m, &Request{})
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeUnavailable, rerr.Code)
+
+	close(release)
+	require.NoError(t, <-errc)
+	require.NoError(t, <-errc)
+	require.False(t, l.Overloaded())
+}
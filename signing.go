@@ -0,0 +1,319 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignatureHeader is the header holding the signature of signed requests,
+// as "t=<unix time>,n=<nonce>,v1=<hex HMAC-SHA256 of
+// "<unix time>.<nonce>.<MethodHeader>.<body>">", see WithRequestSigning.
+const SignatureHeader = "Rpc-Signature"
+
+// KeyIDHeader is the header holding the id of the key requests are signed
+// with, if not the default one, see RequestVerifier.Keys.
+const KeyIDHeader = "Rpc-Key-Id"
+
+type (
+	// RequestVerifier verifies the signatures of requests signed by
+	// clients with WithRequestSigning, and rejects requests replayed by
+	// whoever captured them: their signature must be recent, and their
+	// nonce must not have been seen before.
+	RequestVerifier struct {
+		Secret []byte // secret shared with clients, verifying requests without a key id
+		// Keys are the secrets shared with clients by key id, verifying
+		// requests signed with WithSigningKey. Keys are rotated by adding
+		// the new key, moving clients to it, then removing the old one,
+		// see SetKey and RemoveKey.
+		Keys    map[string][]byte
+		MaxSkew time.Duration // allowed difference between the signing time and the server's clock, defaults to 5m
+		// MaxBodySize is the size limit of the bodies read to verify
+		// requests, defaults to DefaultMaxRequestSize. Set it to the
+		// limit of the service, see WithMaxRequestSize.
+		MaxBodySize int64
+		// Nonces records the nonces of requests, defaults to a
+		// MemoryNonceStore. Replicas of a service must share it for
+		// requests replayed to another replica to be rejected.
+		Nonces NonceStore
+
+		once sync.Once
+		mu   sync.RWMutex // guards Keys
+	}
+	// NonceStore records the nonces of signed requests, see
+	// RequestVerifier.
+	NonceStore interface {
+		// Add records the nonce until expires, and returns false if it
+		// was already recorded.
+		Add(ctx context.Context, nonce string, expires time.Time) (bool, error)
+	}
+	// MemoryNonceStore is a NonceStore keeping nonces in memory, for
+	// services served by a single process.
+	MemoryNonceStore struct {
+		mu        sync.Mutex
+		nonces    map[string]time.Time
+		nextPrune time.Time
+	}
+	// signingTransport signs the requests of a client.
+	signingTransport struct {
+		base   http.RoundTripper
+		keyID  string
+		secret []byte
+	}
+)
+
+// DefaultMaxSkew is the clock skew a RequestVerifier allows by default.
+const DefaultMaxSkew = 5 * time.Minute
+
+// WithRequestSigning signs the client's requests with the given secret,
+// for servers verifying them with a RequestVerifier. Requests whose bodies
+// are streamed, such as uploads and streams of requests, aren't signed.
+func WithRequestSigning(secret []byte) Option {
+	return func(o *clientOptions) {
+		o.signingKeyID, o.signingSecret = "", secret
+	}
+}
+
+// WithSigningKey signs the client's requests like WithRequestSigning, with
+// the secret of the given key id, see RequestVerifier.Keys.
+func WithSigningKey(id string, secret []byte) Option {
+	return func(o *clientOptions) {
+		o.signingKeyID, o.signingSecret = id, secret
+	}
+}
+
+// RoundTrip signs requests whose body can be read ahead of sending it.
+func (t *signingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		if r.GetBody == nil {
+			return t.base.RoundTrip(r)
+		}
+		rc, err := r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	r = r.Clone(r.Context())
+	if t.keyID != "" {
+		r.Header.Set(KeyIDHeader, t.keyID)
+	}
+	r.Header.Set(SignatureHeader, signRequest(t.secret, time.Now(), randomID(), r.Header.Get(MethodHeader), body))
+	return t.base.RoundTrip(r)
+}
+
+// CloseIdleConnections closes the idle connections of the underlying
+// transport.
+func (t *signingTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// Middleware returns an http middleware rejecting requests without a valid
+// signature, or replayed, with CodeUnauthenticated.
+func (v *RequestVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unauthenticated := func(err error) {
+			writeError(w, JSONCodec{}, nil, &Error{
+				Code:    CodeUnauthenticated,
+				Message: err.Error(),
+			})
+		}
+		// Unsigned requests, and those signed outside the clock skew
+		// window, are rejected without reading their body, which may be
+		// a stream.
+		if r.Header.Get(SignatureHeader) == "" {
+			unauthenticated(fmt.Errorf("missing request signature"))
+			return
+		}
+		sig, err := v.parse(r.Header)
+		if err != nil {
+			unauthenticated(err)
+			return
+		}
+		limit := v.MaxBodySize
+		if limit <= 0 {
+			limit = DefaultMaxRequestSize
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, JSONCodec{}, nil, &Error{
+				Code:    CodeRequestTooLarge,
+				Message: fmt.Sprintf("request is over the size limit of %d bytes", limit),
+			})
+			return
+		}
+		if err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err := v.verify(r.Context(), r.Header, sig, body); err != nil {
+			unauthenticated(err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestSignature is the parsed SignatureHeader of a request.
+type requestSignature struct {
+	t     time.Time
+	nonce string
+	sig   string
+}
+
+// parse parses the signature of a request with the given headers, and
+// checks that it was signed within the allowed clock skew.
+func (v *RequestVerifier) parse(h http.Header) (requestSignature, error) {
+	var ts, nonce, sig string
+	for _, part := range strings.Split(h.Get(SignatureHeader), ",") {
+		switch {
+		case strings.HasPrefix(part, "t="):
+			ts = part[2:]
+		case strings.HasPrefix(part, "n="):
+			nonce = part[2:]
+		case strings.HasPrefix(part, "v1="):
+			sig = part[3:]
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || nonce == "" || sig == "" {
+		return requestSignature{}, fmt.Errorf("invalid request signature header")
+	}
+	t := time.Unix(unix, 0)
+	if d := time.Since(t); d > v.skew() || d < -v.skew() {
+		return requestSignature{}, fmt.Errorf("request signed at %s, outside the allowed clock skew", t.UTC().Format(time.RFC3339))
+	}
+	return requestSignature{t: t, nonce: nonce, sig: sig}, nil
+}
+
+func (v *RequestVerifier) skew() time.Duration {
+	if v.MaxSkew <= 0 {
+		return DefaultMaxSkew
+	}
+	return v.MaxSkew
+}
+
+// verify checks the signature of a request with the given headers and
+// body, and records its nonce.
+func (v *RequestVerifier) verify(ctx context.Context, h http.Header, sig requestSignature, body []byte) error {
+	secret, err := v.key(h.Get(KeyIDHeader))
+	if err != nil {
+		return err
+	}
+	expected := signRequest(secret, sig.t, sig.nonce, h.Get(MethodHeader), body)
+	if !hmac.Equal([]byte(expected), []byte(h.Get(SignatureHeader))) {
+		return fmt.Errorf("invalid request signature")
+	}
+	// Nonces are kept until their requests' signatures expire, after
+	// which the signing time rejects them.
+	ok, err := v.nonces().Add(ctx, sig.nonce, sig.t.Add(v.skew()))
+	if err != nil {
+		return fmt.Errorf("error recording request nonce: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("replayed request")
+	}
+	return nil
+}
+
+// SetKey adds or replaces the secret of the given key id.
+func (v *RequestVerifier) SetKey(id string, secret []byte) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.Keys == nil {
+		v.Keys = map[string][]byte{}
+	}
+	v.Keys[id] = secret
+}
+
+// RemoveKey removes the secret of the given key id, rejecting requests
+// still signed with it.
+func (v *RequestVerifier) RemoveKey(id string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.Keys, id)
+}
+
+// key returns the secret of the given key id, or the default one.
+func (v *RequestVerifier) key(id string) ([]byte, error) {
+	if id == "" {
+		if v.Secret == nil {
+			return nil, fmt.Errorf("missing %s header", KeyIDHeader)
+		}
+		return v.Secret, nil
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	secret, ok := v.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", id)
+	}
+	return secret, nil
+}
+
+func (v *RequestVerifier) nonces() NonceStore {
+	v.once.Do(func() {
+		if v.Nonces == nil {
+			v.Nonces = &MemoryNonceStore{}
+		}
+	})
+	return v.Nonces
+}
+
+// Add implements NonceStore.
+func (s *MemoryNonceStore) Add(ctx context.Context, nonce string, expires time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.nonces == nil {
+		s.nonces = map[string]time.Time{}
+	}
+	if now.After(s.nextPrune) {
+		for n, exp := range s.nonces {
+			if now.After(exp) {
+				delete(s.nonces, n)
+			}
+		}
+		s.nextPrune = now.Add(time.Minute)
+	}
+	if exp, ok := s.nonces[nonce]; ok && now.Before(exp) {
+		return false, nil
+	}
+	s.nonces[nonce] = expires
+	return true, nil
+}
+
+// Len returns the number of nonces recorded.
+func (s *MemoryNonceStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.nonces)
+}
+
+func signRequest(secret []byte, t time.Time, nonce, method string, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	io.WriteString(mac, ts+"."+nonce+"."+method+".") // nolint: errcheck
+	mac.Write(body)
+	return "t=" + ts + ",n=" + nonce + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
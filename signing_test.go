@@ -0,0 +1,192 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestVerifier(t *testing.T) {
+	secret := []byte("s3cr3t")
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	nonces := &MemoryNonceStore{}
+	v := &RequestVerifier{Secret: secret, MaxSkew: time.Minute, Nonces: nonces}
+	srv := httptest.NewServer(v.Middleware(s.Serve()))
+	defer srv.Close()
+
+	// A proxy capturing the requests it forwards.
+	var captured *http.Request
+	var capturedBody []byte
+	httpClient := &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			captured, capturedBody = r.Clone(r.Context()), body
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			return http.DefaultTransport.RoundTrip(r)
+		}),
+	}
+	ctx := context.Background()
+
+	// Signed requests are served.
+	c, err := Dial(srv.URL, WithHTTPClient(httpClient), WithRequestSigning(secret))
+	require.NoError(t, err)
+	res := &AddResponse{}
+	require.NoError(t, c.Call(ctx, "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 3, res.X)
+	require.NoError(t, c.Call(ctx, "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.Equal(t, 2, nonces.Len())
+
+	replay := func(h http.Header, body []byte) *Error {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header = h.Clone()
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		err = decodeResult(JSONCodec{}, b, &AddResponse{})
+		var rerr *Error
+		if !errors.As(err, &rerr) {
+			return nil
+		}
+		return rerr
+	}
+
+	// Captured requests can't be replayed, or altered.
+	rerr := replay(captured.Header, capturedBody)
+	require.NotNil(t, rerr)
+	require.Equal(t, CodeUnauthenticated, rerr.Code)
+	require.Equal(t, "replayed request", rerr.Message)
+	rerr = replay(captured.Header, bytes.Replace(capturedBody, []byte(`"A":1`), []byte(`"A":5`), 1))
+	require.NotNil(t, rerr)
+	require.Equal(t, "invalid request signature", rerr.Message)
+
+	// Nor can requests signed outside the clock skew window.
+	h := captured.Header.Clone()
+	h.Set(SignatureHeader, signRequest(secret, time.Now().Add(-2*time.Minute), "n0nce", "", capturedBody))
+	rerr = replay(h, capturedBody)
+	require.NotNil(t, rerr)
+	require.Contains(t, rerr.Message, "outside the allowed clock skew")
+
+	// Unsigned requests, and those signed with another secret, are
+	// rejected.
+	c, err = Dial(srv.URL)
+	require.NoError(t, err)
+	err = c.Call(ctx, "Math.Add", &AddRequest{}, res)
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeUnauthenticated, rerr.Code)
+	c, err = Dial(srv.URL, WithRequestSigning([]byte("other")))
+	require.NoError(t, err)
+	err = c.Call(ctx, "Math.Add", &AddRequest{}, res)
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeUnauthenticated, rerr.Code)
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	s := &MemoryNonceStore{}
+	ctx := context.Background()
+	ok, err := s.Add(ctx, "a", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, _ = s.Add(ctx, "a", time.Now().Add(time.Minute))
+	require.False(t, ok)
+
+	// Expired nonces are forgotten.
+	ok, _ = s.Add(ctx, "b", time.Now().Add(-time.Second))
+	require.True(t, ok)
+	s.nextPrune = time.Time{}
+	ok, _ = s.Add(ctx, "c", time.Now().Add(time.Minute))
+	require.True(t, ok)
+	require.Equal(t, 2, s.Len())
+}
+
+func TestRequestVerifier_Keys(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	v := &RequestVerifier{Keys: map[string][]byte{"2024": []byte("old")}}
+	srv := httptest.NewServer(v.Middleware(s.Serve()))
+	defer srv.Close()
+	ctx := context.Background()
+
+	call := func(opts ...Option) error {
+		c, err := Dial(srv.URL, opts...)
+		require.NoError(t, err)
+		return c.Call(ctx, "Math.Add", &AddRequest{}, &AddResponse{})
+	}
+	rejected := func(err error) bool {
+		var rerr *Error
+		return errors.As(err, &rerr) && rerr.Code == CodeUnauthenticated
+	}
+
+	require.NoError(t, call(WithSigningKey("2024", []byte("old"))))
+	require.True(t, rejected(call(WithSigningKey("2025", []byte("new")))))
+	// Requests without a key id need the default secret.
+	require.True(t, rejected(call(WithRequestSigning([]byte("old")))))
+	// Or the key of another id.
+	require.True(t, rejected(call(WithSigningKey("2024", []byte("new")))))
+
+	// Both keys are accepted while clients move to the new one.
+	v.SetKey("2025", []byte("new"))
+	require.NoError(t, call(WithSigningKey("2024", []byte("old"))))
+	require.NoError(t, call(WithSigningKey("2025", []byte("new"))))
+
+	// Until the old one is removed.
+	v.RemoveKey("2024")
+	require.True(t, rejected(call(WithSigningKey("2024", []byte("old")))))
+	require.NoError(t, call(WithSigningKey("2025", []byte("new"))))
+}
+
+// readTracker is a request body recording whether it was read.
+type readTracker struct {
+	io.Reader
+	read bool
+}
+
+func (r *readTracker) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
+
+func TestRequestVerifier_Body(t *testing.T) {
+	secret := []byte("s3cr3t")
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	v := &RequestVerifier{Secret: secret, MaxSkew: time.Minute, MaxBodySize: 64}
+	h := v.Middleware(s.Serve())
+
+	serve := func(signedAt time.Time, body string) (*httptest.ResponseRecorder, *readTracker) {
+		b := &readTracker{Reader: strings.NewReader(body)}
+		r := httptest.NewRequest(http.MethodPost, "/", b)
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(SignatureHeader, signRequest(secret, signedAt, randomID(), "", []byte(body)))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w, b
+	}
+
+	// Bodies of requests signed outside the clock skew window aren't read.
+	w, b := serve(time.Now().Add(-time.Hour), `{"ServiceMethod":"Math.Add","Body":{}}`)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.False(t, b.read)
+
+	// Nor are bodies over the size limit read in full.
+	w, _ = serve(time.Now(), `{"ServiceMethod":"Math.Add","Body":{"A":1}}`+strings.Repeat(" ", 64))
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w, _ = serve(time.Now(), `{"ServiceMethod":"Math.Add","Body":{"A":1}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+type (
+	// blobStreams holds the streamed bodies of a call whose Blob bodies
+	// are sent raw over HTTP.
+	blobStreams struct {
+		req            io.Reader // body of the request, if spooled
+		res            io.Reader // body of the response, if streamed
+		streamResponse bool      // whether the response can be streamed
+	}
+	blobStreamsKey struct{}
+)
+
+// WithSpoolThreshold stores the raw Blob request bodies larger than n
+// bytes, see Blob, in temporary files instead of memory. Methods read them
+// from the Blob's Reader, and the files are removed once calls complete.
+func WithSpoolThreshold(n int64) ServiceOption {
+	return func(s *Service) {
+		s.spoolThreshold = n
+	}
+}
+
+// readRaw reads the raw Blob body of the request, up to the size limit.
+// Bodies over the spool threshold are written to a temporary file, which
+// the caller must remove.
+func (s *Service) readRaw(r *http.Request) ([]byte, *os.File, error) {
+	if s.spoolThreshold <= 0 {
+		data, err := s.readRequest(r)
+		return data, nil, err
+	}
+
+	body := io.Reader(r.Body)
+	if s.maxRequestSize > 0 {
+		body = io.LimitReader(r.Body, s.maxRequestSize+1)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(body, s.spoolThreshold+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(data)) <= s.spoolThreshold {
+		return data, nil, nil
+	}
+
+	f, err := ioutil.TempFile("", "rpc-blob-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("rpc: error spooling request: %v", err)
+	}
+	n, err := io.Copy(f, io.MultiReader(bytes.NewReader(data), body))
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err == nil && s.maxRequestSize > 0 && n > s.maxRequestSize {
+		err = &Error{
+			Code:    CodeRequestTooLarge,
+			Message: fmt.Sprintf("request exceeds limit of %d bytes", s.maxRequestSize),
+		}
+	}
+	if err != nil {
+		removeSpool(f)
+		return nil, nil, err
+	}
+	return nil, f, nil
+}
+
+func removeSpool(f *os.File) {
+	f.Close()           // nolint: errcheck
+	os.Remove(f.Name()) // nolint: errcheck
+}
+
+// withBlobStreams returns a context holding the streamed bodies of a call
+// served over HTTP.
+func withBlobStreams(ctx context.Context, r *http.Request, spooled io.Reader) context.Context {
+	streams := &blobStreams{
+		req:            spooled,
+		streamResponse: r.Header.Get(RawResponseHeader) != "",
+	}
+	return context.WithValue(ctx, blobStreamsKey{}, streams)
+}
+
+// attachRequestStream sets the Reader of the request body of the call, if
+// it is a spooled Blob.
+func attachRequestStream(ctx context.Context, reqBody interface{}) {
+	b, ok := reqBody.(*Blob)
+	if !ok {
+		return
+	}
+	if streams, ok := ctx.Value(blobStreamsKey{}).(*blobStreams); ok && streams.req != nil {
+		b.Reader = streams.req
+	}
+}
+
+// detachResponseStream takes the Reader of the response body of the call,
+// if it is a Blob, to be streamed to the caller. If it can't be streamed,
+// it is read into the Blob's Data instead.
+func detachResponseStream(ctx context.Context, resBody interface{}) error {
+	b, ok := resBody.(*Blob)
+	if !ok || b.Reader == nil {
+		return nil
+	}
+	r := b.Reader
+	b.Reader = nil
+	if streams, ok := ctx.Value(blobStreamsKey{}).(*blobStreams); ok && streams.streamResponse {
+		streams.res = r
+		return nil
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close() // nolint: errcheck
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	b.Data = data
+	return nil
+}
@@ -0,0 +1,93 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Streamer struct {
+	spooled bool
+}
+
+func (s *Streamer) Size(req *Blob, res *UploadResponse) error {
+	_, s.spooled = req.Reader.(*os.File)
+	r := req.Reader
+	if r == nil {
+		r = bytes.NewReader(req.Data)
+	}
+	n, err := io.Copy(ioutil.Discard, r)
+	res.Size = int(n)
+	return err
+}
+
+func (s *Streamer) Generate(req *DownloadRequest, res *Blob) error {
+	res.ContentType = "application/x-test"
+	res.Reader = io.LimitReader(zeros{}, int64(req.Size))
+	return nil
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestWithSpoolThreshold(t *testing.T) {
+	streamer := &Streamer{}
+	s := New(WithSpoolThreshold(1024), WithMaxRequestSize(1<<20))
+	require.NoError(t, s.Register(streamer))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Small bodies stay in memory.
+	res := &UploadResponse{}
+	require.NoError(t, c.Call(ctx, "Streamer.Size", &Blob{Data: make([]byte, 100)}, res))
+	require.Equal(t, 100, res.Size)
+	require.False(t, streamer.spooled)
+
+	// Larger ones are spooled, and can be streamed by the client.
+	require.NoError(t, c.Call(ctx, "Streamer.Size", &Blob{Reader: io.LimitReader(zeros{}, 100000)}, res))
+	require.Equal(t, 100000, res.Size)
+	require.True(t, streamer.spooled)
+
+	// The size limit still applies.
+	require.Error(t, c.Call(ctx, "Streamer.Size", &Blob{Reader: io.LimitReader(zeros{}, 2<<20)}, res))
+}
+
+func TestBlob_StreamedResponse(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Streamer{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// Responses are streamed to callers accepting raw responses.
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	res := &Blob{}
+	require.NoError(t, c.Call(context.Background(), "Streamer.Generate", &DownloadRequest{Size: 100000}, res))
+	require.Equal(t, "application/x-test", res.ContentType)
+	require.Len(t, res.Data, 100000)
+
+	// And read into the envelope for other callers.
+	resp, err := http.Post(srv.URL, "application/json", bytes.NewBufferString(`{"ServiceMethod":"Streamer.Generate","Body":{"Size":10}}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ServiceMethod":"Streamer.Generate","Body":{"ContentType":"application/x-test","Data":"AAAAAAAAAAAAAA=="},"Seq":0,"Error":"","Code":""}`, string(body))
+}
@@ -0,0 +1,146 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLIdempotencyStore is an IdempotencyStore keeping records in a table
+// of a SQL database, shared by every replica and persisted. The table is
+// created with, adapting the types to the database:
+//
+//	CREATE TABLE rpc_idempotency (
+//		idempotency_key VARCHAR(512) PRIMARY KEY,
+//		request_hash    VARCHAR(64) NOT NULL,
+//		response        BLOB,
+//		expires         BIGINT NOT NULL
+//	)
+//
+// Expired records are replaced when their key is reused, and can be
+// deleted with Prune.
+type SQLIdempotencyStore struct {
+	DB    *sql.DB
+	Table string // defaults to "rpc_idempotency"
+	// Placeholder returns the placeholder of the n-th argument of a
+	// statement, counting from 1. Defaults to "?", as used by MySQL and
+	// SQLite, see DollarPlaceholder for PostgreSQL.
+	Placeholder func(n int) string
+}
+
+// DollarPlaceholder numbers the placeholders of statements as $1, $2...
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// Begin implements IdempotencyStore. Calls racing to begin with the same
+// key are told apart by the primary key of the table.
+func (s *SQLIdempotencyStore) Begin(ctx context.Context, key, hash string, ttl time.Duration) (bool, *Response, error) {
+	now := time.Now()
+	var insertErr error
+	// A record expired or deleted concurrently is retried once.
+	for attempt := 0; attempt < 2; attempt++ {
+		_, insertErr = s.exec(ctx, "INSERT INTO %s (idempotency_key, request_hash, expires) VALUES (?, ?, ?)",
+			key, hash, now.Add(ttl).UnixNano())
+		if insertErr == nil {
+			return true, nil, nil
+		}
+
+		var (
+			recorded string
+			response []byte
+			expires  int64
+		)
+		err := s.queryRow(ctx, "SELECT request_hash, response, expires FROM %s WHERE idempotency_key = ?", key).
+			Scan(&recorded, &response, &expires)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return false, nil, fmt.Errorf("rpc: error reading idempotency record: %v", err)
+		}
+		if expires <= now.UnixNano() {
+			if _, err := s.exec(ctx, "DELETE FROM %s WHERE idempotency_key = ? AND expires = ?", key, expires); err != nil {
+				return false, nil, fmt.Errorf("rpc: error deleting idempotency record: %v", err)
+			}
+			continue
+		}
+		if recorded != hash {
+			return false, nil, ErrIdempotencyKeyReused
+		}
+		if response == nil {
+			return false, nil, nil
+		}
+		res := &Response{}
+		if err := gob.NewDecoder(bytes.NewReader(response)).Decode(res); err != nil {
+			return false, nil, fmt.Errorf("rpc: error decoding idempotency record: %v", err)
+		}
+		return false, res, nil
+	}
+	return false, nil, fmt.Errorf("rpc: error writing idempotency record: %v", insertErr)
+}
+
+// Complete implements IdempotencyStore.
+func (s *SQLIdempotencyStore) Complete(ctx context.Context, key string, res *Response) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(res); err != nil {
+		return fmt.Errorf("rpc: error encoding idempotency record: %v", err)
+	}
+	if _, err := s.exec(ctx, "UPDATE %s SET response = ? WHERE idempotency_key = ?", buf.Bytes(), key); err != nil {
+		return fmt.Errorf("rpc: error writing idempotency record: %v", err)
+	}
+	return nil
+}
+
+// Abort implements IdempotencyStore.
+func (s *SQLIdempotencyStore) Abort(ctx context.Context, key string) error {
+	if _, err := s.exec(ctx, "DELETE FROM %s WHERE idempotency_key = ?", key); err != nil {
+		return fmt.Errorf("rpc: error deleting idempotency record: %v", err)
+	}
+	return nil
+}
+
+// Prune deletes the expired records.
+func (s *SQLIdempotencyStore) Prune(ctx context.Context) error {
+	if _, err := s.exec(ctx, "DELETE FROM %s WHERE expires <= ?", time.Now().UnixNano()); err != nil {
+		return fmt.Errorf("rpc: error deleting idempotency records: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLIdempotencyStore) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.DB.ExecContext(ctx, s.statement(query), args...)
+}
+
+func (s *SQLIdempotencyStore) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.DB.QueryRowContext(ctx, s.statement(query), args...)
+}
+
+// statement returns the query for the table of the store, with its
+// placeholders.
+func (s *SQLIdempotencyStore) statement(query string) string {
+	table := s.Table
+	if table == "" {
+		table = "rpc_idempotency"
+	}
+	query = fmt.Sprintf(query, table)
+	if s.Placeholder == nil {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, part := range strings.Split(query, "?") {
+		if n > 0 {
+			b.WriteString(s.Placeholder(n))
+		}
+		b.WriteString(part)
+		n++
+	}
+	return b.String()
+}
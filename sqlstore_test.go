@@ -0,0 +1,190 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// idempotencyDriver is a database/sql driver serving the statements of
+// SQLIdempotencyStore from a map, standing in for a database.
+type idempotencyDriver struct {
+	mu      sync.Mutex
+	rows    map[string]idempotencyRow
+	queries []string
+}
+
+type idempotencyRow struct {
+	hash     string
+	response []byte
+	expires  int64
+}
+
+func (d *idempotencyDriver) Open(name string) (driver.Conn, error) {
+	return idempotencyConn{d}, nil
+}
+
+func (d *idempotencyDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return idempotencyConn{d}, nil
+}
+
+func (d *idempotencyDriver) Driver() driver.Driver {
+	return d
+}
+
+type idempotencyConn struct {
+	d *idempotencyDriver
+}
+
+func (c idempotencyConn) Prepare(query string) (driver.Stmt, error) {
+	return idempotencyStmt{c.d, query}, nil
+}
+
+func (c idempotencyConn) Close() error {
+	return nil
+}
+
+func (c idempotencyConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type idempotencyStmt struct {
+	d     *idempotencyDriver
+	query string
+}
+
+func (s idempotencyStmt) Close() error {
+	return nil
+}
+
+func (s idempotencyStmt) NumInput() int {
+	return -1
+}
+
+func (s idempotencyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, s.query)
+	key := func(i int) string { return args[i].(string) }
+	switch {
+	case strings.HasPrefix(s.query, "INSERT"):
+		if _, ok := d.rows[key(0)]; ok {
+			return nil, errors.New("duplicate key")
+		}
+		d.rows[key(0)] = idempotencyRow{hash: key(1), expires: args[2].(int64)}
+	case strings.HasPrefix(s.query, "UPDATE"):
+		if r, ok := d.rows[key(1)]; ok {
+			r.response = args[0].([]byte)
+			d.rows[key(1)] = r
+		}
+	case strings.Contains(s.query, "AND expires ="):
+		if r, ok := d.rows[key(0)]; ok && r.expires == args[1].(int64) {
+			delete(d.rows, key(0))
+		}
+	case strings.Contains(s.query, "WHERE idempotency_key ="):
+		delete(d.rows, key(0))
+	case strings.Contains(s.query, "WHERE expires <="):
+		for k, r := range d.rows {
+			if r.expires <= args[0].(int64) {
+				delete(d.rows, k)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected statement %q", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s idempotencyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, s.query)
+	r, ok := d.rows[args[0].(string)]
+	if !ok {
+		return &idempotencyRows{}, nil
+	}
+	return &idempotencyRows{rows: [][]driver.Value{{r.hash, r.response, r.expires}}}, nil
+}
+
+type idempotencyRows struct {
+	rows [][]driver.Value
+}
+
+func (r *idempotencyRows) Columns() []string {
+	return []string{"request_hash", "response", "expires"}
+}
+
+func (r *idempotencyRows) Close() error {
+	return nil
+}
+
+func (r *idempotencyRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLIdempotencyStore(t *testing.T) {
+	d := &idempotencyDriver{rows: map[string]idempotencyRow{}}
+	db := sql.OpenDB(d)
+	defer db.Close()
+	ctx := context.Background()
+	s := &SQLIdempotencyStore{DB: db, Placeholder: DollarPlaceholder}
+
+	start, res, err := s.Begin(ctx, "k", "h", time.Hour)
+	require.NoError(t, err)
+	require.True(t, start)
+	require.Nil(t, res)
+	require.Equal(t, "INSERT INTO rpc_idempotency (idempotency_key, request_hash, expires) VALUES ($1, $2, $3)", d.queries[0])
+
+	// In progress.
+	start, res, err = s.Begin(ctx, "k", "h", time.Hour)
+	require.NoError(t, err)
+	require.False(t, start)
+	require.Nil(t, res)
+
+	// Completed.
+	require.NoError(t, s.Complete(ctx, "k", &Response{Body: []byte(`1`), Seq: 1}))
+	start, res, err = s.Begin(ctx, "k", "h", time.Hour)
+	require.NoError(t, err)
+	require.False(t, start)
+	require.Equal(t, &Response{Body: []byte(`1`), Seq: 1}, res)
+
+	// Reused for another request.
+	_, _, err = s.Begin(ctx, "k", "other", time.Hour)
+	require.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	// Aborted.
+	require.NoError(t, s.Abort(ctx, "k"))
+	start, _, err = s.Begin(ctx, "k", "other", time.Hour)
+	require.NoError(t, err)
+	require.True(t, start)
+
+	// Expired.
+	start, _, err = s.Begin(ctx, "e", "h", -time.Second)
+	require.NoError(t, err)
+	require.True(t, start)
+	start, _, err = s.Begin(ctx, "e", "h", time.Hour)
+	require.NoError(t, err)
+	require.True(t, start)
+
+	// Pruned.
+	_, _, err = s.Begin(ctx, "p", "h", -time.Second)
+	require.NoError(t, err)
+	require.NoError(t, s.Prune(ctx))
+	require.Len(t, d.rows, 2)
+}
@@ -0,0 +1,175 @@
+package rpc
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StatusMethod is the method Stats.RegisterStatus registers.
+const StatusMethod = "rpc.Status"
+
+type (
+	// Stats counts the calls to each method of a service, and exposes them
+	// with the service's uptime, build and limits as StatusMethod.
+	Stats struct {
+		mu          sync.Mutex
+		start       time.Time
+		methods     map[string]*MethodStats
+		profileRate float64 // of calls profiled, see WithProfiling
+	}
+	// MethodStats are the counters of a method.
+	MethodStats struct {
+		Method   string
+		Calls    uint64        // completed calls
+		Errors   uint64        // calls that failed
+		InFlight int64         // calls in progress
+		Duration time.Duration // total duration of completed calls
+		Profile  MethodProfile // of sampled calls, see WithProfiling
+	}
+	// Status is the response of StatusMethod.
+	Status struct {
+		Uptime  time.Duration
+		Build   BuildStatus
+		Methods []MethodStats
+		Limits  LimitsStatus
+		// Streams is the number of streams of requests and responses
+		// open, a bidirectional call having one of each.
+		Streams int64
+	}
+	// BuildStatus describes the binary serving the service.
+	BuildStatus struct {
+		GoVersion string
+		Path      string `json:",omitempty"` // main module path
+		Version   string `json:",omitempty"` // main module version
+		Revision  string `json:",omitempty"` // vcs revision, if known
+	}
+	// LimitsStatus are the limits the service is configured with.
+	LimitsStatus struct {
+		MaxRequestSize int64                    `json:",omitempty"`
+		Timeouts       map[string]time.Duration `json:",omitempty"` // of methods that have one
+	}
+	// statusService implements StatusMethod.
+	statusService struct {
+		st *Stats
+		s  *Service
+	}
+)
+
+// NewStats returns stats with the uptime starting now.
+func NewStats(opts ...StatsOption) *Stats {
+	st := &Stats{
+		start:   time.Now(),
+		methods: map[string]*MethodStats{},
+	}
+	for _, opt := range opts {
+		opt(st)
+	}
+	return st
+}
+
+// Middleware returns the middleware counting calls.
+func (st *Stats) Middleware(next Handler) Handler {
+	return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		st.mu.Lock()
+		ms, ok := st.methods[m.Name]
+		if !ok {
+			ms = &MethodStats{Method: m.Name}
+			st.methods[m.Name] = ms
+		}
+		ms.InFlight++
+		st.mu.Unlock()
+
+		start := time.Now()
+		var (
+			res *Response
+			err error
+		)
+		st.profile(ctx, ms, func(ctx context.Context) {
+			res, err = next(ctx, m, req)
+		})
+
+		st.mu.Lock()
+		ms.InFlight--
+		ms.Calls++
+		ms.Duration += time.Since(start)
+		if err != nil {
+			ms.Errors++
+		}
+		st.mu.Unlock()
+		return res, err
+	}
+}
+
+// Methods returns the counters of the methods that were called, sorted by
+// method.
+func (st *Stats) Methods() []MethodStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	methods := make([]MethodStats, 0, len(st.methods))
+	for _, ms := range st.methods {
+		methods = append(methods, *ms)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Method < methods[j].Method
+	})
+	return methods
+}
+
+// RegisterStatus registers StatusMethod, returning the status of the
+// service. Callers must be authenticated, see WithPrincipal, and the
+// options, eg. WithRoles, are applied to it.
+func (st *Stats) RegisterStatus(s *Service, opts ...MethodOption) error {
+	if err := s.RegisterName("rpc", &statusService{st: st, s: s}); err != nil {
+		return err
+	}
+	return s.Configure(StatusMethod, append([]MethodOption{WithReadOnly()}, opts...)...)
+}
+
+func (a *statusService) Status(ctx context.Context, req *struct{}, res *Status) error {
+	if _, ok := PrincipalFromContext(ctx); !ok {
+		return &Error{
+			Code:    CodeUnauthenticated,
+			Message: "status requires an authenticated caller",
+		}
+	}
+
+	res.Uptime = time.Since(a.st.start)
+	res.Build = buildStatus()
+	res.Methods = a.st.Methods()
+	res.Limits.MaxRequestSize = a.s.maxRequestSize
+	res.Streams = atomic.LoadInt64(&a.s.openStreams)
+	a.s.mu.RLock()
+	defer a.s.mu.RUnlock()
+	for name, m := range a.s.Methods {
+		if m.Timeout > 0 {
+			if res.Limits.Timeouts == nil {
+				res.Limits.Timeouts = map[string]time.Duration{}
+			}
+			res.Limits.Timeouts[name] = m.Timeout
+		}
+	}
+	return nil
+}
+
+func buildStatus() BuildStatus {
+	b := BuildStatus{
+		GoVersion: runtime.Version(),
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.Path = info.Main.Path
+	b.Version = info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			b.Revision = setting.Value
+		}
+	}
+	return b
+}
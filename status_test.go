@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	st := NewStats()
+	s := New(WithMiddleware(st.Middleware), WithMaxRequestSize(1024))
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Configure("Math.Add", WithTimeout(time.Second)))
+	require.NoError(t, st.RegisterStatus(s))
+
+	call := func(ctx context.Context, method, body string) (*Response, error) {
+		return s.callContext(ctx, &Request{
+			ServiceMethod: method,
+			Body:          []byte(body),
+		})
+	}
+	_, err := call(context.Background(), "Math.Add", `{"A":1,"B":2}`)
+	require.NoError(t, err)
+	_, err = call(context.Background(), "Math.Add", `"invalid"`)
+	require.Error(t, err)
+
+	// Callers must be authenticated.
+	_, err = call(context.Background(), StatusMethod, `{}`)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodeUnauthenticated, rerr.Code)
+
+	ctx := WithPrincipal(context.Background(), Principal{Subject: "operator"})
+	res, err := call(ctx, StatusMethod, `{}`)
+	require.NoError(t, err)
+	status := Status{}
+	require.NoError(t, json.Unmarshal(res.Body, &status))
+	require.True(t, status.Uptime > 0)
+	require.NotEmpty(t, status.Build.GoVersion)
+	require.Equal(t, int64(1024), status.Limits.MaxRequestSize)
+	require.Equal(t, map[string]time.Duration{"Math.Add": time.Second}, status.Limits.Timeouts)
+
+	require.Len(t, status.Methods, 2)
+	require.Equal(t, "Math.Add", status.Methods[0].Method)
+	require.Equal(t, uint64(2), status.Methods[0].Calls)
+	require.Equal(t, uint64(1), status.Methods[0].Errors)
+	require.Equal(t, StatusMethod, status.Methods[1].Method)
+	require.Equal(t, int64(1), status.Methods[1].InFlight)
+}
+
+// Held streams a tick, then holds the stream open until released.
+type Held struct {
+	release chan struct{}
+}
+
+func (h *Held) Ticks(ctx context.Context, req *TickRequest, stream *Stream[Tick]) error {
+	if err := stream.Send(ctx, Tick{N: 1}); err != nil {
+		return err
+	}
+	<-h.release
+	return nil
+}
+
+func TestStats_Streams(t *testing.T) {
+	st := NewStats()
+	s := New()
+	held := &Held{release: make(chan struct{})}
+	require.NoError(t, s.Register(held))
+	require.NoError(t, st.RegisterStatus(s))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+
+	streams := func() int64 {
+		ctx := WithPrincipal(context.Background(), Principal{Subject: "operator"})
+		res, err := s.callContext(ctx, &Request{ServiceMethod: StatusMethod, Body: []byte(`{}`)})
+		require.NoError(t, err)
+		status := Status{}
+		require.NoError(t, json.Unmarshal(res.Body, &status))
+		return status.Streams
+	}
+
+	require.Equal(t, int64(0), streams())
+	for _, err := range CallStream[Tick](context.Background(), c, "Held.Ticks", &TickRequest{}) {
+		require.NoError(t, err)
+		require.Equal(t, int64(1), streams())
+		close(held.release)
+	}
+	require.Eventually(t, func() bool {
+		return streams() == 0
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,518 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// NDJSONContentType is the content type of streamed responses sent as
+	// newline delimited JSON: one response envelope per line, the
+	// envelopes of the messages of the stream, with More set, followed by
+	// the final response of the call.
+	NDJSONContentType = "application/x-ndjson"
+	// EventStreamContentType is the content type of streamed responses
+	// sent as server-sent events, for browsers. The data of each event is
+	// a response envelope, as with NDJSONContentType.
+	EventStreamContentType = "text/event-stream"
+)
+
+// WithCompression compresses the streamed responses of the method with
+// gzip, for callers accepting it, which Go clients do unless they set
+// Accept-Encoding themselves. It suits streams of messages which compress
+// well, unlike ones carrying already compressed data.
+func WithCompression() MethodOption {
+	return func(m *Method) {
+		m.Compress = true
+	}
+}
+
+// WithStreamLimits limits how many calls streaming requests or responses
+// can be open at once, in all, and for each client, identified by the
+// subject of its principal if it was authenticated before the service
+// served it, or else by its address. Calls over the limits fail with
+// CodeTooManyStreams. A limit of zero means no limit.
+func WithStreamLimits(max, perClient int) ServiceOption {
+	return func(s *Service) {
+		s.streamLimits.max = max
+		s.streamLimits.perClient = perClient
+	}
+}
+
+// streamLimits counts the calls streaming requests or responses open, see
+// WithStreamLimits.
+type streamLimits struct {
+	max, perClient int
+
+	mu      sync.Mutex
+	open    int
+	clients map[string]int
+}
+
+// Stream sends the messages of a method streaming its response. Methods
+// taking a *Stream[T] in place of their response stream messages of type
+// T to the caller, until they return or close the stream:
+//
+//	func (t *Ticker) Watch(ctx context.Context, req *WatchRequest, stream *rpc.Stream[Tick]) error
+//
+// Streams are sent as NDJSONContentType or EventStreamContentType,
+// depending on what the caller accepts, so methods don't depend on how
+// their messages are framed. Callers receive the messages with CallStream.
+type Stream[T any] struct {
+	w streamWriter
+}
+
+// Send sends a message to the caller, failing if the caller has gone or
+// the stream is closed.
+func (s *Stream[T]) Send(ctx context.Context, v T) error {
+	if s.w == nil {
+		return errStreamNotOpen
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.w.send(v)
+}
+
+// SetRetry asks callers to wait d before reconnecting once the stream
+// ends. Only server-sent events carry it, it is ignored otherwise.
+func (s *Stream[T]) SetRetry(d time.Duration) {
+	if s.w != nil {
+		s.w.setRetry(d)
+	}
+}
+
+// Close ends the stream with err, or successfully if err is nil, before
+// the method returns. Sending messages to a closed stream fails, and the
+// error the method returns is dropped.
+func (s *Stream[T]) Close(err error) error {
+	if s.w == nil {
+		return errStreamNotOpen
+	}
+	return s.w.close(err)
+}
+
+func (s *Stream[T]) open(w streamWriter) {
+	s.w = w
+}
+
+type (
+	// streamOpener is implemented by the response of methods streaming
+	// it, see Stream.
+	streamOpener interface {
+		open(w streamWriter)
+	}
+	// streamWriter writes the messages of a stream to the caller.
+	streamWriter interface {
+		send(body interface{}) error
+		setRetry(d time.Duration)
+		close(err error) error
+	}
+	streamKey struct{}
+)
+
+var (
+	typeOfStreamOpener = reflect.TypeOf((*streamOpener)(nil)).Elem()
+
+	errStreamNotOpen = errors.New("rpc: stream is not open")
+	errStreamClosed  = errors.New("rpc: stream is closed")
+)
+
+// Streaming returns whether the method streams its response, see Stream.
+func (m Method) Streaming() bool {
+	return m.ResponseType != nil && m.ResponseType.Implements(typeOfStreamOpener)
+}
+
+// openStream opens the stream of a call to a method streaming its
+// response, sending its messages with the stream writer of ctx. Calls
+// made over transports which can't stream responses fail.
+func openStream(ctx context.Context, resBody interface{}) error {
+	st, ok := resBody.(streamOpener)
+	if !ok {
+		return nil
+	}
+	w, ok := ctx.Value(streamKey{}).(streamWriter)
+	if !ok {
+		return &Error{
+			Code:    CodeInvalidRequest,
+			Message: "method streams its response, it can't be called over this transport",
+		}
+	}
+	st.open(w)
+	return nil
+}
+
+// httpStream writes the messages of a streamed response over HTTP.
+// The response is only streamed once a message is sent or the stream is
+// closed, until then it is written as usual.
+type httpStream struct {
+	w     http.ResponseWriter
+	codec Codec
+	req   *Request
+	md    *responseMetadata
+	sse   bool // whether messages are sent as server-sent events
+	gzip  bool // whether messages are compressed
+
+	errorEncoder ErrorEncoder
+
+	sendMu sync.Mutex // serializes messages, encoded as deltas
+	deltas *deltaEncoder
+
+	mu      sync.Mutex
+	started bool
+	done    bool
+	retry   time.Duration
+	gz      *gzip.Writer
+}
+
+// withStream returns a context streaming the response of the call of req
+// to w, if the caller accepts streamed responses. It fails if the call
+// can't be admitted, see WithStreamLimits.
+func (s *Service) withStream(ctx context.Context, w http.ResponseWriter, r *http.Request, req *Request, md *responseMetadata) (context.Context, *httpStream, error) {
+	accept := r.Header.Get("Accept")
+	sse := strings.Contains(accept, EventStreamContentType)
+	if !sse && !strings.Contains(accept, NDJSONContentType) {
+		return ctx, nil, nil
+	}
+	st := &httpStream{w: w, codec: s.codec, req: req, md: md, sse: sse, errorEncoder: s.errorEncoder}
+	if m, ok := s.method(req.ServiceMethod); ok {
+		st.gzip = m.Compress && acceptsGzip(r)
+		st.deltas = s.acceptsDeltas(r, m)
+		if m.Streaming() {
+			// Bidirectional calls were admitted with their stream of
+			// requests.
+			if !isStreamRequest(r) {
+				if err := s.admitStream(r); err != nil {
+					return ctx, nil, err
+				}
+			}
+			clearDeadlines(w, false)
+			s.trackStream(r.Context())
+		}
+	}
+	return context.WithValue(ctx, streamKey{}, streamWriter(st)), st, nil
+}
+
+// admitStream counts the call of r as open until it is done, failing with
+// CodeTooManyStreams if that exceeds the limits of the service, see
+// WithStreamLimits.
+func (s *Service) admitStream(r *http.Request) error {
+	l := &s.streamLimits
+	if l.max <= 0 && l.perClient <= 0 {
+		return nil
+	}
+	client := streamClient(r)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.open >= l.max {
+		return &Error{
+			Code:    CodeTooManyStreams,
+			Message: fmt.Sprintf("too many streams open, the limit is %d", l.max),
+		}
+	}
+	if l.perClient > 0 && l.clients[client] >= l.perClient {
+		return &Error{
+			Code:    CodeTooManyStreams,
+			Message: fmt.Sprintf("too many streams open by the client, the limit is %d", l.perClient),
+		}
+	}
+	if l.clients == nil {
+		l.clients = map[string]int{}
+	}
+	l.open++
+	l.clients[client]++
+	context.AfterFunc(r.Context(), func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.open--
+		if l.clients[client]--; l.clients[client] == 0 {
+			delete(l.clients, client)
+		}
+	})
+	return nil
+}
+
+// streamClient identifies the client making the call of r, see
+// WithStreamLimits.
+func streamClient(r *http.Request) string {
+	if p, ok := PrincipalFromContext(r.Context()); ok && p.Subject != "" {
+		return "subject/" + p.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr/" + host
+}
+
+// trackStream counts a stream as open until the request of ctx is done,
+// see Status.
+func (s *Service) trackStream(ctx context.Context) {
+	atomic.AddInt64(&s.openStreams, 1)
+	context.AfterFunc(ctx, func() {
+		atomic.AddInt64(&s.openStreams, -1)
+	})
+}
+
+// clearDeadlines lifts the write timeout of the server, and the read one
+// if read is set, from the connection of w, since streams last as long
+// as their methods do.
+func clearDeadlines(w http.ResponseWriter, read bool) {
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	if read {
+		_ = rc.SetReadDeadline(time.Time{})
+	}
+}
+
+func (st *httpStream) send(body interface{}) error {
+	st.sendMu.Lock()
+	defer st.sendMu.Unlock()
+	b, err := marshalBody(st.codec, body)
+	if err != nil {
+		return fmt.Errorf("rpc: error encoding message: %v", err)
+	}
+	if st.deltas != nil {
+		if b, err = st.deltas.encode(b); err != nil {
+			return err
+		}
+	}
+	return st.write(&Response{
+		ServiceMethod: st.req.ServiceMethod,
+		Body:          b,
+		Seq:           st.req.Seq,
+		Version:       st.req.Version,
+		More:          true,
+	}, false)
+}
+
+func (st *httpStream) setRetry(d time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.retry = d
+}
+
+func (st *httpStream) close(err error) error {
+	if err != nil {
+		res, _ := errorResponse(st.req, st.errorEncoder.encode(err))
+		return st.write(&res, true)
+	}
+	res := &Response{
+		ServiceMethod: st.req.ServiceMethod,
+		Body:          json.RawMessage("{}"),
+		Seq:           st.req.Seq,
+	}
+	return st.write(versioned(res, st.req, st.md), true)
+}
+
+// write writes an envelope of the stream, the last one if done.
+func (st *httpStream) write(res *Response, done bool) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.done {
+		return errStreamClosed
+	}
+	st.done = done
+	b, err := st.codec.Marshal(res)
+	if err != nil {
+		return err
+	}
+	if !st.started {
+		st.started = true
+		if st.sse {
+			st.w.Header().Set("Content-Type", EventStreamContentType)
+			st.w.Header().Set("Cache-Control", "no-cache")
+		} else {
+			st.w.Header().Set("Content-Type", NDJSONContentType)
+		}
+		if st.deltas != nil {
+			st.w.Header().Set(DeltaHeader, MergePatchDelta)
+		}
+		if st.gzip {
+			st.w.Header().Set("Content-Encoding", "gzip")
+			st.w.Header().Add("Vary", "Accept-Encoding")
+			st.gz = gzip.NewWriter(st.w)
+		}
+		st.w.WriteHeader(http.StatusOK)
+	}
+	if st.sse {
+		frame := []byte{}
+		if st.retry > 0 {
+			frame = append(frame, "retry: "+strconv.FormatInt(st.retry.Milliseconds(), 10)+"\n"...)
+			st.retry = 0
+		}
+		frame = append(frame, "data: "...)
+		frame = append(frame, b...)
+		b = append(frame, "\n"...)
+	}
+	if st.gz != nil {
+		if _, err := st.gz.Write(append(b, '\n')); err != nil {
+			return err
+		}
+		if done {
+			err = st.gz.Close()
+		} else {
+			err = st.gz.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	} else if _, err := st.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return http.NewResponseController(st.w).Flush()
+}
+
+// acceptsGzip returns whether the caller accepts responses compressed with
+// gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if enc == "gzip" && strings.TrimSpace(params) != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// finish writes the final response of the call, or its error, and
+// returns whether it did, which it only does once the response was
+// streamed.
+func (st *httpStream) finish(res *Response, err error) bool {
+	if st == nil {
+		return false
+	}
+	st.mu.Lock()
+	started := st.started
+	st.mu.Unlock()
+	if !started {
+		return false
+	}
+	if err != nil {
+		res, _ := errorResponse(st.req, st.errorEncoder.encode(err))
+		_ = st.write(&res, true)
+		return true
+	}
+	_ = st.write(versioned(res, st.req, st.md), true)
+	return true
+}
+
+// CallStream calls a method streaming its response, see Stream, and
+// returns an iterator over its messages. The call is made once iterated,
+// and canceled when the loop exits. Errors end the iteration, including
+// the error of the call if it fails.
+func CallStream[T any](ctx context.Context, c *Client, method string, reqBody interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		resp, seq, err := c.openStream(ctx, method, reqBody)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		msgs := bufio.NewReader(resp.Body)
+		deltas := receivesDeltas(resp)
+		for {
+			var v T
+			more, err := readStreamMessage(c.codec, msgs, method, seq, deltas, &v)
+			if err != nil {
+				yield(zero, c.errorDecoder.decode(err))
+				return
+			}
+			if !more || !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// readStreamMessage reads the next message of a streamed response, encoded
+// with codec, into v, and returns whether there was one. At the end of the
+// stream, it returns the error of the call, if any. Messages sent as
+// deltas are applied to the previous one.
+func readStreamMessage(codec Codec, r *bufio.Reader, method string, seq uint64, deltas *deltaDecoder, v interface{}) (bool, error) {
+	msg, err := readEnvelope(r)
+	if err != nil {
+		return false, fmt.Errorf("rpc: error reading response body: %v", err)
+	}
+	var res Response
+	if err := codec.Unmarshal(msg, &res); err != nil {
+		return false, fmt.Errorf("rpc: error reading response body: %v", err)
+	}
+	if !res.More {
+		return false, decodeReply(codec, msg, method, seq, &struct{}{})
+	}
+	if res.ServiceMethod != method || res.Seq != seq {
+		return false, fmt.Errorf("%w: got %s #%d, expected %s #%d", ErrResponseMismatch, res.ServiceMethod, res.Seq, method, seq)
+	}
+	body := []byte(res.Body)
+	if deltas != nil {
+		if body, err = deltas.decode(body); err != nil {
+			return false, err
+		}
+	}
+	if err := unmarshalBody(codec, body, v); err != nil {
+		return false, fmt.Errorf("rpc: %s", err)
+	}
+	return true, nil
+}
+
+// openStream makes a call to a method streaming its response, and
+// returns the response and the Seq of the call.
+func (c *Client) openStream(ctx context.Context, method string, reqBody interface{}) (*http.Response, uint64, error) {
+	seq := c.nextSeq()
+	reqBytes, err := encodeCall(c.envelopeContext(ctx), c.codec, method, reqBody, seq, c.versions.current())
+	if err != nil {
+		return nil, 0, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.uri, bytes.NewReader(reqBytes))
+	if err != nil {
+		return nil, 0, fmt.Errorf("rpc: error creating request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", c.codec.ContentType())
+	httpReq.Header.Set("Accept", NDJSONContentType)
+	httpReq.Header.Set(DeltaHeader, MergePatchDelta)
+	setTimeoutHeader(ctx, httpReq.Header)
+	setOutgoingHeader(WithOutgoingHeader(ctx, ClientIDHeader, c.id), httpReq.Header)
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, 0, fmt.Errorf("rpc: error sending request: %w", err)
+	}
+	c.versions.update(resp.Header)
+	return resp, seq, nil
+}
+
+// readEnvelope reads the next envelope of a streamed response, one per
+// line. Responses which weren't streamed are read as a single envelope.
+func readEnvelope(r *bufio.Reader) ([]byte, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			return line, nil
+		}
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
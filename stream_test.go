@@ -0,0 +1,277 @@
+package rpc
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Ticker struct {
+	stopped chan error
+}
+
+type (
+	TickRequest struct {
+		Count int
+		Fail  bool
+	}
+	Tick struct {
+		N int
+	}
+)
+
+func (t *Ticker) Ticks(ctx context.Context, req *TickRequest, stream *Stream[Tick]) error {
+	for i := 1; req.Count == 0 || i <= req.Count; i++ {
+		if err := stream.Send(ctx, Tick{N: i}); err != nil {
+			t.stopped <- err
+			return err
+		}
+	}
+	if req.Fail {
+		return &Error{Code: CodeAborted, Message: "ticker failed"}
+	}
+	return nil
+}
+
+// Countdown sends the ticks down from req.Count, and closes the stream
+// once it reaches zero.
+func (t *Ticker) Countdown(ctx context.Context, req *TickRequest, stream *Stream[Tick]) error {
+	stream.SetRetry(5 * time.Second)
+	for i := req.Count; i > 0; i-- {
+		if err := stream.Send(ctx, Tick{N: i}); err != nil {
+			return err
+		}
+	}
+	if req.Fail {
+		return stream.Close(&Error{Code: CodeAborted, Message: "countdown failed"})
+	}
+	if err := stream.Close(nil); err != nil {
+		return err
+	}
+	if err := stream.Send(ctx, Tick{}); !errors.Is(err, errStreamClosed) {
+		return fmt.Errorf("sent to closed stream: %v", err)
+	}
+	return errors.New("dropped")
+}
+
+func TestCallStream(t *testing.T) {
+	ticker := &Ticker{stopped: make(chan error, 1)}
+	s := New()
+	require.NoError(t, s.Register(ticker))
+	require.True(t, s.Methods["Ticker.Ticks"].Streaming())
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Messages are received in order, until the method returns.
+	var ticks []int
+	for tick, err := range CallStream[Tick](ctx, c, "Ticker.Ticks", &TickRequest{Count: 3}) {
+		require.NoError(t, err)
+		ticks = append(ticks, tick.N)
+	}
+	require.Equal(t, []int{1, 2, 3}, ticks)
+
+	// Streams without messages end right away.
+	for range CallStream[Tick](ctx, c, "Ticker.Ticks", &TickRequest{Count: -1}) {
+		t.Fatal("unexpected message")
+	}
+
+	// Errors of the method end the stream.
+	ticks = nil
+	var rerr *Error
+	for tick, err := range CallStream[Tick](ctx, c, "Ticker.Ticks", &TickRequest{Count: 2, Fail: true}) {
+		if err != nil {
+			require.True(t, errors.As(err, &rerr), "%v", err)
+			break
+		}
+		ticks = append(ticks, tick.N)
+	}
+	require.Equal(t, []int{1, 2}, ticks)
+	require.Equal(t, CodeAborted, rerr.Code)
+
+	// Exiting the loop cancels the call.
+	for tick, err := range CallStream[Tick](ctx, c, "Ticker.Ticks", &TickRequest{}) {
+		require.NoError(t, err)
+		if tick.N == 10 {
+			break
+		}
+	}
+	require.Error(t, <-ticker.stopped)
+
+	// Streams can't be received as single responses.
+	err = c.Call(ctx, "Ticker.Ticks", &TickRequest{Count: 1}, &Tick{})
+	require.True(t, errors.As(err, &rerr), "%v", err)
+	require.Equal(t, CodeInvalidRequest, rerr.Code)
+}
+
+func TestStream_Close(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Ticker{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Errors returned once the stream is closed are dropped.
+	var ticks []int
+	for tick, err := range CallStream[Tick](ctx, c, "Ticker.Countdown", &TickRequest{Count: 2}) {
+		require.NoError(t, err)
+		ticks = append(ticks, tick.N)
+	}
+	require.Equal(t, []int{2, 1}, ticks)
+
+	// Streams can be closed with an error, even without messages.
+	var rerr *Error
+	for _, err := range CallStream[Tick](ctx, c, "Ticker.Countdown", &TickRequest{Fail: true}) {
+		require.True(t, errors.As(err, &rerr), "%v", err)
+	}
+	require.Equal(t, CodeAborted, rerr.Code)
+}
+
+func TestStream_ServerSentEvents(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Ticker{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"ServiceMethod":"Ticker.Countdown","Body":{"Count":2},"Seq":7}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", EventStreamContentType)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, EventStreamContentType, resp.Header.Get("Content-Type"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "retry: 5000\n"+
+		`data: {"ServiceMethod":"Ticker.Countdown","Body":{"N":2},"Seq":7,"More":true,"Error":"","Code":""}`+"\n\n"+
+		`data: {"ServiceMethod":"Ticker.Countdown","Body":{"N":1},"Seq":7,"More":true,"Error":"","Code":""}`+"\n\n"+
+		`data: {"ServiceMethod":"Ticker.Countdown","Body":{},"Seq":7,"Error":"","Code":""}`+"\n\n",
+		string(body))
+}
+
+func TestWithCompression(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Ticker{}))
+	require.NoError(t, s.Configure("Ticker.Countdown", WithCompression()))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// Go clients accept compressed streams transparently.
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	var ticks []int
+	for tick, err := range CallStream[Tick](context.Background(), c, "Ticker.Countdown", &TickRequest{Count: 3}) {
+		require.NoError(t, err)
+		ticks = append(ticks, tick.N)
+	}
+	require.Equal(t, []int{3, 2, 1}, ticks)
+
+	// Streams are only compressed for methods configured to, and callers
+	// accepting it.
+	tests := []struct {
+		method         string
+		acceptEncoding string
+		compressed     bool
+	}{
+		{"Ticker.Countdown", "gzip, deflate", true},
+		{"Ticker.Countdown", "gzip;q=0", false},
+		{"Ticker.Countdown", "", false},
+		{"Ticker.Ticks", "gzip", false},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"ServiceMethod":"`+tt.method+`","Body":{"Count":2},"Seq":1}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", NDJSONContentType)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		require.NoError(t, err)
+		body := io.Reader(resp.Body)
+		if tt.compressed {
+			require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+			body, err = gzip.NewReader(resp.Body)
+			require.NoError(t, err)
+		} else {
+			require.Empty(t, resp.Header.Get("Content-Encoding"))
+		}
+		b, err := ioutil.ReadAll(body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, 3, strings.Count(string(b), "\n"), "%s", b)
+	}
+}
+
+func TestWithStreamLimits(t *testing.T) {
+	s := New(WithStreamLimits(2, 1))
+	require.NoError(t, s.Register(&Ticker{stopped: make(chan error, 10)}))
+	require.NoError(t, s.Register(&Ingester{}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subject := r.Header.Get("X-Subject"); subject != "" {
+			r = r.WithContext(WithPrincipal(r.Context(), Principal{Subject: subject}))
+		}
+		s.Serve().ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	open := func(subject string) (func(), error) {
+		ctx := WithOutgoingHeader(context.Background(), "X-Subject", subject)
+		next, stop := iter.Pull2(CallStream[Tick](ctx, c, "Ticker.Ticks", &TickRequest{}))
+		_, err, _ := next()
+		if err != nil {
+			stop()
+		}
+		return stop, err
+	}
+	code := func(err error) string {
+		var rerr *Error
+		require.True(t, errors.As(err, &rerr), "%v", err)
+		return rerr.Code
+	}
+
+	// Clients can only open so many streams each.
+	stop, err := open("alice")
+	require.NoError(t, err)
+	_, err = open("alice")
+	require.Equal(t, CodeTooManyStreams, code(err))
+	stopBob, err := open("bob")
+	require.NoError(t, err)
+	defer stopBob()
+
+	// And the service so many in all, of requests as well.
+	_, err = open("carol")
+	require.Equal(t, CodeTooManyStreams, code(err))
+	ctx := WithOutgoingHeader(context.Background(), "X-Subject", "carol")
+	ingest, err := OpenClientStream[Record](ctx, c, "Ingester.Ingest", &IngestResponse{})
+	require.NoError(t, err)
+	require.Equal(t, CodeTooManyStreams, code(ingest.Close()))
+
+	// Streams count until they are closed.
+	stop()
+	require.Eventually(t, func() bool {
+		stop, err := open("carol")
+		if err == nil {
+			stop()
+		}
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,138 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	// StreamStore persists the events published to named streams, so
+	// callers that were offline can catch up on the events they missed,
+	// from the offset of the last one they received, see CatchUp. Stores
+	// shared by every replica, and persisted, let callers catch up from
+	// any replica, and across restarts.
+	StreamStore interface {
+		// Append appends an event to the stream, and returns its offset.
+		// The offsets of a stream start at 1, and increase by 1.
+		Append(ctx context.Context, stream string, body json.RawMessage) (uint64, error)
+		// Read returns up to limit events of the stream, in order, from
+		// the given offset on. Trimmed events are skipped.
+		Read(ctx context.Context, stream string, offset uint64, limit int) ([]StreamEvent, error)
+		// Trim discards the events of the stream before the given offset.
+		Trim(ctx context.Context, stream string, offset uint64) error
+	}
+	// StreamEvent is an event published to a stream.
+	StreamEvent struct {
+		Offset uint64
+		Body   json.RawMessage
+		Time   time.Time
+	}
+)
+
+// catchUpBatch is how many events CatchUp reads from the store at once.
+const catchUpBatch = 100
+
+// CatchUp sends the events of the named stream of the store, from the
+// given offset on, to the caller, and returns the offset following the
+// last one sent, from which the stream can be caught up on again. Events
+// are decoded from JSON into messages of type T.
+func CatchUp[T any](ctx context.Context, store StreamStore, name string, offset uint64, stream *Stream[T]) (uint64, error) {
+	for {
+		events, err := store.Read(ctx, name, offset, catchUpBatch)
+		if err != nil {
+			return offset, err
+		}
+		for _, e := range events {
+			var v T
+			if err := json.Unmarshal(e.Body, &v); err != nil {
+				return offset, fmt.Errorf("rpc: error decoding event %d of %s: %v", e.Offset, name, err)
+			}
+			if err := stream.Send(ctx, v); err != nil {
+				return offset, err
+			}
+			offset = e.Offset + 1
+		}
+		if len(events) < catchUpBatch {
+			return offset, nil
+		}
+	}
+}
+
+type (
+	// MemoryStreamStore is a StreamStore keeping events in memory, for
+	// services with a single replica.
+	MemoryStreamStore struct {
+		mu      sync.Mutex
+		streams map[string]*memoryStream
+	}
+	memoryStream struct {
+		events []StreamEvent // from the oldest not trimmed
+		next   uint64        // offset of the next event
+	}
+)
+
+// NewMemoryStreamStore returns an empty in-memory store.
+func NewMemoryStreamStore() *MemoryStreamStore {
+	return &MemoryStreamStore{
+		streams: map[string]*memoryStream{},
+	}
+}
+
+// Append implements StreamStore.
+func (s *MemoryStreamStore) Append(ctx context.Context, stream string, body json.RawMessage) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.streams[stream]
+	if !ok {
+		st = &memoryStream{next: 1}
+		s.streams[stream] = st
+	}
+	e := StreamEvent{
+		Offset: st.next,
+		Body:   append(json.RawMessage(nil), body...),
+		Time:   time.Now().UTC(),
+	}
+	st.events = append(st.events, e)
+	st.next++
+	return e.Offset, nil
+}
+
+// Read implements StreamStore.
+func (s *MemoryStreamStore) Read(ctx context.Context, stream string, offset uint64, limit int) ([]StreamEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.streams[stream]
+	if !ok {
+		return nil, nil
+	}
+	events := st.events[st.index(offset):]
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return append([]StreamEvent(nil), events...), nil
+}
+
+// Trim implements StreamStore.
+func (s *MemoryStreamStore) Trim(ctx context.Context, stream string, offset uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.streams[stream]
+	if !ok {
+		return nil
+	}
+	// Copy the events kept, so the trimmed ones can be collected.
+	st.events = append([]StreamEvent(nil), st.events[st.index(offset):]...)
+	return nil
+}
+
+// index returns the index of the event at the offset, or of the first one
+// after it if it was trimmed.
+func (st *memoryStream) index(offset uint64) int {
+	if len(st.events) == 0 || offset <= st.events[0].Offset {
+		return 0
+	}
+	return int(min(offset-st.events[0].Offset, uint64(len(st.events))))
+}
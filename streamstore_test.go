@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Feed streams the ticks published to its store.
+type Feed struct {
+	store StreamStore
+}
+
+type FeedRequest struct {
+	Offset uint64
+}
+
+func (f *Feed) Ticks(ctx context.Context, req *FeedRequest, stream *Stream[Tick]) error {
+	_, err := CatchUp(ctx, f.store, "ticks", req.Offset, stream)
+	return err
+}
+
+func TestMemoryStreamStore(t *testing.T) {
+	store := NewMemoryStreamStore()
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		offset, err := store.Append(ctx, "ticks", json.RawMessage(`{"N":`+strconv.Itoa(i)+`}`))
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), offset)
+	}
+	offset, err := store.Append(ctx, "other", json.RawMessage(`{}`))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), offset)
+
+	offsets := func(events []StreamEvent) []uint64 {
+		var offsets []uint64
+		for _, e := range events {
+			offsets = append(offsets, e.Offset)
+		}
+		return offsets
+	}
+
+	// Events are read from an offset, up to a limit.
+	events, err := store.Read(ctx, "ticks", 2, 2)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2, 3}, offsets(events))
+	require.JSONEq(t, `{"N":2}`, string(events[0].Body))
+	events, err = store.Read(ctx, "ticks", 6, 10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+	events, err = store.Read(ctx, "missing", 1, 10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	// Trimmed events are skipped, and offsets aren't reused.
+	require.NoError(t, store.Trim(ctx, "ticks", 4))
+	events, err = store.Read(ctx, "ticks", 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{4, 5}, offsets(events))
+	offset, err = store.Append(ctx, "ticks", json.RawMessage(`{"N":6}`))
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), offset)
+	require.NoError(t, store.Trim(ctx, "ticks", 10))
+	events, err = store.Read(ctx, "ticks", 1, 10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func TestCatchUp(t *testing.T) {
+	store := NewMemoryStreamStore()
+	ctx := context.Background()
+	for i := 1; i <= 2*catchUpBatch+10; i++ {
+		b, err := json.Marshal(Tick{N: i})
+		require.NoError(t, err)
+		_, err = store.Append(ctx, "ticks", b)
+		require.NoError(t, err)
+	}
+
+	s := New()
+	require.NoError(t, s.Register(&Feed{store: store}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+
+	// Callers catch up from the offset they last received.
+	var ticks []int
+	for tick, err := range CallStream[Tick](ctx, c, "Feed.Ticks", &FeedRequest{Offset: 5}) {
+		require.NoError(t, err)
+		ticks = append(ticks, tick.N)
+	}
+	require.Len(t, ticks, 2*catchUpBatch+6)
+	require.Equal(t, 5, ticks[0])
+	require.Equal(t, 2*catchUpBatch+10, ticks[len(ticks)-1])
+}
@@ -0,0 +1,143 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+)
+
+// TenantHeader is the request header carrying the tenant of a call, by
+// default.
+const TenantHeader = "Rpc-Tenant"
+
+type (
+	// Tenancy isolates the tenants served by a service. Its middleware
+	// finds the tenant of each call, and applies the tenant's
+	// configuration to it.
+	Tenancy struct {
+		// Tenant returns the tenant of a call, defaults to the value of
+		// the TenantHeader. Deriving it from the principal, eg. with a
+		// claim, prevents callers from picking any tenant.
+		Tenant func(ctx context.Context) string
+		// Required rejects calls without a tenant.
+		Required bool
+		// Strict rejects calls from tenants that aren't configured.
+		Strict bool
+
+		mu      sync.RWMutex
+		tenants map[string]*Tenant
+	}
+	// Tenant is the configuration of a tenant.
+	Tenant struct {
+		// Methods the tenant can call, all if empty.
+		Methods []string
+		// Options override the configuration of methods for the tenant,
+		// eg. WithTimeout or WithPriority. Roles are enforced before
+		// tenancy, so they can't be overridden.
+		Options map[string][]MethodOption
+		// Middleware applied to the tenant's calls, eg. a Quota of its
+		// own, after the service's.
+		Middleware []Middleware
+		// Service, if set, handles the tenant's calls instead, with its
+		// own implementations and middleware. Methods must also be
+		// registered on the main service, which defines the API.
+		Service *Service
+
+		methods map[string]bool
+	}
+	tenantKey struct{}
+)
+
+// Set configures the tenant, replacing its previous configuration.
+func (t *Tenancy) Set(tenant string, cfg *Tenant) {
+	cfg.methods = map[string]bool{}
+	for _, m := range cfg.Methods {
+		cfg.methods[m] = true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tenants == nil {
+		t.tenants = map[string]*Tenant{}
+	}
+	t.tenants[tenant] = cfg
+}
+
+// Remove removes the configuration of the tenant.
+func (t *Tenancy) Remove(tenant string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.tenants, tenant)
+}
+
+// Middleware returns the middleware applying the configuration of each
+// call's tenant, which methods can find with TenantFromContext.
+// Calls without a tenant when one is required, from tenants that aren't
+// configured in strict mode, and to methods the tenant can't call fail
+// with CodePermissionDenied.
+func (t *Tenancy) Middleware(next Handler) Handler {
+	return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		tenant := t.tenant(ctx)
+		if tenant == "" {
+			if t.Required {
+				return nil, &Error{
+					Code:    CodePermissionDenied,
+					Message: "permission denied: missing tenant",
+				}
+			}
+			return next(ctx, m, req)
+		}
+		ctx = WithTenant(ctx, tenant)
+
+		t.mu.RLock()
+		cfg, ok := t.tenants[tenant]
+		t.mu.RUnlock()
+		if !ok {
+			if t.Strict {
+				return nil, &Error{
+					Code:    CodePermissionDenied,
+					Message: "permission denied: unknown tenant " + tenant,
+				}
+			}
+			return next(ctx, m, req)
+		}
+
+		if len(cfg.methods) > 0 && !cfg.methods[m.Name] {
+			return nil, &Error{
+				Code:    CodePermissionDenied,
+				Message: "permission denied: method not available to tenant " + tenant,
+			}
+		}
+		h := next
+		if cfg.Service != nil {
+			tm, ok := cfg.Service.method(m.Name)
+			if !ok {
+				return nil, ErrMethodNotFound
+			}
+			m, h = tm, cfg.Service.handler()
+		}
+		for _, opt := range cfg.Options[m.Name] {
+			opt(&m)
+		}
+		for i := len(cfg.Middleware) - 1; i >= 0; i-- {
+			h = cfg.Middleware[i](h)
+		}
+		return h(ctx, m, req)
+	}
+}
+
+func (t *Tenancy) tenant(ctx context.Context) string {
+	if t.Tenant != nil {
+		return t.Tenant(ctx)
+	}
+	return HeaderFromContext(ctx).Get(TenantHeader)
+}
+
+// WithTenant returns a context carrying the tenant of a call.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of the call being served, if any.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type doubleMath struct{}
+
+func (m *doubleMath) Add(req *AddRequest, res *AddResponse) error {
+	res.X = 2 * (req.A + req.B)
+	return nil
+}
+
+func tenantContext(tenant string) context.Context {
+	h := http.Header{}
+	if tenant != "" {
+		h.Set(TenantHeader, tenant)
+	}
+	return context.WithValue(context.Background(), headerKey{}, h)
+}
+
+func TestTenancy(t *testing.T) {
+	tenancy := &Tenancy{Required: true, Strict: true}
+	s := New(WithMiddleware(tenancy.Middleware))
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Register(&Clock{}))
+
+	// Tenant "a" can only add.
+	tenancy.Set("a", &Tenant{Methods: []string{"Math.Add"}})
+	// Tenant "b" has a quota of a single call, and a timeout.
+	tenancy.Set("b", &Tenant{
+		Options: map[string][]MethodOption{
+			"Clock.Remaining": {WithTimeout(time.Minute)},
+		},
+		Middleware: []Middleware{(&Quota{
+			Limit:  1,
+			Window: time.Hour,
+			Key:    TenantFromContext,
+		}).Middleware},
+	})
+	// Tenant "c" has its own implementation.
+	tenantService := New()
+	require.NoError(t, tenantService.RegisterName("Math", &doubleMath{}))
+	tenancy.Set("c", &Tenant{Service: tenantService})
+
+	call := func(tenant, method string) (*Response, error) {
+		return s.callContext(tenantContext(tenant), &Request{
+			ServiceMethod: method,
+			Body:          []byte(`{"A":1,"B":2}`),
+		})
+	}
+	code := func(err error) string {
+		var rerr *Error
+		require.True(t, errors.As(err, &rerr), "%v", err)
+		return rerr.Code
+	}
+
+	_, err := call("", "Math.Add")
+	require.Equal(t, CodePermissionDenied, code(err))
+	_, err = call("unknown", "Math.Add")
+	require.Equal(t, CodePermissionDenied, code(err))
+
+	res, err := call("a", "Math.Add")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":3}`, string(res.Body))
+	_, err = call("a", "Clock.Remaining")
+	require.Equal(t, CodePermissionDenied, code(err))
+
+	res, err = call("b", "Clock.Remaining")
+	require.NoError(t, err)
+	require.Contains(t, string(res.Body), `"Deadline":true`)
+	_, err = call("b", "Clock.Remaining")
+	require.Equal(t, CodeQuotaExceeded, code(err))
+
+	res, err = call("c", "Math.Add")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":6}`, string(res.Body))
+	_, err = call("c", "Clock.Remaining")
+	require.ErrorIs(t, err, ErrMethodNotFound)
+
+	tenancy.Remove("a")
+	_, err = call("a", "Math.Add")
+	require.Equal(t, CodePermissionDenied, code(err))
+}
+
+func TestTenantFromContext(t *testing.T) {
+	require.Equal(t, "", TenantFromContext(context.Background()))
+	require.Equal(t, "a", TenantFromContext(WithTenant(context.Background(), "a")))
+}
@@ -0,0 +1,24 @@
+// Command plugin is a Go plugin exporting a service, for PluginLoader
+// tests.
+package main
+
+type (
+	Greeter      struct{}
+	GreetRequest struct {
+		Name string
+	}
+	GreetResponse struct {
+		Greeting string
+	}
+)
+
+func (g *Greeter) Greet(req *GreetRequest, res *GreetResponse) error {
+	res.Greeting = "Hello, " + req.Name
+	return nil
+}
+
+var Services = map[string]interface{}{
+	"Greeter": &Greeter{},
+}
+
+func main() {}
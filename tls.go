@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloadInterval is how often certificate files are checked for
+// changes.
+const certReloadInterval = 10 * time.Second
+
+// certReloader serves a certificate loaded from files, reloading it when
+// the files change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// WithTLSCertificate serves TLS using the certificate and key in the given
+// PEM files. The files are checked for changes periodically and reloaded,
+// so certificates can be rotated without restarting the server.
+func WithTLSCertificate(certFile, keyFile string) ServerOption {
+	return func(o *serverOptions) {
+		r := &certReloader{
+			certFile: certFile,
+			keyFile:  keyFile,
+			interval: certReloadInterval,
+		}
+		o.tls().GetCertificate = r.GetCertificate
+	}
+}
+
+// WithClientCAs requires clients to present a certificate signed by one of
+// the given CAs.
+func WithClientCAs(pool *x509.CertPool) ServerOption {
+	return func(o *serverOptions) {
+		cfg := o.tls()
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+}
+
+// WithMinTLSVersion sets the minimum TLS version accepted, defaults to
+// TLS 1.2.
+func WithMinTLSVersion(v uint16) ServerOption {
+	return func(o *serverOptions) {
+		o.tls().MinVersion = v
+	}
+}
+
+// WithNextProtos sets the protocols advertised via ALPN, in order of
+// preference.
+func WithNextProtos(protos ...string) ServerOption {
+	return func(o *serverOptions) {
+		o.tls().NextProtos = protos
+	}
+}
+
+// tls returns the server's TLS configuration, enabling TLS.
+func (o *serverOptions) tls() *tls.Config {
+	if o.server.TLSConfig == nil {
+		o.server.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	return o.server.TLSConfig
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert != nil && time.Since(r.checked) < r.interval {
+		return r.cert, nil
+	}
+	r.checked = time.Now()
+
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// Keep serving the current certificate, the files might
+			// be in the middle of being replaced.
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("rpc: error loading certificate: %v", err)
+	}
+	if r.cert != nil && !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("rpc: error loading certificate: %v", err)
+	}
+
+	r.cert = &cert
+	r.modTime = modTime
+	return r.cert, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	latest := time.Time{}
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,487 @@
+// Command codegen generates server registration glue and a typed client
+// for a service defined as a Go interface, or a dispatch table for a
+// service struct.
+//
+// Every method of the interface must have the shape
+//
+//	Method(ctx context.Context, req *Request) (*Response, error)
+//
+// Usage, next to the interface definition:
+//
+//	//go:generate go run github.com/geoah/go-rpc/tools/codegen -type MathService
+//
+// For an interface MathService this generates RegisterMathService, which
+// registers an implementation under the service name "Math", and
+// MathServiceClient, which implements MathService by calling a remote
+// service. Since the client implements the interface, client and server
+// can't drift apart without the build failing.
+//
+// For a struct, such as the Math of:
+//
+//	//go:generate go run github.com/geoah/go-rpc/tools/codegen -type Math
+//
+// it generates a DispatchRPC method, implementing rpc.Dispatcher, through
+// which services call the methods of the struct with a switch on their
+// name, rather than with reflection. The generated server of interfaces
+// implements it too.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+type (
+	service struct {
+		Package   string
+		Interface string
+		Name      string
+		Receiver  string // of DispatchRPC, e.g. *MathServiceServer
+		Imports   []string
+		Methods   []method
+	}
+	method struct {
+		Name         string
+		RequestType  string // e.g. *AddRequest
+		ResponseType string // e.g. *AddResponse
+		TakesContext bool
+	}
+)
+
+// dispatchTmpl generates the DispatchRPC method of a service.
+const dispatchTmpl = `{{ define "dispatch" -}}
+var _ rpc.Dispatcher = ({{ .Receiver }})(nil)
+
+// DispatchRPC calls the method with the given name without reflection.
+func (s {{ .Receiver }}) DispatchRPC(ctx context.Context, method string, decode func(req interface{}) error) (interface{}, bool, error) {
+	switch method {
+{{- range .Methods }}
+	case "{{ .Name }}":
+		req := new({{ slice .RequestType 1 }})
+		if err := decode(req); err != nil {
+			return nil, true, err
+		}
+		res := new({{ slice .ResponseType 1 }})
+		err := s.{{ .Name }}({{ if .TakesContext }}ctx, {{ end }}req, res)
+		return res, true, err
+{{- end }}
+	}
+	return nil, false, nil
+}
+{{ end }}`
+
+var structTmpl = template.Must(template.New("").Parse(dispatchTmpl + `// Code generated by codegen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"context"
+{{ range .Imports }}
+	{{ . }}
+{{- end }}
+
+	rpc "github.com/geoah/go-rpc"
+)
+
+{{ template "dispatch" . }}`))
+
+var tmpl = template.Must(template.New("").Parse(dispatchTmpl + `// Code generated by codegen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"context"
+{{ range .Imports }}
+	{{ . }}
+{{- end }}
+
+	rpc "github.com/geoah/go-rpc"
+)
+
+// {{ .Interface }}Server adapts a {{ .Interface }} to the method shape
+// expected by rpc.Service.
+type {{ .Interface }}Server struct {
+	impl {{ .Interface }}
+}
+
+{{ range .Methods -}}
+func (s *{{ $.Interface }}Server) {{ .Name }}(ctx context.Context, req {{ .RequestType }}, res {{ .ResponseType }}) error {
+	r, err := s.impl.{{ .Name }}(ctx, req)
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		*res = *r
+	}
+	return nil
+}
+
+{{ end -}}
+
+{{ template "dispatch" . }}
+// Register{{ .Interface }} registers the methods of impl under the
+// "{{ .Name }}" service name.
+func Register{{ .Interface }}(s *rpc.Service, impl {{ .Interface }}) error {
+	return s.RegisterName("{{ .Name }}", &{{ .Interface }}Server{impl: impl})
+}
+
+// {{ .Interface }}Client calls the methods of a remote {{ .Interface }}.
+type {{ .Interface }}Client struct {
+	client *rpc.Client
+}
+
+var _ {{ .Interface }} = (*{{ .Interface }}Client)(nil)
+
+// New{{ .Interface }}Client returns a {{ .Interface }} calling the
+// service through the given client.
+func New{{ .Interface }}Client(client *rpc.Client) *{{ .Interface }}Client {
+	return &{{ .Interface }}Client{client: client}
+}
+
+{{ range .Methods -}}
+func (c *{{ $.Interface }}Client) {{ .Name }}(ctx context.Context, req {{ .RequestType }}) ({{ .ResponseType }}, error) {
+	res := new({{ slice .ResponseType 1 }})
+	if err := c.client.Call(ctx, "{{ $.Name }}.{{ .Name }}", req, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+{{ end -}}
+`))
+
+func main() {
+	typeName := flag.String("type", "", "name of the service interface or struct")
+	name := flag.String("service", "", `service name, defaults to the interface name without a "Service" suffix`)
+	output := flag.String("output", "", "output file, defaults to <type>_rpc.go")
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix("codegen: ")
+
+	if *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output == "" {
+		*output = strings.ToLower(*typeName) + "_rpc.go"
+	}
+
+	dir := "."
+	if args := flag.Args(); len(args) > 0 {
+		dir = args[0]
+	}
+
+	src, err := generate(dir, *typeName, *name)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, *output), src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate returns the glue code for the interface typeName defined in the
+// package in dir, or the dispatch table of the struct typeName.
+func generate(dir, typeName, name string) ([]byte, error) {
+	if name == "" {
+		name = strings.TrimSuffix(typeName, "Service")
+	}
+
+	fset := token.NewFileSet()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []*ast.File{}
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if isGenerated(f) {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	for _, f := range files {
+		iface, isStruct := findType(f, typeName)
+		if isStruct {
+			svc, err := parseStruct(fset, files, typeName)
+			if err != nil {
+				return nil, err
+			}
+			return execute(structTmpl, svc)
+		}
+		if iface == nil {
+			continue
+		}
+		svc, err := parseService(fset, f, iface)
+		if err != nil {
+			return nil, err
+		}
+		svc.Interface = typeName
+		svc.Name = name
+		svc.Receiver = "*" + typeName + "Server"
+		return execute(tmpl, svc)
+	}
+
+	return nil, fmt.Errorf("interface or struct %s not found in %s", typeName, dir)
+}
+
+func execute(tmpl *template.Template, svc *service) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, svc); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// isGenerated returns whether f is generated code, such as the output of
+// previous runs.
+func isGenerated(f *ast.File) bool {
+	for _, c := range f.Comments {
+		if c.Pos() > f.Package {
+			break
+		}
+		for _, line := range c.List {
+			if strings.HasPrefix(line.Text, "// Code generated ") && strings.HasSuffix(line.Text, " DO NOT EDIT.") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findType returns the interface typeName defined in f, or whether it's
+// a struct.
+func findType(f *ast.File, typeName string) (*ast.InterfaceType, bool) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if ts.Name.Name != typeName {
+				continue
+			}
+			switch t := ts.Type.(type) {
+			case *ast.InterfaceType:
+				return t, false
+			case *ast.StructType:
+				return nil, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// parseStruct returns the service of the methods of the struct typeName
+// defined in files which have the shape rpc.Service registers:
+//
+//	Method([ctx context.Context,] req *Request, res *Response) error
+//
+// Other methods are left out.
+func parseStruct(fset *token.FileSet, files []*ast.File, typeName string) (*service, error) {
+	svc := &service{
+		Package:  files[0].Name.Name,
+		Receiver: typeName,
+	}
+	used := map[string]bool{}
+	for _, f := range files {
+		imports := importSpecs(f)
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 || !fn.Name.IsExported() {
+				continue
+			}
+			recv := fn.Recv.List[0].Type
+			star, isPtr := recv.(*ast.StarExpr)
+			if isPtr {
+				recv = star.X
+			}
+			if ident, ok := recv.(*ast.Ident); !ok || ident.Name != typeName {
+				continue
+			}
+
+			params := flatten(fn.Type.Params)
+			results := flatten(fn.Type.Results)
+			m := method{Name: fn.Name.Name}
+			if len(params) == 3 && expr(fset, params[0]) == "context.Context" {
+				m.TakesContext = true
+				params = params[1:]
+			}
+			if len(params) != 2 || len(results) != 1 || expr(fset, results[0]) != "error" {
+				continue
+			}
+			pkgs, ok := pointerPackages(params...)
+			if !ok {
+				continue
+			}
+			for _, pkg := range pkgs {
+				spec, ok := imports[pkg]
+				if !ok {
+					return nil, fmt.Errorf("import for %s not found", pkg)
+				}
+				used[spec] = true
+			}
+			if isPtr {
+				svc.Receiver = "*" + typeName
+			}
+			m.RequestType = expr(fset, params[0])
+			m.ResponseType = expr(fset, params[1])
+			svc.Methods = append(svc.Methods, m)
+		}
+	}
+	if len(svc.Methods) == 0 {
+		return nil, fmt.Errorf("%s has no methods of the shape func([context.Context,] *Request, *Response) error", typeName)
+	}
+	sort.Slice(svc.Methods, func(i, j int) bool {
+		return svc.Methods[i].Name < svc.Methods[j].Name
+	})
+
+	for spec := range used {
+		svc.Imports = append(svc.Imports, spec)
+	}
+	sort.Strings(svc.Imports)
+
+	return svc, nil
+}
+
+// importSpecs returns the import specs of f, by the name they are referred
+// to with.
+func importSpecs(f *ast.File) map[string]string {
+	imports := map[string]string{}
+	for _, imp := range f.Imports {
+		path := strings.Trim(imp.Path.Value, `"`)
+		name := filepath.Base(path)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		spec := imp.Path.Value
+		if imp.Name != nil {
+			spec = imp.Name.Name + " " + spec
+		}
+		imports[name] = spec
+	}
+	return imports
+}
+
+// pointerPackages returns the packages the given types refer to, or false
+// if they aren't all pointers.
+func pointerPackages(types ...ast.Expr) ([]string, bool) {
+	pkgs := []string{}
+	for _, t := range types {
+		star, ok := t.(*ast.StarExpr)
+		if !ok {
+			return nil, false
+		}
+		if sel, ok := star.X.(*ast.SelectorExpr); ok {
+			if pkg, ok := sel.X.(*ast.Ident); ok {
+				pkgs = append(pkgs, pkg.Name)
+			}
+		}
+	}
+	return pkgs, true
+}
+
+func parseService(fset *token.FileSet, f *ast.File, iface *ast.InterfaceType) (*service, error) {
+	svc := &service{
+		Package: f.Name.Name,
+	}
+
+	imports := importSpecs(f)
+	used := map[string]bool{}
+
+	for _, field := range iface.Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) != 1 {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported", fset.Position(field.Pos()))
+		}
+		name := field.Names[0].Name
+		pos := fset.Position(field.Pos())
+
+		params := flatten(fn.Params)
+		results := flatten(fn.Results)
+		if len(params) != 2 || len(results) != 2 {
+			return nil, fmt.Errorf("%s: %s must have the shape func(context.Context, *Request) (*Response, error)", pos, name)
+		}
+		if expr(fset, params[0]) != "context.Context" {
+			return nil, fmt.Errorf("%s: first argument of %s must be a context.Context", pos, name)
+		}
+		if expr(fset, results[1]) != "error" {
+			return nil, fmt.Errorf("%s: %s must return an error", pos, name)
+		}
+
+		m := method{
+			Name:         name,
+			RequestType:  expr(fset, params[1]),
+			ResponseType: expr(fset, results[0]),
+			TakesContext: true,
+		}
+		pkgs, ok := pointerPackages(params[1], results[0])
+		if !ok {
+			return nil, fmt.Errorf("%s: request and response of %s must be pointers", pos, name)
+		}
+		for _, pkg := range pkgs {
+			used[pkg] = true
+		}
+		svc.Methods = append(svc.Methods, m)
+	}
+
+	for name := range used {
+		spec, ok := imports[name]
+		if !ok {
+			return nil, fmt.Errorf("import for %s not found", name)
+		}
+		svc.Imports = append(svc.Imports, spec)
+	}
+	sort.Strings(svc.Imports)
+
+	return svc, nil
+}
+
+// flatten returns the type of each parameter in the list, repeating types
+// shared by several names.
+func flatten(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	types := []ast.Expr{}
+	for _, f := range fields.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			types = append(types, f.Type)
+		}
+	}
+	return types
+}
+
+func expr(fset *token.FileSet, e ast.Expr) string {
+	buf := &bytes.Buffer{}
+	_ = printer.Fprint(buf, fset, e)
+	return buf.String()
+}
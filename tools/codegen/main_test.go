@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	src, err := generate("testdata/mathsvc", "MathService", "")
+	require.NoError(t, err)
+
+	code := string(src)
+	require.Contains(t, code, "package mathsvc")
+	require.Contains(t, code, `"time"`)
+	require.Contains(t, code, `return s.RegisterName("Math", &MathServiceServer{impl: impl})`)
+	require.Contains(t, code, "func (s *MathServiceServer) Add(ctx context.Context, req *AddRequest, res *AddResponse) error {")
+	require.Contains(t, code, "func (c *MathServiceClient) Now(ctx context.Context, req *NowRequest) (*time.Time, error) {")
+	require.Contains(t, code, `c.client.Call(ctx, "Math.Add", req, res)`)
+	require.Contains(t, code, "func (s *MathServiceServer) DispatchRPC(")
+	require.Contains(t, code, "err := s.Add(ctx, req, res)")
+}
+
+func TestGenerate_InvalidShape(t *testing.T) {
+	_, err := generate("testdata/invalid", "BadService", "")
+	require.Error(t, err)
+}
+
+func TestGenerate_Struct(t *testing.T) {
+	src, err := generate("testdata/mathstruct", "Math", "")
+	require.NoError(t, err)
+
+	code := string(src)
+	require.Contains(t, code, "package mathstruct")
+	require.Contains(t, code, `"time"`)
+	require.Contains(t, code, "var _ rpc.Dispatcher = (*Math)(nil)")
+	require.Contains(t, code, "func (s *Math) DispatchRPC(ctx context.Context, method string, decode func(req interface{}) error) (interface{}, bool, error) {")
+	require.Contains(t, code, "err := s.Add(ctx, req, res)")
+	require.Contains(t, code, "res := new(time.Time)")
+	require.Contains(t, code, "err := s.Now(req, res)")
+	require.NotContains(t, code, "Helper")
+}
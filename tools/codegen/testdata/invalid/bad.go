@@ -0,0 +1,5 @@
+package invalid
+
+type BadService interface {
+	Add(a, b int) int
+}
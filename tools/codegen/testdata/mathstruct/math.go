@@ -0,0 +1,32 @@
+package mathstruct
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	Math       struct{}
+	AddRequest struct {
+		A, B int
+	}
+	AddResponse struct {
+		X int
+	}
+	NowRequest struct{}
+)
+
+func (m *Math) Add(ctx context.Context, req *AddRequest, res *AddResponse) error {
+	res.X = req.A + req.B
+	return nil
+}
+
+func (m *Math) Now(req *NowRequest, res *time.Time) error {
+	*res = time.Now()
+	return nil
+}
+
+// Helper doesn't have the shape of methods and is left out.
+func (m *Math) Helper(a, b int) int {
+	return a + b
+}
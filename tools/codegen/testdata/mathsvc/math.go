@@ -0,0 +1,20 @@
+package mathsvc
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	MathService interface {
+		Add(ctx context.Context, req *AddRequest) (*AddResponse, error)
+		Now(ctx context.Context, req *NowRequest) (*time.Time, error)
+	}
+	AddRequest struct {
+		A, B int
+	}
+	AddResponse struct {
+		X int
+	}
+	NowRequest struct{}
+)
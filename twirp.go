@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// TwirpPrefix is the path prefix Twirp routes are served under.
+const TwirpPrefix = "/twirp/"
+
+// twirpCodes maps error codes to Twirp error codes.
+var twirpCodes = map[string]string{
+	CodeInvalidRequest:   "invalid_argument",
+	CodePermissionDenied: "permission_denied",
+	CodeUnauthenticated:  "unauthenticated",
+	CodeQuotaExceeded:    "resource_exhausted",
+	CodeUnavailable:      "unavailable",
+	CodeDeadlineExceeded: "deadline_exceeded",
+	CodeCanceled:         "canceled",
+	CodeRequestTooLarge:  "malformed",
+}
+
+// twirpStatus maps Twirp error codes to the HTTP status they are served
+// with, as defined by the Twirp protocol.
+var twirpStatus = map[string]int{
+	"bad_route":          http.StatusNotFound,
+	"malformed":          http.StatusBadRequest,
+	"invalid_argument":   http.StatusBadRequest,
+	"permission_denied":  http.StatusForbidden,
+	"unauthenticated":    http.StatusUnauthorized,
+	"resource_exhausted": http.StatusTooManyRequests,
+	"unavailable":        http.StatusServiceUnavailable,
+	"deadline_exceeded":  http.StatusRequestTimeout,
+	"canceled":           http.StatusRequestTimeout,
+	"internal":           http.StatusInternalServerError,
+}
+
+// TwirpHandler returns a handler exposing the registered methods using
+// Twirp's JSON protocol, so existing Twirp clients can call them.
+// The method Service.Method is served at /twirp/<pkg>.Service/Method, or
+// /twirp/Service/Method if pkg is empty, and errors are returned as Twirp
+// error objects.
+// Only JSON is supported, so the service must use the JSONCodec.
+func (s *Service) TwirpHandler(pkg string) http.Handler {
+	prefix := TwirpPrefix
+	if pkg != "" {
+		prefix += pkg + "."
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeTwirpError(w, "bad_route", "unsupported method "+r.Method, nil)
+			return
+		}
+
+		contentType := r.Header.Get("Content-Type")
+		if i := strings.Index(contentType, ";"); i >= 0 {
+			contentType = contentType[:i]
+		}
+		if contentType != "application/json" {
+			writeTwirpError(w, "bad_route", "unsupported Content-Type "+contentType, nil)
+			return
+		}
+
+		route := strings.TrimPrefix(r.URL.Path, prefix)
+		if route == r.URL.Path || strings.Count(route, "/") != 1 {
+			writeTwirpError(w, "bad_route", "no handler for path "+r.URL.Path, nil)
+			return
+		}
+
+		body, err := s.readRequest(r)
+		if err != nil {
+			writeTwirpErrorFrom(w, err)
+			return
+		}
+
+		req := &Request{
+			ServiceMethod: strings.Replace(route, "/", ".", 1),
+			Body:          body,
+		}
+		res, err := s.dispatch(r, req)
+		if errors.Is(err, ErrMethodNotFound) {
+			writeTwirpError(w, "bad_route", "no handler for path "+r.URL.Path, nil)
+			return
+		}
+		if err != nil {
+			writeTwirpErrorFrom(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(res.Body)
+	})
+}
+
+// writeTwirpErrorFrom writes the given error as a Twirp error.
+func writeTwirpErrorFrom(w http.ResponseWriter, err error) {
+	code := "internal"
+	var meta map[string]string
+	var rerr *Error
+	if errors.As(err, &rerr) {
+		if c, ok := twirpCodes[rerr.Code]; ok {
+			code = c
+		}
+		meta = rerr.Details
+	}
+	writeTwirpError(w, code, err.Error(), meta)
+}
+
+func writeTwirpError(w http.ResponseWriter, code, msg string, meta map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(twirpStatus[code])
+	_ = json.NewEncoder(w).Encode(struct {
+		Code string            `json:"code"`
+		Msg  string            `json:"msg"`
+		Meta map[string]string `json:"meta,omitempty"`
+	}{
+		Code: code,
+		Msg:  msg,
+		Meta: meta,
+	})
+}
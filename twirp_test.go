@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_TwirpHandler(t *testing.T) {
+	s := New(WithAuthorizer(RoleAuthorizer{}))
+	require.NoError(t, s.Register(&Math{}))
+	require.NoError(t, s.Register(&Clock{}))
+	require.NoError(t, s.Configure("Clock.Remaining", WithRoles("admin")))
+	srv := httptest.NewServer(s.TwirpHandler("example.v1"))
+	defer srv.Close()
+
+	post := func(path, body string) (int, map[string]interface{}) {
+		resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		res := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return resp.StatusCode, res
+	}
+
+	status, res := post("/twirp/example.v1.Math/Add", `{"A":1,"B":2}`)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, float64(3), res["X"])
+
+	status, res = post("/twirp/example.v1.Math/Sub", `{}`)
+	require.Equal(t, http.StatusNotFound, status)
+	require.Equal(t, "bad_route", res["code"])
+
+	status, res = post("/twirp/other.Math/Add", `{}`)
+	require.Equal(t, http.StatusNotFound, status)
+	require.Equal(t, "bad_route", res["code"])
+
+	status, res = post("/twirp/example.v1.Math/Add", `nope`)
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Equal(t, "invalid_argument", res["code"])
+
+	status, res = post("/twirp/example.v1.Clock/Remaining", `{}`)
+	require.Equal(t, http.StatusForbidden, status)
+	require.Equal(t, "permission_denied", res["code"])
+}
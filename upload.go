@@ -0,0 +1,159 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+)
+
+// DefaultMaxUploadMemory is the size of the uploaded files of a call kept
+// in memory, larger files are stored in temporary files.
+const DefaultMaxUploadMemory = 32 << 20
+
+// RequestFormField is the field of multipart/form-data calls holding the
+// encoded request body. Its other fields are uploaded files.
+const RequestFormField = "request"
+
+type (
+	// UploadFile is a file uploaded with Client.Upload.
+	UploadFile struct {
+		Field       string // form field of the file
+		Filename    string
+		ContentType string // defaults to application/octet-stream
+		Reader      io.Reader
+	}
+	uploadsKey struct{}
+)
+
+// UploadsFromContext returns the files uploaded with the call being
+// served, keyed by form field. They can be uploaded to any method, along
+// with its request body, as multipart/form-data requests with the method
+// in the MethodHeader.
+func UploadsFromContext(ctx context.Context) map[string][]*multipart.FileHeader {
+	form, _ := ctx.Value(uploadsKey{}).(*multipart.Form)
+	if form == nil {
+		return nil
+	}
+	return form.File
+}
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// readMultipart parses a multipart/form-data call, up to the size limit,
+// and returns its request body. Its files are made available to the call
+// with UploadsFromContext.
+func (s *Service) readMultipart(r *http.Request) (*http.Request, []byte, error) {
+	if s.maxRequestSize > 0 {
+		if r.ContentLength > s.maxRequestSize {
+			return r, nil, &Error{
+				Code:    CodeRequestTooLarge,
+				Message: fmt.Sprintf("request exceeds limit of %d bytes", s.maxRequestSize),
+			}
+		}
+		r.Body = http.MaxBytesReader(nil, r.Body, s.maxRequestSize)
+	}
+	if err := r.ParseMultipartForm(DefaultMaxUploadMemory); err != nil {
+		return r, nil, err
+	}
+	body := []byte("{}")
+	if v := r.MultipartForm.Value[RequestFormField]; len(v) > 0 {
+		body = []byte(v[0])
+	}
+	r = r.WithContext(context.WithValue(r.Context(), uploadsKey{}, r.MultipartForm))
+	return r, body, nil
+}
+
+// formRequest returns the request of a multipart/form-data call.
+func (s *Service) formRequest(r *http.Request, method string, body []byte) (*Request, error) {
+	if method == "" {
+		return nil, fmt.Errorf("rpc: missing %s header", MethodHeader)
+	}
+	req := &Request{
+		ServiceMethod: method,
+		Body:          body,
+	}
+	if v := r.Header.Get(SeqHeader); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("rpc: invalid %s header: %v", SeqHeader, err)
+		}
+		req.Seq = seq
+	}
+	return req, nil
+}
+
+// Upload calls the method like Call, uploading the files along with the
+// request body as a multipart/form-data request. Files are streamed, not
+// buffered in memory. The method finds them with UploadsFromContext.
+func (c *Client) Upload(ctx context.Context, method string, reqBody interface{}, files []UploadFile, resBody interface{}) error {
+	codec := c.codec
+	body, err := marshalBody(codec, reqBody)
+	if err != nil {
+		return fmt.Errorf("rpc: error encoding request: %v", err)
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeForm(mw, body, files)) // nolint: errcheck
+	}()
+	defer pr.Close()
+
+	seq := c.nextSeq()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.uri, pr)
+	if err != nil {
+		return fmt.Errorf("rpc: error creating request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", mw.FormDataContentType())
+	httpReq.Header.Set(MethodHeader, method)
+	httpReq.Header.Set(SeqHeader, strconv.FormatUint(seq, 10))
+	setTimeoutHeader(ctx, httpReq.Header)
+	setOutgoingHeader(WithOutgoingHeader(ctx, ClientIDHeader, c.id), httpReq.Header)
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("rpc: error sending request: %w", err)
+	}
+
+	defer resp.Body.Close()
+	resBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("rpc: error reading response body: %v", err)
+	}
+	return c.errorDecoder.decode(decodeReply(codec, resBytes, method, seq, resBody))
+}
+
+// writeForm writes the request body and files as a multipart form.
+func writeForm(mw *multipart.Writer, body []byte, files []UploadFile) error {
+	if err := mw.WriteField(RequestFormField, string(body)); err != nil {
+		return err
+	}
+	for _, f := range files {
+		contentType := f.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+			"name":     f.Field,
+			"filename": f.Filename,
+		}))
+		h.Set("Content-Type", contentType)
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, f.Reader); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
@@ -0,0 +1,91 @@
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	Uploader     struct{}
+	StoreRequest struct {
+		Folder string
+	}
+	StoreResponse struct {
+		Folder string
+		Files  map[string]string
+	}
+)
+
+func (u *Uploader) Store(ctx context.Context, req *StoreRequest, res *StoreResponse) error {
+	res.Folder = req.Folder
+	res.Files = map[string]string{}
+	for field, files := range UploadsFromContext(ctx) {
+		for _, fh := range files {
+			f, err := fh.Open()
+			if err != nil {
+				return err
+			}
+			b, err := ioutil.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			res.Files[field+"/"+fh.Filename] = fh.Header.Get("Content-Type") + ":" + string(b)
+		}
+	}
+	return nil
+}
+
+func TestClient_Upload(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Uploader{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	res := &StoreResponse{}
+	require.NoError(t, c.Upload(context.Background(), "Uploader.Store", &StoreRequest{Folder: "docs"}, []UploadFile{{
+		Field:    "file",
+		Filename: "a.txt",
+		Reader:   strings.NewReader("hello"),
+	}, {
+		Field:       "file",
+		Filename:    "b.csv",
+		ContentType: "text/csv",
+		Reader:      strings.NewReader("a,b"),
+	}}, res))
+	require.Equal(t, &StoreResponse{
+		Folder: "docs",
+		Files: map[string]string{
+			"file/a.txt": "application/octet-stream:hello",
+			"file/b.csv": "text/csv:a,b",
+		},
+	}, res)
+
+	// Calls without uploads have no files.
+	res = &StoreResponse{}
+	require.NoError(t, c.Call(context.Background(), "Uploader.Store", &StoreRequest{Folder: "docs"}, res))
+	require.Empty(t, res.Files)
+}
+
+func TestClient_Upload_TooLarge(t *testing.T) {
+	s := New(WithMaxRequestSize(1024))
+	require.NoError(t, s.Register(&Uploader{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	err = c.Upload(context.Background(), "Uploader.Store", &StoreRequest{}, []UploadFile{{
+		Field:    "file",
+		Filename: "big",
+		Reader:   strings.NewReader(strings.Repeat("x", 4096)),
+	}}, &StoreResponse{})
+	require.Error(t, err)
+}
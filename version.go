@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// VersionsHeader is the response header servers advertise the envelope
+// protocol versions they support with, as a comma separated list.
+const VersionsHeader = "Rpc-Versions"
+
+// ProtocolVersion is the latest version of the envelope protocol.
+// Envelopes without a Version are of version 1.
+const ProtocolVersion = 2
+
+// supportedVersions are the envelope protocol versions servers and
+// clients support, oldest first.
+var supportedVersions = []int{1, 2}
+
+// supportsVersion returns whether envelopes of the version can be handled.
+func supportsVersion(version int) bool {
+	if version == 0 {
+		return true
+	}
+	for _, v := range supportedVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// advertiseVersions sets the VersionsHeader.
+func advertiseVersions(h http.Header) {
+	versions := make([]string, len(supportedVersions))
+	for i, v := range supportedVersions {
+		versions[i] = strconv.Itoa(v)
+	}
+	h.Set(VersionsHeader, strings.Join(versions, ","))
+}
+
+// checkVersion returns an error if the request's envelope version isn't
+// supported. The error details list the supported versions.
+func checkVersion(req *Request) error {
+	if supportsVersion(req.Version) {
+		return nil
+	}
+	versions := make([]string, len(supportedVersions))
+	for i, v := range supportedVersions {
+		versions[i] = strconv.Itoa(v)
+	}
+	return &Error{
+		Code:    CodeInvalidRequest,
+		Message: "unsupported protocol version " + strconv.Itoa(req.Version),
+		Details: map[string]string{"versions": strings.Join(versions, ",")},
+	}
+}
+
+// versionNegotiator tracks the latest envelope version supported by both
+// the client and the server it calls, from the VersionsHeader of the
+// server's responses. Until the server advertises versions, calls use
+// version 1, which every server supports.
+type versionNegotiator struct {
+	version int32
+}
+
+// current returns the version to send envelopes with, 0 for version 1 so
+// envelopes stay the same for servers predating versioning.
+func (n *versionNegotiator) current() int {
+	if n == nil {
+		return 0
+	}
+	if v := int(atomic.LoadInt32(&n.version)); v > 1 {
+		return v
+	}
+	return 0
+}
+
+// update negotiates the version from the headers of a response.
+func (n *versionNegotiator) update(h http.Header) {
+	if n == nil {
+		return
+	}
+	advertised := h.Get(VersionsHeader)
+	if advertised == "" {
+		return
+	}
+	best := 1
+	for _, s := range strings.Split(advertised, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		if err == nil && v > best && supportsVersion(v) {
+			best = v
+		}
+	}
+	atomic.StoreInt32(&n.version, int32(best))
+}
@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Serve_Versions(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	post := func(body string) (*http.Response, Response) {
+		resp, err := http.Post(srv.URL, "application/json", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		res := Response{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return resp, res
+	}
+
+	// Versions are advertised, and echoed.
+	resp, res := post(`{"ServiceMethod":"Math.Add","Body":{"A":1,"B":2},"Version":1}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "1,2", resp.Header.Get(VersionsHeader))
+	require.Equal(t, 1, res.Version)
+
+	// Unsupported versions are rejected.
+	resp, res = post(`{"ServiceMethod":"Math.Add","Body":{"A":1,"B":2},"Version":99}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, CodeInvalidRequest, res.Code)
+	require.Equal(t, "1,2", res.Details["versions"])
+}
+
+func TestVersionNegotiator(t *testing.T) {
+	n := &versionNegotiator{}
+	require.Equal(t, 0, n.current())
+
+	h := http.Header{}
+	h.Set(VersionsHeader, "1, 99")
+	n.update(h)
+	require.Equal(t, 0, n.current())
+
+	h.Set(VersionsHeader, "1,2")
+	n.update(h)
+	require.Equal(t, 2, n.current())
+
+	// Responses without the header, eg. from proxies, don't reset it.
+	n.update(http.Header{})
+	require.Equal(t, 2, n.current())
+
+	var nilNegotiator *versionNegotiator
+	require.Equal(t, 0, nilNegotiator.current())
+}
+
+func TestPing_Versions(t *testing.T) {
+	s := New()
+	res, err := s.callContext(context.Background(), &Request{
+		ServiceMethod: PingMethod,
+		Body:          []byte(`{}`),
+	})
+	require.NoError(t, err)
+	require.Contains(t, string(res.Body), `"Versions":[1,2]`)
+}
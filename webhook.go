@@ -0,0 +1,401 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Webhooks delivers events to the URLs subscribed to them.
+	// Events are published for every successful call going through its
+	// Middleware, named after the method called, and with Publish.
+	// Deliveries are signed with Secret, see VerifyWebhookSignature, and
+	// retried with exponential backoff. Deliveries failing MaxAttempts
+	// times are dead-lettered.
+	Webhooks struct {
+		Secret      []byte
+		Client      *http.Client  // defaults to a client timing out after DefaultWebhookTimeout
+		MaxAttempts int           // defaults to 3
+		Backoff     time.Duration // delay before the first retry, defaults to 1s
+		// DeadLetter, if set, is called with deliveries that failed.
+		DeadLetter func(WebhookDelivery)
+
+		mu          sync.Mutex
+		subs        map[string]WebhookSubscription
+		deadLetters []WebhookDelivery
+		wg          sync.WaitGroup
+		once        sync.Once
+		ctx         context.Context // of deliveries, canceled by Close
+		cancel      context.CancelFunc
+	}
+	// WebhookSubscription subscribes a URL to events.
+	WebhookSubscription struct {
+		ID     string   // assigned when subscribing, if empty
+		URL    string   // URL events are posted to
+		Events []string // names of the events, all events if empty
+	}
+	// WebhookEvent is the body of webhook deliveries.
+	WebhookEvent struct {
+		ID       string
+		Event    string // name of the method called, or published event
+		Time     time.Time
+		Request  json.RawMessage `json:",omitempty"` // request of the call
+		Response json.RawMessage `json:",omitempty"` // response of the call
+		Data     json.RawMessage `json:",omitempty"` // published data
+	}
+	// WebhookDelivery is a failed delivery of an event.
+	WebhookDelivery struct {
+		Subscription WebhookSubscription
+		Event        WebhookEvent
+		Attempts     int
+		Error        string
+	}
+	// webhooksAdmin exposes the management of webhooks as methods.
+	webhooksAdmin struct {
+		w *Webhooks
+	}
+)
+
+// WebhookSignatureHeader is the header holding the signature of webhook
+// deliveries, as "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">".
+const WebhookSignatureHeader = "Rpc-Webhook-Signature"
+
+// maxDeadLetters is the number of dead-lettered deliveries kept.
+const maxDeadLetters = 100
+
+// DefaultWebhookTimeout is how long delivery attempts of Webhooks without
+// a Client can take.
+const DefaultWebhookTimeout = 10 * time.Second
+
+var defaultWebhookClient = &http.Client{Timeout: DefaultWebhookTimeout}
+
+// Middleware publishes an event for every successful call.
+func (w *Webhooks) Middleware(next Handler) Handler {
+	return func(ctx context.Context, m Method, req *Request) (*Response, error) {
+		res, err := next(ctx, m, req)
+		if err == nil {
+			w.publish(WebhookEvent{
+				Event:    m.Name,
+				Request:  req.Body,
+				Response: res.Body,
+			})
+		}
+		return res, err
+	}
+}
+
+// Publish delivers an event with the given name and data to its
+// subscribers.
+func (w *Webhooks) Publish(event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("rpc: error encoding event data: %v", err)
+	}
+	w.publish(WebhookEvent{
+		Event: event,
+		Data:  b,
+	})
+	return nil
+}
+
+// Subscribe subscribes a URL to events, and returns the subscription
+// with its ID.
+func (w *Webhooks) Subscribe(sub WebhookSubscription) (WebhookSubscription, error) {
+	if !strings.HasPrefix(sub.URL, "http://") && !strings.HasPrefix(sub.URL, "https://") {
+		return sub, &Error{
+			Code:    CodeInvalidRequest,
+			Message: "invalid webhook url " + sub.URL,
+		}
+	}
+	if sub.ID == "" {
+		sub.ID = randomID()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.subs == nil {
+		w.subs = map[string]WebhookSubscription{}
+	}
+	w.subs[sub.ID] = sub
+	return sub, nil
+}
+
+// Unsubscribe removes the subscription with the given ID.
+func (w *Webhooks) Unsubscribe(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.subs, id)
+}
+
+// Subscriptions returns the current subscriptions.
+func (w *Webhooks) Subscriptions() []WebhookSubscription {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	subs := make([]WebhookSubscription, 0, len(w.subs))
+	for _, sub := range w.subs {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// DeadLetters returns the most recent deliveries that failed.
+func (w *Webhooks) DeadLetters() []WebhookDelivery {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]WebhookDelivery{}, w.deadLetters...)
+}
+
+// Wait waits for pending deliveries, including their retries.
+func (w *Webhooks) Wait() {
+	w.wg.Wait()
+}
+
+// Close cancels pending deliveries, which are dead-lettered, and waits
+// for them. Events published afterwards aren't delivered.
+func (w *Webhooks) Close() {
+	w.init()
+	w.cancel()
+	w.wg.Wait()
+}
+
+func (w *Webhooks) init() {
+	w.once.Do(func() {
+		w.ctx, w.cancel = context.WithCancel(context.Background())
+	})
+}
+
+// webhooksService is the name the webhooks admin methods are registered
+// under, in the namespace reserved to the package.
+const webhooksService = "rpc.Webhooks"
+
+// RegisterAdmin registers methods managing the webhooks on the service,
+// as "rpc.Webhooks.Subscribe", "rpc.Webhooks.Unsubscribe",
+// "rpc.Webhooks.List" and "rpc.Webhooks.DeadLetters", with the options
+// applied to each of them. Subscribers receive the requests and responses
+// of every call, and make the server send requests to the URLs they
+// choose, so the options must require roles, see WithRoles, that the
+// service's Authorizer enforces, and callers must be authenticated, see
+// WithPrincipal.
+func (w *Webhooks) RegisterAdmin(s *Service, opts ...MethodOption) error {
+	if err := requireAdminRoles(s, "managing webhooks", opts); err != nil {
+		return err
+	}
+	if err := s.RegisterName(webhooksService, &webhooksAdmin{w: w}); err != nil {
+		return err
+	}
+	for _, name := range []string{"Subscribe", "Unsubscribe", "List", "DeadLetters"} {
+		if err := s.Configure(webhooksService+"."+name, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *webhooksAdmin) Subscribe(ctx context.Context, req *WebhookSubscription, res *WebhookSubscription) error {
+	if err := requirePrincipal(ctx, "managing webhooks"); err != nil {
+		return err
+	}
+	sub, err := a.w.Subscribe(*req)
+	if err != nil {
+		return err
+	}
+	*res = sub
+	return nil
+}
+
+func (a *webhooksAdmin) Unsubscribe(ctx context.Context, req *WebhookSubscription, res *struct{}) error {
+	if err := requirePrincipal(ctx, "managing webhooks"); err != nil {
+		return err
+	}
+	a.w.Unsubscribe(req.ID)
+	return nil
+}
+
+func (a *webhooksAdmin) List(ctx context.Context, req *struct{}, res *[]WebhookSubscription) error {
+	if err := requirePrincipal(ctx, "managing webhooks"); err != nil {
+		return err
+	}
+	*res = a.w.Subscriptions()
+	return nil
+}
+
+func (a *webhooksAdmin) DeadLetters(ctx context.Context, req *struct{}, res *[]WebhookDelivery) error {
+	if err := requirePrincipal(ctx, "managing webhooks"); err != nil {
+		return err
+	}
+	*res = a.w.DeadLetters()
+	return nil
+}
+
+// publish delivers the event to its subscribers in the background.
+func (w *Webhooks) publish(event WebhookEvent) {
+	w.init()
+	if w.ctx.Err() != nil {
+		return
+	}
+	event.ID = randomID()
+	event.Time = time.Now().UTC()
+
+	w.mu.Lock()
+	subs := []WebhookSubscription{}
+	for _, sub := range w.subs {
+		if sub.matches(event.Event) {
+			subs = append(subs, sub)
+		}
+	}
+	w.mu.Unlock()
+	if len(subs) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	for _, sub := range subs {
+		w.wg.Add(1)
+		go func(sub WebhookSubscription) {
+			defer w.wg.Done()
+			w.deliver(w.ctx, sub, event, body)
+		}(sub)
+	}
+}
+
+// deliver posts the event to the subscriber, retrying failures, and
+// dead-letters it if all attempts fail or ctx is done.
+func (w *Webhooks) deliver(ctx context.Context, sub WebhookSubscription, event WebhookEvent, body []byte) {
+	attempts := w.MaxAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	backoff := w.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	var err error
+	tried := 0
+	for tried < attempts {
+		if tried > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+			backoff *= 2
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
+		tried++
+		if err = w.post(ctx, sub.URL, event.ID, body); err == nil {
+			return
+		}
+	}
+
+	d := WebhookDelivery{
+		Subscription: sub,
+		Event:        event,
+		Attempts:     tried,
+		Error:        err.Error(),
+	}
+	w.mu.Lock()
+	w.deadLetters = append(w.deadLetters, d)
+	if len(w.deadLetters) > maxDeadLetters {
+		w.deadLetters = w.deadLetters[len(w.deadLetters)-maxDeadLetters:]
+	}
+	w.mu.Unlock()
+	if w.DeadLetter != nil {
+		w.DeadLetter(d)
+	}
+}
+
+func (w *Webhooks) post(ctx context.Context, url, id string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Rpc-Webhook-Id", id)
+	req.Header.Set(WebhookSignatureHeader, signWebhook(w.Secret, time.Now(), body))
+
+	client := w.Client
+	if client == nil {
+		client = defaultWebhookClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (sub WebhookSubscription) matches(event string) bool {
+	if len(sub.Events) == 0 {
+		return true
+	}
+	for _, e := range sub.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyWebhookSignature checks the signature header of a webhook delivery
+// with the given body, rejecting deliveries signed more than tolerance
+// ago, if set.
+func VerifyWebhookSignature(secret []byte, header string, body []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		switch {
+		case strings.HasPrefix(part, "t="):
+			ts = part[2:]
+		case strings.HasPrefix(part, "v1="):
+			sig = part[3:]
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return fmt.Errorf("rpc: invalid webhook signature header")
+	}
+	t := time.Unix(unix, 0)
+	if tolerance > 0 && time.Since(t) > tolerance {
+		return fmt.Errorf("rpc: webhook signature expired")
+	}
+	expected := signWebhook(secret, t, body)
+	if !hmac.Equal([]byte(expected), []byte(header)) {
+		return fmt.Errorf("rpc: invalid webhook signature")
+	}
+	return nil
+}
+
+func signWebhook(secret []byte, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
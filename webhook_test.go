@@ -0,0 +1,175 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	secret := []byte("secret")
+	mu := sync.Mutex{}
+	events := []WebhookEvent{}
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		sig := r.Header.Get(WebhookSignatureHeader)
+		require.NoError(t, VerifyWebhookSignature(secret, sig, body, time.Minute))
+		require.Error(t, VerifyWebhookSignature([]byte("other"), sig, body, time.Minute))
+
+		event := WebhookEvent{}
+		require.NoError(t, json.Unmarshal(body, &event))
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	w := &Webhooks{Secret: secret}
+	s := New(WithMiddleware(w.Middleware), WithAuthorizer(RoleAuthorizer{}))
+	require.NoError(t, s.Register(&Math{}))
+
+	// Admin methods are denied unless they require roles.
+	require.Error(t, w.RegisterAdmin(s))
+	require.Error(t, w.RegisterAdmin(New(), WithRoles("ops")))
+	require.NoError(t, w.RegisterAdmin(s, WithRoles("ops")))
+
+	var principal *Principal
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if principal != nil {
+			r = r.WithContext(WithPrincipal(r.Context(), *principal))
+		}
+		s.Serve().ServeHTTP(rw, r)
+	}))
+	defer srv.Close()
+
+	// Anonymous callers can't subscribe to the traffic of the service.
+	sub := &WebhookSubscription{}
+	err := s.Call(http.DefaultClient, srv.URL, "rpc.Webhooks.Subscribe", &WebhookSubscription{URL: hook.URL}, sub)
+	var rerr *Error
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodePermissionDenied, rerr.Code)
+	require.Empty(t, w.Subscriptions())
+
+	// Nor can callers without the role.
+	principal = &Principal{Subject: "user"}
+	err = s.Call(http.DefaultClient, srv.URL, "rpc.Webhooks.Subscribe", &WebhookSubscription{URL: hook.URL}, sub)
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, CodePermissionDenied, rerr.Code)
+	require.Empty(t, w.Subscriptions())
+
+	// Subscribe through the admin methods.
+	principal = &Principal{Subject: "ops", Roles: []string{"ops"}}
+	err = s.Call(http.DefaultClient, srv.URL, "rpc.Webhooks.Subscribe", &WebhookSubscription{
+		URL:    hook.URL,
+		Events: []string{"Math.Add", "custom"},
+	}, sub)
+	require.NoError(t, err)
+	require.NotEmpty(t, sub.ID)
+
+	res := &AddResponse{}
+	require.NoError(t, s.Call(http.DefaultClient, srv.URL, "Math.Add", &AddRequest{A: 1, B: 2}, res))
+	require.NoError(t, w.Publish("custom", map[string]int{"n": 1}))
+	require.NoError(t, w.Publish("ignored", nil))
+	w.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, events, 2)
+	for _, event := range events {
+		switch event.Event {
+		case "Math.Add":
+			require.JSONEq(t, `{"A":1,"B":2}`, string(event.Request))
+			require.JSONEq(t, `{"X":3}`, string(event.Response))
+		case "custom":
+			require.JSONEq(t, `{"n":1}`, string(event.Data))
+		default:
+			t.Fatalf("unexpected event %s", event.Event)
+		}
+	}
+
+	subs := []WebhookSubscription{}
+	require.NoError(t, s.Call(http.DefaultClient, srv.URL, "rpc.Webhooks.List", &struct{}{}, &subs))
+	require.Equal(t, []WebhookSubscription{*sub}, subs)
+	require.NoError(t, s.Call(http.DefaultClient, srv.URL, "rpc.Webhooks.Unsubscribe", sub, &struct{}{}))
+	require.Empty(t, w.Subscriptions())
+}
+
+func TestWebhooks_DeadLetter(t *testing.T) {
+	attempts := 0
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer hook.Close()
+
+	dead := make(chan WebhookDelivery, 1)
+	w := &Webhooks{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		DeadLetter:  func(d WebhookDelivery) { dead <- d },
+	}
+	_, err := w.Subscribe(WebhookSubscription{URL: hook.URL})
+	require.NoError(t, err)
+	require.NoError(t, w.Publish("event", nil))
+	w.Wait()
+
+	require.Equal(t, 3, attempts)
+	d := <-dead
+	require.Equal(t, 3, d.Attempts)
+	require.Equal(t, "event", d.Event.Event)
+	require.Equal(t, []WebhookDelivery{d}, w.DeadLetters())
+}
+
+func TestWebhooks_Close(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan struct{}, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hook.Close()
+	defer close(release)
+
+	w := &Webhooks{Backoff: time.Hour}
+	_, err := w.Subscribe(WebhookSubscription{URL: hook.URL})
+	require.NoError(t, err)
+	require.NoError(t, w.Publish("event", nil))
+	<-received
+
+	// Deliveries waiting on subscribers, or to be retried, are canceled.
+	done := make(chan struct{})
+	go func() {
+		w.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close didn't cancel the delivery")
+	}
+	dead := w.DeadLetters()
+	require.Len(t, dead, 1)
+	require.Equal(t, 1, dead[0].Attempts)
+
+	// Events published once closed aren't delivered.
+	require.NoError(t, w.Publish("event", nil))
+	w.Wait()
+	require.Len(t, w.DeadLetters(), 1)
+}
+
+func TestWebhooks_Subscribe_InvalidURL(t *testing.T) {
+	w := &Webhooks{}
+	_, err := w.Subscribe(WebhookSubscription{URL: "ftp://example.com"})
+	require.Error(t, err)
+}
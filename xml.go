@@ -0,0 +1,213 @@
+package rpc
+
+import (
+	"encoding/xml"
+	"sort"
+)
+
+// XMLCodec encodes messages as XML, for integrations that can't speak
+// JSON. Bodies are nested in the <Body> of envelopes as is, and the
+// metadata and error details of envelopes as lists of <Entry Key="">
+// elements, since encoding/xml can't encode maps. Bodies themselves must
+// be types encoding/xml can encode.
+type XMLCodec struct{}
+
+type (
+	xmlRequest struct {
+		XMLName       xml.Name `xml:"Request"`
+		ServiceMethod string
+		Body          xmlBody
+		Seq           uint64
+		Version       int         `xml:",omitempty"`
+		Checksum      string      `xml:",omitempty"`
+		Encrypted     bool        `xml:",omitempty"`
+		Metadata      *xmlEntries `xml:",omitempty"`
+		Timeout       int64       `xml:",omitempty"`
+		Trace         string      `xml:",omitempty"`
+	}
+	xmlResponse struct {
+		XMLName       xml.Name `xml:"Response"`
+		ServiceMethod string
+		Body          xmlBody
+		Seq           uint64
+		Version       int         `xml:",omitempty"`
+		Checksum      string      `xml:",omitempty"`
+		Encrypted     bool        `xml:",omitempty"`
+		Metadata      *xmlEntries `xml:",omitempty"`
+		More          bool        `xml:",omitempty"`
+		Error         string
+		Code          string
+		Details       *xmlEntries    `xml:",omitempty"`
+		Chain         *xmlErrorChain `xml:",omitempty"`
+	}
+	xmlBody struct {
+		Inner []byte `xml:",innerxml"`
+	}
+	xmlEntries struct {
+		Entries []xmlEntry `xml:"Entry"`
+	}
+	xmlEntry struct {
+		Key   string `xml:",attr"`
+		Value string `xml:",chardata"`
+	}
+	xmlErrorChain struct {
+		Links []xmlErrorLink `xml:"Link"`
+	}
+	xmlErrorLink struct {
+		ID      string `xml:",omitempty"`
+		Message string
+		Data    []byte `xml:",omitempty"`
+	}
+)
+
+func (XMLCodec) ContentType() string {
+	return "application/xml"
+}
+
+func (XMLCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case *Request:
+		return xml.Marshal(xmlRequestOf(v))
+	case Request:
+		return xml.Marshal(xmlRequestOf(&v))
+	case *Response:
+		return xml.Marshal(xmlResponseOf(v))
+	case Response:
+		return xml.Marshal(xmlResponseOf(&v))
+	}
+	return xml.Marshal(v)
+}
+
+func (XMLCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *Request:
+		var req xmlRequest
+		if err := xml.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		*v = Request{
+			ServiceMethod: req.ServiceMethod,
+			Body:          req.Body.bytes(),
+			Seq:           req.Seq,
+			Version:       req.Version,
+			Checksum:      req.Checksum,
+			Encrypted:     req.Encrypted,
+			Metadata:      xmlMap(req.Metadata),
+			Timeout:       req.Timeout,
+			Trace:         req.Trace,
+		}
+		return nil
+	case *Response:
+		var res xmlResponse
+		if err := xml.Unmarshal(data, &res); err != nil {
+			return err
+		}
+		*v = Response{
+			ServiceMethod: res.ServiceMethod,
+			Body:          res.Body.bytes(),
+			Seq:           res.Seq,
+			Version:       res.Version,
+			Checksum:      res.Checksum,
+			Encrypted:     res.Encrypted,
+			Metadata:      xmlMap(res.Metadata),
+			More:          res.More,
+			Error:         res.Error,
+			Code:          res.Code,
+			Details:       xmlMap(res.Details),
+		}
+		for _, link := range res.Chain.links() {
+			v.Chain = append(v.Chain, ErrorLink{
+				ID:      link.ID,
+				Message: link.Message,
+				Data:    link.Data,
+			})
+		}
+		return nil
+	}
+	return xml.Unmarshal(data, v)
+}
+
+func xmlRequestOf(req *Request) *xmlRequest {
+	return &xmlRequest{
+		ServiceMethod: req.ServiceMethod,
+		Body:          xmlBody{req.Body},
+		Seq:           req.Seq,
+		Version:       req.Version,
+		Checksum:      req.Checksum,
+		Encrypted:     req.Encrypted,
+		Metadata:      xmlEntriesOf(req.Metadata),
+		Timeout:       req.Timeout,
+		Trace:         req.Trace,
+	}
+}
+
+func xmlResponseOf(res *Response) *xmlResponse {
+	out := &xmlResponse{
+		ServiceMethod: res.ServiceMethod,
+		Body:          xmlBody{res.Body},
+		Seq:           res.Seq,
+		Version:       res.Version,
+		Checksum:      res.Checksum,
+		Encrypted:     res.Encrypted,
+		Metadata:      xmlEntriesOf(res.Metadata),
+		More:          res.More,
+		Error:         res.Error,
+		Code:          res.Code,
+		Details:       xmlEntriesOf(res.Details),
+	}
+	if len(res.Chain) > 0 {
+		out.Chain = &xmlErrorChain{}
+		for _, link := range res.Chain {
+			out.Chain.Links = append(out.Chain.Links, xmlErrorLink{
+				ID:      link.ID,
+				Message: link.Message,
+				Data:    link.Data,
+			})
+		}
+	}
+	return out
+}
+
+// bytes returns the encoded body, or nil if there is none.
+func (b xmlBody) bytes() []byte {
+	if len(b.Inner) == 0 {
+		return nil
+	}
+	return b.Inner
+}
+
+// links returns the links of the chain, if any.
+func (c *xmlErrorChain) links() []xmlErrorLink {
+	if c == nil {
+		return nil
+	}
+	return c.Links
+}
+
+// xmlEntriesOf returns the entries of m sorted by key, or nil if it's
+// empty.
+func xmlEntriesOf(m map[string]string) *xmlEntries {
+	if len(m) == 0 {
+		return nil
+	}
+	entries := &xmlEntries{}
+	for k, v := range m {
+		entries.Entries = append(entries.Entries, xmlEntry{Key: k, Value: v})
+	}
+	sort.Slice(entries.Entries, func(i, j int) bool {
+		return entries.Entries[i].Key < entries.Entries[j].Key
+	})
+	return entries
+}
+
+// xmlMap returns the map of entries, or nil if there are none.
+func xmlMap(entries *xmlEntries) map[string]string {
+	if entries == nil || len(entries.Entries) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(entries.Entries))
+	for _, e := range entries.Entries {
+		m[e.Key] = e.Value
+	}
+	return m
+}
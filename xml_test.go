@@ -0,0 +1,79 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestXMLCodec(t *testing.T) {
+	s := New(WithCodecs(XMLCodec{}))
+	require.NoError(t, s.Register(&Math{}))
+	srv := httptest.NewServer(s.Serve())
+	defer srv.Close()
+
+	// Partners post and are answered with plain XML.
+	resp, err := http.Post(srv.URL, "application/xml", strings.NewReader(
+		`<Request><ServiceMethod>Math.Add</ServiceMethod><Body><AddRequest><A>1</A><B>2</B></AddRequest></Body><Seq>7</Seq></Request>`,
+	))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/xml", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t,
+		`<Response><ServiceMethod>Math.Add</ServiceMethod><Body><AddResponse><X>3</X></AddResponse></Body><Seq>7</Seq><Error></Error><Code></Code></Response>`,
+		string(body),
+	)
+
+	// Calls made with the codec decode their responses.
+	xs := New(WithCodec(XMLCodec{}))
+	require.NoError(t, xs.Register(&Math{}))
+	res := &AddResponse{}
+	require.NoError(t, xs.Call(http.DefaultClient, srv.URL, "Math.Add", &AddRequest{A: 2, B: 3}, res))
+	require.Equal(t, 5, res.X)
+
+	// JSON callers are served as usual.
+	c, err := Dial(srv.URL)
+	require.NoError(t, err)
+	require.NoError(t, c.Call(context.Background(), "Math.Add", &AddRequest{A: 1, B: 1}, res))
+	require.Equal(t, 2, res.X)
+}
+
+func TestXMLCodec_Envelopes(t *testing.T) {
+	codec := XMLCodec{}
+	req := &Request{
+		ServiceMethod: "Math.Add",
+		Body:          []byte(`<AddRequest><A>1</A></AddRequest>`),
+		Seq:           1,
+		Version:       2,
+		Metadata:      map[string]string{"b": "2", "a": "1"},
+		Timeout:       100,
+	}
+	reqBytes, err := codec.Marshal(req)
+	require.NoError(t, err)
+	require.Contains(t, string(reqBytes), `<Metadata><Entry Key="a">1</Entry><Entry Key="b">2</Entry></Metadata>`)
+	got := &Request{}
+	require.NoError(t, codec.Unmarshal(reqBytes, got))
+	require.Equal(t, req, got)
+
+	res := Response{
+		ServiceMethod: "Math.Add",
+		Seq:           1,
+		Error:         "over quota",
+		Code:          CodeQuotaExceeded,
+		Details:       map[string]string{RetryAfterDetail: "3"},
+		Chain:         []ErrorLink{{ID: "quota", Message: "over quota", Data: []byte(`{"Limit":1}`)}},
+	}
+	resBytes, err := codec.Marshal(res)
+	require.NoError(t, err)
+	gotRes := &Response{}
+	require.NoError(t, codec.Unmarshal(resBytes, gotRes))
+	require.Equal(t, &res, gotRes)
+}